@@ -143,7 +143,6 @@ func NewRELPClient(logger log15.Logger) *RELPClient {
 }
 
 func (c *RELPClient) Host(host string) *RELPClient {
-	// TODO: support multiple hosts as failovers
 	c.host = host
 	return c
 }
@@ -372,7 +371,11 @@ func (c *RELPClient) scan() (txnr int32, retcode int, data []byte, err error) {
 	if !ret {
 		return 0, 0, nil, c.scanner.Err()
 	}
-	splits := bytes.SplitN(c.scanner.Bytes(), sp, 4)
+	// utils.RelpSplit returns TXNR COMMAND[ DATA], without DATALEN
+	splits := bytes.SplitN(c.scanner.Bytes(), sp, 3)
+	if len(splits) < 2 {
+		return 0, 0, nil, RELPClientError(eerrors.New("RELP server answered with an invalid frame"))
+	}
 	txnr64, _ := strconv.ParseInt(string(splits[0]), 10, 64)
 	if txnr64 > int64(math.MaxInt32) {
 		return 0, 0, nil, RELPClientError(eerrors.Errorf("RELPClient: received txnr is not an int32: %d", txnr64))
@@ -381,12 +384,11 @@ func (c *RELPClient) scan() (txnr int32, retcode int, data []byte, err error) {
 		return 0, 0, nil, RELPClientError(eerrors.Errorf("RELP server answered with invalid command: '%s'", string(splits[1])))
 	}
 	txnr = int32(txnr64)
-	datalen, _ := strconv.Atoi(string(splits[2]))
-	if datalen == 0 {
+	if len(splits) == 2 {
 		data = []byte{}
 		return
 	}
-	data = bytes.Trim(splits[3], " \r\n")
+	data = bytes.Trim(splits[2], " \r\n")
 	if len(data) >= 3 {
 		code := string(data[:3])
 		if code == "200" {
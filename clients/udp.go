@@ -1,15 +1,18 @@
 package clients
 
 import (
+	"crypto/tls"
 	"io"
 	"net"
 	"strconv"
 
 	"github.com/inconshreveable/log15"
 	"github.com/oklog/ulid"
+	"github.com/pion/dtls/v2"
 	"github.com/stephane-martin/skewer/encoders"
 	"github.com/stephane-martin/skewer/encoders/baseenc"
 	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
 	"go.uber.org/atomic"
 )
@@ -20,6 +23,8 @@ type SyslogUDPClient struct {
 	path   string
 	format baseenc.Format
 
+	tlsConfig *tls.Config
+
 	conn    net.Conn
 	encoder encoders.Encoder
 	logger  log15.Logger
@@ -51,6 +56,12 @@ func (c *SyslogUDPClient) Format(format baseenc.Format) *SyslogUDPClient {
 	return c
 }
 
+// TLS enables DTLS (RFC 6012) with the given configuration.
+func (c *SyslogUDPClient) TLS(config *tls.Config) *SyslogUDPClient {
+	c.tlsConfig = config
+	return c
+}
+
 func (c *SyslogUDPClient) Close() (err error) {
 	if c.closed.CAS(false, true) {
 		if c.conn != nil {
@@ -95,6 +106,14 @@ func (c *SyslogUDPClient) Connect() (err error) {
 		udpconn := conn.(*net.UDPConn)
 		udpconn.SetWriteBuffer(65536)
 		c.conn = udpconn
+		if c.tlsConfig != nil {
+			dconn, err := dtls.Client(udpconn, utils.NewDTLSConfig(c.tlsConfig, false))
+			if err != nil {
+				_ = udpconn.Close()
+				return eerrors.Wrap(err, "SyslogUDPClient: DTLS handshake failed")
+			}
+			c.conn = dconn
+		}
 	} else {
 		conn, err = net.Dial("unixgram", c.path)
 		if err != nil {
@@ -129,7 +148,13 @@ func (c *SyslogUDPClient) Send(msg *model.FullMessage) (err error) {
 	if msg == nil {
 		return nil
 	}
-	buf, err := encoders.ChainEncode(c.encoder, msg)
+	var buf string
+	if c.tlsConfig != nil && len(c.path) == 0 {
+		// RFC 6012 section 5.3: the messages are octet counted
+		buf, err = encoders.TcpOctetEncode(c.encoder, msg)
+	} else {
+		buf, err = encoders.ChainEncode(c.encoder, msg)
+	}
 	if err != nil {
 		return err
 	}
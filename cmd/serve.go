@@ -71,6 +71,9 @@ func ExecuteChild() (err error) {
 		return eerrors.New("empty session ID")
 	}
 	ringSecretPipe := os.NewFile(uintptr(len(base.Handles)+3), "ringsecretpipe")
+	// the plugins must not inherit the ready pipe
+	readyPipe := os.NewFile(uintptr(len(base.Handles)+5), "readypipe")
+	syscall.CloseOnExec(int(readyPipe.Fd()))
 	var ringSecret *memguard.LockedBuffer
 	buf := make([]byte, 32)
 	_, err = ringSecretPipe.Read(buf)
@@ -91,6 +94,7 @@ func ExecuteChild() (err error) {
 	if err != nil {
 		return eerrors.Wrap(err, "fatal error initializing main child")
 	}
+	ch.readyPipe = readyPipe
 	err = ch.init()
 	if err != nil {
 		return eerrors.Wrap(err, "fatal error initializing Serve()")
@@ -127,6 +131,7 @@ type serveChild struct {
 	metricsServer  *metrics.MetricsServer
 	signPrivKey    *memguard.LockedBuffer
 	ring           kring.Ring
+	readyPipe      *os.File
 }
 
 func newServeChild(ring kring.Ring) (*serveChild, error) {
@@ -288,6 +293,7 @@ func (ch *serveChild) setupStore() (st *services.StoreController, err error) {
 	err = st.Create(
 		services.DumpableOpt(DumpableFlag),
 		services.StorePathOpt(storeDirname),
+		services.ConfDirOpt(ch.conf.LookupDir),
 		services.FileDestTmplOpt(tmpl),
 		services.CertFilesOpt(certfiles),
 		services.CertPathsOpt(certpaths),
@@ -622,9 +628,14 @@ func (ch *serveChild) StartUdp() error {
 	if len(ch.conf.UDPSource) == 0 {
 		return nil
 	}
+	certfiles := ch.conf.GetCertificateFiles()["udpsource"]
+	certpaths := ch.conf.GetCertificatePaths()["udpsource"]
+
 	ctl := ch.controllers[base.UDP]
 	err := ctl.Create(
 		services.DumpableOpt(DumpableFlag),
+		services.CertFilesOpt(certfiles),
+		services.CertPathsOpt(certpaths),
 	)
 
 	if err != nil {
@@ -649,9 +660,14 @@ func (ch *serveChild) StartGraylog() error {
 	if len(ch.conf.GraylogSource) == 0 {
 		return nil
 	}
+	certfiles := ch.conf.GetCertificateFiles()["graylogsource"]
+	certpaths := ch.conf.GetCertificatePaths()["graylogsource"]
+
 	ctl := ch.controllers[base.Graylog]
 	err := ctl.Create(
 		services.DumpableOpt(DumpableFlag),
+		services.CertFilesOpt(certfiles),
+		services.CertPathsOpt(certpaths),
 	)
 
 	if err != nil {
@@ -735,6 +751,26 @@ func (ch *serveChild) Reload() (err error) {
 	return nil
 }
 
+// ReloadFiles gives the new script files to the plugins, and the new lookup
+// files to the Store.
+func (ch *serveChild) ReloadFiles() {
+	ch.logger.Info("Reloading the script and lookup files")
+	err := ch.store.ReloadScripts(ch.conf.Scripts)
+	if err != nil {
+		ch.logger.Warn("Error reloading the scripts of the Store", "error", err)
+	}
+	err = ch.store.ReloadLookups(ch.conf.Lookups)
+	if err != nil {
+		ch.logger.Warn("Error reloading the lookup files of the Store", "error", err)
+	}
+	for typ, ctl := range ch.controllers {
+		err = ctl.ReloadScripts(ch.conf.Scripts)
+		if err != nil {
+			ch.logger.Warn("Error reloading the scripts of a plugin", "type", base.Types2Names[typ], "error", err)
+		}
+	}
+}
+
 func (ch *serveChild) setupMetrics(logger log15.Logger) {
 	ch.metricsServer = &metrics.MetricsServer{}
 	controllers := make([]prometheus.Gatherer, 0, len(base.Types2Names))
@@ -765,6 +801,9 @@ func (ch *serveChild) Serve() error {
 	if !errs.Empty() {
 		return errs.Wrap("Error starting controllers")
 	}
+	// tell the parent that we are ready (needed for graceful upgrades)
+	_, _ = ch.readyPipe.Write([]byte{1})
+	_ = ch.readyPipe.Close()
 
 	ch.logger.Debug("Main loop is starting")
 	c := eerrors.ChainErrors()
@@ -804,6 +843,12 @@ func (ch *serveChild) Serve() error {
 				// some parameters can't be modified online
 				newConf.Store = ch.conf.Store
 				newConf.Main.EncryptIPC = ch.conf.Main.EncryptIPC
+				if ch.conf.OnlyFilesDiffer(*newConf) {
+					// the plugins keep running with the new files
+					ch.conf = newConf
+					ch.ReloadFiles()
+					continue
+				}
 				ch.conf = newConf
 				err := ch.Reload()
 				if err != nil {
@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
 	"github.com/stephane-martin/skewer/javascript"
 	"github.com/stephane-martin/skewer/model"
 
@@ -33,7 +34,15 @@ var testjsCmd = &cobra.Command{
 		ffunc := `function FilterMessages(m) { m.Message="bla"; return FILTER.PASS; }`
 		tfunc := `function Topic(m) { return "topic-" + m.Appname; }`
 		pfunc := `function PartitionNumber(m) {return 4; }`
-		env := javascript.NewFilterEnvironment(ffunc, tfunc, "", "", "", pfunc, logger)
+		env := javascript.NewFilterEnvironment(
+			conf.FilterSubConfig{
+				FilterFunc:          ffunc,
+				TopicFunc:           tfunc,
+				PartitionNumberFunc: pfunc,
+				JSBudgetConfig:      conf.JSBudgetConfig{JSTimeout: time.Second},
+			},
+			logger,
+		)
 		m := &model.SyslogMessage{}
 		m.TimeReportedNum = time.Now().UnixNano()
 		m.TimeGeneratedNum = time.Now().Add(time.Hour).UnixNano()
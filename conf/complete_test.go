@@ -0,0 +1,36 @@
+package conf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// completer is a configuration section that is checked, and gets its
+// defaults, by complete.
+type completer interface {
+	complete() error
+}
+
+type completeTest struct {
+	name   string
+	config completer
+	err    bool
+}
+
+// testComplete completes the configuration of each test. The configurations
+// that are valid are given to check, to test their defaults.
+func testComplete(t *testing.T, tests []completeTest, check func(t *testing.T, c completer)) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.complete()
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				check(t, test.config)
+			}
+		})
+	}
+}
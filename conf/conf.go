@@ -9,8 +9,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"hash/fnv"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"text/template"
@@ -26,9 +28,13 @@ import (
 	"github.com/inconshreveable/log15"
 	"github.com/spf13/viper"
 	"github.com/stephane-martin/skewer/consul"
+	"github.com/stephane-martin/skewer/decoders/accesslog"
 	"github.com/stephane-martin/skewer/decoders/base"
+	"github.com/stephane-martin/skewer/decoders/grok"
+	"github.com/stephane-martin/skewer/expr/syntax"
 	"github.com/stephane-martin/skewer/sys/kring"
 	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/acl"
 	"github.com/stephane-martin/skewer/utils/eerrors"
 )
 
@@ -198,7 +204,57 @@ func (l KafkaVersion) Greater(r KafkaVersion) bool {
 }
 
 func (c *FilterSubConfig) CalculateID() utils.MyULID {
-	return utils.MyULID(string(fnv.New128a().Sum([]byte(c.Export()))))
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(c.Export()))
+	return utils.MyULID(string(h.Sum(nil)))
+}
+
+// Unfiltered returns the configuration without the filter function and
+// expression, the sampling, the suppression and the log metrics. It applies
+// to the extra messages that the filter has already produced, and to the
+// summaries of the suppressions.
+func (c FilterSubConfig) Unfiltered() FilterSubConfig {
+	c.FilterFunc = ""
+	c.FilterExpr = ""
+	c.Suppress = ""
+	c.Sample = ""
+	c.LogMetrics = ""
+	return c
+}
+
+// HasJS tells whether the configuration uses javascript functions.
+func (c *FilterSubConfig) HasJS() bool {
+	for _, f := range []string{c.FilterFunc, c.TopicFunc, c.PartitionFunc, c.PartitionNumberFunc} {
+		if len(strings.TrimSpace(f)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExpressions checks the syntax and the types of the native
+// expressions.
+func (c *FilterSubConfig) checkExpressions() error {
+	exprs := []struct {
+		name  string
+		value string
+		types []syntax.Type
+	}{
+		{"filter_expr", c.FilterExpr, []syntax.Type{syntax.Bool}},
+		{"topic_expr", c.TopicExpr, []syntax.Type{syntax.String}},
+		{"partition_key_expr", c.PartitionKeyExpr, []syntax.Type{syntax.String, syntax.Number}},
+		{"partition_number_expr", c.PartitionNumberExpr, []syntax.Type{syntax.Number}},
+	}
+	for _, e := range exprs {
+		if len(strings.TrimSpace(e.value)) == 0 {
+			continue
+		}
+		_, err := syntax.Check(e.value, e.types...)
+		if err != nil {
+			return eerrors.Wrapf(err, "Invalid %s", e.name)
+		}
+	}
+	return nil
 }
 
 func (c *HTTPServerSourceConfig) SetConfID() {
@@ -249,6 +305,10 @@ func (c *HTTPServerSourceConfig) GetClientAuthType() tls.ClientAuthType {
 	return convertClientAuthType(c.ClientAuthType)
 }
 
+func (c *UDPSourceConfig) GetClientAuthType() tls.ClientAuthType {
+	return convertClientAuthType(c.ClientAuthType)
+}
+
 func (c *TCPSourceConfig) GetClientAuthType() tls.ClientAuthType {
 	return convertClientAuthType(c.ClientAuthType)
 }
@@ -265,6 +325,179 @@ func (c *DirectRELPSourceConfig) GetClientAuthType() tls.ClientAuthType {
 	return convertClientAuthType(c.ClientAuthType)
 }
 
+func (c *GraylogSourceConfig) GetClientAuthType() tls.ClientAuthType {
+	return convertClientAuthType(c.ClientAuthType)
+}
+
+// GetTransport returns how the GELF messages are received by a Graylog
+// source: "udp" (chunked datagrams), "tcp" (null byte delimited) or "http".
+func (c *GraylogSourceConfig) GetTransport() string {
+	transport := strings.ToLower(strings.TrimSpace(c.Transport))
+	if transport == "" {
+		return "udp"
+	}
+	return transport
+}
+
+// The policies applied when a javascript function exceeds its budget.
+const (
+	JSPolicyDrop  = "drop"
+	JSPolicyPass  = "pass"
+	JSPolicyError = "error"
+)
+
+// completeBudget sets the default values of the javascript budget: one
+// second per call, 10000 nested calls, and a permanent error when the budget
+// is exceeded.
+func (c *JSBudgetConfig) completeBudget() error {
+	if c.JSTimeout < 0 {
+		return eerrors.New("js_timeout must not be negative")
+	}
+	if c.JSTimeout == 0 {
+		c.JSTimeout = time.Second
+	}
+	if c.JSMaxStack < 0 {
+		return eerrors.New("js_max_stack must not be negative")
+	}
+	if c.JSMaxStack == 0 {
+		c.JSMaxStack = 10000
+	}
+	c.JSTimeoutPolicy = strings.ToLower(strings.TrimSpace(c.JSTimeoutPolicy))
+	switch c.JSTimeoutPolicy {
+	case "":
+		c.JSTimeoutPolicy = JSPolicyError
+	case JSPolicyDrop, JSPolicyPass, JSPolicyError:
+	default:
+		return eerrors.Errorf("Unknown js_timeout_policy: '%s'", c.JSTimeoutPolicy)
+	}
+	return nil
+}
+
+// Targets returns the remote servers of the destination, as host:port
+// strings. The entries of Hosts may omit the port, Port is used then. When
+// Hosts is empty, the single target is Host:Port.
+func (c *TcpUdpRelpDestBaseConfig) Targets() ([]string, error) {
+	hosts := c.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{c.Host}
+	}
+	targets := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		h = strings.TrimSpace(h)
+		if len(h) == 0 {
+			continue
+		}
+		host, port, err := net.SplitHostPort(h)
+		if err != nil {
+			// no port
+			host = strings.Trim(h, "[]")
+			port = strconv.FormatInt(int64(c.Port), 10)
+		}
+		if len(host) == 0 {
+			return nil, eerrors.Errorf("Invalid destination host: '%s'", h)
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return nil, eerrors.Errorf("Invalid destination port: '%s'", h)
+		}
+		targets = append(targets, net.JoinHostPort(host, port))
+	}
+	if len(targets) == 0 {
+		return nil, eerrors.New("No destination host")
+	}
+	return targets, nil
+}
+
+func (c *TcpUdpRelpDestBaseConfig) check() error {
+	switch c.Strategy {
+	case "", "failover", "roundrobin", "hash":
+	default:
+		return eerrors.Errorf("Unknown balancing strategy: '%s'", c.Strategy)
+	}
+	if c.Strategy == "hash" {
+		_, err := template.New("hashkey").Parse(c.HashKeyTmpl)
+		if err != nil {
+			return eerrors.Wrap(err, "Invalid hash_key_tmpl")
+		}
+	}
+	if len(c.UnixSocketPath) > 0 {
+		return nil
+	}
+	_, err := c.Targets()
+	return err
+}
+
+// Policy builds the access rules described by the configuration.
+func (c *AccessControlConfig) Policy() (*acl.Policy, error) {
+	allow, err := acl.ParseNetworks(c.AllowFrom)
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Invalid allow_from")
+	}
+	deny, err := acl.ParseNetworks(c.DenyFrom)
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Invalid deny_from")
+	}
+	action, err := acl.ParseAction(c.RateLimitAction)
+	if err != nil {
+		return nil, err
+	}
+	return acl.NewPolicy(allow, deny, c.TLSAllowedSubjects, c.TLSAllowedSANs, c.RateLimitMessages, c.RateLimitBytes, action)
+}
+
+func checkFraming(framing string) error {
+	switch strings.ToLower(strings.TrimSpace(framing)) {
+	case "", "auto", "octet", "lf":
+		return nil
+	default:
+		return eerrors.Errorf("Unknown framing: '%s'", framing)
+	}
+}
+
+// checkRELPFraming rejects the framing option on the RELP sources: RELP
+// frames are always delimited by the DATALEN header.
+func checkRELPFraming(framing string) error {
+	switch strings.ToLower(strings.TrimSpace(framing)) {
+	case "", "auto":
+		return nil
+	default:
+		return eerrors.Errorf("The framing option is not supported by RELP sources: '%s'", framing)
+	}
+}
+
+// GetFraming returns how the messages are delimited on a TCP source:
+//
+// - octet: octet counting only (RFC 5425, RFC 6587 section 3.4.1)
+// - lf: the messages end with the delimiter (RFC 6587 section 3.4.2)
+// - auto: octet counting or LF, detected for each message
+//
+// When framing is not set, line_framing chooses between lf and auto.
+func (c *TCPSourceConfig) GetFraming() string {
+	framing := strings.ToLower(strings.TrimSpace(c.Framing))
+	if len(framing) > 0 {
+		return framing
+	}
+	if c.LineFraming {
+		return "lf"
+	}
+	return "auto"
+}
+
+// GetLineFraming tells whether the TCP destination delimits the messages
+// with the delimiter, instead of octet counting. With the auto framing, TLS
+// connections use octet counting, as required by RFC 5425.
+func (c *TCPDestConfig) GetLineFraming() bool {
+	switch strings.ToLower(strings.TrimSpace(c.Framing)) {
+	case "lf":
+		return true
+	case "octet":
+		return false
+	case "auto":
+		return c.LineFraming && !c.TLSEnabled
+	default:
+		return c.LineFraming
+	}
+}
+
 func convertClientAuthType(authType string) tls.ClientAuthType {
 	s := strings.TrimSpace(authType)
 	if len(s) == 0 {
@@ -308,6 +541,7 @@ func (c *BaseConfig) GetCertificateFiles() (res map[string][]string) {
 	s.Add(c.KafkaDest.CAFile, c.KafkaDest.CertFile, c.KafkaDest.KeyFile)
 	s.Add(c.RELPDest.CAFile, c.RELPDest.CertFile, c.RELPDest.KeyFile)
 	s.Add(c.TCPDest.CAFile, c.TCPDest.CertFile, c.TCPDest.KeyFile)
+	s.Add(c.UDPDest.CAFile, c.UDPDest.CertFile, c.UDPDest.KeyFile)
 	s.Add(c.HTTPServerDest.CAFile, c.HTTPServerDest.CertFile, c.HTTPServerDest.KeyFile)
 	res["dests"] = cleanList(s)
 
@@ -317,6 +551,12 @@ func (c *BaseConfig) GetCertificateFiles() (res map[string][]string) {
 	}
 	res["tcpsource"] = cleanList(s)
 
+	s = set.New(set.ThreadSafe)
+	for _, src := range c.UDPSource {
+		s.Add(src.CAFile, src.CertFile, src.KeyFile)
+	}
+	res["udpsource"] = cleanList(s)
+
 	s = set.New(set.ThreadSafe)
 	for _, src := range c.RELPSource {
 		s.Add(src.CAFile, src.CertFile, src.KeyFile)
@@ -341,6 +581,12 @@ func (c *BaseConfig) GetCertificateFiles() (res map[string][]string) {
 	}
 	res["httpserversource"] = cleanList(s)
 
+	s = set.New(set.ThreadSafe)
+	for _, src := range c.GraylogSource {
+		s.Add(src.CAFile, src.CertFile, src.KeyFile)
+	}
+	res["graylogsource"] = cleanList(s)
+
 	return res
 }
 
@@ -350,6 +596,7 @@ func (c *BaseConfig) GetCertificatePaths() (res map[string][]string) {
 	s.Add(c.KafkaDest.CAPath)
 	s.Add(c.RELPDest.CAPath)
 	s.Add(c.TCPDest.CAPath)
+	s.Add(c.UDPDest.CAPath)
 	res["dests"] = cleanList(s)
 
 	s = set.New(set.ThreadSafe)
@@ -358,6 +605,12 @@ func (c *BaseConfig) GetCertificatePaths() (res map[string][]string) {
 	}
 	res["tcpsource"] = cleanList(s)
 
+	s = set.New(set.ThreadSafe)
+	for _, src := range c.UDPSource {
+		s.Add(src.CAPath)
+	}
+	res["udpsource"] = cleanList(s)
+
 	s = set.New(set.ThreadSafe)
 	for _, src := range c.RELPSource {
 		s.Add(src.CAPath)
@@ -376,6 +629,12 @@ func (c *BaseConfig) GetCertificatePaths() (res map[string][]string) {
 	}
 	res["kafkasource"] = cleanList(s)
 
+	s = set.New(set.ThreadSafe)
+	for _, src := range c.GraylogSource {
+		s.Add(src.CAPath)
+	}
+	res["graylogsource"] = cleanList(s)
+
 	return res
 }
 
@@ -682,6 +941,15 @@ func InitLoad(ctx context.Context, confDir string, p consul.ConnParams, r kring.
 	}
 
 	err = c.Complete(r)
+	if err == nil {
+		err = c.LoadGrokPatterns(scriptsDir(v, confDir))
+	}
+	if err == nil {
+		err = c.LoadScripts(scriptsDir(v, confDir))
+	}
+	if err == nil {
+		err = c.LoadLookups(scriptsDir(v, confDir))
+	}
 	if err != nil {
 		if cancelWatch != nil {
 			cancelWatch()
@@ -689,12 +957,40 @@ func InitLoad(ctx context.Context, confDir string, p consul.ConnParams, r kring.
 		return NewBaseConf(), nil, err
 	}
 
-	if consulResults != nil {
-		// watch for updates from Consul
+	var scriptsChanged chan struct{}
+	var watcher *scriptsWatcher
+	if len(c.Scripts) > 0 || len(c.Lookups) > 0 {
+		watcher, err = newScriptsWatcher(l)
+		if err != nil {
+			l.Warn("The script and lookup files can not be watched for changes", "error", err)
+		} else {
+			watcher.watch(c.watchedFiles(scriptsDir(v, confDir)))
+			scriptsChanged = watcher.changed
+		}
+	}
+
+	if consulResults != nil || scriptsChanged != nil {
+		// watch for updates from Consul and for changes of the script files
 		updates = make(chan *BaseConfig)
 		go func() {
+			defer close(updates)
+			if watcher != nil {
+				defer watcher.close()
+			}
+			consulConf := getFirstValue(firstResults)
 		Loop:
-			for result := range consulResults {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case result, more := <-consulResults:
+					if !more {
+						return
+					}
+					consulConf = getFirstValue(result)
+				case <-scriptsChanged:
+					l.Info("Script or lookup files have changed")
+				}
 				v, err := getViper(confDir)
 				if err != nil {
 					switch err.(type) {
@@ -706,10 +1002,12 @@ func InitLoad(ctx context.Context, confDir string, p consul.ConnParams, r kring.
 					}
 				}
 
-				err = FromConsul(v, getFirstValue(result))
-				if err != nil {
-					l.Warn("Error decoding conf from Consul", "error", err)
-					continue Loop
+				if consulResults != nil {
+					err = FromConsul(v, consulConf)
+					if err != nil {
+						l.Warn("Error decoding conf from Consul", "error", err)
+						continue Loop
+					}
 				}
 
 				newConfig := NewBaseConf()
@@ -720,19 +1018,49 @@ func InitLoad(ctx context.Context, confDir string, p consul.ConnParams, r kring.
 				}
 
 				err = newConfig.Complete(r)
+				if err == nil {
+					err = newConfig.LoadGrokPatterns(scriptsDir(v, confDir))
+				}
+				if err == nil {
+					err = newConfig.LoadScripts(scriptsDir(v, confDir))
+				}
+				if err == nil {
+					err = newConfig.LoadLookups(scriptsDir(v, confDir))
+				}
 				if err != nil {
-					l.Error("Error updating conf from Consul", "error", err)
+					l.Error("Error updating configuration", "error", err)
 					continue Loop
 				}
-				updates <- &newConfig
+				if watcher != nil {
+					watcher.watch(newConfig.watchedFiles(scriptsDir(v, confDir)))
+				}
+				select {
+				case updates <- &newConfig:
+				case <-ctx.Done():
+					return
+				}
 			}
-			close(updates)
 		}()
 	}
 
 	return c, updates, nil
 }
 
+// watchedFiles returns the script and lookup files, that are reloaded when
+// they change.
+func (c *BaseConfig) watchedFiles(confDir string) []string {
+	return append(c.ScriptFiles(confDir), c.LookupFiles(confDir)...)
+}
+
+// scriptsDir returns the directory where the script files are looked for:
+// the directory of the configuration file.
+func scriptsDir(v *viper.Viper, confDir string) string {
+	if v != nil && len(v.ConfigFileUsed()) > 0 {
+		return filepath.Dir(v.ConfigFileUsed())
+	}
+	return confDir
+}
+
 func getFirstValue(m map[string]string) (val string) {
 	for _, val = range m {
 		break
@@ -760,9 +1088,97 @@ func (c *BaseConfig) Export() (string, error) {
 	return buf.String(), nil
 }
 
+// completeGrok checks the grok settings. When the patterns are completed by
+// a patterns file, the grok pattern is compiled by LoadGrokPatterns, once
+// the file is read.
+func (c *DecoderBaseConfig) completeGrok() error {
+	if len(strings.TrimSpace(c.GrokPattern)) == 0 {
+		return eerrors.New("The grok decoder needs a grok_pattern")
+	}
+	if len(c.GrokPatternsFile) > 0 {
+		name, err := confFileName(c.GrokPatternsFile, "grok patterns file")
+		if err != nil {
+			return err
+		}
+		c.GrokPatternsFile = name
+		return nil
+	}
+	return c.compileGrok()
+}
+
+func (c *DecoderBaseConfig) compileGrok() error {
+	g := grok.New()
+	err := g.AddPatterns(c.GrokPatterns)
+	if err != nil {
+		return eerrors.Wrap(err, "Invalid grok patterns")
+	}
+	_, err = g.Compile(c.GrokPattern)
+	if err != nil {
+		return eerrors.Wrap(err, "Invalid grok pattern")
+	}
+	return nil
+}
+
+// LoadGrokPatterns reads from the configuration directory the grok patterns
+// files of the sources, so that the plugins do not need to access them, and
+// checks that the grok patterns compile.
+func (c *BaseConfig) LoadGrokPatterns(confDir string) error {
+	for _, source := range c.sources() {
+		decodr := source.DecoderConf()
+		if decodr == nil || len(decodr.GrokPatternsFile) == 0 {
+			continue
+		}
+		if base.ParseFormat(decodr.Format) != base.Grok {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(confDir, filepath.FromSlash(decodr.GrokPatternsFile)))
+		if err != nil {
+			return confCheckError(eerrors.Wrapf(err, "Error reading grok patterns file '%s'", decodr.GrokPatternsFile))
+		}
+		decodr.GrokPatterns = string(content) + "\n" + decodr.GrokPatterns
+		err = decodr.compileGrok()
+		if err != nil {
+			return confCheckError(err)
+		}
+	}
+	return nil
+}
+
+// sources lists the configurations of all the sources.
+func (c *BaseConfig) sources() []Source {
+	sources := make([]Source, 0)
+	for i := range c.FSSource {
+		sources = append(sources, &c.FSSource[i])
+	}
+	for i := range c.TCPSource {
+		sources = append(sources, &c.TCPSource[i])
+	}
+	for i := range c.UDPSource {
+		sources = append(sources, &c.UDPSource[i])
+	}
+	for i := range c.RELPSource {
+		sources = append(sources, &c.RELPSource[i])
+	}
+	for i := range c.DirectRELPSource {
+		sources = append(sources, &c.DirectRELPSource[i])
+	}
+	for i := range c.GraylogSource {
+		sources = append(sources, &c.GraylogSource[i])
+	}
+	for i := range c.KafkaSource {
+		sources = append(sources, &c.KafkaSource[i])
+	}
+	for i := range c.HTTPServerSource {
+		sources = append(sources, &c.HTTPServerSource[i])
+	}
+	sources = append(sources, &c.Journald, &c.Accounting, &c.MacOS)
+	return sources
+}
+
 func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 	parsersNames := map[string]bool{}
-	for _, parserConf := range c.Parsers {
+	for i := range c.Parsers {
+		parserConf := &(c.Parsers[i])
 		name := strings.TrimSpace(parserConf.Name)
 		if base.ParseFormat(parserConf.Name) != -1 {
 			return confCheckError(eerrors.New("Parser configuration must not use a reserved name"))
@@ -777,9 +1193,85 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 		if len(f) == 0 {
 			return confCheckError(eerrors.New("Empty parser func"))
 		}
+		err = parserConf.completeBudget()
+		if err != nil {
+			return confCheckError(err)
+		}
 		parsersNames[name] = true
 	}
 
+	enrichmentsNames := map[string]bool{}
+	for i := range c.Enrichments {
+		enrichConf := &(c.Enrichments[i])
+		err = enrichConf.complete()
+		if err != nil {
+			return confCheckError(err)
+		}
+		if enrichmentsNames[enrichConf.Name] {
+			return confCheckError(eerrors.New("The same enrichment name is used multiple times"))
+		}
+		enrichmentsNames[enrichConf.Name] = true
+	}
+
+	redactionsNames := map[string]bool{}
+	for i := range c.Redactions {
+		redactConf := &(c.Redactions[i])
+		err = redactConf.complete()
+		if err != nil {
+			return confCheckError(err)
+		}
+		if redactionsNames[redactConf.Name] {
+			return confCheckError(eerrors.New("The same redaction name is used multiple times"))
+		}
+		redactionsNames[redactConf.Name] = true
+	}
+
+	suppressionsNames := map[string]bool{}
+	for i := range c.Suppressions {
+		suppressConf := &(c.Suppressions[i])
+		err = suppressConf.complete()
+		if err != nil {
+			return confCheckError(err)
+		}
+		if suppressionsNames[suppressConf.Name] {
+			return confCheckError(eerrors.New("The same suppression name is used multiple times"))
+		}
+		suppressionsNames[suppressConf.Name] = true
+	}
+
+	samplingsNames := map[string]bool{}
+	for i := range c.Samplings {
+		sampleConf := &(c.Samplings[i])
+		err = sampleConf.complete()
+		if err != nil {
+			return confCheckError(err)
+		}
+		if samplingsNames[sampleConf.Name] {
+			return confCheckError(eerrors.New("The same sampling name is used multiple times"))
+		}
+		samplingsNames[sampleConf.Name] = true
+	}
+
+	logMetricsNames := map[string]bool{}
+	metricNames := map[string]bool{}
+	for i := range c.LogMetrics {
+		metricsConf := &(c.LogMetrics[i])
+		err = metricsConf.complete()
+		if err != nil {
+			return confCheckError(err)
+		}
+		if logMetricsNames[metricsConf.Name] {
+			return confCheckError(eerrors.New("The same log_metrics name is used multiple times"))
+		}
+		logMetricsNames[metricsConf.Name] = true
+		for _, metricConf := range metricsConf.Metrics {
+			if metricNames[metricConf.Name] {
+				return confCheckError(eerrors.Errorf("The metric '%s' is defined multiple times", metricConf.Name))
+			}
+			metricNames[metricConf.Name] = true
+		}
+	}
+
 	_, err = c.Main.GetDestinations()
 	if err != nil {
 		return err
@@ -790,6 +1282,35 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 		return err
 	}
 
+	if c.TCPDest.Port == 0 {
+		c.TCPDest.Port = 1514
+		if c.TCPDest.TLSEnabled {
+			c.TCPDest.Port = 6514
+		}
+	}
+	if c.UDPDest.Port == 0 {
+		c.UDPDest.Port = 1514
+		if c.UDPDest.TLSEnabled {
+			c.UDPDest.Port = 6514
+		}
+	}
+	err = checkFraming(c.TCPDest.Framing)
+	if err != nil {
+		return confCheckError(err)
+	}
+	for _, fingerprints := range [][]string{c.TCPDest.TLSFingerprints, c.UDPDest.TLSFingerprints, c.RELPDest.TLSFingerprints} {
+		_, err = utils.ParseFingerprints(fingerprints)
+		if err != nil {
+			return confCheckError(err)
+		}
+	}
+	for _, dest := range []*TcpUdpRelpDestBaseConfig{&c.TCPDest.TcpUdpRelpDestBaseConfig, &c.UDPDest.TcpUdpRelpDestBaseConfig, &c.RELPDest.TcpUdpRelpDestBaseConfig} {
+		err = dest.check()
+		if err != nil {
+			return confCheckError(err)
+		}
+	}
+
 	_, err = ParseVersion(c.KafkaDest.Version)
 	if err != nil {
 		return confCheckError(
@@ -819,32 +1340,7 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 		}
 	}
 
-	sources := make([]Source, 0)
-	for i := range c.FSSource {
-		sources = append(sources, &c.FSSource[i])
-	}
-	for i := range c.TCPSource {
-		sources = append(sources, &c.TCPSource[i])
-	}
-	for i := range c.UDPSource {
-		sources = append(sources, &c.UDPSource[i])
-	}
-	for i := range c.RELPSource {
-		sources = append(sources, &c.RELPSource[i])
-	}
-	for i := range c.DirectRELPSource {
-		sources = append(sources, &c.DirectRELPSource[i])
-	}
-	for i := range c.GraylogSource {
-		sources = append(sources, &c.GraylogSource[i])
-	}
-	for i := range c.KafkaSource {
-		sources = append(sources, &c.KafkaSource[i])
-	}
-	for i := range c.HTTPServerSource {
-		sources = append(sources, &c.HTTPServerSource[i])
-	}
-	sources = append(sources, &c.Journald, &c.Accounting, &c.MacOS)
+	sources := c.sources()
 
 	for i := range c.TCPSource {
 		if len(c.TCPSource[i].FrameDelimiter) == 0 {
@@ -887,6 +1383,89 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 		}
 	}
 
+	// check the access rules of the network sources
+	accessControls := make([]*AccessControlConfig, 0)
+	for i := range c.TCPSource {
+		accessControls = append(accessControls, &c.TCPSource[i].AccessControlConfig)
+	}
+	for i := range c.UDPSource {
+		accessControls = append(accessControls, &c.UDPSource[i].AccessControlConfig)
+	}
+	for i := range c.RELPSource {
+		accessControls = append(accessControls, &c.RELPSource[i].AccessControlConfig)
+	}
+	for i := range c.DirectRELPSource {
+		accessControls = append(accessControls, &c.DirectRELPSource[i].AccessControlConfig)
+	}
+	for i := range c.HTTPServerSource {
+		accessControls = append(accessControls, &c.HTTPServerSource[i].AccessControlConfig)
+	}
+	for _, accessControl := range accessControls {
+		_, err = accessControl.Policy()
+		if err != nil {
+			return confCheckError(err)
+		}
+		_, err = utils.ParseFingerprints(accessControl.TLSFingerprints)
+		if err != nil {
+			return confCheckError(err)
+		}
+	}
+	for _, tcpConf := range c.TCPSource {
+		if tcpConf.MaxWindow != 0 {
+			return confCheckError(eerrors.New("The max_window option is only supported by RELP sources"))
+		}
+		err = checkFraming(tcpConf.Framing)
+		if err != nil {
+			return confCheckError(err)
+		}
+	}
+	for _, relpConf := range c.RELPSource {
+		if relpConf.MaxWindow < 0 {
+			return confCheckError(eerrors.New("max_window must not be negative"))
+		}
+		err = checkRELPFraming(relpConf.Framing)
+		if err != nil {
+			return confCheckError(err)
+		}
+	}
+	for _, relpConf := range c.DirectRELPSource {
+		if relpConf.MaxWindow < 0 {
+			return confCheckError(eerrors.New("max_window must not be negative"))
+		}
+		if len(relpConf.Redact) > 0 {
+			return confCheckError(eerrors.New("The redact option is not supported by the direct RELP sources"))
+		}
+		if len(relpConf.Suppress) > 0 {
+			return confCheckError(eerrors.New("The suppress option is not supported by the direct RELP sources"))
+		}
+		if len(relpConf.Sample) > 0 {
+			return confCheckError(eerrors.New("The sample option is not supported by the direct RELP sources"))
+		}
+		if len(relpConf.LogMetrics) > 0 {
+			return confCheckError(eerrors.New("The log_metrics option is not supported by the direct RELP sources"))
+		}
+		err = checkRELPFraming(relpConf.Framing)
+		if err != nil {
+			return confCheckError(err)
+		}
+	}
+	for _, graylogConf := range c.GraylogSource {
+		switch graylogConf.GetTransport() {
+		case "udp":
+			if graylogConf.TLSEnabled {
+				return confCheckError(eerrors.New("TLS is not supported by the udp transport of graylog_source"))
+			}
+		case "tcp", "http":
+		default:
+			return confCheckError(eerrors.Errorf("Unknown graylog_source transport: '%s'", graylogConf.Transport))
+		}
+	}
+	for _, udpConf := range c.UDPSource {
+		if udpConf.PassCredentials && len(udpConf.UnixSocketPath) == 0 {
+			return confCheckError(eerrors.New("pass_credentials requires unix_socket_path"))
+		}
+	}
+
 	// set default values for sources
 	for _, sourceConf := range sources {
 		listeners := sourceConf.ListenersConf()
@@ -899,6 +1478,18 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 			if decodr.Charset == "" {
 				decodr.Charset = "utf8"
 			}
+			switch base.ParseFormat(decodr.Format) {
+			case base.Grok:
+				err = decodr.completeGrok()
+				if err != nil {
+					return confCheckError(err)
+				}
+			case base.AccessLog:
+				_, err = accesslog.Compile(decodr.AccessLogFormat)
+				if err != nil {
+					return confCheckError(eerrors.Wrap(err, "Invalid access_log_format"))
+				}
+			}
 		}
 		if listeners != nil {
 			if listeners.UnixSocketPath == "" {
@@ -924,6 +1515,34 @@ func (c *BaseConfig) Complete(r kring.Ring) (err error) {
 
 		}
 		if filtering != nil {
+			err = filtering.completeBudget()
+			if err != nil {
+				return confCheckError(err)
+			}
+			err = filtering.checkExpressions()
+			if err != nil {
+				return confCheckError(err)
+			}
+			filtering.Enrich = strings.TrimSpace(filtering.Enrich)
+			if len(filtering.Enrich) > 0 && !enrichmentsNames[filtering.Enrich] {
+				return confCheckError(eerrors.Errorf("Unknown enrichment '%s'", filtering.Enrich))
+			}
+			filtering.Redact = strings.TrimSpace(filtering.Redact)
+			if len(filtering.Redact) > 0 && !redactionsNames[filtering.Redact] {
+				return confCheckError(eerrors.Errorf("Unknown redaction '%s'", filtering.Redact))
+			}
+			filtering.Suppress = strings.TrimSpace(filtering.Suppress)
+			if len(filtering.Suppress) > 0 && !suppressionsNames[filtering.Suppress] {
+				return confCheckError(eerrors.Errorf("Unknown suppression '%s'", filtering.Suppress))
+			}
+			filtering.Sample = strings.TrimSpace(filtering.Sample)
+			if len(filtering.Sample) > 0 && !samplingsNames[filtering.Sample] {
+				return confCheckError(eerrors.Errorf("Unknown sampling '%s'", filtering.Sample))
+			}
+			filtering.LogMetrics = strings.TrimSpace(filtering.LogMetrics)
+			if len(filtering.LogMetrics) > 0 && !logMetricsNames[filtering.LogMetrics] {
+				return confCheckError(eerrors.Errorf("Unknown log_metrics '%s'", filtering.LogMetrics))
+			}
 			if filtering.TopicTmpl == "" {
 				filtering.TopicTmpl = "topic-{{.AppName}}"
 			}
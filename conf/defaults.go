@@ -167,6 +167,9 @@ func SetRelpDestDefaults(v *viper.Viper, prefixed bool) {
 	}
 	v.SetDefault(prefix+"host", "127.0.0.1")
 	v.SetDefault(prefix+"port", 1515)
+	v.SetDefault(prefix+"strategy", "failover")
+	v.SetDefault(prefix+"hash_key_tmpl", "{{.HostName}}")
+	v.SetDefault(prefix+"probe_interval", "10s")
 	v.SetDefault(prefix+"format", "rfc5424")
 	v.SetDefault(prefix+"keepalive", true)
 	v.SetDefault(prefix+"keepalive_period", "75s")
@@ -207,7 +210,11 @@ func SetUdpDestDefaults(v *viper.Viper, prefixed bool) {
 		prefix = "udp_destination."
 	}
 	v.SetDefault(prefix+"host", "127.0.0.1")
-	v.SetDefault(prefix+"port", 1514)
+	// the default port depends on tls_enabled, see Complete
+	v.SetDefault(prefix+"port", 0)
+	v.SetDefault(prefix+"strategy", "failover")
+	v.SetDefault(prefix+"hash_key_tmpl", "{{.HostName}}")
+	v.SetDefault(prefix+"probe_interval", "10s")
 	v.SetDefault(prefix+"format", "rfc5424")
 }
 
@@ -217,7 +224,11 @@ func SetTcpDestDefaults(v *viper.Viper, prefixed bool) {
 		prefix = "tcp_destination."
 	}
 	v.SetDefault(prefix+"host", "127.0.0.1")
-	v.SetDefault(prefix+"port", 1514)
+	// the default port depends on tls_enabled, see Complete
+	v.SetDefault(prefix+"port", 0)
+	v.SetDefault(prefix+"strategy", "failover")
+	v.SetDefault(prefix+"hash_key_tmpl", "{{.HostName}}")
+	v.SetDefault(prefix+"probe_interval", "10s")
 	v.SetDefault(prefix+"format", "rfc5424")
 	v.SetDefault(prefix+"delimiter", 10)
 	v.SetDefault(prefix+"keepalive", true)
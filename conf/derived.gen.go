@@ -99,7 +99,7 @@ func deriveDeepCopy(dst, src *BaseConfig) {
 		} else {
 			dst.HTTPServerSource = make([]HTTPServerSourceConfig, len(src.HTTPServerSource))
 		}
-		copy(dst.HTTPServerSource, src.HTTPServerSource)
+		deriveDeepCopy_3(dst.HTTPServerSource, src.HTTPServerSource)
 	}
 	if src.DirectRELPSource == nil {
 		dst.DirectRELPSource = nil
@@ -117,7 +117,7 @@ func deriveDeepCopy(dst, src *BaseConfig) {
 		} else {
 			dst.DirectRELPSource = make([]DirectRELPSourceConfig, len(src.DirectRELPSource))
 		}
-		deriveDeepCopy_3(dst.DirectRELPSource, src.DirectRELPSource)
+		deriveDeepCopy_4(dst.DirectRELPSource, src.DirectRELPSource)
 	}
 	if src.KafkaSource == nil {
 		dst.KafkaSource = nil
@@ -135,7 +135,7 @@ func deriveDeepCopy(dst, src *BaseConfig) {
 		} else {
 			dst.KafkaSource = make([]KafkaSourceConfig, len(src.KafkaSource))
 		}
-		deriveDeepCopy_4(dst.KafkaSource, src.KafkaSource)
+		deriveDeepCopy_5(dst.KafkaSource, src.KafkaSource)
 	}
 	if src.GraylogSource == nil {
 		dst.GraylogSource = nil
@@ -153,7 +153,7 @@ func deriveDeepCopy(dst, src *BaseConfig) {
 		} else {
 			dst.GraylogSource = make([]GraylogSourceConfig, len(src.GraylogSource))
 		}
-		deriveDeepCopy_5(dst.GraylogSource, src.GraylogSource)
+		deriveDeepCopy_6(dst.GraylogSource, src.GraylogSource)
 	}
 	dst.Store = src.Store
 	if src.Parsers == nil {
@@ -174,6 +174,96 @@ func deriveDeepCopy(dst, src *BaseConfig) {
 		}
 		copy(dst.Parsers, src.Parsers)
 	}
+	if src.Enrichments == nil {
+		dst.Enrichments = nil
+	} else {
+		if dst.Enrichments != nil {
+			if len(src.Enrichments) > len(dst.Enrichments) {
+				if cap(dst.Enrichments) >= len(src.Enrichments) {
+					dst.Enrichments = (dst.Enrichments)[:len(src.Enrichments)]
+				} else {
+					dst.Enrichments = make([]EnrichmentConfig, len(src.Enrichments))
+				}
+			} else if len(src.Enrichments) < len(dst.Enrichments) {
+				dst.Enrichments = (dst.Enrichments)[:len(src.Enrichments)]
+			}
+		} else {
+			dst.Enrichments = make([]EnrichmentConfig, len(src.Enrichments))
+		}
+		deriveDeepCopy_7(dst.Enrichments, src.Enrichments)
+	}
+	if src.Redactions == nil {
+		dst.Redactions = nil
+	} else {
+		if dst.Redactions != nil {
+			if len(src.Redactions) > len(dst.Redactions) {
+				if cap(dst.Redactions) >= len(src.Redactions) {
+					dst.Redactions = (dst.Redactions)[:len(src.Redactions)]
+				} else {
+					dst.Redactions = make([]RedactionConfig, len(src.Redactions))
+				}
+			} else if len(src.Redactions) < len(dst.Redactions) {
+				dst.Redactions = (dst.Redactions)[:len(src.Redactions)]
+			}
+		} else {
+			dst.Redactions = make([]RedactionConfig, len(src.Redactions))
+		}
+		deriveDeepCopy_8(dst.Redactions, src.Redactions)
+	}
+	if src.Suppressions == nil {
+		dst.Suppressions = nil
+	} else {
+		if dst.Suppressions != nil {
+			if len(src.Suppressions) > len(dst.Suppressions) {
+				if cap(dst.Suppressions) >= len(src.Suppressions) {
+					dst.Suppressions = (dst.Suppressions)[:len(src.Suppressions)]
+				} else {
+					dst.Suppressions = make([]SuppressionConfig, len(src.Suppressions))
+				}
+			} else if len(src.Suppressions) < len(dst.Suppressions) {
+				dst.Suppressions = (dst.Suppressions)[:len(src.Suppressions)]
+			}
+		} else {
+			dst.Suppressions = make([]SuppressionConfig, len(src.Suppressions))
+		}
+		deriveDeepCopy_9(dst.Suppressions, src.Suppressions)
+	}
+	if src.Samplings == nil {
+		dst.Samplings = nil
+	} else {
+		if dst.Samplings != nil {
+			if len(src.Samplings) > len(dst.Samplings) {
+				if cap(dst.Samplings) >= len(src.Samplings) {
+					dst.Samplings = (dst.Samplings)[:len(src.Samplings)]
+				} else {
+					dst.Samplings = make([]SamplingConfig, len(src.Samplings))
+				}
+			} else if len(src.Samplings) < len(dst.Samplings) {
+				dst.Samplings = (dst.Samplings)[:len(src.Samplings)]
+			}
+		} else {
+			dst.Samplings = make([]SamplingConfig, len(src.Samplings))
+		}
+		deriveDeepCopy_10(dst.Samplings, src.Samplings)
+	}
+	if src.LogMetrics == nil {
+		dst.LogMetrics = nil
+	} else {
+		if dst.LogMetrics != nil {
+			if len(src.LogMetrics) > len(dst.LogMetrics) {
+				if cap(dst.LogMetrics) >= len(src.LogMetrics) {
+					dst.LogMetrics = (dst.LogMetrics)[:len(src.LogMetrics)]
+				} else {
+					dst.LogMetrics = make([]LogMetricsConfig, len(src.LogMetrics))
+				}
+			} else if len(src.LogMetrics) < len(dst.LogMetrics) {
+				dst.LogMetrics = (dst.LogMetrics)[:len(src.LogMetrics)]
+			}
+		} else {
+			dst.LogMetrics = make([]LogMetricsConfig, len(src.LogMetrics))
+		}
+		deriveDeepCopy_11(dst.LogMetrics, src.LogMetrics)
+	}
 	dst.Journald = src.Journald
 	dst.Metrics = src.Metrics
 	dst.Accounting = src.Accounting
@@ -183,10 +273,18 @@ func deriveDeepCopy(dst, src *BaseConfig) {
 		dst.KafkaDest = nil
 	} else {
 		dst.KafkaDest = new(KafkaDestConfig)
-		deriveDeepCopy_6(dst.KafkaDest, src.KafkaDest)
+		deriveDeepCopy_12(dst.KafkaDest, src.KafkaDest)
 	}
-	dst.UDPDest = src.UDPDest
-	dst.TCPDest = src.TCPDest
+	func() {
+		field := new(UDPDestConfig)
+		deriveDeepCopy_13(field, &src.UDPDest)
+		dst.UDPDest = *field
+	}()
+	func() {
+		field := new(TCPDestConfig)
+		deriveDeepCopy_14(field, &src.TCPDest)
+		dst.TCPDest = *field
+	}()
 	dst.HTTPDest = src.HTTPDest
 	dst.HTTPServerDest = src.HTTPServerDest
 	dst.WebsocketServerDest = src.WebsocketServerDest
@@ -194,85 +292,249 @@ func deriveDeepCopy(dst, src *BaseConfig) {
 		dst.NATSDest = nil
 	} else {
 		dst.NATSDest = new(NATSDestConfig)
-		deriveDeepCopy_7(dst.NATSDest, src.NATSDest)
+		deriveDeepCopy_15(dst.NATSDest, src.NATSDest)
 	}
-	dst.RELPDest = src.RELPDest
+	func() {
+		field := new(RELPDestConfig)
+		deriveDeepCopy_16(field, &src.RELPDest)
+		dst.RELPDest = *field
+	}()
 	dst.FileDest = src.FileDest
 	dst.StderrDest = src.StderrDest
 	dst.GraylogDest = src.GraylogDest
-	field := new(ElasticDestConfig)
-	deriveDeepCopy_8(field, &src.ElasticDest)
-	dst.ElasticDest = *field
+	func() {
+		field := new(ElasticDestConfig)
+		deriveDeepCopy_17(field, &src.ElasticDest)
+		dst.ElasticDest = *field
+	}()
 	dst.RedisDest = src.RedisDest
+	if src.Scripts != nil {
+		dst.Scripts = make(map[string]string, len(src.Scripts))
+		deriveDeepCopy_18(dst.Scripts, src.Scripts)
+	} else {
+		dst.Scripts = nil
+	}
+	if src.Lookups != nil {
+		dst.Lookups = make(map[string]string, len(src.Lookups))
+		deriveDeepCopy_18(dst.Lookups, src.Lookups)
+	} else {
+		dst.Lookups = nil
+	}
+	dst.LookupDir = src.LookupDir
 }
 
 // deriveDeepCopy_ recursively copies the contents of src into dst.
 func deriveDeepCopy_(dst, src []TCPSourceConfig) {
 	for src_i, src_value := range src {
-		field := new(TCPSourceConfig)
-		deriveDeepCopy_9(field, &src_value)
-		dst[src_i] = *field
+		func() {
+			field := new(TCPSourceConfig)
+			deriveDeepCopy_19(field, &src_value)
+			dst[src_i] = *field
+		}()
 	}
 }
 
 // deriveDeepCopy_1 recursively copies the contents of src into dst.
 func deriveDeepCopy_1(dst, src []UDPSourceConfig) {
 	for src_i, src_value := range src {
-		field := new(UDPSourceConfig)
-		deriveDeepCopy_10(field, &src_value)
-		dst[src_i] = *field
+		func() {
+			field := new(UDPSourceConfig)
+			deriveDeepCopy_20(field, &src_value)
+			dst[src_i] = *field
+		}()
 	}
 }
 
 // deriveDeepCopy_2 recursively copies the contents of src into dst.
 func deriveDeepCopy_2(dst, src []RELPSourceConfig) {
 	for src_i, src_value := range src {
-		field := new(RELPSourceConfig)
-		deriveDeepCopy_11(field, &src_value)
-		dst[src_i] = *field
+		func() {
+			field := new(RELPSourceConfig)
+			deriveDeepCopy_21(field, &src_value)
+			dst[src_i] = *field
+		}()
 	}
 }
 
 // deriveDeepCopy_3 recursively copies the contents of src into dst.
-func deriveDeepCopy_3(dst, src []DirectRELPSourceConfig) {
+func deriveDeepCopy_3(dst, src []HTTPServerSourceConfig) {
 	for src_i, src_value := range src {
-		field := new(DirectRELPSourceConfig)
-		deriveDeepCopy_12(field, &src_value)
-		dst[src_i] = *field
+		func() {
+			field := new(HTTPServerSourceConfig)
+			deriveDeepCopy_22(field, &src_value)
+			dst[src_i] = *field
+		}()
 	}
 }
 
 // deriveDeepCopy_4 recursively copies the contents of src into dst.
-func deriveDeepCopy_4(dst, src []KafkaSourceConfig) {
+func deriveDeepCopy_4(dst, src []DirectRELPSourceConfig) {
 	for src_i, src_value := range src {
-		field := new(KafkaSourceConfig)
-		deriveDeepCopy_13(field, &src_value)
-		dst[src_i] = *field
+		func() {
+			field := new(DirectRELPSourceConfig)
+			deriveDeepCopy_23(field, &src_value)
+			dst[src_i] = *field
+		}()
 	}
 }
 
 // deriveDeepCopy_5 recursively copies the contents of src into dst.
-func deriveDeepCopy_5(dst, src []GraylogSourceConfig) {
+func deriveDeepCopy_5(dst, src []KafkaSourceConfig) {
 	for src_i, src_value := range src {
-		field := new(GraylogSourceConfig)
-		deriveDeepCopy_14(field, &src_value)
-		dst[src_i] = *field
+		func() {
+			field := new(KafkaSourceConfig)
+			deriveDeepCopy_24(field, &src_value)
+			dst[src_i] = *field
+		}()
 	}
 }
 
 // deriveDeepCopy_6 recursively copies the contents of src into dst.
-func deriveDeepCopy_6(dst, src *KafkaDestConfig) {
-	field := new(KafkaBaseConfig)
-	deriveDeepCopy_15(field, &src.KafkaBaseConfig)
-	dst.KafkaBaseConfig = *field
+func deriveDeepCopy_6(dst, src []GraylogSourceConfig) {
+	for src_i, src_value := range src {
+		func() {
+			field := new(GraylogSourceConfig)
+			deriveDeepCopy_25(field, &src_value)
+			dst[src_i] = *field
+		}()
+	}
+}
+
+// deriveDeepCopy_7 recursively copies the contents of src into dst.
+func deriveDeepCopy_7(dst, src []EnrichmentConfig) {
+	for src_i, src_value := range src {
+		func() {
+			field := new(EnrichmentConfig)
+			deriveDeepCopy_26(field, &src_value)
+			dst[src_i] = *field
+		}()
+	}
+}
+
+// deriveDeepCopy_8 recursively copies the contents of src into dst.
+func deriveDeepCopy_8(dst, src []RedactionConfig) {
+	for src_i, src_value := range src {
+		func() {
+			field := new(RedactionConfig)
+			deriveDeepCopy_27(field, &src_value)
+			dst[src_i] = *field
+		}()
+	}
+}
+
+// deriveDeepCopy_9 recursively copies the contents of src into dst.
+func deriveDeepCopy_9(dst, src []SuppressionConfig) {
+	for src_i, src_value := range src {
+		func() {
+			field := new(SuppressionConfig)
+			deriveDeepCopy_28(field, &src_value)
+			dst[src_i] = *field
+		}()
+	}
+}
+
+// deriveDeepCopy_10 recursively copies the contents of src into dst.
+func deriveDeepCopy_10(dst, src []SamplingConfig) {
+	for src_i, src_value := range src {
+		func() {
+			field := new(SamplingConfig)
+			deriveDeepCopy_29(field, &src_value)
+			dst[src_i] = *field
+		}()
+	}
+}
+
+// deriveDeepCopy_11 recursively copies the contents of src into dst.
+func deriveDeepCopy_11(dst, src []LogMetricsConfig) {
+	for src_i, src_value := range src {
+		func() {
+			field := new(LogMetricsConfig)
+			deriveDeepCopy_30(field, &src_value)
+			dst[src_i] = *field
+		}()
+	}
+}
+
+// deriveDeepCopy_12 recursively copies the contents of src into dst.
+func deriveDeepCopy_12(dst, src *KafkaDestConfig) {
+	func() {
+		field := new(KafkaBaseConfig)
+		deriveDeepCopy_31(field, &src.KafkaBaseConfig)
+		dst.KafkaBaseConfig = *field
+	}()
 	dst.KafkaProducerBaseConfig = src.KafkaProducerBaseConfig
 	dst.TlsBaseConfig = src.TlsBaseConfig
 	dst.Insecure = src.Insecure
 	dst.Format = src.Format
 }
 
-// deriveDeepCopy_7 recursively copies the contents of src into dst.
-func deriveDeepCopy_7(dst, src *NATSDestConfig) {
+// deriveDeepCopy_13 recursively copies the contents of src into dst.
+func deriveDeepCopy_13(dst, src *UDPDestConfig) {
+	func() {
+		field := new(TcpUdpRelpDestBaseConfig)
+		deriveDeepCopy_32(field, &src.TcpUdpRelpDestBaseConfig)
+		dst.TcpUdpRelpDestBaseConfig = *field
+	}()
+	dst.TlsBaseConfig = src.TlsBaseConfig
+	dst.Insecure = src.Insecure
+	if src.TLSFingerprints == nil {
+		dst.TLSFingerprints = nil
+	} else {
+		if dst.TLSFingerprints != nil {
+			if len(src.TLSFingerprints) > len(dst.TLSFingerprints) {
+				if cap(dst.TLSFingerprints) >= len(src.TLSFingerprints) {
+					dst.TLSFingerprints = (dst.TLSFingerprints)[:len(src.TLSFingerprints)]
+				} else {
+					dst.TLSFingerprints = make([]string, len(src.TLSFingerprints))
+				}
+			} else if len(src.TLSFingerprints) < len(dst.TLSFingerprints) {
+				dst.TLSFingerprints = (dst.TLSFingerprints)[:len(src.TLSFingerprints)]
+			}
+		} else {
+			dst.TLSFingerprints = make([]string, len(src.TLSFingerprints))
+		}
+		copy(dst.TLSFingerprints, src.TLSFingerprints)
+	}
+}
+
+// deriveDeepCopy_14 recursively copies the contents of src into dst.
+func deriveDeepCopy_14(dst, src *TCPDestConfig) {
+	func() {
+		field := new(TcpUdpRelpDestBaseConfig)
+		deriveDeepCopy_32(field, &src.TcpUdpRelpDestBaseConfig)
+		dst.TcpUdpRelpDestBaseConfig = *field
+	}()
+	dst.TlsBaseConfig = src.TlsBaseConfig
+	dst.Insecure = src.Insecure
+	dst.KeepAlive = src.KeepAlive
+	dst.KeepAlivePeriod = src.KeepAlivePeriod
+	dst.ConnTimeout = src.ConnTimeout
+	dst.FlushPeriod = src.FlushPeriod
+	dst.LineFraming = src.LineFraming
+	dst.FrameDelimiter = src.FrameDelimiter
+	dst.Framing = src.Framing
+	if src.TLSFingerprints == nil {
+		dst.TLSFingerprints = nil
+	} else {
+		if dst.TLSFingerprints != nil {
+			if len(src.TLSFingerprints) > len(dst.TLSFingerprints) {
+				if cap(dst.TLSFingerprints) >= len(src.TLSFingerprints) {
+					dst.TLSFingerprints = (dst.TLSFingerprints)[:len(src.TLSFingerprints)]
+				} else {
+					dst.TLSFingerprints = make([]string, len(src.TLSFingerprints))
+				}
+			} else if len(src.TLSFingerprints) < len(dst.TLSFingerprints) {
+				dst.TLSFingerprints = (dst.TLSFingerprints)[:len(src.TLSFingerprints)]
+			}
+		} else {
+			dst.TLSFingerprints = make([]string, len(src.TLSFingerprints))
+		}
+		copy(dst.TLSFingerprints, src.TLSFingerprints)
+	}
+}
+
+// deriveDeepCopy_15 recursively copies the contents of src into dst.
+func deriveDeepCopy_15(dst, src *NATSDestConfig) {
 	dst.TlsBaseConfig = src.TlsBaseConfig
 	dst.Insecure = src.Insecure
 	if src.NServers == nil {
@@ -308,8 +570,43 @@ func deriveDeepCopy_7(dst, src *NATSDestConfig) {
 	dst.AllowReconnect = src.AllowReconnect
 }
 
-// deriveDeepCopy_8 recursively copies the contents of src into dst.
-func deriveDeepCopy_8(dst, src *ElasticDestConfig) {
+// deriveDeepCopy_16 recursively copies the contents of src into dst.
+func deriveDeepCopy_16(dst, src *RELPDestConfig) {
+	func() {
+		field := new(TcpUdpRelpDestBaseConfig)
+		deriveDeepCopy_32(field, &src.TcpUdpRelpDestBaseConfig)
+		dst.TcpUdpRelpDestBaseConfig = *field
+	}()
+	dst.TlsBaseConfig = src.TlsBaseConfig
+	dst.Insecure = src.Insecure
+	dst.KeepAlive = src.KeepAlive
+	dst.KeepAlivePeriod = src.KeepAlivePeriod
+	dst.ConnTimeout = src.ConnTimeout
+	dst.FlushPeriod = src.FlushPeriod
+	dst.WindowSize = src.WindowSize
+	dst.RelpTimeout = src.RelpTimeout
+	if src.TLSFingerprints == nil {
+		dst.TLSFingerprints = nil
+	} else {
+		if dst.TLSFingerprints != nil {
+			if len(src.TLSFingerprints) > len(dst.TLSFingerprints) {
+				if cap(dst.TLSFingerprints) >= len(src.TLSFingerprints) {
+					dst.TLSFingerprints = (dst.TLSFingerprints)[:len(src.TLSFingerprints)]
+				} else {
+					dst.TLSFingerprints = make([]string, len(src.TLSFingerprints))
+				}
+			} else if len(src.TLSFingerprints) < len(dst.TLSFingerprints) {
+				dst.TLSFingerprints = (dst.TLSFingerprints)[:len(src.TLSFingerprints)]
+			}
+		} else {
+			dst.TLSFingerprints = make([]string, len(src.TLSFingerprints))
+		}
+		copy(dst.TLSFingerprints, src.TLSFingerprints)
+	}
+}
+
+// deriveDeepCopy_17 recursively copies the contents of src into dst.
+func deriveDeepCopy_17(dst, src *ElasticDestConfig) {
 	dst.TlsBaseConfig = src.TlsBaseConfig
 	dst.Insecure = src.Insecure
 	dst.ProxyURL = src.ProxyURL
@@ -354,63 +651,130 @@ func deriveDeepCopy_8(dst, src *ElasticDestConfig) {
 	dst.NReplicas = src.NReplicas
 }
 
-// deriveDeepCopy_9 recursively copies the contents of src into dst.
-func deriveDeepCopy_9(dst, src *TCPSourceConfig) {
+// deriveDeepCopy_18 recursively copies the contents of src into dst.
+func deriveDeepCopy_18(dst, src map[string]string) {
+	for src_key, src_value := range src {
+		dst[src_key] = src_value
+	}
+}
+
+// deriveDeepCopy_19 recursively copies the contents of src into dst.
+func deriveDeepCopy_19(dst, src *TCPSourceConfig) {
 	dst.DecoderBaseConfig = src.DecoderBaseConfig
-	field := new(ListenersConfig)
-	deriveDeepCopy_16(field, &src.ListenersConfig)
-	dst.ListenersConfig = *field
+	func() {
+		field := new(ListenersConfig)
+		deriveDeepCopy_33(field, &src.ListenersConfig)
+		dst.ListenersConfig = *field
+	}()
 	dst.FilterSubConfig = src.FilterSubConfig
 	dst.TlsBaseConfig = src.TlsBaseConfig
+	func() {
+		field := new(AccessControlConfig)
+		deriveDeepCopy_34(field, &src.AccessControlConfig)
+		dst.AccessControlConfig = *field
+	}()
 	dst.ClientAuthType = src.ClientAuthType
 	dst.LineFraming = src.LineFraming
 	dst.FrameDelimiter = src.FrameDelimiter
+	dst.Framing = src.Framing
+	dst.MaxWindow = src.MaxWindow
 	dst.ConfID = src.ConfID
 }
 
-// deriveDeepCopy_10 recursively copies the contents of src into dst.
-func deriveDeepCopy_10(dst, src *UDPSourceConfig) {
+// deriveDeepCopy_20 recursively copies the contents of src into dst.
+func deriveDeepCopy_20(dst, src *UDPSourceConfig) {
 	dst.DecoderBaseConfig = src.DecoderBaseConfig
-	field := new(ListenersConfig)
-	deriveDeepCopy_16(field, &src.ListenersConfig)
-	dst.ListenersConfig = *field
+	func() {
+		field := new(ListenersConfig)
+		deriveDeepCopy_33(field, &src.ListenersConfig)
+		dst.ListenersConfig = *field
+	}()
 	dst.FilterSubConfig = src.FilterSubConfig
+	dst.TlsBaseConfig = src.TlsBaseConfig
+	func() {
+		field := new(AccessControlConfig)
+		deriveDeepCopy_34(field, &src.AccessControlConfig)
+		dst.AccessControlConfig = *field
+	}()
+	dst.ClientAuthType = src.ClientAuthType
+	dst.DTLSSessionTimeout = src.DTLSSessionTimeout
+	dst.PassCredentials = src.PassCredentials
 	dst.ConfID = src.ConfID
 }
 
-// deriveDeepCopy_11 recursively copies the contents of src into dst.
-func deriveDeepCopy_11(dst, src *RELPSourceConfig) {
+// deriveDeepCopy_21 recursively copies the contents of src into dst.
+func deriveDeepCopy_21(dst, src *RELPSourceConfig) {
 	dst.DecoderBaseConfig = src.DecoderBaseConfig
-	field := new(ListenersConfig)
-	deriveDeepCopy_16(field, &src.ListenersConfig)
-	dst.ListenersConfig = *field
+	func() {
+		field := new(ListenersConfig)
+		deriveDeepCopy_33(field, &src.ListenersConfig)
+		dst.ListenersConfig = *field
+	}()
 	dst.FilterSubConfig = src.FilterSubConfig
 	dst.TlsBaseConfig = src.TlsBaseConfig
+	func() {
+		field := new(AccessControlConfig)
+		deriveDeepCopy_34(field, &src.AccessControlConfig)
+		dst.AccessControlConfig = *field
+	}()
 	dst.ClientAuthType = src.ClientAuthType
 	dst.LineFraming = src.LineFraming
 	dst.FrameDelimiter = src.FrameDelimiter
+	dst.Framing = src.Framing
+	dst.MaxWindow = src.MaxWindow
 	dst.ConfID = src.ConfID
 }
 
-// deriveDeepCopy_12 recursively copies the contents of src into dst.
-func deriveDeepCopy_12(dst, src *DirectRELPSourceConfig) {
+// deriveDeepCopy_22 recursively copies the contents of src into dst.
+func deriveDeepCopy_22(dst, src *HTTPServerSourceConfig) {
+	dst.HTTPServerBaseConfig = src.HTTPServerBaseConfig
+	dst.DecoderBaseConfig = src.DecoderBaseConfig
+	dst.FilterSubConfig = src.FilterSubConfig
+	dst.ConfID = src.ConfID
+	dst.TlsBaseConfig = src.TlsBaseConfig
+	func() {
+		field := new(AccessControlConfig)
+		deriveDeepCopy_34(field, &src.AccessControlConfig)
+		dst.AccessControlConfig = *field
+	}()
+	dst.ClientAuthType = src.ClientAuthType
+	dst.Port = src.Port
+	dst.DisableMultiple = src.DisableMultiple
+	dst.FrameDelimiter = src.FrameDelimiter
+	dst.MaxBodySize = src.MaxBodySize
+	dst.MaxMessages = src.MaxMessages
+}
+
+// deriveDeepCopy_23 recursively copies the contents of src into dst.
+func deriveDeepCopy_23(dst, src *DirectRELPSourceConfig) {
 	dst.DecoderBaseConfig = src.DecoderBaseConfig
-	field := new(ListenersConfig)
-	deriveDeepCopy_16(field, &src.ListenersConfig)
-	dst.ListenersConfig = *field
+	func() {
+		field := new(ListenersConfig)
+		deriveDeepCopy_33(field, &src.ListenersConfig)
+		dst.ListenersConfig = *field
+	}()
 	dst.FilterSubConfig = src.FilterSubConfig
 	dst.TlsBaseConfig = src.TlsBaseConfig
+	func() {
+		field := new(AccessControlConfig)
+		deriveDeepCopy_34(field, &src.AccessControlConfig)
+		dst.AccessControlConfig = *field
+	}()
 	dst.ClientAuthType = src.ClientAuthType
 	dst.LineFraming = src.LineFraming
 	dst.FrameDelimiter = src.FrameDelimiter
+	dst.Framing = src.Framing
+	dst.MaxWindow = src.MaxWindow
 	dst.ConfID = src.ConfID
 }
 
-// deriveDeepCopy_13 recursively copies the contents of src into dst.
-func deriveDeepCopy_13(dst, src *KafkaSourceConfig) {
-	field := new(KafkaBaseConfig)
-	deriveDeepCopy_15(field, &src.KafkaBaseConfig)
-	dst.KafkaBaseConfig = *field
+// deriveDeepCopy_24 recursively copies the contents of src into dst.
+func deriveDeepCopy_24(dst, src *KafkaSourceConfig) {
+	func() {
+		field := new(KafkaBaseConfig)
+		deriveDeepCopy_31(field, &src.KafkaBaseConfig)
+		dst.KafkaBaseConfig = *field
+	}()
 	dst.KafkaConsumerBaseConfig = src.KafkaConsumerBaseConfig
 	dst.FilterSubConfig = src.FilterSubConfig
 	dst.TlsBaseConfig = src.TlsBaseConfig
@@ -441,18 +805,233 @@ func deriveDeepCopy_13(dst, src *KafkaSourceConfig) {
 	}
 }
 
-// deriveDeepCopy_14 recursively copies the contents of src into dst.
-func deriveDeepCopy_14(dst, src *GraylogSourceConfig) {
+// deriveDeepCopy_25 recursively copies the contents of src into dst.
+func deriveDeepCopy_25(dst, src *GraylogSourceConfig) {
 	dst.DecoderBaseConfig = src.DecoderBaseConfig
-	field := new(ListenersConfig)
-	deriveDeepCopy_16(field, &src.ListenersConfig)
-	dst.ListenersConfig = *field
+	func() {
+		field := new(ListenersConfig)
+		deriveDeepCopy_33(field, &src.ListenersConfig)
+		dst.ListenersConfig = *field
+	}()
 	dst.FilterSubConfig = src.FilterSubConfig
+	dst.TlsBaseConfig = src.TlsBaseConfig
+	dst.ClientAuthType = src.ClientAuthType
+	dst.Transport = src.Transport
 	dst.ConfID = src.ConfID
 }
 
-// deriveDeepCopy_15 recursively copies the contents of src into dst.
-func deriveDeepCopy_15(dst, src *KafkaBaseConfig) {
+// deriveDeepCopy_26 recursively copies the contents of src into dst.
+func deriveDeepCopy_26(dst, src *EnrichmentConfig) {
+	dst.Name = src.Name
+	dst.Namespace = src.Namespace
+	dst.LookupFile = src.LookupFile
+	dst.LookupKey = src.LookupKey
+	dst.GeoIPDatabase = src.GeoIPDatabase
+	if src.GeoIPProperties == nil {
+		dst.GeoIPProperties = nil
+	} else {
+		if dst.GeoIPProperties != nil {
+			if len(src.GeoIPProperties) > len(dst.GeoIPProperties) {
+				if cap(dst.GeoIPProperties) >= len(src.GeoIPProperties) {
+					dst.GeoIPProperties = (dst.GeoIPProperties)[:len(src.GeoIPProperties)]
+				} else {
+					dst.GeoIPProperties = make([]string, len(src.GeoIPProperties))
+				}
+			} else if len(src.GeoIPProperties) < len(dst.GeoIPProperties) {
+				dst.GeoIPProperties = (dst.GeoIPProperties)[:len(src.GeoIPProperties)]
+			}
+		} else {
+			dst.GeoIPProperties = make([]string, len(src.GeoIPProperties))
+		}
+		copy(dst.GeoIPProperties, src.GeoIPProperties)
+	}
+	dst.ReverseDNS = src.ReverseDNS
+	dst.ReverseDNSTTL = src.ReverseDNSTTL
+}
+
+// deriveDeepCopy_27 recursively copies the contents of src into dst.
+func deriveDeepCopy_27(dst, src *RedactionConfig) {
+	dst.Name = src.Name
+	if src.Detectors == nil {
+		dst.Detectors = nil
+	} else {
+		if dst.Detectors != nil {
+			if len(src.Detectors) > len(dst.Detectors) {
+				if cap(dst.Detectors) >= len(src.Detectors) {
+					dst.Detectors = (dst.Detectors)[:len(src.Detectors)]
+				} else {
+					dst.Detectors = make([]string, len(src.Detectors))
+				}
+			} else if len(src.Detectors) < len(dst.Detectors) {
+				dst.Detectors = (dst.Detectors)[:len(src.Detectors)]
+			}
+		} else {
+			dst.Detectors = make([]string, len(src.Detectors))
+		}
+		copy(dst.Detectors, src.Detectors)
+	}
+	if src.Rules == nil {
+		dst.Rules = nil
+	} else {
+		if dst.Rules != nil {
+			if len(src.Rules) > len(dst.Rules) {
+				if cap(dst.Rules) >= len(src.Rules) {
+					dst.Rules = (dst.Rules)[:len(src.Rules)]
+				} else {
+					dst.Rules = make([]RedactionRuleConfig, len(src.Rules))
+				}
+			} else if len(src.Rules) < len(dst.Rules) {
+				dst.Rules = (dst.Rules)[:len(src.Rules)]
+			}
+		} else {
+			dst.Rules = make([]RedactionRuleConfig, len(src.Rules))
+		}
+		copy(dst.Rules, src.Rules)
+	}
+	dst.Mode = src.Mode
+	dst.Mask = src.Mask
+	dst.HashKey = src.HashKey
+	if src.Fields == nil {
+		dst.Fields = nil
+	} else {
+		if dst.Fields != nil {
+			if len(src.Fields) > len(dst.Fields) {
+				if cap(dst.Fields) >= len(src.Fields) {
+					dst.Fields = (dst.Fields)[:len(src.Fields)]
+				} else {
+					dst.Fields = make([]string, len(src.Fields))
+				}
+			} else if len(src.Fields) < len(dst.Fields) {
+				dst.Fields = (dst.Fields)[:len(src.Fields)]
+			}
+		} else {
+			dst.Fields = make([]string, len(src.Fields))
+		}
+		copy(dst.Fields, src.Fields)
+	}
+	if src.Properties == nil {
+		dst.Properties = nil
+	} else {
+		if dst.Properties != nil {
+			if len(src.Properties) > len(dst.Properties) {
+				if cap(dst.Properties) >= len(src.Properties) {
+					dst.Properties = (dst.Properties)[:len(src.Properties)]
+				} else {
+					dst.Properties = make([]string, len(src.Properties))
+				}
+			} else if len(src.Properties) < len(dst.Properties) {
+				dst.Properties = (dst.Properties)[:len(src.Properties)]
+			}
+		} else {
+			dst.Properties = make([]string, len(src.Properties))
+		}
+		copy(dst.Properties, src.Properties)
+	}
+	if src.Destinations == nil {
+		dst.Destinations = nil
+	} else {
+		if dst.Destinations != nil {
+			if len(src.Destinations) > len(dst.Destinations) {
+				if cap(dst.Destinations) >= len(src.Destinations) {
+					dst.Destinations = (dst.Destinations)[:len(src.Destinations)]
+				} else {
+					dst.Destinations = make([]string, len(src.Destinations))
+				}
+			} else if len(src.Destinations) < len(dst.Destinations) {
+				dst.Destinations = (dst.Destinations)[:len(src.Destinations)]
+			}
+		} else {
+			dst.Destinations = make([]string, len(src.Destinations))
+		}
+		copy(dst.Destinations, src.Destinations)
+	}
+}
+
+// deriveDeepCopy_28 recursively copies the contents of src into dst.
+func deriveDeepCopy_28(dst, src *SuppressionConfig) {
+	dst.Name = src.Name
+	if src.Key == nil {
+		dst.Key = nil
+	} else {
+		if dst.Key != nil {
+			if len(src.Key) > len(dst.Key) {
+				if cap(dst.Key) >= len(src.Key) {
+					dst.Key = (dst.Key)[:len(src.Key)]
+				} else {
+					dst.Key = make([]string, len(src.Key))
+				}
+			} else if len(src.Key) < len(dst.Key) {
+				dst.Key = (dst.Key)[:len(src.Key)]
+			}
+		} else {
+			dst.Key = make([]string, len(src.Key))
+		}
+		copy(dst.Key, src.Key)
+	}
+	dst.Mode = src.Mode
+	dst.Window = src.Window
+	dst.Max = src.Max
+	dst.MaxKeys = src.MaxKeys
+}
+
+// deriveDeepCopy_29 recursively copies the contents of src into dst.
+func deriveDeepCopy_29(dst, src *SamplingConfig) {
+	dst.Name = src.Name
+	if src.Rules == nil {
+		dst.Rules = nil
+	} else {
+		if dst.Rules != nil {
+			if len(src.Rules) > len(dst.Rules) {
+				if cap(dst.Rules) >= len(src.Rules) {
+					dst.Rules = (dst.Rules)[:len(src.Rules)]
+				} else {
+					dst.Rules = make([]SamplingRuleConfig, len(src.Rules))
+				}
+			} else if len(src.Rules) < len(dst.Rules) {
+				dst.Rules = (dst.Rules)[:len(src.Rules)]
+			}
+		} else {
+			dst.Rules = make([]SamplingRuleConfig, len(src.Rules))
+		}
+		copy(dst.Rules, src.Rules)
+	}
+	dst.Key = src.Key
+	dst.StoreWatermark = src.StoreWatermark
+	dst.DestWatermark = src.DestWatermark
+	if src.ShedRate == nil {
+		dst.ShedRate = nil
+	} else {
+		dst.ShedRate = new(float64)
+		*dst.ShedRate = *src.ShedRate
+	}
+	dst.ShedSeverity = src.ShedSeverity
+}
+
+// deriveDeepCopy_30 recursively copies the contents of src into dst.
+func deriveDeepCopy_30(dst, src *LogMetricsConfig) {
+	dst.Name = src.Name
+	if src.Metrics == nil {
+		dst.Metrics = nil
+	} else {
+		if dst.Metrics != nil {
+			if len(src.Metrics) > len(dst.Metrics) {
+				if cap(dst.Metrics) >= len(src.Metrics) {
+					dst.Metrics = (dst.Metrics)[:len(src.Metrics)]
+				} else {
+					dst.Metrics = make([]LogMetricConfig, len(src.Metrics))
+				}
+			} else if len(src.Metrics) < len(dst.Metrics) {
+				dst.Metrics = (dst.Metrics)[:len(src.Metrics)]
+			}
+		} else {
+			dst.Metrics = make([]LogMetricConfig, len(src.Metrics))
+		}
+		deriveDeepCopy_35(dst.Metrics, src.Metrics)
+	}
+}
+
+// deriveDeepCopy_31 recursively copies the contents of src into dst.
+func deriveDeepCopy_31(dst, src *KafkaBaseConfig) {
 	if src.Brokers == nil {
 		dst.Brokers = nil
 	} else {
@@ -484,8 +1063,38 @@ func deriveDeepCopy_15(dst, src *KafkaBaseConfig) {
 	dst.MetadataRefreshFrequency = src.MetadataRefreshFrequency
 }
 
-// deriveDeepCopy_16 recursively copies the contents of src into dst.
-func deriveDeepCopy_16(dst, src *ListenersConfig) {
+// deriveDeepCopy_32 recursively copies the contents of src into dst.
+func deriveDeepCopy_32(dst, src *TcpUdpRelpDestBaseConfig) {
+	dst.Host = src.Host
+	dst.Port = src.Port
+	if src.Hosts == nil {
+		dst.Hosts = nil
+	} else {
+		if dst.Hosts != nil {
+			if len(src.Hosts) > len(dst.Hosts) {
+				if cap(dst.Hosts) >= len(src.Hosts) {
+					dst.Hosts = (dst.Hosts)[:len(src.Hosts)]
+				} else {
+					dst.Hosts = make([]string, len(src.Hosts))
+				}
+			} else if len(src.Hosts) < len(dst.Hosts) {
+				dst.Hosts = (dst.Hosts)[:len(src.Hosts)]
+			}
+		} else {
+			dst.Hosts = make([]string, len(src.Hosts))
+		}
+		copy(dst.Hosts, src.Hosts)
+	}
+	dst.Strategy = src.Strategy
+	dst.HashKeyTmpl = src.HashKeyTmpl
+	dst.ProbeInterval = src.ProbeInterval
+	dst.UnixSocketPath = src.UnixSocketPath
+	dst.Rebind = src.Rebind
+	dst.Format = src.Format
+}
+
+// deriveDeepCopy_33 recursively copies the contents of src into dst.
+func deriveDeepCopy_33(dst, src *ListenersConfig) {
 	if src.Ports == nil {
 		dst.Ports = nil
 	} else {
@@ -509,4 +1118,148 @@ func deriveDeepCopy_16(dst, src *ListenersConfig) {
 	dst.KeepAlive = src.KeepAlive
 	dst.KeepAlivePeriod = src.KeepAlivePeriod
 	dst.Timeout = src.Timeout
+	dst.ProxyProtocol = src.ProxyProtocol
+}
+
+// deriveDeepCopy_34 recursively copies the contents of src into dst.
+func deriveDeepCopy_34(dst, src *AccessControlConfig) {
+	if src.AllowFrom == nil {
+		dst.AllowFrom = nil
+	} else {
+		if dst.AllowFrom != nil {
+			if len(src.AllowFrom) > len(dst.AllowFrom) {
+				if cap(dst.AllowFrom) >= len(src.AllowFrom) {
+					dst.AllowFrom = (dst.AllowFrom)[:len(src.AllowFrom)]
+				} else {
+					dst.AllowFrom = make([]string, len(src.AllowFrom))
+				}
+			} else if len(src.AllowFrom) < len(dst.AllowFrom) {
+				dst.AllowFrom = (dst.AllowFrom)[:len(src.AllowFrom)]
+			}
+		} else {
+			dst.AllowFrom = make([]string, len(src.AllowFrom))
+		}
+		copy(dst.AllowFrom, src.AllowFrom)
+	}
+	if src.DenyFrom == nil {
+		dst.DenyFrom = nil
+	} else {
+		if dst.DenyFrom != nil {
+			if len(src.DenyFrom) > len(dst.DenyFrom) {
+				if cap(dst.DenyFrom) >= len(src.DenyFrom) {
+					dst.DenyFrom = (dst.DenyFrom)[:len(src.DenyFrom)]
+				} else {
+					dst.DenyFrom = make([]string, len(src.DenyFrom))
+				}
+			} else if len(src.DenyFrom) < len(dst.DenyFrom) {
+				dst.DenyFrom = (dst.DenyFrom)[:len(src.DenyFrom)]
+			}
+		} else {
+			dst.DenyFrom = make([]string, len(src.DenyFrom))
+		}
+		copy(dst.DenyFrom, src.DenyFrom)
+	}
+	if src.TLSAllowedSubjects == nil {
+		dst.TLSAllowedSubjects = nil
+	} else {
+		if dst.TLSAllowedSubjects != nil {
+			if len(src.TLSAllowedSubjects) > len(dst.TLSAllowedSubjects) {
+				if cap(dst.TLSAllowedSubjects) >= len(src.TLSAllowedSubjects) {
+					dst.TLSAllowedSubjects = (dst.TLSAllowedSubjects)[:len(src.TLSAllowedSubjects)]
+				} else {
+					dst.TLSAllowedSubjects = make([]string, len(src.TLSAllowedSubjects))
+				}
+			} else if len(src.TLSAllowedSubjects) < len(dst.TLSAllowedSubjects) {
+				dst.TLSAllowedSubjects = (dst.TLSAllowedSubjects)[:len(src.TLSAllowedSubjects)]
+			}
+		} else {
+			dst.TLSAllowedSubjects = make([]string, len(src.TLSAllowedSubjects))
+		}
+		copy(dst.TLSAllowedSubjects, src.TLSAllowedSubjects)
+	}
+	if src.TLSAllowedSANs == nil {
+		dst.TLSAllowedSANs = nil
+	} else {
+		if dst.TLSAllowedSANs != nil {
+			if len(src.TLSAllowedSANs) > len(dst.TLSAllowedSANs) {
+				if cap(dst.TLSAllowedSANs) >= len(src.TLSAllowedSANs) {
+					dst.TLSAllowedSANs = (dst.TLSAllowedSANs)[:len(src.TLSAllowedSANs)]
+				} else {
+					dst.TLSAllowedSANs = make([]string, len(src.TLSAllowedSANs))
+				}
+			} else if len(src.TLSAllowedSANs) < len(dst.TLSAllowedSANs) {
+				dst.TLSAllowedSANs = (dst.TLSAllowedSANs)[:len(src.TLSAllowedSANs)]
+			}
+		} else {
+			dst.TLSAllowedSANs = make([]string, len(src.TLSAllowedSANs))
+		}
+		copy(dst.TLSAllowedSANs, src.TLSAllowedSANs)
+	}
+	dst.RateLimitMessages = src.RateLimitMessages
+	dst.RateLimitBytes = src.RateLimitBytes
+	dst.RateLimitAction = src.RateLimitAction
+	if src.TLSFingerprints == nil {
+		dst.TLSFingerprints = nil
+	} else {
+		if dst.TLSFingerprints != nil {
+			if len(src.TLSFingerprints) > len(dst.TLSFingerprints) {
+				if cap(dst.TLSFingerprints) >= len(src.TLSFingerprints) {
+					dst.TLSFingerprints = (dst.TLSFingerprints)[:len(src.TLSFingerprints)]
+				} else {
+					dst.TLSFingerprints = make([]string, len(src.TLSFingerprints))
+				}
+			} else if len(src.TLSFingerprints) < len(dst.TLSFingerprints) {
+				dst.TLSFingerprints = (dst.TLSFingerprints)[:len(src.TLSFingerprints)]
+			}
+		} else {
+			dst.TLSFingerprints = make([]string, len(src.TLSFingerprints))
+		}
+		copy(dst.TLSFingerprints, src.TLSFingerprints)
+	}
+}
+
+// deriveDeepCopy_35 recursively copies the contents of src into dst.
+func deriveDeepCopy_35(dst, src []LogMetricConfig) {
+	for src_i, src_value := range src {
+		func() {
+			field := new(LogMetricConfig)
+			deriveDeepCopy_36(field, &src_value)
+			dst[src_i] = *field
+		}()
+	}
+}
+
+// deriveDeepCopy_36 recursively copies the contents of src into dst.
+func deriveDeepCopy_36(dst, src *LogMetricConfig) {
+	dst.Name = src.Name
+	dst.Help = src.Help
+	dst.Type = src.Type
+	dst.Match = src.Match
+	dst.Regexp = src.Regexp
+	dst.Value = src.Value
+	if src.Labels != nil {
+		dst.Labels = make(map[string]string, len(src.Labels))
+		deriveDeepCopy_18(dst.Labels, src.Labels)
+	} else {
+		dst.Labels = nil
+	}
+	if src.Buckets == nil {
+		dst.Buckets = nil
+	} else {
+		if dst.Buckets != nil {
+			if len(src.Buckets) > len(dst.Buckets) {
+				if cap(dst.Buckets) >= len(src.Buckets) {
+					dst.Buckets = (dst.Buckets)[:len(src.Buckets)]
+				} else {
+					dst.Buckets = make([]float64, len(src.Buckets))
+				}
+			} else if len(src.Buckets) < len(dst.Buckets) {
+				dst.Buckets = (dst.Buckets)[:len(src.Buckets)]
+			}
+		} else {
+			dst.Buckets = make([]float64, len(src.Buckets))
+		}
+		copy(dst.Buckets, src.Buckets)
+	}
+	dst.MaxSeries = src.MaxSeries
 }
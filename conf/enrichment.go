@@ -0,0 +1,151 @@
+package conf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stephane-martin/skewer/expr/syntax"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// SplitProperty splits the name of a property, "domain.key". The key may
+// contain dots.
+func SplitProperty(s string) (domain string, key string, err error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexByte(s, '.')
+	if i <= 0 || i == len(s)-1 {
+		return "", "", eerrors.Errorf("Invalid property '%s', the format is 'domain.key'", s)
+	}
+	return s[:i], s[i+1:], nil
+}
+
+// complete checks the enrichment configuration and sets the default values.
+func (c *EnrichmentConfig) complete() (err error) {
+	c.Name = strings.TrimSpace(c.Name)
+	if len(c.Name) == 0 {
+		return eerrors.New("Empty enrichment name")
+	}
+	c.Namespace = strings.TrimSpace(c.Namespace)
+	if len(c.Namespace) == 0 {
+		c.Namespace = "enrich"
+	}
+	c.LookupFile = strings.TrimSpace(c.LookupFile)
+	c.GeoIPDatabase = strings.TrimSpace(c.GeoIPDatabase)
+
+	if len(c.LookupFile) > 0 {
+		switch strings.ToLower(path.Ext(c.LookupFile)) {
+		case ".csv", ".json":
+		default:
+			return eerrors.Errorf("The lookup file '%s' must be a .csv or a .json file", c.LookupFile)
+		}
+		_, err = LookupName(c.LookupFile)
+		if err != nil {
+			return err
+		}
+		if len(strings.TrimSpace(c.LookupKey)) == 0 {
+			c.LookupKey = "hostname"
+		}
+		_, err = syntax.Check(c.LookupKey, syntax.String)
+		if err != nil {
+			return eerrors.Wrap(err, "Invalid lookup_key")
+		}
+	}
+
+	if len(c.GeoIPDatabase) > 0 {
+		_, err = LookupName(c.GeoIPDatabase)
+		if err != nil {
+			return err
+		}
+		if len(c.GeoIPProperties) == 0 {
+			return eerrors.New("geoip_database requires geoip_properties")
+		}
+	} else if len(c.GeoIPProperties) > 0 {
+		return eerrors.New("geoip_properties requires geoip_database")
+	}
+	for _, prop := range c.GeoIPProperties {
+		_, _, err = SplitProperty(prop)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.ReverseDNSTTL <= 0 {
+		c.ReverseDNSTTL = 10 * time.Minute
+	}
+	return nil
+}
+
+// Enrichment returns the enrichment configuration called name.
+func (c *BaseConfig) Enrichment(name string) (EnrichmentConfig, bool) {
+	for _, enrichConf := range c.Enrichments {
+		if enrichConf.Name == name {
+			return enrichConf, true
+		}
+	}
+	return EnrichmentConfig{}, false
+}
+
+// LoadLookups checks that the lookup tables and the GeoIP databases of the
+// enrichments can be read from the configuration directory. The Store reads
+// the files itself: Lookups only holds a digest of their content, so that
+// their changes are noticed.
+func (c *BaseConfig) LoadLookups(confDir string) error {
+	dir, err := filepath.Abs(confDir)
+	if err != nil {
+		return confCheckError(err)
+	}
+	c.LookupDir = dir
+	c.Lookups = make(map[string]string)
+	for _, enrichConf := range c.Enrichments {
+		for _, p := range []string{enrichConf.LookupFile, enrichConf.GeoIPDatabase} {
+			if len(p) == 0 {
+				continue
+			}
+			name, err := LookupName(p)
+			if err != nil {
+				return confCheckError(err)
+			}
+			if _, ok := c.Lookups[name]; ok {
+				continue
+			}
+			digest, err := fileDigest(filepath.Join(dir, filepath.FromSlash(name)))
+			if err != nil {
+				return confCheckError(eerrors.Wrapf(err, "Error reading lookup file '%s'", name))
+			}
+			c.Lookups[name] = digest
+		}
+	}
+	return nil
+}
+
+// fileDigest returns the SHA256 of the content of the file p.
+func fileDigest(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LookupFiles returns the paths of the lookup files that were loaded.
+func (c *BaseConfig) LookupFiles(confDir string) []string {
+	files := make([]string, 0, len(c.Lookups))
+	for name := range c.Lookups {
+		files = append(files, filepath.Join(confDir, filepath.FromSlash(name)))
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,63 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrichmentComplete(t *testing.T) {
+	testComplete(t, []completeTest{
+		{"defaults", &EnrichmentConfig{Name: "a", LookupFile: "hosts.csv"}, false},
+		{"no name", &EnrichmentConfig{LookupFile: "hosts.csv"}, true},
+		{"format", &EnrichmentConfig{Name: "a", LookupFile: "hosts.txt"}, true},
+		{"outside", &EnrichmentConfig{Name: "a", LookupFile: "../hosts.csv"}, true},
+		{"key", &EnrichmentConfig{Name: "a", LookupFile: "hosts.json", LookupKey: "lower(app_name)"}, false},
+		{"bad key", &EnrichmentConfig{Name: "a", LookupFile: "hosts.json", LookupKey: "severity"}, true},
+		{"geoip", &EnrichmentConfig{Name: "a", GeoIPDatabase: "GeoLite2-ASN.mmdb", GeoIPProperties: []string{"nginx.remote_addr"}}, false},
+		{"geoip props", &EnrichmentConfig{Name: "a", GeoIPDatabase: "GeoLite2-ASN.mmdb"}, true},
+		{"geoip db", &EnrichmentConfig{Name: "a", GeoIPProperties: []string{"nginx.remote_addr"}}, true},
+		{"bad prop", &EnrichmentConfig{Name: "a", GeoIPDatabase: "a.mmdb", GeoIPProperties: []string{"remote_addr"}}, true},
+	}, func(t *testing.T, config completer) {
+		c := config.(*EnrichmentConfig)
+		assert.Equal(t, "enrich", c.Namespace)
+		assert.Equal(t, 10*time.Minute, c.ReverseDNSTTL)
+		if c.LookupFile != "" {
+			assert.NotEmpty(t, c.LookupKey)
+		}
+	})
+
+	c := EnrichmentConfig{Name: "a", LookupFile: "hosts.csv"}
+	assert.NoError(t, c.complete())
+	assert.Equal(t, "hostname", c.LookupKey)
+}
+
+func TestLoadLookups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-lookups")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	_ = os.MkdirAll(filepath.Join(dir, "geoip"), 0755)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "hosts.csv"), []byte("host,team\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "geoip", "asn.mmdb"), []byte{0xab, 0xcd, 0xef}, 0644))
+
+	c := NewBaseConf()
+	c.Enrichments = []EnrichmentConfig{
+		{Name: "a", LookupFile: "hosts.csv", GeoIPDatabase: "geoip/asn.mmdb"},
+		{Name: "b", LookupFile: "./hosts.csv"},
+	}
+	assert.NoError(t, c.LoadLookups(dir))
+	assert.Len(t, c.Lookups, 2)
+	// the files are read by the Store, the configuration only has digests
+	assert.Equal(t, "995da3cf545787d65f9ced52674e92ee8171c87c7a4008aa4349ec47d21609a7", c.Lookups["geoip/asn.mmdb"])
+	assert.Equal(t, dir, c.LookupDir)
+	assert.Equal(t, []string{filepath.Join(dir, "geoip", "asn.mmdb"), filepath.Join(dir, "hosts.csv")}, c.LookupFiles(dir))
+
+	c.Enrichments[1].LookupFile = "missing.csv"
+	assert.Error(t, c.LoadLookups(dir))
+}
@@ -0,0 +1,62 @@
+package conf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFraming(t *testing.T) {
+	tests := []struct {
+		framing     string
+		lineFraming bool
+		expected    string
+	}{
+		{"", false, "auto"},
+		{"", true, "lf"},
+		{"octet", true, "octet"},
+		{" LF ", false, "lf"},
+		{"auto", true, "auto"},
+	}
+	for _, tt := range tests {
+		c := TCPSourceConfig{Framing: tt.framing, LineFraming: tt.lineFraming}
+		assert.Equal(t, tt.expected, c.GetFraming(), "framing: '%s', line_framing: %v", tt.framing, tt.lineFraming)
+	}
+}
+
+func TestGetLineFraming(t *testing.T) {
+	tests := []struct {
+		framing     string
+		lineFraming bool
+		tls         bool
+		expected    bool
+	}{
+		{"", true, false, true},
+		{"", false, false, false},
+		{"", true, true, true},
+		{"lf", false, true, true},
+		{"octet", true, false, false},
+		{"auto", true, false, true},
+		{"auto", true, true, false},
+		{"Auto", false, false, false},
+	}
+	for _, tt := range tests {
+		c := TCPDestConfig{Framing: tt.framing, LineFraming: tt.lineFraming}
+		c.TLSEnabled = tt.tls
+		assert.Equal(t, tt.expected, c.GetLineFraming(), "framing: '%s', line_framing: %v, tls: %v", tt.framing, tt.lineFraming, tt.tls)
+	}
+}
+
+func TestCheckFraming(t *testing.T) {
+	for _, framing := range []string{"", "auto", "octet", "LF"} {
+		assert.NoError(t, checkFraming(framing), framing)
+	}
+	assert.Error(t, checkFraming("crlf"))
+
+	for _, framing := range []string{"", "auto"} {
+		assert.NoError(t, checkRELPFraming(framing), framing)
+	}
+	for _, framing := range []string{"lf", "octet", "crlf"} {
+		assert.Error(t, checkRELPFraming(framing), framing)
+	}
+}
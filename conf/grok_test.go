@@ -0,0 +1,45 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadGrokPatterns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-grok")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	_ = os.MkdirAll(filepath.Join(dir, "grok"), 0755)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "grok", "app.grok"), []byte("APPID [a-z]+-[0-9]+\n"), 0644))
+
+	decodr := DecoderBaseConfig{
+		Format:           "grok",
+		GrokPattern:      "%{APPID:app}",
+		GrokPatternsFile: "./grok/app.grok",
+	}
+	assert.NoError(t, decodr.completeGrok())
+	assert.Equal(t, "grok/app.grok", decodr.GrokPatternsFile)
+
+	c := NewBaseConf()
+	c.TCPSource = []TCPSourceConfig{{DecoderBaseConfig: decodr}}
+	assert.NoError(t, c.LoadGrokPatterns(dir))
+	assert.Contains(t, c.TCPSource[0].GrokPatterns, "APPID")
+
+	decodr.GrokPatternsFile = "../app.grok"
+	assert.Error(t, decodr.completeGrok())
+	decodr.GrokPatternsFile = "/etc/app.grok"
+	assert.Error(t, decodr.completeGrok())
+
+	c.TCPSource[0].GrokPatterns = ""
+	c.TCPSource[0].GrokPatternsFile = "missing.grok"
+	assert.Error(t, c.LoadGrokPatterns(dir))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "bad.grok"), []byte("OTHER [a-z]+\n"), 0644))
+	c.TCPSource[0].GrokPatternsFile = "bad.grok"
+	assert.Error(t, c.LoadGrokPatterns(dir))
+}
@@ -0,0 +1,115 @@
+package conf
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/stephane-martin/skewer/expr/syntax"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+var metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// complete checks the log metrics configuration and sets the default values.
+func (c *LogMetricsConfig) complete() (err error) {
+	c.Name = strings.TrimSpace(c.Name)
+	if len(c.Name) == 0 {
+		return eerrors.New("Empty log_metrics name")
+	}
+	if len(c.Metrics) == 0 {
+		return eerrors.Errorf("The log_metrics '%s' has no metric", c.Name)
+	}
+	for i := range c.Metrics {
+		err = c.Metrics[i].complete()
+		if err != nil {
+			return eerrors.Wrapf(err, "Invalid metric in the log_metrics '%s'", c.Name)
+		}
+	}
+	return nil
+}
+
+func (c *LogMetricConfig) complete() (err error) {
+	c.Name = strings.TrimSpace(c.Name)
+	if !metricNameRe.MatchString(c.Name) {
+		return eerrors.Errorf("Invalid metric name '%s'", c.Name)
+	}
+	if strings.HasPrefix(c.Name, "skw_") {
+		return eerrors.Errorf("The metric name '%s' uses the reserved prefix skw_", c.Name)
+	}
+	if len(c.Help) == 0 {
+		c.Help = "Metric derived from the log messages"
+	}
+	c.Type = strings.ToLower(strings.TrimSpace(c.Type))
+	if len(c.Type) == 0 {
+		c.Type = "counter"
+	}
+	if c.Type != "counter" && c.Type != "histogram" {
+		return eerrors.Errorf("Unknown type '%s' for the metric '%s'", c.Type, c.Name)
+	}
+	if len(strings.TrimSpace(c.Match)) > 0 {
+		_, err = syntax.Check(c.Match, syntax.Bool)
+		if err != nil {
+			return eerrors.Wrapf(err, "Invalid match for the metric '%s'", c.Name)
+		}
+	}
+	var groups []string
+	if len(c.Regexp) > 0 {
+		var re *regexp.Regexp
+		re, err = regexp.Compile(c.Regexp)
+		if err != nil {
+			return eerrors.Wrapf(err, "Invalid regexp for the metric '%s'", c.Name)
+		}
+		groups = re.SubexpNames()
+	}
+	hasGroup := func(name string) bool {
+		for _, g := range groups {
+			if g == name {
+				return true
+			}
+		}
+		return false
+	}
+	if len(strings.TrimSpace(c.Value)) > 0 {
+		_, err = syntax.Check(c.Value, syntax.Number, syntax.String)
+		if err != nil {
+			return eerrors.Wrapf(err, "Invalid value for the metric '%s'", c.Name)
+		}
+	} else if c.Type == "histogram" && !hasGroup("value") {
+		return eerrors.Errorf("The histogram '%s' needs a value, or a regexp with a value group", c.Name)
+	}
+	for name, value := range c.Labels {
+		if !labelNameRe.MatchString(name) || strings.HasPrefix(name, "__") || name == "destination" {
+			return eerrors.Errorf("Invalid label name '%s' for the metric '%s'", name, c.Name)
+		}
+		if strings.HasPrefix(value, "$") {
+			if !hasGroup(value[1:]) {
+				return eerrors.Errorf("The regexp of the metric '%s' has no group '%s'", c.Name, value[1:])
+			}
+			continue
+		}
+		_, err = syntax.Check(value, syntax.String, syntax.Number, syntax.Bool)
+		if err != nil {
+			return eerrors.Wrapf(err, "Invalid label '%s' for the metric '%s'", name, c.Name)
+		}
+	}
+	for i := 1; i < len(c.Buckets); i++ {
+		if c.Buckets[i] <= c.Buckets[i-1] {
+			return eerrors.Errorf("The buckets of the histogram '%s' are not in increasing order", c.Name)
+		}
+	}
+	if c.MaxSeries <= 0 {
+		c.MaxSeries = 1000
+	}
+	return nil
+}
+
+// LogMetricsSet returns the log metrics configuration called name.
+func (c *BaseConfig) LogMetricsSet(name string) (LogMetricsConfig, bool) {
+	for _, metricsConf := range c.LogMetrics {
+		if metricsConf.Name == name {
+			return metricsConf, true
+		}
+	}
+	return LogMetricsConfig{}, false
+}
@@ -0,0 +1,54 @@
+package conf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogMetricComplete(t *testing.T) {
+	testComplete(t, []completeTest{
+		{"defaults", &LogMetricConfig{Name: "log_errors_total"}, false},
+		{"name", &LogMetricConfig{Name: "log-errors"}, true},
+		{"reserved", &LogMetricConfig{Name: "skw_errors"}, true},
+		{"type", &LogMetricConfig{Name: "a", Type: "gauge"}, true},
+		{"match", &LogMetricConfig{Name: "a", Match: `severity <= "err"`}, false},
+		{"bad match", &LogMetricConfig{Name: "a", Match: "hostname"}, true},
+		{"regexp", &LogMetricConfig{Name: "a", Regexp: "("}, true},
+		{"histogram", &LogMetricConfig{Name: "a", Type: "histogram", Value: "num(props.nginx.request_time)"}, false},
+		{"histogram group", &LogMetricConfig{Name: "a", Type: "histogram", Regexp: `took (?P<value>\d+)ms`}, false},
+		{"histogram value", &LogMetricConfig{Name: "a", Type: "histogram"}, true},
+		{"buckets", &LogMetricConfig{Name: "a", Type: "histogram", Value: "1", Buckets: []float64{1, 1, 2}}, true},
+		{"labels", &LogMetricConfig{Name: "a", Labels: map[string]string{"app": "app_name", "team": "props.enrich.team"}}, false},
+		{"label group", &LogMetricConfig{Name: "a", Regexp: `status=(?P<status>\d+)`, Labels: map[string]string{"status": "$status"}}, false},
+		{"missing group", &LogMetricConfig{Name: "a", Regexp: `status=(\d+)`, Labels: map[string]string{"status": "$status"}}, true},
+		{"label name", &LogMetricConfig{Name: "a", Labels: map[string]string{"destination": "hostname"}}, true},
+		{"label expression", &LogMetricConfig{Name: "a", Labels: map[string]string{"app": "app_name +"}}, true},
+	}, func(t *testing.T, config completer) {
+		c := config.(*LogMetricConfig)
+		assert.NotEmpty(t, c.Help)
+		assert.NotEmpty(t, c.Type)
+		assert.Equal(t, 1000, c.MaxSeries)
+	})
+}
+
+func TestLogMetricsComplete(t *testing.T) {
+	c := LogMetricsConfig{Name: "web"}
+	assert.Error(t, c.complete())
+	c.Metrics = []LogMetricConfig{{Name: "a"}, {Name: "b", Type: "histogram"}}
+	assert.Error(t, c.complete())
+	c.Metrics[1].Value = "len(message)"
+	assert.NoError(t, c.complete())
+}
+
+func TestDirectRELPLogMetrics(t *testing.T) {
+	c, err := Default()
+	if !assert.NoError(t, err) {
+		return
+	}
+	c.LogMetrics = []LogMetricsConfig{{Name: "a", Metrics: []LogMetricConfig{{Name: "log_errors_total"}}}}
+	c.DirectRELPSource = []DirectRELPSourceConfig{{}}
+	assert.NoError(t, c.Complete(nil))
+	c.DirectRELPSource[0].LogMetrics = "a"
+	assert.Error(t, c.Complete(nil))
+}
@@ -0,0 +1,121 @@
+package conf
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// RedactionDetectors are the names of the builtin detectors of the
+// redactions.
+var RedactionDetectors = []string{"email", "ip", "credit_card", "token"}
+
+func isRedactionMode(mode string) bool {
+	switch mode {
+	case "mask", "hash", "drop":
+		return true
+	default:
+		return false
+	}
+}
+
+// complete checks the redaction configuration and sets the default values.
+func (c *RedactionConfig) complete() (err error) {
+	c.Name = strings.TrimSpace(c.Name)
+	if len(c.Name) == 0 {
+		return eerrors.New("Empty redaction name")
+	}
+	c.Mode = strings.ToLower(strings.TrimSpace(c.Mode))
+	if len(c.Mode) == 0 {
+		c.Mode = "mask"
+	}
+	if !isRedactionMode(c.Mode) {
+		return eerrors.Errorf("Unknown redaction mode '%s'", c.Mode)
+	}
+	if len(c.Mask) == 0 {
+		c.Mask = "[REDACTED]"
+	}
+	if len(c.Detectors) == 0 && len(c.Rules) == 0 {
+		return eerrors.Errorf("The redaction '%s' has no detector and no rule", c.Name)
+	}
+
+	hashed := c.Mode == "hash"
+	for i, detector := range c.Detectors {
+		detector = strings.ToLower(strings.TrimSpace(detector))
+		known := false
+		for _, d := range RedactionDetectors {
+			known = known || d == detector
+		}
+		if !known {
+			return eerrors.Errorf("Unknown redaction detector '%s'", detector)
+		}
+		c.Detectors[i] = detector
+	}
+	for i := range c.Rules {
+		rule := &(c.Rules[i])
+		rule.Name = strings.TrimSpace(rule.Name)
+		if len(rule.Name) == 0 {
+			return eerrors.New("Empty redaction rule name")
+		}
+		_, err = regexp.Compile(rule.Regexp)
+		if err != nil {
+			return eerrors.Wrapf(err, "Invalid regexp for the redaction rule '%s'", rule.Name)
+		}
+		rule.Mode = strings.ToLower(strings.TrimSpace(rule.Mode))
+		if len(rule.Mode) > 0 && !isRedactionMode(rule.Mode) {
+			return eerrors.Errorf("Unknown redaction mode '%s'", rule.Mode)
+		}
+		hashed = hashed || rule.Mode == "hash"
+	}
+	if hashed && len(c.HashKey) == 0 {
+		return eerrors.Errorf("The redaction '%s' needs a hash_key", c.Name)
+	}
+
+	if c.Fields == nil {
+		c.Fields = []string{"message", "structured"}
+	}
+	for i, field := range c.Fields {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field != "message" && field != "structured" {
+			return eerrors.Errorf("Unknown redaction field '%s'", field)
+		}
+		c.Fields[i] = field
+	}
+	for _, prop := range c.Properties {
+		_, _, err = SplitProperty(prop)
+		if err != nil {
+			return err
+		}
+	}
+	for _, dest := range c.Destinations {
+		if _, ok := Destinations[strings.ToLower(strings.TrimSpace(dest))]; !ok {
+			return eerrors.Errorf("Unknown destination '%s' for the redaction '%s'", dest, c.Name)
+		}
+	}
+	return nil
+}
+
+// Redaction returns the redaction configuration called name.
+func (c *BaseConfig) Redaction(name string) (RedactionConfig, bool) {
+	for _, redactConf := range c.Redactions {
+		if redactConf.Name == name {
+			return redactConf, true
+		}
+	}
+	return RedactionConfig{}, false
+}
+
+// DestinationRedactions returns the redactions that apply to the messages sent
+// to dest.
+func (c *BaseConfig) DestinationRedactions(dest DestinationType) (redactions []RedactionConfig) {
+	for _, redactConf := range c.Redactions {
+		for _, name := range redactConf.Destinations {
+			if Destinations[strings.ToLower(strings.TrimSpace(name))] == dest {
+				redactions = append(redactions, redactConf)
+				break
+			}
+		}
+	}
+	return redactions
+}
@@ -0,0 +1,58 @@
+package conf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactionComplete(t *testing.T) {
+	rule := func(name, re, mode string) []RedactionRuleConfig {
+		return []RedactionRuleConfig{{Name: name, Regexp: re, Mode: mode}}
+	}
+	testComplete(t, []completeTest{
+		{"defaults", &RedactionConfig{Name: "a", Detectors: []string{"Email", "ip"}}, false},
+		{"no name", &RedactionConfig{Detectors: []string{"email"}}, true},
+		{"nothing", &RedactionConfig{Name: "a"}, true},
+		{"detector", &RedactionConfig{Name: "a", Detectors: []string{"phone"}}, true},
+		{"mode", &RedactionConfig{Name: "a", Detectors: []string{"email"}, Mode: "erase"}, true},
+		{"hash key", &RedactionConfig{Name: "a", Detectors: []string{"email"}, Mode: "hash"}, true},
+		{"rule hash key", &RedactionConfig{Name: "a", Rules: rule("r", "x", "hash")}, true},
+		{"rule", &RedactionConfig{Name: "a", Rules: rule("r", `id=(\d+)`, "drop")}, false},
+		{"rule name", &RedactionConfig{Name: "a", Rules: rule("", "x", "")}, true},
+		{"rule regexp", &RedactionConfig{Name: "a", Rules: rule("r", "(", "")}, true},
+		{"field", &RedactionConfig{Name: "a", Detectors: []string{"ip"}, Fields: []string{"hostname"}}, true},
+		{"property", &RedactionConfig{Name: "a", Detectors: []string{"ip"}, Properties: []string{"nginx"}}, true},
+		{"destination", &RedactionConfig{Name: "a", Detectors: []string{"ip"}, Destinations: []string{"elasticsearch"}}, false},
+		{"bad destination", &RedactionConfig{Name: "a", Detectors: []string{"ip"}, Destinations: []string{"nowhere"}}, true},
+	}, func(t *testing.T, config completer) {
+		c := config.(*RedactionConfig)
+		assert.Equal(t, "[REDACTED]", c.Mask)
+		assert.NotEmpty(t, c.Mode)
+		assert.Equal(t, []string{"message", "structured"}, c.Fields)
+	})
+}
+
+func TestDestinationRedactions(t *testing.T) {
+	c := NewBaseConf()
+	c.Redactions = []RedactionConfig{
+		{Name: "a", Destinations: []string{"elasticsearch", "kafka"}},
+		{Name: "b"},
+		{Name: "c", Destinations: []string{"Kafka"}},
+	}
+	assert.Len(t, c.DestinationRedactions(Elasticsearch), 1)
+	assert.Len(t, c.DestinationRedactions(Kafka), 2)
+	assert.Len(t, c.DestinationRedactions(Stderr), 0)
+}
+
+func TestDirectRELPRedaction(t *testing.T) {
+	c, err := Default()
+	if !assert.NoError(t, err) {
+		return
+	}
+	c.Redactions = []RedactionConfig{{Name: "a", Detectors: []string{"email"}}}
+	c.DirectRELPSource = []DirectRELPSourceConfig{{}}
+	assert.NoError(t, c.Complete(nil))
+	c.DirectRELPSource[0].Redact = "a"
+	assert.Error(t, c.Complete(nil))
+}
@@ -0,0 +1,62 @@
+package conf
+
+import (
+	"strings"
+
+	"github.com/stephane-martin/skewer/expr/syntax"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// complete checks the sampling configuration and sets the default values.
+func (c *SamplingConfig) complete() (err error) {
+	c.Name = strings.TrimSpace(c.Name)
+	if len(c.Name) == 0 {
+		return eerrors.New("Empty sampling name")
+	}
+	for _, rule := range c.Rules {
+		if len(strings.TrimSpace(rule.Match)) == 0 {
+			return eerrors.Errorf("Empty match for a rule of the sampling '%s'", c.Name)
+		}
+		_, err = syntax.Check(rule.Match, syntax.Bool)
+		if err != nil {
+			return eerrors.Wrapf(err, "Invalid match for the sampling '%s'", c.Name)
+		}
+		if rule.Rate < 0 || rule.Rate > 1 {
+			return eerrors.Errorf("The rates of the sampling '%s' must be between 0 and 1", c.Name)
+		}
+	}
+	if len(strings.TrimSpace(c.Key)) > 0 {
+		_, err = syntax.Check(c.Key, syntax.String, syntax.Number)
+		if err != nil {
+			return eerrors.Wrapf(err, "Invalid key for the sampling '%s'", c.Name)
+		}
+	}
+	if c.StoreWatermark < 0 || c.DestWatermark < 0 {
+		return eerrors.Errorf("Negative watermark for the sampling '%s'", c.Name)
+	}
+	if c.ShedRate == nil {
+		shedRate := 0.1
+		c.ShedRate = &shedRate
+	}
+	if *c.ShedRate < 0 || *c.ShedRate > 1 {
+		return eerrors.Errorf("The shed_rate of the sampling '%s' must be between 0 and 1", c.Name)
+	}
+	c.ShedSeverity = strings.ToLower(strings.TrimSpace(c.ShedSeverity))
+	if len(c.ShedSeverity) == 0 {
+		c.ShedSeverity = "warning"
+	}
+	if _, ok := syntax.Severity(c.ShedSeverity); !ok {
+		return eerrors.Errorf("Unknown severity '%s' for the sampling '%s'", c.ShedSeverity, c.Name)
+	}
+	return nil
+}
+
+// Sampling returns the sampling configuration called name.
+func (c *BaseConfig) Sampling(name string) (SamplingConfig, bool) {
+	for _, sampleConf := range c.Samplings {
+		if sampleConf.Name == name {
+			return sampleConf, true
+		}
+	}
+	return SamplingConfig{}, false
+}
@@ -0,0 +1,55 @@
+package conf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplingComplete(t *testing.T) {
+	rule := func(match string, rate float64) []SamplingRuleConfig {
+		return []SamplingRuleConfig{{Match: match, Rate: rate}}
+	}
+	shedRate := func(rate float64) *float64 {
+		return &rate
+	}
+	testComplete(t, []completeTest{
+		{"defaults", &SamplingConfig{Name: "a"}, false},
+		{"no name", &SamplingConfig{}, true},
+		{"rule", &SamplingConfig{Name: "a", Rules: rule(`severity >= "info"`, 0.1)}, false},
+		{"drop", &SamplingConfig{Name: "a", Rules: rule(`app_name == "chatty"`, 0)}, false},
+		{"empty match", &SamplingConfig{Name: "a", Rules: rule("", 0.5)}, true},
+		{"match type", &SamplingConfig{Name: "a", Rules: rule("hostname", 0.5)}, true},
+		{"rate", &SamplingConfig{Name: "a", Rules: rule("true", 2)}, true},
+		{"key", &SamplingConfig{Name: "a", Key: "props.http.request_id"}, false},
+		{"bad key", &SamplingConfig{Name: "a", Key: "props."}, true},
+		{"watermark", &SamplingConfig{Name: "a", StoreWatermark: -1}, true},
+		{"shed rate", &SamplingConfig{Name: "a", ShedRate: shedRate(1.5)}, true},
+		{"no shed rate", &SamplingConfig{Name: "a", ShedRate: shedRate(0)}, false},
+		{"shed severity", &SamplingConfig{Name: "a", ShedSeverity: "Error"}, false},
+		{"bad shed severity", &SamplingConfig{Name: "a", ShedSeverity: "loud"}, true},
+	}, func(t *testing.T, config completer) {
+		c := config.(*SamplingConfig)
+		assert.NotNil(t, c.ShedRate)
+		assert.NotEmpty(t, c.ShedSeverity)
+	})
+
+	c := SamplingConfig{Name: "a"}
+	assert.NoError(t, c.complete())
+	assert.Equal(t, 0.1, *c.ShedRate)
+	c = SamplingConfig{Name: "a", ShedRate: shedRate(0)}
+	assert.NoError(t, c.complete())
+	assert.Equal(t, 0.0, *c.ShedRate)
+}
+
+func TestDirectRELPSampling(t *testing.T) {
+	c, err := Default()
+	if !assert.NoError(t, err) {
+		return
+	}
+	c.Samplings = []SamplingConfig{{Name: "a"}}
+	c.DirectRELPSource = []DirectRELPSourceConfig{{}}
+	assert.NoError(t, c.Complete(nil))
+	c.DirectRELPSource[0].Sample = "a"
+	assert.Error(t, c.Complete(nil))
+}
@@ -0,0 +1,164 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// IsScriptPath tells whether the value of a javascript setting is the path
+// of a script file, relative to the configuration directory, instead of
+// inline code.
+func IsScriptPath(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasSuffix(s, ".js") && !strings.ContainsAny(s, "\n(){};=")
+}
+
+// ScriptName returns the key of a script file in BaseConfig.Scripts. The
+// script must be under the configuration directory.
+func ScriptName(p string) (string, error) {
+	return confFileName(p, "script")
+}
+
+// LookupName returns the key of a lookup file in BaseConfig.Lookups. The file
+// must be under the configuration directory.
+func LookupName(p string) (string, error) {
+	return confFileName(p, "lookup file")
+}
+
+func confFileName(p string, kind string) (string, error) {
+	p = path.Clean(filepath.ToSlash(strings.TrimSpace(p)))
+	if path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+		return "", eerrors.Errorf("The %s '%s' is not under the configuration directory", kind, p)
+	}
+	return p, nil
+}
+
+// RequireName returns the key of the module that a require() call made by
+// the script base refers to. The module identifiers that start with ./ or
+// ../ are relative to the directory of base, the other ones are relative to
+// the configuration directory. The .js extension may be omitted.
+func RequireName(base, id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if strings.HasPrefix(id, "./") || strings.HasPrefix(id, "../") {
+		id = path.Join(path.Dir(base), id)
+	}
+	if !strings.HasSuffix(id, ".js") {
+		id += ".js"
+	}
+	return ScriptName(id)
+}
+
+var requireRe = regexp.MustCompile(`\brequire\s*\(\s*['"]([^'"]+)['"]\s*\)`)
+
+// scriptSettings returns the values of the javascript settings: the
+// functions of the parsers and of the sources.
+func (c *BaseConfig) scriptSettings() (settings []string) {
+	for _, parserConf := range c.Parsers {
+		settings = append(settings, parserConf.Func)
+	}
+	for _, source := range c.sources() {
+		filtering := source.FilterConf()
+		if filtering == nil {
+			continue
+		}
+		settings = append(
+			settings,
+			filtering.TopicFunc,
+			filtering.PartitionFunc,
+			filtering.PartitionNumberFunc,
+			filtering.FilterFunc,
+		)
+	}
+	return settings
+}
+
+// LoadScripts reads from the configuration directory the script files that
+// the javascript settings refer to, and the modules that they require. The
+// modules are found by looking for the require() calls with a literal
+// module identifier.
+func (c *BaseConfig) LoadScripts(confDir string) error {
+	c.Scripts = make(map[string]string)
+	for _, setting := range c.scriptSettings() {
+		setting = strings.TrimSpace(setting)
+		if len(setting) == 0 {
+			continue
+		}
+		var err error
+		if IsScriptPath(setting) {
+			var name string
+			name, err = ScriptName(setting)
+			if err == nil {
+				err = c.addScript(confDir, name)
+			}
+		} else {
+			err = c.addRequired(confDir, "", setting)
+		}
+		if err != nil {
+			return confCheckError(err)
+		}
+	}
+	return nil
+}
+
+func (c *BaseConfig) addScript(confDir, name string) error {
+	if _, ok := c.Scripts[name]; ok {
+		return nil
+	}
+	content, err := ioutil.ReadFile(filepath.Join(confDir, filepath.FromSlash(name)))
+	if err != nil {
+		return eerrors.Wrapf(err, "Error reading script '%s'", name)
+	}
+	c.Scripts[name] = string(content)
+	return c.addRequired(confDir, name, string(content))
+}
+
+func (c *BaseConfig) addRequired(confDir, base, code string) error {
+	for _, match := range requireRe.FindAllStringSubmatch(code, -1) {
+		name, err := RequireName(base, match[1])
+		if err != nil {
+			return err
+		}
+		err = c.addScript(confDir, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScriptFiles returns the paths of the script files that were loaded.
+func (c *BaseConfig) ScriptFiles(confDir string) []string {
+	files := make([]string, 0, len(c.Scripts))
+	for name := range c.Scripts {
+		files = append(files, filepath.Join(confDir, filepath.FromSlash(name)))
+	}
+	sort.Strings(files)
+	return files
+}
+
+// OnlyFilesDiffer returns true when the configurations are the same, except
+// for the content of the script and of the lookup files.
+func (c BaseConfig) OnlyFilesDiffer(other BaseConfig) bool {
+	if reflect.DeepEqual(c.Scripts, other.Scripts) && reflect.DeepEqual(c.Lookups, other.Lookups) {
+		return false
+	}
+	c.Scripts = nil
+	other.Scripts = nil
+	c.Lookups = nil
+	other.Lookups = nil
+	b1, err1 := json.Marshal(c)
+	b2, err2 := json.Marshal(other)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return bytes.Equal(b1, b2)
+}
@@ -0,0 +1,118 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireName(t *testing.T) {
+	tests := []struct {
+		base string
+		id   string
+		name string
+		err  bool
+	}{
+		{"filters/f.js", "./lib/helpers", "filters/lib/helpers.js", false},
+		{"filters/f.js", "../common.js", "common.js", false},
+		{"filters/f.js", "lib/helpers", "lib/helpers.js", false},
+		{"", "./helpers", "helpers.js", false},
+		{"f.js", "../outside", "", true},
+		{"f.js", "/etc/passwd.js", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.base+" "+test.id, func(t *testing.T) {
+			name, err := RequireName(test.base, test.id)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.name, name)
+		})
+	}
+}
+
+func TestLoadScripts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-scripts")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"parsers/p.js":       `var h = require("./helpers"); function P(raw) { return h.parse(raw); }`,
+		"parsers/helpers.js": `var u = require("lib/util.js"); exports.parse = u.parse;`,
+		"lib/util.js":        `exports.parse = function(raw) { return NewEmptySyslogMessage(); };`,
+		"unused.js":          `exports.x = 1;`,
+	}
+	for name, content := range files {
+		_ = os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	c := NewBaseConf()
+	c.Parsers = []ParserConfig{{Name: "P", Func: "parsers/p.js"}}
+	c.TCPSource = []TCPSourceConfig{{}}
+	c.TCPSource[0].FilterFunc = `function FilterMessages(m) { return require("lib/util").x; }`
+	assert.NoError(t, c.LoadScripts(dir))
+	assert.Len(t, c.Scripts, 3)
+	assert.Equal(t, files["lib/util.js"], c.Scripts["lib/util.js"])
+	assert.NotContains(t, c.Scripts, "unused.js")
+
+	c.Parsers[0].Func = "../p.js"
+	assert.Error(t, c.LoadScripts(dir))
+}
+
+func TestOnlyFilesDiffer(t *testing.T) {
+	c1 := NewBaseConf()
+	c1.Scripts = map[string]string{"a.js": "1"}
+	c1.Lookups = map[string]string{"hosts.csv": "1"}
+	c2 := c1.Clone()
+	assert.False(t, c1.OnlyFilesDiffer(c2))
+	c2.Scripts["a.js"] = "2"
+	assert.True(t, c1.OnlyFilesDiffer(c2))
+	c2 = c1.Clone()
+	c2.Lookups["hosts.csv"] = "2"
+	assert.True(t, c1.OnlyFilesDiffer(c2))
+	c2.Main.Destination = "stderr"
+	assert.False(t, c1.OnlyFilesDiffer(c2))
+}
+
+func TestScriptsWatcherDirs(t *testing.T) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	w, err := newScriptsWatcher(logger)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer w.close()
+
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	w.watch([]string{filepath.Join(dir1, "a.js"), filepath.Join(dir1, "b.js"), filepath.Join(dir2, "c.js")})
+	assert.Equal(t, map[string]bool{dir1: true, dir2: true}, w.dirs)
+
+	// dir1 does not hold a script anymore
+	w.watch([]string{filepath.Join(dir2, "c.js")})
+	assert.Equal(t, map[string]bool{dir2: true}, w.dirs)
+	assert.False(t, w.isScript(filepath.Join(dir1, "a.js")))
+	assert.True(t, w.isScript(filepath.Join(dir2, "c.js")))
+
+	// the changes in an unwatched directory are not notified
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir1, "a.js"), []byte("1"), 0600))
+	select {
+	case <-w.changed:
+		t.Fatal("unexpected notification")
+	case <-time.After(2 * scriptsDebounce):
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir2, "c.js"), []byte("1"), 0600))
+	select {
+	case <-w.changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change has not been notified")
+	}
+}
@@ -0,0 +1,56 @@
+package conf
+
+import (
+	"strings"
+	"time"
+
+	"github.com/stephane-martin/skewer/expr/syntax"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// complete checks the suppression configuration and sets the default values.
+func (c *SuppressionConfig) complete() (err error) {
+	c.Name = strings.TrimSpace(c.Name)
+	if len(c.Name) == 0 {
+		return eerrors.New("Empty suppression name")
+	}
+	c.Mode = strings.ToLower(strings.TrimSpace(c.Mode))
+	if len(c.Mode) == 0 {
+		c.Mode = "dedup"
+	}
+	if c.Mode != "dedup" && c.Mode != "throttle" {
+		return eerrors.Errorf("Unknown suppression mode '%s'", c.Mode)
+	}
+	if len(c.Key) == 0 {
+		c.Key = []string{"hostname", "app_name", "template(message)"}
+	}
+	for _, key := range c.Key {
+		_, err = syntax.Check(key, syntax.String, syntax.Number)
+		if err != nil {
+			return eerrors.Wrapf(err, "Invalid key for the suppression '%s'", c.Name)
+		}
+	}
+	if c.Window == 0 {
+		c.Window = 30 * time.Second
+	}
+	if c.Window < 0 {
+		return eerrors.Errorf("Negative window for the suppression '%s'", c.Name)
+	}
+	if c.Mode == "throttle" && c.Max <= 0 {
+		return eerrors.Errorf("The suppression '%s' needs a positive max", c.Name)
+	}
+	if c.MaxKeys <= 0 {
+		c.MaxKeys = 10000
+	}
+	return nil
+}
+
+// Suppression returns the suppression configuration called name.
+func (c *BaseConfig) Suppression(name string) (SuppressionConfig, bool) {
+	for _, suppressConf := range c.Suppressions {
+		if suppressConf.Name == name {
+			return suppressConf, true
+		}
+	}
+	return SuppressionConfig{}, false
+}
@@ -0,0 +1,38 @@
+package conf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuppressionComplete(t *testing.T) {
+	testComplete(t, []completeTest{
+		{"defaults", &SuppressionConfig{Name: "a"}, false},
+		{"no name", &SuppressionConfig{}, true},
+		{"mode", &SuppressionConfig{Name: "a", Mode: "sample"}, true},
+		{"throttle", &SuppressionConfig{Name: "a", Mode: "Throttle", Max: 10}, false},
+		{"throttle max", &SuppressionConfig{Name: "a", Mode: "throttle"}, true},
+		{"key", &SuppressionConfig{Name: "a", Key: []string{"hostname", "severity"}}, false},
+		{"bad key", &SuppressionConfig{Name: "a", Key: []string{"severity < 4"}}, true},
+		{"window", &SuppressionConfig{Name: "a", Window: -time.Second}, true},
+	}, func(t *testing.T, config completer) {
+		c := config.(*SuppressionConfig)
+		assert.NotEmpty(t, c.Key)
+		assert.True(t, c.Window > 0)
+		assert.Equal(t, 10000, c.MaxKeys)
+	})
+}
+
+func TestDirectRELPSuppression(t *testing.T) {
+	c, err := Default()
+	if !assert.NoError(t, err) {
+		return
+	}
+	c.Suppressions = []SuppressionConfig{{Name: "a"}}
+	c.DirectRELPSource = []DirectRELPSourceConfig{{}}
+	assert.NoError(t, c.Complete(nil))
+	c.DirectRELPSource[0].Suppress = "a"
+	assert.Error(t, c.Complete(nil))
+}
@@ -25,6 +25,11 @@ type BaseConfig struct {
 	GraylogSource       []GraylogSourceConfig     `mapstructure:"graylog_source" toml:"graylog_source" json:"graylog_source"`
 	Store               StoreConfig               `mapstructure:"store" toml:"store" json:"store"`
 	Parsers             []ParserConfig            `mapstructure:"parser" toml:"parser" json:"parser"`
+	Enrichments         []EnrichmentConfig        `mapstructure:"enrichment" toml:"enrichment" json:"enrichment"`
+	Redactions          []RedactionConfig         `mapstructure:"redaction" toml:"redaction" json:"redaction"`
+	Suppressions        []SuppressionConfig       `mapstructure:"suppression" toml:"suppression" json:"suppression"`
+	Samplings           []SamplingConfig          `mapstructure:"sampling" toml:"sampling" json:"sampling"`
+	LogMetrics          []LogMetricsConfig        `mapstructure:"log_metrics" toml:"log_metrics" json:"log_metrics"`
 	Journald            JournaldConfig            `mapstructure:"journald" toml:"journald" json:"journald"`
 	Metrics             MetricsConfig             `mapstructure:"metrics" toml:"metrics" json:"metrics"`
 	Accounting          AccountingSourceConfig    `mapstructure:"accounting" toml:"accounting" json:"accounting"`
@@ -43,6 +48,9 @@ type BaseConfig struct {
 	GraylogDest         GraylogDestConfig         `mapstructure:"graylog_destination" toml:"graylog_destination" json:"graylog_destination"`
 	ElasticDest         ElasticDestConfig         `mapstructure:"elasticsearch_destination" toml:"elasticsearch_destination" json:"elasticsearch_destination"`
 	RedisDest           RedisDestConfig           `mapstructure:"redis_destination" toml:"redis_destination" json:"redis_destination"`
+	Scripts             map[string]string         `mapstructure:"-" toml:"-" json:"scripts"`
+	Lookups             map[string]string         `mapstructure:"-" toml:"-" json:"lookups"`
+	LookupDir           string                    `mapstructure:"-" toml:"-" json:"lookup_dir"`
 }
 
 // MainConfig lists general/global parameters.
@@ -64,8 +72,117 @@ type WatcherConfig struct {
 }
 
 type ParserConfig struct {
-	Name string `mapstructure:"name" toml:"name" json:"name"`
-	Func string `mapstructure:"func" toml:"func" json:"func"`
+	JSBudgetConfig `mapstructure:",squash"`
+	Name           string `mapstructure:"name" toml:"name" json:"name"`
+	Func           string `mapstructure:"func" toml:"func" json:"func"`
+}
+
+// EnrichmentConfig adds context to the messages of the sources that refer to
+// it: the columns of a lookup table, GeoIP data and the reverse DNS of the
+// client. The results are written in the properties, under Namespace.
+type EnrichmentConfig struct {
+	Name            string        `mapstructure:"name" toml:"name" json:"name"`
+	Namespace       string        `mapstructure:"namespace" toml:"namespace" json:"namespace"`
+	LookupFile      string        `mapstructure:"lookup_file" toml:"lookup_file" json:"lookup_file"`
+	LookupKey       string        `mapstructure:"lookup_key" toml:"lookup_key" json:"lookup_key"`
+	GeoIPDatabase   string        `mapstructure:"geoip_database" toml:"geoip_database" json:"geoip_database"`
+	GeoIPProperties []string      `mapstructure:"geoip_properties" toml:"geoip_properties" json:"geoip_properties"`
+	ReverseDNS      bool          `mapstructure:"reverse_dns" toml:"reverse_dns" json:"reverse_dns"`
+	ReverseDNSTTL   time.Duration `mapstructure:"reverse_dns_ttl" toml:"reverse_dns_ttl" json:"reverse_dns_ttl"`
+}
+
+// RedactionConfig removes the personal data from the messages of the sources
+// that refer to it, and from the messages sent to Destinations. The matches
+// of the detectors and of the rules are masked, replaced by their keyed hash,
+// or the whole field is dropped.
+type RedactionConfig struct {
+	Name         string                `mapstructure:"name" toml:"name" json:"name"`
+	Detectors    []string              `mapstructure:"detectors" toml:"detectors" json:"detectors"`
+	Rules        []RedactionRuleConfig `mapstructure:"rule" toml:"rule" json:"rule"`
+	Mode         string                `mapstructure:"mode" toml:"mode" json:"mode"`
+	Mask         string                `mapstructure:"mask" toml:"mask" json:"mask"`
+	HashKey      string                `mapstructure:"hash_key" toml:"hash_key" json:"hash_key"`
+	Fields       []string              `mapstructure:"fields" toml:"fields" json:"fields"`
+	Properties   []string              `mapstructure:"properties" toml:"properties" json:"properties"`
+	Destinations []string              `mapstructure:"destinations" toml:"destinations" json:"destinations"`
+}
+
+// RedactionRuleConfig is a custom rule of a redaction. When the regexp has
+// groups, only the first group is redacted.
+type RedactionRuleConfig struct {
+	Name   string `mapstructure:"name" toml:"name" json:"name"`
+	Regexp string `mapstructure:"regexp" toml:"regexp" json:"regexp"`
+	Mode   string `mapstructure:"mode" toml:"mode" json:"mode"`
+}
+
+// SuppressionConfig collapses the repeated messages of the sources that refer
+// to it. The messages whose Key expressions give the same values are
+// repeats. In dedup mode, the repeats are dropped during Window, and then a
+// summary message tells how many were. In throttle mode, Max messages per
+// key are forwarded in each Window, and the others are dropped.
+type SuppressionConfig struct {
+	Name    string        `mapstructure:"name" toml:"name" json:"name"`
+	Key     []string      `mapstructure:"key" toml:"key" json:"key"`
+	Mode    string        `mapstructure:"mode" toml:"mode" json:"mode"`
+	Window  time.Duration `mapstructure:"window" toml:"window" json:"window"`
+	Max     int           `mapstructure:"max" toml:"max" json:"max"`
+	MaxKeys int           `mapstructure:"max_keys" toml:"max_keys" json:"max_keys"`
+}
+
+// SamplingConfig keeps a part of the messages of the sources that refer to
+// it. The rate of a message is given by the first rule that matches it, the
+// messages that match no rule are kept. When Key is set, the messages whose
+// keys have the same value are kept or dropped together. When the Store holds
+// more than StoreWatermark messages, or when more than DestWatermark messages
+// wait for a destination, the rates of the messages less severe than
+// ShedSeverity are multiplied by ShedRate. ShedRate is nil when it is not
+// set, so that an explicit 0 drops those messages.
+type SamplingConfig struct {
+	Name           string               `mapstructure:"name" toml:"name" json:"name"`
+	Rules          []SamplingRuleConfig `mapstructure:"rule" toml:"rule" json:"rule"`
+	Key            string               `mapstructure:"key" toml:"key" json:"key"`
+	StoreWatermark int64                `mapstructure:"store_watermark" toml:"store_watermark" json:"store_watermark"`
+	DestWatermark  int64                `mapstructure:"destination_watermark" toml:"destination_watermark" json:"destination_watermark"`
+	ShedRate       *float64             `mapstructure:"shed_rate" toml:"shed_rate" json:"shed_rate"`
+	ShedSeverity   string               `mapstructure:"shed_severity" toml:"shed_severity" json:"shed_severity"`
+}
+
+// SamplingRuleConfig gives the rate, between 0 and 1, of the messages for
+// which the Match expression is true.
+type SamplingRuleConfig struct {
+	Match string  `mapstructure:"match" toml:"match" json:"match"`
+	Rate  float64 `mapstructure:"rate" toml:"rate" json:"rate"`
+}
+
+// LogMetricsConfig derives Prometheus metrics from the messages of the
+// sources that refer to it.
+type LogMetricsConfig struct {
+	Name    string            `mapstructure:"name" toml:"name" json:"name"`
+	Metrics []LogMetricConfig `mapstructure:"metric" toml:"metric" json:"metric"`
+}
+
+// LogMetricConfig is a counter or a histogram of the messages for which
+// Match is true, and whose message matches Regexp. The value is given by the
+// Value expression, or by the "value" group of Regexp. Labels maps the label
+// names to expressions, or to the groups of Regexp ("$name"). At most
+// MaxSeries label combinations are tracked.
+type LogMetricConfig struct {
+	Name      string            `mapstructure:"name" toml:"name" json:"name"`
+	Help      string            `mapstructure:"help" toml:"help" json:"help"`
+	Type      string            `mapstructure:"type" toml:"type" json:"type"`
+	Match     string            `mapstructure:"match" toml:"match" json:"match"`
+	Regexp    string            `mapstructure:"regexp" toml:"regexp" json:"regexp"`
+	Value     string            `mapstructure:"value" toml:"value" json:"value"`
+	Labels    map[string]string `mapstructure:"labels" toml:"labels" json:"labels"`
+	Buckets   []float64         `mapstructure:"buckets" toml:"buckets" json:"buckets"`
+	MaxSeries int               `mapstructure:"max_series" toml:"max_series" json:"max_series"`
+}
+
+// JSBudgetConfig bounds the execution of the javascript functions.
+type JSBudgetConfig struct {
+	JSTimeout       time.Duration `mapstructure:"js_timeout" toml:"js_timeout" json:"js_timeout"`
+	JSMaxStack      int           `mapstructure:"js_max_stack" toml:"js_max_stack" json:"js_max_stack"`
+	JSTimeoutPolicy string        `mapstructure:"js_timeout_policy" toml:"js_timeout_policy" json:"js_timeout_policy"`
 }
 
 type StoreConfig struct {
@@ -207,6 +324,10 @@ type GraylogDestConfig struct {
 type TcpUdpRelpDestBaseConfig struct {
 	Host           string        `mapstructure:"host" toml:"host" json:"host"`
 	Port           int           `mapstructure:"port" toml:"port" json:"port"`
+	Hosts          []string      `mapstructure:"hosts" toml:"hosts" json:"hosts"`
+	Strategy       string        `mapstructure:"strategy" toml:"strategy" json:"strategy"`
+	HashKeyTmpl    string        `mapstructure:"hash_key_tmpl" toml:"hash_key_tmpl" json:"hash_key_tmpl"`
+	ProbeInterval  time.Duration `mapstructure:"probe_interval" toml:"probe_interval" json:"probe_interval"`
 	UnixSocketPath string        `mapstructure:"unix_socket_path" toml:"unix_socket_path" json:"unix_socket_path"`
 	Rebind         time.Duration `mapstructure:"rebind" toml:"rebind" json:"rebind"`
 	Format         string        `mapstructure:"format" toml:"format" json:"format"`
@@ -214,6 +335,9 @@ type TcpUdpRelpDestBaseConfig struct {
 
 type UDPDestConfig struct {
 	TcpUdpRelpDestBaseConfig `mapstructure:",squash"`
+	TlsBaseConfig            `mapstructure:",squash"`
+	Insecure                 bool     `mapstructure:"insecure" toml:"insecure" json:"insecure"`
+	TLSFingerprints          []string `mapstructure:"tls_fingerprints" toml:"tls_fingerprints" json:"tls_fingerprints"`
 }
 
 type RELPDestConfig struct {
@@ -225,8 +349,9 @@ type RELPDestConfig struct {
 	ConnTimeout              time.Duration `mapstructure:"connection_timeout" toml:"connection_timeout" json:"connection_timeout"`
 	FlushPeriod              time.Duration `mapstructure:"flush_period" toml:"flush_period" json:"flush_period"`
 
-	WindowSize  int32         `mapstructure:"window_size" toml:"window_size" json:"window_size"`
-	RelpTimeout time.Duration `mapstructure:"relp_timeout" toml:"relp_timeout" json:"relp_timeout"`
+	WindowSize      int32         `mapstructure:"window_size" toml:"window_size" json:"window_size"`
+	RelpTimeout     time.Duration `mapstructure:"relp_timeout" toml:"relp_timeout" json:"relp_timeout"`
+	TLSFingerprints []string      `mapstructure:"tls_fingerprints" toml:"tls_fingerprints" json:"tls_fingerprints"`
 }
 
 type TCPDestConfig struct {
@@ -238,8 +363,10 @@ type TCPDestConfig struct {
 	ConnTimeout              time.Duration `mapstructure:"connection_timeout" toml:"connection_timeout" json:"connection_timeout"`
 	FlushPeriod              time.Duration `mapstructure:"flush_period" toml:"flush_period" json:"flush_period"`
 
-	LineFraming    bool  `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
-	FrameDelimiter uint8 `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
+	LineFraming     bool     `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
+	FrameDelimiter  uint8    `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
+	Framing         string   `mapstructure:"framing" toml:"framing" json:"framing"`
+	TLSFingerprints []string `mapstructure:"tls_fingerprints" toml:"tls_fingerprints" json:"tls_fingerprints"`
 }
 
 type HTTPServerDestConfig struct {
@@ -366,12 +493,22 @@ type StderrDestConfig struct {
 }
 
 type FilterSubConfig struct {
+	JSBudgetConfig      `mapstructure:",squash"`
 	TopicTmpl           string `mapstructure:"topic_tmpl" toml:"topic_tmpl" json:"topic_tmpl"`
 	TopicFunc           string `mapstructure:"topic_function" toml:"topic_function" json:"topic_function"`
 	PartitionTmpl       string `mapstructure:"partition_key_tmpl" toml:"partition_key_tmpl" json:"partition_key_tmpl"`
 	PartitionFunc       string `mapstructure:"partition_key_func" toml:"partition_key_func" json:"partition_key_func"`
 	PartitionNumberFunc string `mapstructure:"partition_number_func" toml:"partition_number_func" json:"partition_number_func"`
 	FilterFunc          string `mapstructure:"filter_func" toml:"filter_func" json:"filter_func"`
+	FilterExpr          string `mapstructure:"filter_expr" toml:"filter_expr" json:"filter_expr"`
+	TopicExpr           string `mapstructure:"topic_expr" toml:"topic_expr" json:"topic_expr"`
+	PartitionKeyExpr    string `mapstructure:"partition_key_expr" toml:"partition_key_expr" json:"partition_key_expr"`
+	PartitionNumberExpr string `mapstructure:"partition_number_expr" toml:"partition_number_expr" json:"partition_number_expr"`
+	Enrich              string `mapstructure:"enrich" toml:"enrich" json:"enrich"`
+	Redact              string `mapstructure:"redact" toml:"redact" json:"redact"`
+	Suppress            string `mapstructure:"suppress" toml:"suppress" json:"suppress"`
+	Sample              string `mapstructure:"sample" toml:"sample" json:"sample"`
+	LogMetrics          string `mapstructure:"log_metrics" toml:"log_metrics" json:"log_metrics"`
 }
 
 type JournaldConfig struct {
@@ -447,9 +584,19 @@ func (c *MacOSSourceConfig) DefaultPort() int {
 }
 
 type DecoderBaseConfig struct {
-	Format    string `mapstructure:"format" toml:"format" json:"format"`
-	Charset   string `mapstructure:"charset" toml:"charset" json:"charset"`
-	W3CFields string `mapstructure:"w3c_fields" toml:"w3c_fields" json:"fields"`
+	Format           string `mapstructure:"format" toml:"format" json:"format"`
+	Charset          string `mapstructure:"charset" toml:"charset" json:"charset"`
+	W3CFields        string `mapstructure:"w3c_fields" toml:"w3c_fields" json:"fields"`
+	GrokPattern      string `mapstructure:"grok_pattern" toml:"grok_pattern" json:"grok_pattern"`
+	GrokPatterns     string `mapstructure:"grok_patterns" toml:"grok_patterns" json:"grok_patterns"`
+	GrokPatternsFile string `mapstructure:"grok_patterns_file" toml:"grok_patterns_file" json:"grok_patterns_file"`
+	// separators used by the logfmt decoder
+	LogfmtPairSeparator string `mapstructure:"logfmt_pair_separator" toml:"logfmt_pair_separator" json:"logfmt_pair_separator"`
+	LogfmtKVSeparator   string `mapstructure:"logfmt_kv_separator" toml:"logfmt_kv_separator" json:"logfmt_kv_separator"`
+	// Apache LogFormat or nginx log_format string, for the accesslog decoder
+	AccessLogFormat string `mapstructure:"access_log_format" toml:"access_log_format" json:"access_log_format"`
+	// tolerate malformed messages (rfc5424 decoder)
+	Lenient bool `mapstructure:"lenient" toml:"lenient" json:"lenient"`
 }
 
 func (c *DecoderBaseConfig) Equals(other gotomic.Thing) bool {
@@ -464,6 +611,14 @@ func (c *DecoderBaseConfig) HashCode() uint32 {
 	h.Write([]byte(c.Format))
 	h.Write([]byte(c.Charset))
 	h.Write([]byte(c.W3CFields))
+	h.Write([]byte(c.GrokPattern))
+	h.Write([]byte(c.GrokPatterns))
+	h.Write([]byte(c.LogfmtPairSeparator))
+	h.Write([]byte(c.LogfmtKVSeparator))
+	h.Write([]byte(c.AccessLogFormat))
+	if c.Lenient {
+		h.Write([]byte{1})
+	}
 	return h.Sum32()
 }
 
@@ -498,8 +653,9 @@ type HTTPServerSourceConfig struct {
 	FilterSubConfig `mapstructure:",squash"`
 	ConfID          utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
 
-	TlsBaseConfig  `mapstructure:",squash"`
-	ClientAuthType string `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
+	TlsBaseConfig       `mapstructure:",squash"`
+	AccessControlConfig `mapstructure:",squash"`
+	ClientAuthType      string `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
 
 	Port int `mapstructure:"port" toml:"port" json:"port"`
 	// should the server accept multiple messages per request
@@ -525,15 +681,21 @@ func (c *HTTPServerSourceConfig) DefaultPort() int {
 	return 8081
 }
 
+// TCPSourceConfig configures a TCP source. It has the same fields as
+// RELPSourceConfig, so that the RELP configurations can be converted: the
+// RELP-only MaxWindow is rejected on TCP sources.
 type TCPSourceConfig struct {
-	DecoderBaseConfig `mapstructure:",squash"`
-	ListenersConfig   `mapstructure:",squash"`
-	FilterSubConfig   `mapstructure:",squash"`
-	TlsBaseConfig     `mapstructure:",squash"`
-	ClientAuthType    string       `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
-	LineFraming       bool         `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
-	FrameDelimiter    string       `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
-	ConfID            utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
+	DecoderBaseConfig   `mapstructure:",squash"`
+	ListenersConfig     `mapstructure:",squash"`
+	FilterSubConfig     `mapstructure:",squash"`
+	TlsBaseConfig       `mapstructure:",squash"`
+	AccessControlConfig `mapstructure:",squash"`
+	ClientAuthType      string       `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
+	LineFraming         bool         `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
+	FrameDelimiter      string       `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
+	Framing             string       `mapstructure:"framing" toml:"framing" json:"framing"`
+	MaxWindow           int          `mapstructure:"max_window" toml:"max_window" json:"max_window"`
+	ConfID              utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
 }
 
 func (c *TCPSourceConfig) FilterConf() *FilterSubConfig {
@@ -549,14 +711,23 @@ func (c *TCPSourceConfig) DecoderConf() *DecoderBaseConfig {
 }
 
 func (c *TCPSourceConfig) DefaultPort() int {
+	if c.TLSEnabled {
+		// RFC 5425
+		return 6514
+	}
 	return 1514
 }
 
 type UDPSourceConfig struct {
-	DecoderBaseConfig `mapstructure:",squash"`
-	ListenersConfig   `mapstructure:",squash"`
-	FilterSubConfig   `mapstructure:",squash"`
-	ConfID            utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
+	DecoderBaseConfig   `mapstructure:",squash"`
+	ListenersConfig     `mapstructure:",squash"`
+	FilterSubConfig     `mapstructure:",squash"`
+	TlsBaseConfig       `mapstructure:",squash"`
+	AccessControlConfig `mapstructure:",squash"`
+	ClientAuthType      string        `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
+	DTLSSessionTimeout  time.Duration `mapstructure:"dtls_session_timeout" toml:"dtls_session_timeout" json:"dtls_session_timeout"`
+	PassCredentials     bool          `mapstructure:"pass_credentials" toml:"pass_credentials" json:"pass_credentials"`
+	ConfID              utils.MyULID  `mapstructure:"-" toml:"-" json:"conf_id"`
 }
 
 func (c *UDPSourceConfig) FilterConf() *FilterSubConfig {
@@ -572,6 +743,10 @@ func (c *UDPSourceConfig) DecoderConf() *DecoderBaseConfig {
 }
 
 func (c *UDPSourceConfig) DefaultPort() int {
+	if c.TLSEnabled {
+		// RFC 6012
+		return 6514
+	}
 	return 1514
 }
 
@@ -579,6 +754,9 @@ type GraylogSourceConfig struct {
 	DecoderBaseConfig `mapstructure:",squash"`
 	ListenersConfig   `mapstructure:",squash"`
 	FilterSubConfig   `mapstructure:",squash"`
+	TlsBaseConfig     `mapstructure:",squash"`
+	ClientAuthType    string       `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
+	Transport         string       `mapstructure:"transport" toml:"transport" json:"transport"`
 	ConfID            utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
 }
 
@@ -599,14 +777,17 @@ func (c *GraylogSourceConfig) DefaultPort() int {
 }
 
 type RELPSourceConfig struct {
-	DecoderBaseConfig `mapstructure:",squash"`
-	ListenersConfig   `mapstructure:",squash"`
-	FilterSubConfig   `mapstructure:",squash"`
-	TlsBaseConfig     `mapstructure:",squash"`
-	ClientAuthType    string       `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
-	LineFraming       bool         `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
-	FrameDelimiter    string       `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
-	ConfID            utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
+	DecoderBaseConfig   `mapstructure:",squash"`
+	ListenersConfig     `mapstructure:",squash"`
+	FilterSubConfig     `mapstructure:",squash"`
+	TlsBaseConfig       `mapstructure:",squash"`
+	AccessControlConfig `mapstructure:",squash"`
+	ClientAuthType      string       `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
+	LineFraming         bool         `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
+	FrameDelimiter      string       `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
+	Framing             string       `mapstructure:"framing" toml:"framing" json:"framing"`
+	MaxWindow           int          `mapstructure:"max_window" toml:"max_window" json:"max_window"`
+	ConfID              utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
 }
 
 func (c *RELPSourceConfig) FilterConf() *FilterSubConfig {
@@ -626,14 +807,17 @@ func (c *RELPSourceConfig) DefaultPort() int {
 }
 
 type DirectRELPSourceConfig struct {
-	DecoderBaseConfig `mapstructure:",squash"`
-	ListenersConfig   `mapstructure:",squash"`
-	FilterSubConfig   `mapstructure:",squash"`
-	TlsBaseConfig     `mapstructure:",squash"`
-	ClientAuthType    string       `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
-	LineFraming       bool         `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
-	FrameDelimiter    string       `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
-	ConfID            utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
+	DecoderBaseConfig   `mapstructure:",squash"`
+	ListenersConfig     `mapstructure:",squash"`
+	FilterSubConfig     `mapstructure:",squash"`
+	TlsBaseConfig       `mapstructure:",squash"`
+	AccessControlConfig `mapstructure:",squash"`
+	ClientAuthType      string       `mapstructure:"client_auth_type" toml:"client_auth_type" json:"client_auth_type"`
+	LineFraming         bool         `mapstructure:"line_framing" toml:"line_framing" json:"line_framing"`
+	FrameDelimiter      string       `mapstructure:"delimiter" toml:"delimiter" json:"delimiter"`
+	Framing             string       `mapstructure:"framing" toml:"framing" json:"framing"`
+	MaxWindow           int          `mapstructure:"max_window" toml:"max_window" json:"max_window"`
+	ConfID              utils.MyULID `mapstructure:"-" toml:"-" json:"conf_id"`
 }
 
 func (c *DirectRELPSourceConfig) FilterConf() *FilterSubConfig {
@@ -667,6 +851,7 @@ type ListenersConfig struct {
 	KeepAlive       bool          `mapstructure:"keepalive" toml:"keepalive" json:"keepalive"`
 	KeepAlivePeriod time.Duration `mapstructure:"keepalive_period" toml:"keepalive_period" json:"keepalive_period"`
 	Timeout         time.Duration `mapstructure:"timeout" toml:"timeout" json:"timeout"`
+	ProxyProtocol   bool          `mapstructure:"proxy_protocol" toml:"proxy_protocol" json:"proxy_protocol"`
 }
 
 type KafkaSourceConfig struct {
@@ -708,6 +893,17 @@ type TlsBaseConfig struct {
 	CertFile   string `mapstructure:"cert_file" toml:"cert_file" json:"cert_file"`
 }
 
+type AccessControlConfig struct {
+	AllowFrom          []string `mapstructure:"allow_from" toml:"allow_from" json:"allow_from"`
+	DenyFrom           []string `mapstructure:"deny_from" toml:"deny_from" json:"deny_from"`
+	TLSAllowedSubjects []string `mapstructure:"tls_allowed_subjects" toml:"tls_allowed_subjects" json:"tls_allowed_subjects"`
+	TLSAllowedSANs     []string `mapstructure:"tls_allowed_sans" toml:"tls_allowed_sans" json:"tls_allowed_sans"`
+	RateLimitMessages  float64  `mapstructure:"rate_limit_messages" toml:"rate_limit_messages" json:"rate_limit_messages"`
+	RateLimitBytes     float64  `mapstructure:"rate_limit_bytes" toml:"rate_limit_bytes" json:"rate_limit_bytes"`
+	RateLimitAction    string   `mapstructure:"rate_limit_action" toml:"rate_limit_action" json:"rate_limit_action"`
+	TLSFingerprints    []string `mapstructure:"tls_fingerprints" toml:"tls_fingerprints" json:"tls_fingerprints"`
+}
+
 type HTTPServerBaseConfig struct {
 	BindAddr             string        `mapstructure:"bind_addr" toml:"bind_addr" json:"bind_addr"`
 	ReadTimeout          time.Duration `mapstructure:"read_timeout" toml:"read_timeout" json:"read_timeout"`
@@ -718,4 +914,5 @@ type HTTPServerBaseConfig struct {
 	DisableConnKeepAlive bool          `mapstructure:"disable_conn_keepalive" toml:"disable_conn_keepalive" json:"disable_conn_keepalive"`
 	ConnKeepAlivePeriod  time.Duration `mapstructure:"conn_keepalive_period" toml:"conn_keepalive_period" json:"conn_keepalive_period"`
 	DisableHTTPKeepAlive bool          `mapstructure:"disable_http_keepalive" toml:"disable_http_keepalive" json:"disable_http_keepalive"`
+	ProxyProtocol        bool          `mapstructure:"proxy_protocol" toml:"proxy_protocol" json:"proxy_protocol"`
 }
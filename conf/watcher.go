@@ -0,0 +1,117 @@
+package conf
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/inconshreveable/log15"
+)
+
+// scriptsDebounce is the delay between a change of a script file and the
+// notification, so that an editor has finished writing the file.
+const scriptsDebounce = 500 * time.Millisecond
+
+// scriptsWatcher notifies the changes of the script and lookup files.
+type scriptsWatcher struct {
+	watcher *fsnotify.Watcher
+	logger  log15.Logger
+	changed chan struct{}
+	done    chan struct{}
+	mu      sync.Mutex
+	files   map[string]bool
+	dirs    map[string]bool
+}
+
+func newScriptsWatcher(logger log15.Logger) (*scriptsWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := scriptsWatcher{
+		watcher: watcher,
+		logger:  logger,
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		files:   make(map[string]bool),
+		dirs:    make(map[string]bool),
+	}
+	go w.run()
+	return &w, nil
+}
+
+// watch sets the files to watch. The directories of the files are watched,
+// as editors often replace the files instead of writing them. The
+// directories that do not hold a watched file anymore are unwatched.
+func (w *scriptsWatcher) watch(files []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.files = make(map[string]bool, len(files))
+	needed := make(map[string]bool, len(files))
+	for _, f := range files {
+		f = filepath.Clean(f)
+		w.files[f] = true
+		dir := filepath.Dir(f)
+		needed[dir] = true
+		if w.dirs[dir] {
+			continue
+		}
+		err := w.watcher.Add(dir)
+		if err != nil {
+			w.logger.Warn("Error watching script directory", "dir", dir, "error", err)
+			continue
+		}
+		w.dirs[dir] = true
+	}
+	for dir := range w.dirs {
+		if needed[dir] {
+			continue
+		}
+		delete(w.dirs, dir)
+		err := w.watcher.Remove(dir)
+		if err != nil {
+			w.logger.Debug("Error unwatching script directory", "dir", dir, "error", err)
+		}
+	}
+}
+
+func (w *scriptsWatcher) isScript(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.files[filepath.Clean(name)]
+}
+
+func (w *scriptsWatcher) run() {
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, more := <-w.watcher.Events:
+			if !more {
+				return
+			}
+			if event.Op == fsnotify.Chmod || !w.isScript(event.Name) {
+				continue
+			}
+			timer = time.After(scriptsDebounce)
+		case err, more := <-w.watcher.Errors:
+			if !more {
+				return
+			}
+			w.logger.Warn("Error watching script files", "error", err)
+		case <-timer:
+			timer = nil
+			select {
+			case w.changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (w *scriptsWatcher) close() {
+	close(w.done)
+	_ = w.watcher.Close()
+}
@@ -0,0 +1,195 @@
+package decoders
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stephane-martin/skewer/decoders/accesslog"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// The access log decoder parses web server logs, as described by an Apache
+// LogFormat string (%h %l %u %t "%r" %>s %b) or an nginx log_format string
+// ($remote_addr - $remote_user [$time_local] "$request" $status ...).
+//
+// The access log line may come as is, or inside a RFC3164/RFC5424 envelope,
+// as sent by nginx "access_log syslog:" directive.
+
+// AccessLogDecoder makes a web server access log decoder from the given
+// Apache LogFormat or nginx log_format string. The usual nicknames (common,
+// combined, vhost_combined, nginx, nginx_main) are accepted.
+func AccessLogDecoder(format string) (func([]byte) ([]*model.SyslogMessage, error), error) {
+	tokens, err := accesslog.Compile(format)
+	if err != nil {
+		return nil, err
+	}
+	return func(m []byte) ([]*model.SyslogMessage, error) {
+		m = bytes.TrimSpace(m)
+		msg, line := accessLogEnvelope(m)
+		err := parseAccessLog(line, tokens, func(field *accesslog.Field, value string) {
+			setAccessLogField(msg, field, value)
+		})
+		if err != nil {
+			model.Free(msg)
+			return nil, AccessLogDecodingError(err)
+		}
+		msg.Message = string(line)
+		msg.SetPriority()
+		return []*model.SyslogMessage{msg}, nil
+	}, nil
+}
+
+// accessLogEnvelope strips the optional syslog envelope.
+func accessLogEnvelope(m []byte) (msg *model.SyslogMessage, line []byte) {
+	if len(m) > 0 && m[0] == '<' {
+		var msgs []*model.SyslogMessage
+		var err error
+		priEnd := bytes.IndexByte(m, '>')
+		if priEnd > 0 && bytes.HasPrefix(m[priEnd+1:], []byte("1 ")) {
+			msgs, err = p5424(m)
+		} else {
+			msgs, err = p3164(m)
+		}
+		if err == nil && len(msgs) == 1 {
+			msg = msgs[0]
+			msg.ClearDomain("accesslog")
+			msg.Severity = model.Sinfo
+			return msg, bytes.TrimSpace([]byte(msg.Message))
+		}
+		for _, msg := range msgs {
+			model.Free(msg)
+		}
+	}
+	now := time.Now().UnixNano()
+	msg = model.Factory()
+	msg.ClearDomain("accesslog")
+	msg.Version = 1
+	msg.Facility = model.Flocal7
+	msg.Severity = model.Sinfo
+	msg.TimeGeneratedNum = now
+	msg.TimeReportedNum = now
+	return msg, m
+}
+
+// parseAccessLog matches the line against the compiled tokens. A field value
+// extends up to the following literal, or to the end of the line.
+func parseAccessLog(line []byte, tokens []accesslog.Token, f func(*accesslog.Field, string)) error {
+	pos := 0
+	for i, tok := range tokens {
+		if tok.Field == nil {
+			if !bytes.HasPrefix(line[pos:], tok.Literal) {
+				return eerrors.Errorf("The line does not match the format at position %d", pos)
+			}
+			pos += len(tok.Literal)
+			continue
+		}
+		var end int
+		switch {
+		case i == len(tokens)-1:
+			end = len(line)
+		case tokens[i+1].Field != nil:
+			// two consecutive fields: the first one can't contain a space
+			end = bytes.IndexByte(line[pos:], ' ')
+			if end == -1 {
+				end = len(line)
+			} else {
+				end += pos
+			}
+		default:
+			end = indexUnescaped(line, pos, tokens[i+1].Literal)
+			if end == -1 {
+				return eerrors.Errorf("The line does not match the format at position %d", pos)
+			}
+		}
+		f(tok.Field, string(line[pos:end]))
+		pos = end
+	}
+	return nil
+}
+
+// indexUnescaped looks for delim in line, starting at pos, skipping the
+// backslash escaped quotes that appear in quoted fields.
+func indexUnescaped(line []byte, pos int, delim []byte) int {
+	for pos <= len(line) {
+		idx := bytes.Index(line[pos:], delim)
+		if idx == -1 {
+			return -1
+		}
+		idx += pos
+		if delim[0] == '"' && idx > 0 && line[idx-1] == '\\' {
+			pos = idx + 1
+			continue
+		}
+		return idx
+	}
+	return -1
+}
+
+func statusSeverity(status int) model.Severity {
+	switch {
+	case status >= 500:
+		return model.Serr
+	case status >= 400:
+		return model.SWarning
+	default:
+		return model.Sinfo
+	}
+}
+
+func setLatency(msg *model.SyslogMessage, value string, factor float64) {
+	if d, err := strconv.ParseFloat(value, 64); err == nil {
+		msg.SetProperty("accesslog", "latency_ms", strconv.FormatFloat(d*factor, 'f', -1, 64))
+	}
+}
+
+func setAccessLogField(msg *model.SyslogMessage, field *accesslog.Field, value string) {
+	if value == "-" && field.Kind != accesslog.Bytes {
+		// the web servers write "-" for missing values
+		return
+	}
+	switch field.Kind {
+	case accesslog.Bytes:
+		if value == "-" {
+			value = "0"
+		}
+	case accesslog.Status:
+		if status, err := strconv.Atoi(value); err == nil {
+			msg.Severity = statusSeverity(status)
+		}
+	case accesslog.Time:
+		var t time.Time
+		var ok bool
+		switch field.Param {
+		case "sec", "msec":
+			t, ok = parseEpochOrLogTime(value)
+		case "usec":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+				t, ok = time.Unix(0, us*1000), true
+			}
+		default:
+			t, ok = parseEpochOrLogTime(strings.Trim(value, "[]"))
+		}
+		if ok {
+			msg.TimeReportedNum = t.UnixNano()
+		}
+	case accesslog.Request:
+		parts := strings.Split(value, " ")
+		if len(parts) == 3 {
+			msg.SetProperty("accesslog", "method", parts[0])
+			msg.SetProperty("accesslog", "uri", parts[1])
+			msg.SetProperty("accesslog", "protocol", parts[2])
+		}
+	case accesslog.Pid:
+		msg.ProcId = value
+	case accesslog.DurationS:
+		setLatency(msg, value, 1000)
+	case accesslog.DurationMS:
+		setLatency(msg, value, 1)
+	case accesslog.DurationUS:
+		setLatency(msg, value, 0.001)
+	}
+	msg.SetProperty("accesslog", field.Name, value)
+}
@@ -0,0 +1,267 @@
+// Package accesslog compiles Apache LogFormat and nginx log_format strings
+// into a list of tokens, used to parse the web servers access logs.
+package accesslog
+
+import (
+	"strings"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+var nicknames = map[string]string{
+	"":               `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`,
+	"combined":       `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`,
+	"common":         `%h %l %u %t "%r" %>s %b`,
+	"vhost_combined": `%v:%p %h %l %u %t "%r" %>s %O "%{Referer}i" "%{User-Agent}i"`,
+	"nginx":          `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+	"nginx_main":     `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`,
+}
+
+// Kind tells how a field value is interpreted.
+type Kind int
+
+const (
+	String Kind = iota
+	Bytes
+	Status
+	Time
+	Request
+	Pid
+	DurationS
+	DurationMS
+	DurationUS
+)
+
+// Field describes a variable part of the access log line. The value is
+// stored in the property Name of the "accesslog" domain.
+type Field struct {
+	Name  string
+	Kind  Kind
+	Param string
+}
+
+// Token is either a literal, or a field.
+type Token struct {
+	Literal []byte
+	Field   *Field
+}
+
+var apacheDirectives = map[byte]Field{
+	'a': {Name: "client_ip"},
+	'A': {Name: "local_ip"},
+	'b': {Name: "bytes", Kind: Bytes},
+	'B': {Name: "bytes", Kind: Bytes},
+	'D': {Name: "duration_us", Kind: DurationUS},
+	'f': {Name: "filename"},
+	'h': {Name: "remote_host"},
+	'H': {Name: "protocol"},
+	'I': {Name: "bytes_received", Kind: Bytes},
+	'k': {Name: "keepalive_requests"},
+	'l': {Name: "ident"},
+	'L': {Name: "log_id"},
+	'm': {Name: "method"},
+	'O': {Name: "bytes_sent", Kind: Bytes},
+	'p': {Name: "port"},
+	'P': {Name: "pid", Kind: Pid},
+	'q': {Name: "query"},
+	'r': {Name: "request", Kind: Request},
+	'R': {Name: "handler"},
+	's': {Name: "status", Kind: Status},
+	'S': {Name: "bytes_transferred", Kind: Bytes},
+	't': {Name: "time", Kind: Time},
+	'T': {Name: "duration_s", Kind: DurationS},
+	'u': {Name: "user"},
+	'U': {Name: "path"},
+	'v': {Name: "server_name"},
+	'V': {Name: "server_name"},
+	'X': {Name: "connection_status"},
+}
+
+var nginxVariables = map[string]Field{
+	"remote_addr":     {Name: "client_ip"},
+	"remote_user":     {Name: "user"},
+	"time_local":      {Name: "time", Kind: Time},
+	"time_iso8601":    {Name: "time", Kind: Time},
+	"msec":            {Name: "time", Kind: Time},
+	"request":         {Name: "request", Kind: Request},
+	"status":          {Name: "status", Kind: Status},
+	"body_bytes_sent": {Name: "bytes", Kind: Bytes},
+	"bytes_sent":      {Name: "bytes_sent", Kind: Bytes},
+	"request_length":  {Name: "bytes_received", Kind: Bytes},
+	"request_time":    {Name: "duration_s", Kind: DurationS},
+	"request_method":  {Name: "method"},
+	"request_uri":     {Name: "uri"},
+	"uri":             {Name: "path"},
+	"args":            {Name: "query"},
+	"query_string":    {Name: "query"},
+	"server_protocol": {Name: "protocol"},
+	"server_port":     {Name: "port"},
+	"host":            {Name: "vhost"},
+	"pid":             {Name: "pid", Kind: Pid},
+}
+
+func headerPropertyName(prefix, header string) string {
+	header = strings.Replace(strings.ToLower(header), "-", "_", -1)
+	switch header {
+	case "referer", "user_agent":
+		if prefix == "req_" {
+			return header
+		}
+	}
+	return prefix + header
+}
+
+// compileApacheFormat parses an Apache LogFormat string.
+func compileApacheFormat(format string) ([]Token, error) {
+	format = strings.Replace(format, `\"`, `"`, -1)
+	var tokens []Token
+	var literal []byte
+	flush := func() {
+		if len(literal) > 0 {
+			tokens = append(tokens, Token{Literal: literal})
+			literal = nil
+		}
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			literal = append(literal, format[i])
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			literal = append(literal, '%')
+			continue
+		}
+		// modifiers: %>s, %<s, %!200,304{...}i
+		for i < len(format) && strings.IndexByte("<>!,0123456789", format[i]) != -1 {
+			i++
+		}
+		var param string
+		if i < len(format) && format[i] == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end == -1 {
+				return nil, eerrors.New("Unterminated parameter in access log format")
+			}
+			param = format[i+1 : i+end]
+			i += end + 1
+		}
+		if i >= len(format) {
+			return nil, eerrors.New("Truncated directive at the end of access log format")
+		}
+		var field Field
+		switch format[i] {
+		case 'i':
+			field = Field{Name: headerPropertyName("req_", param)}
+		case 'o':
+			field = Field{Name: headerPropertyName("resp_", param)}
+		case 'e':
+			field = Field{Name: headerPropertyName("env_", param)}
+		case 'C':
+			field = Field{Name: headerPropertyName("cookie_", param)}
+		case 'n':
+			field = Field{Name: headerPropertyName("note_", param)}
+		case 'T':
+			switch param {
+			case "ms":
+				field = Field{Name: "duration_ms", Kind: DurationMS}
+			case "us":
+				field = Field{Name: "duration_us", Kind: DurationUS}
+			default:
+				field = Field{Name: "duration_s", Kind: DurationS}
+			}
+		case 't':
+			// %{sec}t, %{msec}t, %{usec}t, possibly prefixed by begin: or end:.
+			// The strftime formats are not supported.
+			unit := strings.TrimPrefix(strings.TrimPrefix(param, "begin:"), "end:")
+			switch unit {
+			case "", "sec", "msec", "usec":
+			default:
+				return nil, eerrors.Errorf("Unsupported access log time format: '%%{%s}t'", param)
+			}
+			field = apacheDirectives['t']
+			field.Param = unit
+		default:
+			var ok bool
+			field, ok = apacheDirectives[format[i]]
+			if !ok {
+				return nil, eerrors.Errorf("Unknown access log format directive: '%%%c'", format[i])
+			}
+			field.Param = param
+		}
+		flush()
+		tokens = append(tokens, Token{Field: &field})
+	}
+	flush()
+	return tokens, nil
+}
+
+func isNginxVarChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// compileNginxFormat parses a nginx log_format string.
+func compileNginxFormat(format string) ([]Token, error) {
+	var tokens []Token
+	var literal []byte
+	for i := 0; i < len(format); i++ {
+		if format[i] != '$' {
+			literal = append(literal, format[i])
+			continue
+		}
+		i++
+		var name string
+		if i < len(format) && format[i] == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end == -1 {
+				return nil, eerrors.New("Unterminated variable in access log format")
+			}
+			name = format[i+1 : i+end]
+			i += end
+		} else {
+			start := i
+			for i < len(format) && isNginxVarChar(format[i]) {
+				i++
+			}
+			name = format[start:i]
+			i--
+		}
+		if len(name) == 0 {
+			return nil, eerrors.New("Empty variable name in access log format")
+		}
+		field, ok := nginxVariables[name]
+		if !ok {
+			switch {
+			case strings.HasPrefix(name, "http_"):
+				field = Field{Name: headerPropertyName("req_", name[5:])}
+			case strings.HasPrefix(name, "sent_http_"):
+				field = Field{Name: headerPropertyName("resp_", name[10:])}
+			case strings.HasPrefix(name, "cookie_"):
+				field = Field{Name: headerPropertyName("cookie_", name[7:])}
+			default:
+				field = Field{Name: name}
+			}
+		}
+		if len(literal) > 0 {
+			tokens = append(tokens, Token{Literal: literal})
+			literal = nil
+		}
+		tokens = append(tokens, Token{Field: &field})
+	}
+	if len(literal) > 0 {
+		tokens = append(tokens, Token{Literal: literal})
+	}
+	return tokens, nil
+}
+
+// Compile parses the given Apache LogFormat or nginx log_format string. The
+// usual nicknames (common, combined, vhost_combined, nginx, nginx_main) are
+// accepted.
+func Compile(format string) ([]Token, error) {
+	if f, ok := nicknames[strings.TrimSpace(format)]; ok {
+		format = f
+	}
+	if strings.IndexByte(format, '$') != -1 && strings.IndexByte(format, '%') == -1 {
+		return compileNginxFormat(format)
+	}
+	return compileApacheFormat(format)
+}
@@ -0,0 +1,89 @@
+package decoders
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		raw      string
+		appname  string
+		severity model.Severity
+		props    map[string]string
+	}{
+		{
+			name:     "apache combined",
+			format:   "combined",
+			raw:      `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			severity: model.Sinfo,
+			props: map[string]string{
+				"remote_host": "127.0.0.1",
+				"user":        "frank",
+				"method":      "GET",
+				"uri":         "/apache_pb.gif",
+				"status":      "200",
+				"bytes":       "2326",
+				"referer":     "http://www.example.com/start.html",
+				"user_agent":  "Mozilla/4.08 [en] (Win98; I ;Nav)",
+			},
+		},
+		{
+			name:     "apache custom",
+			format:   `%a %>s %b %D "%{X-Request-Id}i" "%r"`,
+			raw:      `10.0.0.1 503 - 1500 "abc" "POST /a\"b HTTP/1.1"`,
+			severity: model.Serr,
+			props: map[string]string{
+				"client_ip":        "10.0.0.1",
+				"bytes":            "0",
+				"latency_ms":       "1.5",
+				"req_x_request_id": "abc",
+				"request":          `POST /a\"b HTTP/1.1`,
+			},
+		},
+		{
+			name:     "nginx over syslog",
+			format:   `$remote_addr [$time_local] "$request" $status $body_bytes_sent $request_time "$http_user_agent"`,
+			raw:      `<190>Feb 14 19:04:54 web1 nginx: 192.168.1.1 [14/Feb/2018:19:04:54 +0100] "GET / HTTP/1.1" 404 12 0.250 "curl/7.58"`,
+			appname:  "nginx",
+			severity: model.SWarning,
+			props: map[string]string{
+				"client_ip":  "192.168.1.1",
+				"status":     "404",
+				"latency_ms": "250",
+				"user_agent": "curl/7.58",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := AccessLogDecoder(tt.format)
+			if !assert.NoError(t, err) {
+				return
+			}
+			msgs, err := p([]byte(tt.raw))
+			if !assert.NoError(t, err) || !assert.Len(t, msgs, 1) {
+				return
+			}
+			msg := msgs[0]
+			assert.Equal(t, tt.appname, msg.AppName)
+			assert.Equal(t, tt.severity, msg.Severity)
+			for k, v := range tt.props {
+				assert.Equal(t, v, msg.GetProperty("accesslog", k), k)
+			}
+		})
+	}
+
+	for _, format := range []string{`%h %Z`, `%h %{%Y-%m-%d}t`, `%h %{begin:%d/%b}t`, `%h %{`} {
+		_, err := AccessLogDecoder(format)
+		assert.Error(t, err, format)
+	}
+	for _, format := range []string{`%h %t`, `%h %{msec}t`, `%h %{end:usec}t`} {
+		_, err := AccessLogDecoder(format)
+		assert.NoError(t, err, format)
+	}
+}
@@ -17,19 +17,31 @@ const (
 	Collectd
 	W3C
 	LTSV
+	CEF
+	LEEF
+	Grok
+	Logfmt
+	AccessLog
+	RFC3164Local
 )
 
 var Formats = map[string]Format{
-	"rfc5424":     RFC5424,
-	"rfc3164":     RFC3164,
-	"json":        JSON,
-	"rsyslogjson": RsyslogJSON,
-	"gelf":        GELF,
-	"influxdb":    InfluxDB,
-	"protobuf":    Protobuf,
-	"collectd":    Collectd,
-	"w3c":         W3C,
-	"ltsv":        LTSV,
+	"rfc5424":      RFC5424,
+	"rfc3164":      RFC3164,
+	"json":         JSON,
+	"rsyslogjson":  RsyslogJSON,
+	"gelf":         GELF,
+	"influxdb":     InfluxDB,
+	"protobuf":     Protobuf,
+	"collectd":     Collectd,
+	"w3c":          W3C,
+	"ltsv":         LTSV,
+	"cef":          CEF,
+	"leef":         LEEF,
+	"grok":         Grok,
+	"logfmt":       Logfmt,
+	"accesslog":    AccessLog,
+	"rfc3164local": RFC3164Local,
 }
 
 func ParseFormat(format string) Format {
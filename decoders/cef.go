@@ -0,0 +1,307 @@
+package decoders
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// CEF:Version|Device Vendor|Device Product|Device Version|Device Event Class ID|Name|Severity|[Extension]
+//
+// The CEF payload may be sent as is, or inside a RFC3164/RFC5424 envelope:
+// <PRI>Mmm dd hh:mm:ss HOSTNAME CEF:0|...
+// <PRI>1 TIMESTAMP HOSTNAME APPNAME PROCID MSGID - CEF:0|...
+
+var cefMarker = []byte("CEF:")
+
+// names of the CEF header fields, as defined by the ArcSight dictionary
+var cefHeaderNames = []string{
+	"cefVersion",
+	"deviceVendor",
+	"deviceProduct",
+	"deviceVersion",
+	"deviceEventClassId",
+	"name",
+	"severity",
+}
+
+func pCEF(m []byte) ([]*model.SyslogMessage, error) {
+	m = bytes.TrimSpace(m)
+	msg, payload := splitEnvelope(m, cefMarker)
+	if !bytes.HasPrefix(payload, cefMarker) {
+		model.Free(msg)
+		return nil, CEFDecodingError(eerrors.New("Missing CEF prefix"))
+	}
+	header, ext, err := splitHeader(payload[len(cefMarker):], len(cefHeaderNames))
+	if err != nil {
+		model.Free(msg)
+		return nil, CEFDecodingError(err)
+	}
+
+	msg.ClearDomain("cef")
+	for i, name := range cefHeaderNames {
+		msg.SetProperty("cef", name, header[i])
+	}
+	if len(header[2]) > 0 {
+		msg.AppName = header[2]
+	}
+	msg.MsgId = header[4]
+	msg.Message = header[5]
+	msg.Severity = cefSeverity(header[6])
+	msg.SetPriority()
+
+	err = parseCEFExtension(ext, func(key, value string) {
+		msg.SetProperty("cef", key, value)
+		switch key {
+		case "dvchost":
+			if len(msg.HostName) == 0 {
+				msg.HostName = value
+			}
+		case "dvcpid":
+			if len(msg.ProcId) == 0 {
+				msg.ProcId = value
+			}
+		case "rt":
+			if t, ok := parseSecurityTime(value, ""); ok {
+				msg.TimeReportedNum = t.UnixNano()
+			}
+		}
+	})
+	if err != nil {
+		model.Free(msg)
+		return nil, CEFDecodingError(err)
+	}
+	return []*model.SyslogMessage{msg}, nil
+}
+
+// splitEnvelope separates the optional syslog envelope from the payload that
+// begins with marker. The returned message holds the envelope fields.
+func splitEnvelope(m []byte, marker []byte) (msg *model.SyslogMessage, payload []byte) {
+	now := time.Now().UnixNano()
+	idx := bytes.Index(m, marker)
+	if idx <= 0 || m[0] != '<' {
+		msg = model.Factory()
+		msg.Version = 1
+		msg.Facility = model.Fuser
+		msg.Severity = model.Sinfo
+		msg.SetPriority()
+		msg.TimeGeneratedNum = now
+		msg.TimeReportedNum = now
+		if idx < 0 {
+			return msg, m
+		}
+		return msg, m[idx:]
+	}
+	envelope := bytes.TrimSpace(m[:idx])
+	payload = m[idx:]
+	var msgs []*model.SyslogMessage
+	var err error
+	priEnd := bytes.IndexByte(envelope, '>')
+	if priEnd > 0 && bytes.HasPrefix(envelope[priEnd+1:], []byte("1 ")) {
+		msgs, err = p5424(envelope)
+	} else {
+		msgs, err = p3164(envelope)
+	}
+	if err != nil || len(msgs) == 0 {
+		return splitEnvelope(payload, marker)
+	}
+	msg = msgs[0]
+	if len(msg.HostName) == 0 && len(msg.AppName) == 0 && isHostname([]byte(msg.Message)) {
+		// "<PRI>TIMESTAMP HOSTNAME CEF:..."
+		msg.HostName = msg.Message
+	}
+	msg.Message = ""
+	msg.Version = 1
+	if msg.TimeGeneratedNum == 0 {
+		msg.TimeGeneratedNum = now
+	}
+	if msg.TimeReportedNum == 0 {
+		msg.TimeReportedNum = now
+	}
+	return msg, payload
+}
+
+// splitHeader splits the n pipe-separated header fields. The remaining bytes
+// after the last pipe are returned as the extension.
+func splitHeader(m []byte, n int) (header []string, ext []byte, err error) {
+	header = make([]string, 0, n)
+	start := 0
+	for i := 0; i < len(m) && len(header) < n; i++ {
+		switch m[i] {
+		case '\\':
+			i++
+		case '|':
+			header = append(header, unescapeHeader(m[start:i]))
+			start = i + 1
+		}
+	}
+	if len(header) < n {
+		return nil, nil, eerrors.Errorf("Not enough header fields: %d, expected %d", len(header), n)
+	}
+	return header, m[start:], nil
+}
+
+func unescapeHeader(b []byte) string {
+	if bytes.IndexByte(b, '\\') == -1 {
+		return string(b)
+	}
+	res := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] == '\\' && i+1 < len(b) && (b[i+1] == '\\' || b[i+1] == '|') {
+			i++
+		}
+		res = append(res, b[i])
+	}
+	return string(res)
+}
+
+func unescapeValue(b []byte) string {
+	if bytes.IndexByte(b, '\\') == -1 {
+		return string(b)
+	}
+	res := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] == '\\' && i+1 < len(b) {
+			i++
+			switch b[i] {
+			case 'n':
+				res = append(res, '\n')
+			case 'r':
+				res = append(res, '\r')
+			case 't':
+				res = append(res, '\t')
+			default:
+				res = append(res, b[i])
+			}
+			continue
+		}
+		res = append(res, b[i])
+	}
+	return string(res)
+}
+
+// parseCEFExtension parses the space separated key=value pairs of a CEF
+// extension. Values may contain spaces, so a value ends right before the
+// last space that precedes the next unescaped equal sign.
+func parseCEFExtension(ext []byte, f func(key, value string)) error {
+	ext = bytes.TrimSpace(ext)
+	if len(ext) == 0 {
+		return nil
+	}
+	var key []byte
+	keyStart := 0
+	valueStart := -1
+	for i := 0; i < len(ext); i++ {
+		switch ext[i] {
+		case '\\':
+			i++
+		case '=':
+			if valueStart == -1 {
+				key = bytes.TrimSpace(ext[keyStart:i])
+				if len(key) == 0 {
+					return eerrors.New("Empty key in CEF extension")
+				}
+				valueStart = i + 1
+				continue
+			}
+			sp := bytes.LastIndexByte(ext[valueStart:i], ' ')
+			if sp == -1 {
+				// unescaped equal sign inside the value
+				continue
+			}
+			sp += valueStart
+			f(string(key), unescapeValue(ext[valueStart:sp]))
+			key = bytes.TrimSpace(ext[sp+1 : i])
+			if len(key) == 0 {
+				return eerrors.New("Empty key in CEF extension")
+			}
+			valueStart = i + 1
+		}
+	}
+	if valueStart == -1 {
+		return eerrors.New("Invalid CEF extension")
+	}
+	f(string(key), unescapeValue(bytes.TrimRight(ext[valueStart:], " ")))
+	return nil
+}
+
+// cefSeverity converts a CEF severity (0-10 or Unknown, Low, Medium, High,
+// Very-High) to a syslog severity.
+func cefSeverity(s string) model.Severity {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil {
+		switch {
+		case n <= 1:
+			return model.Sdebug
+		case n <= 3:
+			return model.Sinfo
+		case n == 4:
+			return model.Snotice
+		case n <= 6:
+			return model.SWarning
+		case n == 7:
+			return model.Serr
+		case n == 8:
+			return model.Scrit
+		case n == 9:
+			return model.Salert
+		default:
+			return model.Semerg
+		}
+	}
+	switch strings.ToLower(s) {
+	case "low":
+		return model.Sinfo
+	case "medium":
+		return model.SWarning
+	case "high":
+		return model.Serr
+	case "very-high":
+		return model.Salert
+	default:
+		return model.Sinfo
+	}
+}
+
+var securityTimeLayouts = []string{
+	"Jan 02 2006 15:04:05.000 MST",
+	"Jan 02 2006 15:04:05.000",
+	"Jan 02 2006 15:04:05 MST",
+	"Jan 02 2006 15:04:05",
+	"Jan 02 15:04:05.000 MST",
+	"Jan 02 15:04:05.000",
+	"Jan 02 15:04:05 MST",
+	"Jan 02 15:04:05",
+	time.RFC3339Nano,
+}
+
+// parseSecurityTime parses the timestamps found in CEF and LEEF messages:
+// milliseconds since epoch, or one of the layouts allowed by the specs.
+func parseSecurityTime(s string, layout string) (t time.Time, ok bool) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return t, false
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)), true
+	}
+	if len(layout) > 0 {
+		t, err := time.Parse(layout, s)
+		return t, err == nil
+	}
+	var err error
+	for _, l := range securityTimeLayouts {
+		t, err = time.Parse(l, s)
+		if err == nil {
+			if t.Year() == 0 {
+				t = t.AddDate(time.Now().Year(), 0, 0)
+			}
+			return t, true
+		}
+	}
+	return t, false
+}
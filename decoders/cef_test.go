@@ -0,0 +1,71 @@
+package decoders
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCEF(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		hostname string
+		appname  string
+		severity model.Severity
+		message  string
+		props    map[string]string
+	}{
+		{
+			name:     "bare",
+			raw:      `CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 spt=1232`,
+			appname:  "threatmanager",
+			severity: model.Semerg,
+			message:  "worm successfully stopped",
+			props:    map[string]string{"deviceVendor": "Security", "src": "10.0.0.1", "dst": "2.1.2.2", "spt": "1232"},
+		},
+		{
+			name:     "escaping",
+			raw:      `CEF:0|Vendor|Pro\|duct|1.0|ID|Name|Low|msg=hello world a\=b\nc act=blocked a \= b`,
+			appname:  "Pro|duct",
+			severity: model.Sinfo,
+			message:  "Name",
+			props:    map[string]string{"msg": "hello world a=b\nc", "act": "blocked a = b"},
+		},
+		{
+			name:     "rfc3164 envelope",
+			raw:      `<134>Feb 14 19:04:54 myhost CEF:0|Vendor|Product|1.0|ID|Name|7|rt=1516273673000 cs1=x`,
+			hostname: "myhost",
+			appname:  "Product",
+			severity: model.Serr,
+			message:  "Name",
+			props:    map[string]string{"rt": "1516273673000", "cs1": "x"},
+		},
+		{
+			name:     "rfc5424 envelope",
+			raw:      `<134>1 2018-02-14T19:04:54Z host app 123 - - CEF:0|V|P|1|I|N|4|`,
+			hostname: "host",
+			appname:  "P",
+			severity: model.Snotice,
+			message:  "N",
+			props:    map[string]string{"deviceEventClassId": "I"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := pCEF([]byte(tt.raw))
+			if !assert.NoError(t, err) || !assert.Len(t, msgs, 1) {
+				return
+			}
+			msg := msgs[0]
+			assert.Equal(t, tt.hostname, msg.HostName)
+			assert.Equal(t, tt.appname, msg.AppName)
+			assert.Equal(t, tt.severity, msg.Severity)
+			assert.Equal(t, tt.message, msg.Message)
+			for k, v := range tt.props {
+				assert.Equal(t, v, msg.GetProperty("cef", k), k)
+			}
+		})
+	}
+}
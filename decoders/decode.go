@@ -17,16 +17,22 @@ import (
 type BaseParser func([]byte) ([]*model.SyslogMessage, error)
 
 var parsers = map[base.Format](func([]byte) ([]*model.SyslogMessage, error)){
-	base.RFC5424:     p5424,
-	base.RFC3164:     p3164,
-	base.JSON:        pJSON,
-	base.RsyslogJSON: pRsyslogJSON,
-	base.GELF:        pGELF,
-	base.InfluxDB:    pInflux,
-	base.Protobuf:    pProtobuf,
-	base.Collectd:    pCollectd,
-	base.LTSV:        pLTSV,
-	base.W3C:         nil,
+	base.RFC5424:      p5424,
+	base.RFC3164:      p3164,
+	base.JSON:         pJSON,
+	base.RsyslogJSON:  pRsyslogJSON,
+	base.GELF:         pGELF,
+	base.InfluxDB:     pInflux,
+	base.Protobuf:     pProtobuf,
+	base.Collectd:     pCollectd,
+	base.LTSV:         pLTSV,
+	base.W3C:          nil,
+	base.CEF:          pCEF,
+	base.LEEF:         pLEEF,
+	base.Grok:         nil,
+	base.Logfmt:       nil,
+	base.AccessLog:    nil,
+	base.RFC3164Local: p3164local,
 }
 
 type Parser interface {
@@ -64,19 +70,19 @@ func (p *jsParser) Parse(m []byte) ([]*model.SyslogMessage, error) {
 type ParsersEnv struct {
 	sync.Mutex
 	parserCache *gotomic.Hash
-	jsFuncs     map[string]string
+	jsFuncs     map[string]conf.ParserConfig
 	jsEnvsPool  *sync.Pool
 	logger      log15.Logger
 }
 
 func NewParsersEnv(config []conf.ParserConfig, logger log15.Logger) *ParsersEnv {
 	env := ParsersEnv{
-		jsFuncs:     make(map[string]string, len(config)),
+		jsFuncs:     make(map[string]conf.ParserConfig, len(config)),
 		logger:      logger,
 		parserCache: gotomic.NewHash(),
 	}
 	for _, c := range config {
-		env.jsFuncs[c.Name] = c.Func
+		env.jsFuncs[c.Name] = c
 	}
 	env.jsEnvsPool = &sync.Pool{New: env.newJSEnv}
 	return &env
@@ -84,10 +90,11 @@ func NewParsersEnv(config []conf.ParserConfig, logger log15.Logger) *ParsersEnv
 
 func (e *ParsersEnv) newJSEnv() interface{} {
 	jsEnv := javascript.NewParsersEnvironment(e.logger)
-	var jsFuncName, jsFuncBody string
+	var jsFuncName string
+	var jsFunc conf.ParserConfig
 	var err error
-	for jsFuncName, jsFuncBody = range e.jsFuncs {
-		err = jsEnv.AddParser(jsFuncName, jsFuncBody)
+	for jsFuncName, jsFunc = range e.jsFuncs {
+		err = jsEnv.AddParser(jsFuncName, jsFunc.Func, jsFunc.JSBudgetConfig)
 		if err != nil {
 			e.logger.Warn("Error initializing parser", "name", jsFuncName, "error", err)
 		}
@@ -96,7 +103,14 @@ func (e *ParsersEnv) newJSEnv() interface{} {
 }
 
 func (e *ParsersEnv) getJSEnv() *javascript.Environment {
-	return e.jsEnvsPool.Get().(*javascript.Environment)
+	for {
+		jsEnv := e.jsEnvsPool.Get().(*javascript.Environment)
+		// the environments that were created before the scripts were
+		// reloaded are thrown away
+		if !jsEnv.Obsolete() {
+			return jsEnv
+		}
+	}
 }
 
 func (e *ParsersEnv) Parse(c *conf.DecoderBaseConfig, m []byte) ([]*model.SyslogMessage, error) {
@@ -160,6 +174,26 @@ func (e *ParsersEnv) getNonJSParser(frmt base.Format, c *conf.DecoderBaseConfig)
 			return nil, DecodingError(eerrors.New("No fields specified for W3C Extended Log Format decoder"))
 		}
 		p = W3CDecoder(c.W3CFields)
+	} else if frmt == base.Grok {
+		// so is the grok parser
+		if len(c.GrokPattern) == 0 {
+			return nil, DecodingError(eerrors.New("No pattern specified for grok decoder"))
+		}
+		var err error
+		p, err = GrokDecoder(c.GrokPattern, c.GrokPatterns)
+		if err != nil {
+			return nil, DecodingError(err)
+		}
+	} else if frmt == base.Logfmt {
+		p = LogfmtDecoder(c.LogfmtPairSeparator, c.LogfmtKVSeparator)
+	} else if frmt == base.RFC5424 && c.Lenient {
+		p = p5424Lenient
+	} else if frmt == base.AccessLog {
+		var err error
+		p, err = AccessLogDecoder(c.AccessLogFormat)
+		if err != nil {
+			return nil, DecodingError(err)
+		}
 	} else {
 		p = parsers[frmt]
 	}
@@ -173,7 +207,7 @@ func (e *ParsersEnv) getNonJSParser(frmt base.Format, c *conf.DecoderBaseConfig)
 
 func parserWithEncoding(frmt base.Format, charset string, p func([]byte) ([]*model.SyslogMessage, error)) func([]byte) ([]*model.SyslogMessage, error) {
 	switch frmt {
-	case base.RFC3164, base.RFC5424, base.W3C:
+	case base.RFC3164, base.RFC5424, base.W3C, base.CEF, base.LEEF, base.Grok, base.Logfmt, base.AccessLog, base.RFC3164Local:
 		return func(m []byte) ([]*model.SyslogMessage, error) {
 			var err error
 			m, err = utils.SelectDecoder(charset).Bytes(m)
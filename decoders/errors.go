@@ -53,6 +53,36 @@ func W3CDecodingError(err error) error {
 	)
 }
 
+func CEFDecodingError(err error) error {
+	return DecodingError(
+		eerrors.Wrap(err, "Error decoding CEF message"),
+	)
+}
+
+func LEEFDecodingError(err error) error {
+	return DecodingError(
+		eerrors.Wrap(err, "Error decoding LEEF message"),
+	)
+}
+
+func GrokDecodingError(err error) error {
+	return DecodingError(
+		eerrors.Wrap(err, "Error decoding message with grok pattern"),
+	)
+}
+
+func LogfmtDecodingError(err error) error {
+	return DecodingError(
+		eerrors.Wrap(err, "Error decoding logfmt message"),
+	)
+}
+
+func AccessLogDecodingError(err error) error {
+	return DecodingError(
+		eerrors.Wrap(err, "Error decoding access log message"),
+	)
+}
+
 var ErrInvalidSD = DecodingError(eerrors.New("Invalid structured data"))
 
 var ErrInvalidPriority = DecodingError(eerrors.New("Invalid priority field"))
@@ -0,0 +1,190 @@
+// Package grok compiles logstash-like grok expressions into golang regular
+// expressions.
+//
+// A grok expression is a regular expression that may reference named patterns
+// with the %{SYNTAX}, %{SYNTAX:SEMANTIC} or %{SYNTAX:SEMANTIC:TYPE} notation.
+// When SEMANTIC is given, the matched text is captured under that name. TYPE
+// can be "int" or "float": the captured value is then normalized as a number.
+//
+// As golang regexps do not support lookarounds or atomic groups, the default
+// pattern library is an RE2 compatible adaptation of the logstash patterns.
+package grok
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const maxDepth = 64
+
+var referenceRe = regexp.MustCompile(`%{(\w+(?:-\w+)*)(?::([\w.\[\]-]+))?(?::(\w+))?}`)
+var namedGroupRe = regexp.MustCompile(`\(\?<(\w+)>`)
+
+// Grok holds a library of named patterns.
+type Grok struct {
+	patterns map[string]string
+}
+
+// New returns a Grok initialized with the default pattern library.
+func New() *Grok {
+	g := &Grok{patterns: make(map[string]string, len(defaultPatterns))}
+	for name, p := range defaultPatterns {
+		g.patterns[name] = p
+	}
+	return g
+}
+
+// AddPattern adds (or replaces) a named pattern.
+func (g *Grok) AddPattern(name, pattern string) {
+	g.patterns[name] = pattern
+}
+
+// AddPatterns parses pattern definitions, in the logstash pattern files
+// format: one "NAME PATTERN" definition per line. Empty lines and lines
+// starting with # are ignored.
+func (g *Grok) AddPatterns(definitions string) error {
+	scanner := bufio.NewScanner(strings.NewReader(definitions))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		idx := strings.IndexAny(line, " \t")
+		if idx == -1 {
+			return fmt.Errorf("Invalid grok pattern definition at line %d", lineNumber)
+		}
+		g.AddPattern(line[:idx], strings.TrimSpace(line[idx+1:]))
+	}
+	return scanner.Err()
+}
+
+// Field describes a named capture of a compiled grok expression.
+type Field struct {
+	Name string
+	Type string
+}
+
+// Pattern is a compiled grok expression.
+type Pattern struct {
+	re     *regexp.Regexp
+	fields []Field
+	// groups maps the regexp submatch indices to the fields
+	groups []int
+}
+
+// Compile expands the pattern references found in expr and compiles the result.
+func (g *Grok) Compile(expr string) (*Pattern, error) {
+	p := &Pattern{}
+	expanded, err := g.expand(expr, p, 0)
+	if err != nil {
+		return nil, err
+	}
+	p.re, err = regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid grok expression: %s", err)
+	}
+	p.groups = make([]int, len(p.re.SubexpNames()))
+	for i, name := range p.re.SubexpNames() {
+		p.groups[i] = -1
+		if len(name) == 0 {
+			continue
+		}
+		if strings.HasPrefix(name, "grok") {
+			if n, err := strconv.Atoi(name[4:]); err == nil && n < len(p.fields) {
+				p.groups[i] = n
+				continue
+			}
+		}
+		// a named capture written as a raw regexp
+		p.groups[i] = len(p.fields)
+		p.fields = append(p.fields, Field{Name: name})
+	}
+	return p, nil
+}
+
+func (g *Grok) expand(expr string, p *Pattern, depth int) (string, error) {
+	if depth > maxDepth {
+		return "", fmt.Errorf("Grok patterns are nested too deep (recursive definition?)")
+	}
+	var err error
+	expr = namedGroupRe.ReplaceAllString(expr, "(?P<$1>")
+	expanded := referenceRe.ReplaceAllStringFunc(expr, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		parts := referenceRe.FindStringSubmatch(ref)
+		syntax, semantic, typ := parts[1], parts[2], parts[3]
+		pattern, ok := g.patterns[syntax]
+		if !ok {
+			err = fmt.Errorf("Unknown grok pattern: '%s'", syntax)
+			return ""
+		}
+		switch typ {
+		case "", "string", "int", "float":
+		default:
+			err = fmt.Errorf("Unknown grok type conversion: '%s'", typ)
+			return ""
+		}
+		var sub string
+		sub, err = g.expand(pattern, p, depth+1)
+		if err != nil {
+			return ""
+		}
+		if len(semantic) == 0 {
+			return "(?:" + sub + ")"
+		}
+		p.fields = append(p.fields, Field{Name: semantic, Type: typ})
+		return fmt.Sprintf("(?P<grok%d>%s)", len(p.fields)-1, sub)
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+// Fields returns the named captures of the pattern.
+func (p *Pattern) Fields() []Field {
+	return p.fields
+}
+
+// Parse matches line against the pattern. For each named capture that
+// participated in the match, f is called with the field and the captured
+// value, converted according to the field type.
+func (p *Pattern) Parse(line []byte, f func(field Field, value string)) bool {
+	indices := p.re.FindSubmatchIndex(line)
+	if indices == nil {
+		return false
+	}
+	for i, n := range p.groups {
+		if n == -1 || indices[2*i] == -1 {
+			continue
+		}
+		field := p.fields[n]
+		f(field, Convert(string(line[indices[2*i]:indices[2*i+1]]), field.Type))
+	}
+	return true
+}
+
+// Convert normalizes value according to the grok type. Values that can not
+// be converted are returned unchanged.
+func Convert(value string, typ string) string {
+	switch typ {
+	case "int":
+		if i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+		if fl, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			return strconv.FormatInt(int64(fl), 10)
+		}
+	case "float":
+		if fl, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			return strconv.FormatFloat(fl, 'f', -1, 64)
+		}
+	}
+	return value
+}
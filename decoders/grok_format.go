@@ -0,0 +1,139 @@
+package decoders
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stephane-martin/skewer/decoders/grok"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// GrokDecoder makes a decoder from the given grok expression. definitions
+// holds additional pattern definitions, in the logstash patterns file format.
+//
+// Captures named after the syslog fields (hostname, appname, procid, msgid,
+// message, timestamp, severity, facility, and the usual logstash aliases)
+// fill the corresponding fields. Captures named like "domain.key" are stored
+// as properties in that domain, the others in the "grok" domain.
+func GrokDecoder(pattern string, definitions string) (func([]byte) ([]*model.SyslogMessage, error), error) {
+	g := grok.New()
+	err := g.AddPatterns(definitions)
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Invalid grok pattern definitions")
+	}
+	compiled, err := g.Compile(pattern)
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Invalid grok pattern")
+	}
+	return func(m []byte) ([]*model.SyslogMessage, error) {
+		now := time.Now().UnixNano()
+		msg := model.Factory()
+		msg.ClearDomain("grok")
+		msg.Version = 1
+		msg.Facility = model.Fuser
+		msg.Severity = model.Sinfo
+		msg.TimeGeneratedNum = now
+		msg.TimeReportedNum = now
+		msg.Message = string(m)
+
+		matched := compiled.Parse(m, func(field grok.Field, value string) {
+			switch field.Name {
+			case "hostname", "host", "logsource":
+				msg.HostName = value
+			case "appname", "program":
+				msg.AppName = value
+			case "procid", "pid":
+				msg.ProcId = value
+			case "msgid":
+				msg.MsgId = value
+			case "message":
+				msg.Message = value
+			case "timestamp":
+				if t, ok := parseLogTime(value); ok {
+					msg.TimeReportedNum = t.UnixNano()
+				} else {
+					msg.SetProperty("grok", field.Name, value)
+				}
+			case "severity", "level", "loglevel":
+				msg.Severity = levelSeverity(value)
+			case "facility":
+				if f, err := strconv.Atoi(value); err == nil && f >= 0 && f < 24 {
+					msg.Facility = model.Facility(f)
+				} else {
+					msg.Facility = model.FacilityFromString(strings.ToLower(value))
+				}
+			default:
+				if dot := strings.IndexByte(field.Name, '.'); dot > 0 && dot < len(field.Name)-1 {
+					msg.SetProperty(field.Name[:dot], field.Name[dot+1:], value)
+				} else {
+					msg.SetProperty("grok", field.Name, value)
+				}
+			}
+		})
+		if !matched {
+			model.Free(msg)
+			return nil, GrokDecodingError(eerrors.New("The message does not match the pattern"))
+		}
+		msg.SetPriority()
+		return []*model.SyslogMessage{msg}, nil
+	}, nil
+}
+
+var logTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05,999999999",
+	"2006/01/02 15:04:05",
+	"02/Jan/2006:15:04:05 -0700",
+	"02/Jan/2006:15:04:05.000",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.UnixDate,
+	"Jan _2 15:04:05.999999999",
+}
+
+// parseLogTime parses the timestamps commonly found in application logs.
+func parseLogTime(s string) (t time.Time, ok bool) {
+	s = strings.TrimSpace(s)
+	var err error
+	for _, layout := range logTimeLayouts {
+		t, err = time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			if t.Year() == 0 {
+				// syslog timestamps do not include the year
+				t = t.AddDate(time.Now().Year(), 0, 0)
+			}
+			return t, true
+		}
+	}
+	return t, false
+}
+
+// levelSeverity converts a syslog severity, a log level as used by the
+// common logging libraries, or a severity number, to a syslog severity.
+func levelSeverity(s string) model.Severity {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= 7 {
+		return model.Severity(n)
+	}
+	switch s {
+	case "emergency", "panic":
+		return model.Semerg
+	case "fatal", "critical":
+		return model.Scrit
+	case "error", "severe":
+		return model.Serr
+	case "warn":
+		return model.SWarning
+	case "trace":
+		return model.Sdebug
+	default:
+		return model.SeverityFromString(s)
+	}
+}
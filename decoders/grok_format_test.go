@@ -0,0 +1,88 @@
+package decoders
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrok(t *testing.T) {
+	tests := []struct {
+		name        string
+		pattern     string
+		definitions string
+		raw         string
+		hostname    string
+		appname     string
+		procid      string
+		severity    model.Severity
+		message     string
+		props       map[string]string
+	}{
+		{
+			name:     "nginx",
+			pattern:  `%{NGINXACCESS}`,
+			raw:      `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+			severity: model.Sinfo,
+			message:  `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+			props:    map[string]string{"clientip": "127.0.0.1", "auth": "frank", "verb": "GET", "response": "200", "bytes": "2326", "agent": `"Mozilla/4.08"`},
+		},
+		{
+			name:     "postfix",
+			pattern:  `%{POSTFIX}`,
+			raw:      `Feb 14 19:04:54 mail postfix/smtp[4242]: 3F2A41C2: to=<bob@example.org>, relay=mx.example.org[10.0.0.2]:25, delay=0.50, delays=0.1/0/0.2/0.2, dsn=2.0.0, status=sent (250 OK)`,
+			hostname: "mail",
+			appname:  "postfix/smtp",
+			procid:   "4242",
+			severity: model.Sinfo,
+			props:    map[string]string{"postfix_queueid": "3F2A41C2", "postfix_to": "bob@example.org", "postfix_delay": "0.5", "postfix_status": "sent"},
+		},
+		{
+			name:        "custom",
+			pattern:     `%{MYLEVEL:severity} %{WORD:app.user} %{GREEDYDATA:message}`,
+			definitions: "# comment\nMYLEVEL [A-Z]+\n",
+			raw:         `WARN alice something happened`,
+			severity:    model.SWarning,
+			message:     "something happened",
+			props:       map[string]string{"app.user": "alice"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := GrokDecoder(tt.pattern, tt.definitions)
+			if !assert.NoError(t, err) {
+				return
+			}
+			msgs, err := p([]byte(tt.raw))
+			if !assert.NoError(t, err) || !assert.Len(t, msgs, 1) {
+				return
+			}
+			msg := msgs[0]
+			assert.Equal(t, tt.hostname, msg.HostName)
+			assert.Equal(t, tt.appname, msg.AppName)
+			assert.Equal(t, tt.procid, msg.ProcId)
+			assert.Equal(t, tt.severity, msg.Severity)
+			if len(tt.message) > 0 {
+				assert.Equal(t, tt.message, msg.Message)
+			}
+			for k, v := range tt.props {
+				// "domain.key" captures are routed to their own domain
+				if dot := strings.IndexByte(k, '.'); dot > 0 {
+					assert.Equal(t, v, msg.GetProperty(k[:dot], k[dot+1:]), k)
+					assert.Empty(t, msg.GetProperty("grok", k), k)
+					continue
+				}
+				assert.Equal(t, v, msg.GetProperty("grok", k), k)
+			}
+		})
+	}
+
+	p, err := GrokDecoder(`%{USER:user} says hello`, "")
+	assert.NoError(t, err)
+	_, err = p([]byte("nothing to see"))
+	assert.Error(t, err)
+	_, err = GrokDecoder(`%{DOESNOTEXIST}`, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+package decoders
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// LEEF:1.0|Vendor|Product|Version|EventID|key1=value1<tab>key2=value2
+// LEEF:2.0|Vendor|Product|Version|EventID|DelimiterCharacter|key1=value1^key2=value2
+//
+// As for CEF, the LEEF payload may be wrapped in a RFC3164/RFC5424 envelope.
+
+var leefMarker = []byte("LEEF:")
+
+var leefHeaderNames = []string{
+	"leefVersion",
+	"vendor",
+	"product",
+	"version",
+	"eventId",
+}
+
+func pLEEF(m []byte) ([]*model.SyslogMessage, error) {
+	m = bytes.TrimSpace(m)
+	msg, payload := splitEnvelope(m, leefMarker)
+	if !bytes.HasPrefix(payload, leefMarker) {
+		model.Free(msg)
+		return nil, LEEFDecodingError(eerrors.New("Missing LEEF prefix"))
+	}
+	header, attrs, err := splitHeader(payload[len(leefMarker):], len(leefHeaderNames))
+	if err != nil {
+		model.Free(msg)
+		return nil, LEEFDecodingError(err)
+	}
+	delimiter := byte('\t')
+	if strings.HasPrefix(header[0], "2") {
+		// LEEF 2.0 has an optional delimiter field
+		var d []string
+		d, attrs, err = splitHeader(attrs, 1)
+		if err != nil {
+			model.Free(msg)
+			return nil, LEEFDecodingError(err)
+		}
+		delimiter, err = leefDelimiter(d[0])
+		if err != nil {
+			model.Free(msg)
+			return nil, LEEFDecodingError(err)
+		}
+	}
+
+	msg.ClearDomain("leef")
+	for i, name := range leefHeaderNames {
+		msg.SetProperty("leef", name, header[i])
+	}
+	if len(header[2]) > 0 {
+		msg.AppName = header[2]
+	}
+	msg.MsgId = header[4]
+
+	var devTime, devTimeFormat string
+	parseLEEFAttributes(attrs, delimiter, func(key, value string) {
+		msg.SetProperty("leef", key, value)
+		switch key {
+		case "sev":
+			msg.Severity = cefSeverity(value)
+			msg.SetPriority()
+		case "devTime":
+			devTime = value
+		case "devTimeFormat":
+			devTimeFormat = value
+		case "identHostName":
+			if len(msg.HostName) == 0 {
+				msg.HostName = value
+			}
+		}
+	})
+	if len(devTime) > 0 {
+		if t, ok := parseSecurityTime(devTime, javaLayout(devTimeFormat)); ok {
+			msg.TimeReportedNum = t.UnixNano()
+		}
+	}
+	return []*model.SyslogMessage{msg}, nil
+}
+
+// leefDelimiter decodes the LEEF 2.0 delimiter field: either a single
+// character, or its hexadecimal code like "x09" or "0x09".
+func leefDelimiter(s string) (byte, error) {
+	switch {
+	case len(s) == 0:
+		return '\t', nil
+	case len(s) == 1:
+		return s[0], nil
+	}
+	h := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "0"), "x")
+	d, err := strconv.ParseUint(h, 16, 8)
+	if err != nil {
+		return 0, eerrors.Wrapf(err, "Invalid LEEF delimiter: '%s'", s)
+	}
+	return byte(d), nil
+}
+
+func parseLEEFAttributes(attrs []byte, delimiter byte, f func(key, value string)) {
+	start := 0
+	for i := 0; i <= len(attrs); i++ {
+		if i < len(attrs) {
+			if attrs[i] == '\\' {
+				i++
+				continue
+			}
+			if attrs[i] != delimiter {
+				continue
+			}
+		}
+		attr := attrs[start:i]
+		start = i + 1
+		eq := bytes.IndexByte(attr, '=')
+		if eq <= 0 {
+			continue
+		}
+		key := string(bytes.TrimSpace(attr[:eq]))
+		if len(key) > 0 {
+			f(key, unescapeValue(attr[eq+1:]))
+		}
+	}
+}
+
+var javaTokens = []struct {
+	java   string
+	golang string
+}{
+	{"yyyy", "2006"},
+	{"yy", "06"},
+	{"MMMM", "January"},
+	{"MMM", "Jan"},
+	{"MM", "01"},
+	{"dd", "02"},
+	{"d", "2"},
+	{"HH", "15"},
+	{"hh", "03"},
+	{"h", "3"},
+	{"mm", "04"},
+	{"ss", "05"},
+	{"SSS", "000"},
+	{"a", "PM"},
+	{"zzz", "MST"},
+	{"z", "MST"},
+	{"Z", "-0700"},
+	{"XXX", "-07:00"},
+	{"EEE", "Mon"},
+}
+
+// javaLayout converts a Java SimpleDateFormat pattern, as used by the LEEF
+// devTimeFormat attribute, to a golang time layout.
+func javaLayout(format string) string {
+	if len(format) == 0 {
+		return ""
+	}
+	var layout strings.Builder
+	quoted := false
+Loop:
+	for i := 0; i < len(format); {
+		if format[i] == '\'' {
+			quoted = !quoted
+			i++
+			continue
+		}
+		if !quoted {
+			for _, tok := range javaTokens {
+				if strings.HasPrefix(format[i:], tok.java) {
+					layout.WriteString(tok.golang)
+					i += len(tok.java)
+					continue Loop
+				}
+			}
+		}
+		layout.WriteByte(format[i])
+		i++
+	}
+	return layout.String()
+}
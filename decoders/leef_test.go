@@ -0,0 +1,81 @@
+package decoders
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLEEF(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		hostname string
+		appname  string
+		msgid    string
+		severity model.Severity
+		reported time.Time
+		props    map[string]string
+	}{
+		{
+			name:     "leef 1.0",
+			raw:      "LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0\tdst=172.50.123.1\tsev=5\tcat=anomaly\tmsg=hello\\tworld",
+			appname:  "MSExchange",
+			msgid:    "15345",
+			severity: model.SWarning,
+			props:    map[string]string{"vendor": "Microsoft", "version": "4.0 SP1", "src": "192.0.2.0", "cat": "anomaly", "msg": "hello\tworld"},
+		},
+		{
+			name:     "leef 2.0 delimiter",
+			raw:      "LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^identHostName=sw01",
+			hostname: "sw01",
+			appname:  "StealthWatch",
+			msgid:    "41",
+			props:    map[string]string{"leefVersion": "2.0", "src": "10.0.1.8", "dst": "10.0.0.5"},
+		},
+		{
+			name:    "leef 2.0 hex delimiter",
+			raw:     "LEEF:2.0|V|P|1|ID|x7C|a=1|b=2",
+			appname: "P",
+			msgid:   "ID",
+			props:   map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name:     "device time",
+			raw:      "<134>Feb 14 19:04:54 myhost LEEF:1.0|V|P|1|ID|devTime=2018-02-14 19:04:54.123 +0000\tdevTimeFormat=yyyy-MM-dd HH:mm:ss.SSS Z\tsev=8",
+			hostname: "myhost",
+			appname:  "P",
+			msgid:    "ID",
+			severity: model.Scrit,
+			reported: time.Date(2018, 2, 14, 19, 4, 54, 123000000, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := pLEEF([]byte(tt.raw))
+			if !assert.NoError(t, err) || !assert.Len(t, msgs, 1) {
+				return
+			}
+			msg := msgs[0]
+			assert.Equal(t, tt.hostname, msg.HostName)
+			assert.Equal(t, tt.appname, msg.AppName)
+			assert.Equal(t, tt.msgid, msg.MsgId)
+			if tt.severity != 0 {
+				assert.Equal(t, tt.severity, msg.Severity)
+			}
+			if !tt.reported.IsZero() {
+				assert.Equal(t, tt.reported.UnixNano(), msg.TimeReportedNum)
+			}
+			for k, v := range tt.props {
+				assert.Equal(t, v, msg.GetProperty("leef", k), k)
+			}
+		})
+	}
+
+	_, err := pLEEF([]byte("CEF:0|V|P|1|ID|N|1|"))
+	assert.Error(t, err)
+	_, err = pLEEF([]byte("LEEF:2.0|V|P|1|ID|xZZ|a=1"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package decoders
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+)
+
+// level=info ts=2018-02-14T19:04:54Z app=myapp msg="hello world" user=bob admin
+//
+// Bare keys are interpreted as boolean flags. Values may be double-quoted,
+// with the usual golang escapes.
+
+// LogfmtDecoder makes a logfmt decoder. pairSep separates the key/value pairs
+// (default: whitespace), kvSep separates the key from the value (default: "=").
+func LogfmtDecoder(pairSep, kvSep string) func([]byte) ([]*model.SyslogMessage, error) {
+	if len(kvSep) == 0 {
+		kvSep = "="
+	}
+	return func(m []byte) ([]*model.SyslogMessage, error) {
+		now := time.Now().UnixNano()
+		msg := model.Factory()
+		msg.ClearDomain("logfmt")
+		msg.Version = 1
+		msg.Facility = model.Fuser
+		msg.Severity = model.Sinfo
+		msg.TimeGeneratedNum = now
+		msg.TimeReportedNum = now
+
+		err := utils.ParseLogfmt(bytes.TrimSpace(m), pairSep, kvSep, func(key, value string) {
+			switch strings.ToLower(key) {
+			case "level", "lvl", "severity":
+				msg.Severity = levelSeverity(value)
+			case "ts", "time", "timestamp":
+				if t, ok := parseEpochOrLogTime(value); ok {
+					msg.TimeReportedNum = t.UnixNano()
+				} else {
+					msg.SetProperty("logfmt", key, value)
+				}
+			case "msg", "message":
+				msg.Message = value
+			case "app", "appname", "program":
+				msg.AppName = value
+			case "host", "hostname":
+				msg.HostName = value
+			case "pid", "procid":
+				msg.ProcId = value
+			case "msgid":
+				msg.MsgId = value
+			case "facility":
+				msg.Facility = model.FacilityFromString(strings.ToLower(value))
+			default:
+				msg.SetProperty("logfmt", key, value)
+			}
+		})
+		if err != nil {
+			model.Free(msg)
+			return nil, LogfmtDecodingError(err)
+		}
+		msg.SetPriority()
+		return []*model.SyslogMessage{msg}, nil
+	}
+}
+
+// parseEpochOrLogTime parses a timestamp given as seconds or milliseconds
+// since epoch, or in one of the usual text formats.
+func parseEpochOrLogTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 {
+		if f > 1e11 {
+			// milliseconds
+			f = f / 1000
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)), true
+	}
+	return parseLogTime(s)
+}
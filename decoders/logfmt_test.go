@@ -0,0 +1,57 @@
+package decoders
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogfmt(t *testing.T) {
+	tests := []struct {
+		name     string
+		pairSep  string
+		kvSep    string
+		raw      string
+		appname  string
+		severity model.Severity
+		message  string
+		props    map[string]string
+	}{
+		{
+			name:     "go",
+			raw:      `level=warn ts=2018-02-14T19:04:54.123Z app=myapp msg="hello \"world\"" user=bob admin`,
+			appname:  "myapp",
+			severity: model.SWarning,
+			message:  `hello "world"`,
+			props:    map[string]string{"user": "bob", "admin": "true"},
+		},
+		{
+			name:     "separators",
+			pairSep:  ";",
+			kvSep:    ":",
+			raw:      `lvl:error; msg:disk full; path:/var/log`,
+			severity: model.Serr,
+			message:  "disk full",
+			props:    map[string]string{"path": "/var/log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := LogfmtDecoder(tt.pairSep, tt.kvSep)([]byte(tt.raw))
+			if !assert.NoError(t, err) || !assert.Len(t, msgs, 1) {
+				return
+			}
+			msg := msgs[0]
+			assert.Equal(t, tt.appname, msg.AppName)
+			assert.Equal(t, tt.severity, msg.Severity)
+			assert.Equal(t, tt.message, msg.Message)
+			for k, v := range tt.props {
+				assert.Equal(t, v, msg.GetProperty("logfmt", k), k)
+			}
+		})
+	}
+
+	_, err := LogfmtDecoder("", "")([]byte(`msg="unterminated`))
+	assert.Error(t, err)
+}
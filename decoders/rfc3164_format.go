@@ -192,3 +192,53 @@ func isHostname(s []byte) bool {
 	}
 	return true
 }
+
+// p3164local decodes the RFC3164 dialect that the local programs send to
+// /dev/log (syslog(3) in the libc, systemd-journald forwarding). There is
+// no HOSTNAME field, so the first word is the TAG when it looks like one.
+//
+// <PRI>Mmm dd hh:mm:ss TAG[PID]: MSG
+func p3164local(m []byte) ([]*model.SyslogMessage, error) {
+	m = bytes.TrimRight(m, " \r\n\x00")
+	now := time.Now()
+	smsg := model.Factory()
+	smsg.TimeGeneratedNum = now.UnixNano()
+	smsg.TimeReportedNum = now.UnixNano()
+	// user.notice, like syslog(3) when no priority is given
+	smsg.Priority = 13
+	smsg.Facility = 1
+	smsg.Severity = 5
+
+	if bytes.HasPrefix(m, []byte("<")) {
+		priEnd := bytes.IndexByte(m, '>')
+		if priEnd > 1 && priEnd <= 4 {
+			priNum, err := strconv.Atoi(string(m[1:priEnd]))
+			if err == nil {
+				smsg.Priority = model.Priority(priNum)
+				smsg.Facility = model.Facility(priNum / 8)
+				smsg.Severity = model.Severity(priNum % 8)
+				m = m[priEnd+1:]
+			}
+		}
+	}
+
+	if len(m) >= len(time.Stamp) {
+		t, err := time.ParseInLocation(time.Stamp, string(m[:len(time.Stamp)]), time.Local)
+		if err == nil {
+			smsg.TimeReportedNum = t.AddDate(now.Year(), 0, 0).UnixNano()
+			m = m[len(time.Stamp):]
+		}
+	}
+	m = bytes.TrimLeft(m, " ")
+
+	word := m
+	if sp := bytes.IndexByte(m, ' '); sp >= 0 {
+		word = m[:sp]
+	}
+	if len(word) > 0 && (bytes.HasSuffix(word, []byte(":")) || bytes.Contains(word, []byte("["))) {
+		smsg.AppName, smsg.ProcId = pair2str(parseTag(word))
+		m = bytes.TrimLeft(m[len(word):], " ")
+	}
+	smsg.Message = string(m)
+	return []*model.SyslogMessage{smsg}, nil
+}
@@ -0,0 +1,62 @@
+package decoders
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRFC3164Local(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		appname  string
+		procid   string
+		severity model.Severity
+		message  string
+	}{
+		{
+			name:     "libc",
+			raw:      "<30>Oct 18 10:00:00 sshd[1234]: Accepted publickey for bob",
+			appname:  "sshd",
+			procid:   "1234",
+			severity: model.Sinfo,
+			message:  "Accepted publickey for bob",
+		},
+		{
+			name:     "no pid",
+			raw:      "<13>Oct  8 10:00:00 cron: job started\n",
+			appname:  "cron",
+			severity: model.Snotice,
+			message:  "job started",
+		},
+		{
+			name:     "no tag",
+			raw:      "<11>Oct 18 10:00:00 something happened",
+			severity: model.Serr,
+			message:  "something happened",
+		},
+		{
+			name:     "no priority",
+			raw:      "myapp: hello",
+			appname:  "myapp",
+			severity: model.Snotice,
+			message:  "hello",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := p3164local([]byte(tt.raw))
+			if !assert.NoError(t, err) || !assert.Len(t, msgs, 1) {
+				return
+			}
+			msg := msgs[0]
+			assert.Equal(t, "", msg.HostName)
+			assert.Equal(t, tt.appname, msg.AppName)
+			assert.Equal(t, tt.procid, msg.ProcId)
+			assert.Equal(t, tt.severity, msg.Severity)
+			assert.Equal(t, tt.message, msg.Message)
+		})
+	}
+}
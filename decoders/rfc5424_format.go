@@ -22,7 +22,10 @@ func init() {
 	}
 }
 
-func p5424(m []byte) ([]*model.SyslogMessage, error) {
+// p5424ANTLR parses a RFC5424 message with the ANTLR generated parser. It has
+// been superseded by the hand-written parser, and is kept as the reference
+// implementation for the equivalence tests and benchmarks.
+func p5424ANTLR(m []byte) ([]*model.SyslogMessage, error) {
 	// TODO: multiple messages ?
 	parser := parser5424Pool.Get().(*rfc5424.RFC5424Parser)
 	defer parser5424Pool.Put(parser)
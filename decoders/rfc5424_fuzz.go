@@ -0,0 +1,39 @@
+// +build gofuzz
+
+package decoders
+
+import (
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+// Fuzz5424 is the go-fuzz entry point that checks that the hand-written
+// RFC5424 parser and the ANTLR parser agree. Use testdata/rfc5424 as the
+// initial corpus:
+//
+//	go-fuzz-build -func Fuzz5424 github.com/stephane-martin/skewer/decoders
+//	mkdir -p /tmp/fuzz5424/corpus && cp testdata/rfc5424/* /tmp/fuzz5424/corpus
+//	go-fuzz -bin decoders-fuzz.zip -workdir /tmp/fuzz5424
+func Fuzz5424(data []byte) int {
+	if !utf8.Valid(data) {
+		return -1
+	}
+	expected, expectedErr := p5424ANTLR(data)
+	actual, actualErr := p5424(data)
+	if expectedErr != nil {
+		if actualErr == nil && actual[0].TimeReportedNum != actual[0].TimeGeneratedNum {
+			panic(fmt.Sprintf("ANTLR parser failed, but not the hand-written one: %q", data))
+		}
+		return 0
+	}
+	if actualErr != nil {
+		panic(fmt.Sprintf("hand-written parser failed, but not the ANTLR one: %q", data))
+	}
+	expected[0].TimeGeneratedNum = 0
+	actual[0].TimeGeneratedNum = 0
+	if !reflect.DeepEqual(expected[0], actual[0]) {
+		panic(fmt.Sprintf("different results for %q: %+v != %+v", data, expected[0], actual[0]))
+	}
+	return 1
+}
@@ -0,0 +1,370 @@
+package decoders
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// p5424 parses a RFC5424 message with a hand-written state machine. It
+// accepts the same messages as the grammar in grammars/rfc5424, and produces
+// the same output. The NILVALUE timestamp, allowed by the RFC, is accepted
+// too.
+//
+// The message is converted to a string only once: all the fields of the
+// resulting SyslogMessage are substrings of it.
+func p5424(m []byte) ([]*model.SyslogMessage, error) {
+	return parse5424(m, false)
+}
+
+// p5424Lenient parses a RFC5424 message, tolerating the most common
+// deviations from the RFC:
+//
+// - header fields may contain non-ASCII characters
+// - timestamps without timezone (local time), or that can't be parsed at all
+// - missing fields at the end of the header
+// - missing or malformed structured data: the remaining text is then the message
+// - UTF-8 BOM at the beginning of the message, trailing newlines
+func p5424Lenient(m []byte) ([]*model.SyslogMessage, error) {
+	return parse5424(m, true)
+}
+
+type sdParam struct {
+	sid   string
+	name  string
+	value string
+	// for an element without parameter, only sid is set
+	empty bool
+}
+
+type parser5424 struct {
+	s       string
+	pos     int
+	lenient bool
+}
+
+func (p *parser5424) errorf(format string, args ...interface{}) error {
+	return RFC5424DecodingError(eerrors.Errorf(format+" (at position %d)", append(args, p.pos)...))
+}
+
+func (p *parser5424) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser5424) digits() string {
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// spaces skips one or more spaces
+func (p *parser5424) spaces() bool {
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func isPrintUSASCII(c byte) bool {
+	return c >= 33 && c <= 126
+}
+
+// headerField reads a header field (HOSTNAME, APP-NAME, PROCID, MSGID).
+func (p *parser5424) headerField() (string, bool) {
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] != ' ' {
+		if !isPrintUSASCII(p.s[p.pos]) && !(p.lenient && p.s[p.pos] > 126) {
+			return "", false
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return "", false
+	}
+	f := p.s[start:p.pos]
+	if f == "-" {
+		return "", true
+	}
+	return f, true
+}
+
+func (p *parser5424) expect(c byte) bool {
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser5424) expectDigits(n int) bool {
+	for i := 0; i < n; i++ {
+		if p.pos >= len(p.s) || p.s[p.pos] < '0' || p.s[p.pos] > '9' {
+			return false
+		}
+		p.pos++
+	}
+	return true
+}
+
+// timestampLetter matches the separators allowed by the grammar between date
+// and time, and as timezone: a letter or a punctuation character.
+func timestampLetter(c byte) bool {
+	return c == '!' || (c >= '#' && c <= '*') || c == ',' || c == '/' || c == ';' || c == '?' || c == '@' ||
+		(c >= 'A' && c <= 'Z') || c == '^' || c == '_' || c == '`' || (c >= 'a' && c <= '~')
+}
+
+// timestamp scans a timestamp with the shape of the grammar, and returns its text.
+func (p *parser5424) timestamp() (string, bool) {
+	start := p.pos
+	ok := p.expectDigits(4) && p.expect('-') && p.expectDigits(2) && p.expect('-') && p.expectDigits(2)
+	if !ok || p.eof() || !timestampLetter(p.s[p.pos]) {
+		return "", false
+	}
+	p.pos++
+	if !(p.expectDigits(2) && p.expect(':') && p.expectDigits(2) && p.expect(':') && p.expectDigits(2)) {
+		return "", false
+	}
+	if p.expect('.') {
+		if len(p.digits()) == 0 {
+			return "", false
+		}
+	}
+	if p.eof() {
+		return "", false
+	}
+	switch c := p.s[p.pos]; {
+	case c == '+' || c == '-':
+		p.pos++
+		if !(p.expectDigits(2) && p.expect(':') && p.expectDigits(2)) {
+			return "", false
+		}
+	case timestampLetter(c):
+		p.pos++
+	default:
+		return "", false
+	}
+	return p.s[start:p.pos], true
+}
+
+var lenientTimestampLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+func (p *parser5424) parseTimestamp(msg *model.SyslogMessage) error {
+	msg.TimeGeneratedNum = time.Now().UnixNano()
+	if strings.HasPrefix(p.s[p.pos:], "-") && (p.pos+1 == len(p.s) || p.s[p.pos+1] == ' ') {
+		p.pos++
+		msg.TimeReportedNum = msg.TimeGeneratedNum
+		return nil
+	}
+	if !p.lenient {
+		ts, ok := p.timestamp()
+		if !ok {
+			return p.errorf("Invalid timestamp")
+		}
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return RFC5424DecodingError(err)
+		}
+		msg.TimeReportedNum = t.UnixNano()
+		return nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] != ' ' {
+		p.pos++
+	}
+	ts := p.s[start:p.pos]
+	if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+		msg.TimeReportedNum = t.UnixNano()
+		return nil
+	}
+	for _, layout := range lenientTimestampLayouts {
+		if t, err := time.ParseInLocation(layout, ts, time.Local); err == nil {
+			msg.TimeReportedNum = t.UnixNano()
+			return nil
+		}
+	}
+	msg.TimeReportedNum = msg.TimeGeneratedNum
+	return nil
+}
+
+// sdName reads a SD-NAME: printable characters, except '=', ']', '"' and space.
+func (p *parser5424) sdName() (string, bool) {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if !isPrintUSASCII(c) || c == '=' || c == ']' || c == '"' {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos], p.pos > start
+}
+
+// sdValue reads a PARAM-VALUE, up to the closing quote. The value is
+// returned as is, escape sequences included.
+func (p *parser5424) sdValue() (string, bool) {
+	start := p.pos
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '"':
+			return p.s[start:p.pos], true
+		case ']':
+			return "", false
+		case '\\':
+			if p.pos+1 >= len(p.s) {
+				return "", false
+			}
+			switch p.s[p.pos+1] {
+			case '\\', ']', '"':
+				p.pos += 2
+				continue
+			default:
+				return "", false
+			}
+		}
+		p.pos++
+	}
+	return "", false
+}
+
+// structuredData parses the SD-ELEMENTs.
+func (p *parser5424) structuredData(params []sdParam) ([]sdParam, error) {
+	if p.expect('-') {
+		return params, nil
+	}
+	if p.eof() || p.s[p.pos] != '[' {
+		return nil, p.errorf("Invalid structured data")
+	}
+	for p.expect('[') {
+		sid, ok := p.sdName()
+		if !ok {
+			return nil, p.errorf("Empty SDID")
+		}
+		params = append(params, sdParam{sid: sid, empty: true})
+		for p.expect(' ') {
+			name, ok := p.sdName()
+			if !ok {
+				return nil, p.errorf("Empty parameter name")
+			}
+			if !p.expect('=') || !p.expect('"') {
+				return nil, p.errorf("Invalid structured data parameter")
+			}
+			value, ok := p.sdValue()
+			if !ok {
+				return nil, p.errorf("Invalid structured data value")
+			}
+			p.pos++
+			params = append(params, sdParam{sid: sid, name: name, value: value})
+		}
+		if !p.expect(']') {
+			return nil, ErrInvalidSD
+		}
+	}
+	return params, nil
+}
+
+func parse5424(m []byte, lenient bool) ([]*model.SyslogMessage, error) {
+	p := &parser5424{s: string(m), lenient: lenient}
+	if lenient {
+		p.s = strings.TrimRight(p.s, "\r\n\x00")
+	}
+	msg := model.Factory()
+	err := p.parse(msg)
+	if err != nil {
+		model.Free(msg)
+		return nil, err
+	}
+	return []*model.SyslogMessage{msg}, nil
+}
+
+func (p *parser5424) parse(msg *model.SyslogMessage) (err error) {
+	// PRI
+	if !p.expect('<') {
+		return p.errorf("Missing priority")
+	}
+	pri, err := strconv.Atoi(p.digits())
+	if err != nil || !p.expect('>') {
+		return ErrInvalidPriority
+	}
+	msg.Priority = model.Priority(pri)
+	msg.Facility = model.Facility(pri / 8)
+	msg.Severity = model.Severity(pri % 8)
+
+	// VERSION
+	v, err := strconv.Atoi(p.digits())
+	if err != nil {
+		return ErrInvalidPriority
+	}
+	msg.Version = model.Version(v)
+	if !p.spaces() {
+		return p.errorf("Missing space after version")
+	}
+
+	err = p.parseTimestamp(msg)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range []*string{&msg.HostName, &msg.AppName, &msg.ProcId, &msg.MsgId} {
+		if !p.spaces() {
+			if p.lenient && p.eof() {
+				return nil
+			}
+			return p.errorf("Missing space in header")
+		}
+		var ok bool
+		*field, ok = p.headerField()
+		if !ok {
+			if p.lenient && p.eof() {
+				return nil
+			}
+			return p.errorf("Invalid header field")
+		}
+	}
+
+	if !p.spaces() {
+		if p.lenient && p.eof() {
+			return nil
+		}
+		return p.errorf("Missing space after header")
+	}
+
+	sdStart := p.pos
+	var params [8]sdParam
+	sd, err := p.structuredData(params[:0])
+	if err == nil && !p.eof() && p.s[p.pos] != ' ' {
+		err = p.errorf("Missing space after structured data")
+	}
+	if err != nil {
+		if !p.lenient {
+			return err
+		}
+		// consider that the structured data is missing
+		sd = nil
+		p.pos = sdStart
+	}
+	for _, param := range sd {
+		if param.empty {
+			msg.ClearDomain(param.sid)
+			continue
+		}
+		msg.SetProperty(param.sid, param.name, param.value)
+	}
+
+	if p.pos > sdStart {
+		p.spaces()
+	}
+	msg.Message = p.s[p.pos:]
+	if p.lenient {
+		msg.Message = strings.TrimPrefix(msg.Message, "\ufeff")
+	}
+	return nil
+}
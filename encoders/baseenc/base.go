@@ -24,6 +24,13 @@ const (
 	File
 	GELF
 	Protobuf
+	CEF
+	LEEF
+	RFC3164CEF
+	RFC5424CEF
+	RFC3164LEEF
+	RFC5424LEEF
+	Logfmt
 )
 
 var Formats = map[string]Format{
@@ -38,5 +45,12 @@ var Formats = map[string]Format{
 	"file":         File,
 	"gelf":         GELF,
 	"protobuf":     Protobuf,
+	"cef":          CEF,
+	"leef":         LEEF,
+	"rfc3164cef":   RFC3164CEF,
+	"rfc5424cef":   RFC5424CEF,
+	"rfc3164leef":  RFC3164LEEF,
+	"rfc5424leef":  RFC5424LEEF,
+	"logfmt":       Logfmt,
 	"":             JSON,
 }
@@ -0,0 +1,230 @@
+package encoders
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/valyala/bytebufferpool"
+)
+
+var cefHeaderNames = map[string]bool{
+	"cefVersion":         true,
+	"deviceVendor":       true,
+	"deviceProduct":      true,
+	"deviceVersion":      true,
+	"deviceEventClassId": true,
+	"name":               true,
+	"severity":           true,
+}
+
+var leefHeaderNames = map[string]bool{
+	"leefVersion": true,
+	"vendor":      true,
+	"product":     true,
+	"version":     true,
+	"eventId":     true,
+}
+
+// syslog severity to CEF/LEEF severity (0-10)
+var securitySeverities = map[model.Severity]int{
+	model.Semerg:   10,
+	model.Salert:   9,
+	model.Scrit:    8,
+	model.Serr:     7,
+	model.SWarning: 5,
+	model.Snotice:  4,
+	model.Sinfo:    2,
+	model.Sdebug:   0,
+}
+
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+var cefValueEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+var leefValueEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+func validExtensionKey(k string) bool {
+	if len(k) == 0 {
+		return false
+	}
+	return strings.IndexAny(k, " =|\\\t\r\n") == -1
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func encodeCEF(v interface{}, w io.Writer) error {
+	if v == nil {
+		return nil
+	}
+	switch val := v.(type) {
+	case *model.FullMessage:
+		return encodeMsgCEF(val.Fields, w)
+	case *model.SyslogMessage:
+		return encodeMsgCEF(val, w)
+	default:
+		return defaultEncode(v, w)
+	}
+}
+
+func encodeLEEF(v interface{}, w io.Writer) error {
+	if v == nil {
+		return nil
+	}
+	switch val := v.(type) {
+	case *model.FullMessage:
+		return encodeMsgLEEF(val.Fields, w)
+	case *model.SyslogMessage:
+		return encodeMsgLEEF(val, w)
+	default:
+		return defaultEncode(v, w)
+	}
+}
+
+func encodeMsgCEF(m *model.SyslogMessage, w io.Writer) (err error) {
+	props := m.Properties.GetMap()["cef"].GetMap()
+	name := firstNonEmpty(props["name"], m.Message)
+	severity := props["severity"]
+	if len(severity) == 0 {
+		severity = strconv.Itoa(securitySeverities[m.Severity])
+	}
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	buf.WriteString("CEF:")
+	buf.WriteString(firstNonEmpty(props["cefVersion"], "0"))
+	for _, field := range []string{
+		firstNonEmpty(props["deviceVendor"], "skewer"),
+		firstNonEmpty(props["deviceProduct"], m.AppName, "skewer"),
+		props["deviceVersion"],
+		firstNonEmpty(props["deviceEventClassId"], m.MsgId, "syslog"),
+		name,
+		severity,
+	} {
+		buf.WriteByte('|')
+		buf.WriteString(cefHeaderEscaper.Replace(field))
+	}
+	buf.WriteByte('|')
+
+	ext := make(map[string]string, len(props)+4)
+	for k, v := range props {
+		if !cefHeaderNames[k] && validExtensionKey(k) {
+			ext[k] = v
+		}
+	}
+	if _, ok := ext["rt"]; !ok && m.TimeReportedNum != 0 {
+		ext["rt"] = strconv.FormatInt(m.TimeReportedNum/1000000, 10)
+	}
+	if _, ok := ext["dvchost"]; !ok && len(m.HostName) > 0 {
+		ext["dvchost"] = m.HostName
+	}
+	if _, ok := ext["dvcpid"]; !ok && len(m.ProcId) > 0 {
+		ext["dvcpid"] = m.ProcId
+	}
+	if _, ok := ext["msg"]; !ok && len(m.Message) > 0 && m.Message != name {
+		ext["msg"] = m.Message
+	}
+	for i, k := range sortedKeys(ext) {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(cefValueEscaper.Replace(ext[k]))
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func encodeMsgLEEF(m *model.SyslogMessage, w io.Writer) (err error) {
+	props := m.Properties.GetMap()["leef"].GetMap()
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	// LEEF 1.0 is the most widely supported version, its delimiter is always a tab
+	buf.WriteString("LEEF:1.0")
+	for _, field := range []string{
+		firstNonEmpty(props["vendor"], "skewer"),
+		firstNonEmpty(props["product"], m.AppName, "skewer"),
+		props["version"],
+		firstNonEmpty(props["eventId"], m.MsgId, "syslog"),
+	} {
+		buf.WriteByte('|')
+		buf.WriteString(cefHeaderEscaper.Replace(field))
+	}
+	buf.WriteByte('|')
+
+	attrs := make(map[string]string, len(props)+3)
+	for k, v := range props {
+		if !leefHeaderNames[k] && validExtensionKey(k) {
+			attrs[k] = v
+		}
+	}
+	if _, ok := attrs["devTime"]; !ok && m.TimeReportedNum != 0 {
+		attrs["devTime"] = strconv.FormatInt(m.TimeReportedNum/1000000, 10)
+		delete(attrs, "devTimeFormat")
+	}
+	if _, ok := attrs["sev"]; !ok {
+		attrs["sev"] = strconv.Itoa(securitySeverities[m.Severity])
+	}
+	if _, ok := attrs["msg"]; !ok && len(m.Message) > 0 {
+		attrs["msg"] = m.Message
+	}
+	for i, k := range sortedKeys(attrs) {
+		if i > 0 {
+			buf.WriteByte('\t')
+		}
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(leefValueEscaper.Replace(attrs[k]))
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// syslogEnvelope returns an encoder that wraps the payload produced by
+// payloadEncoder inside a RFC3164 or RFC5424 syslog message, as most security
+// appliances do.
+func syslogEnvelope(payloadEncoder func(*model.SyslogMessage, io.Writer) error, envelopeEncoder func(*model.SyslogMessage, io.Writer) error) Encoder {
+	var encode Encoder
+	encode = func(v interface{}, w io.Writer) (err error) {
+		if v == nil {
+			return nil
+		}
+		switch val := v.(type) {
+		case *model.FullMessage:
+			return encode(val.Fields, w)
+		case *model.SyslogMessage:
+			buf := bytebufferpool.Get()
+			defer bytebufferpool.Put(buf)
+			err = payloadEncoder(val, buf)
+			if err != nil {
+				return err
+			}
+			envelope := *val
+			envelope.Message = buf.String()
+			// the properties are already part of the payload
+			envelope.Properties = model.Properties{}
+			return envelopeEncoder(&envelope, w)
+		default:
+			return defaultEncode(v, w)
+		}
+	}
+	return encode
+}
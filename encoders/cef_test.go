@@ -0,0 +1,76 @@
+package encoders
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stephane-martin/skewer/encoders/baseenc"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func securityMessage() *model.SyslogMessage {
+	m := model.Factory()
+	m.HostName = "myhost"
+	m.AppName = "myapp"
+	m.ProcId = "42"
+	m.MsgId = "login"
+	m.Severity = model.Serr
+	m.Facility = model.Fuser
+	m.SetPriority()
+	m.Message = "user a=b logged in"
+	m.TimeReportedNum = time.Date(2018, 2, 14, 19, 4, 54, 0, time.UTC).UnixNano()
+	return m
+}
+
+func TestEncodeCEF(t *testing.T) {
+	m := securityMessage()
+	var buf bytes.Buffer
+	if assert.NoError(t, encodeCEF(m, &buf)) {
+		assert.Equal(t, `CEF:0|skewer|myapp||login|user a=b logged in|7|dvchost=myhost dvcpid=42 rt=1518635094000`, buf.String())
+	}
+
+	// properties of the "cef" domain override the header and become extensions
+	m.SetProperty("cef", "deviceVendor", "Ven|dor")
+	m.SetProperty("cef", "name", "Login")
+	m.SetProperty("cef", "severity", "3")
+	m.SetProperty("cef", "suser", `bob\alice`)
+	m.SetProperty("cef", "bad key", "x")
+	buf.Reset()
+	if assert.NoError(t, encodeCEF(m, &buf)) {
+		assert.Equal(t, `CEF:0|Ven\|dor|myapp||login|Login|3|dvchost=myhost dvcpid=42 msg=user a\=b logged in rt=1518635094000 suser=bob\\alice`, buf.String())
+	}
+}
+
+func TestEncodeLEEF(t *testing.T) {
+	m := securityMessage()
+	var buf bytes.Buffer
+	if assert.NoError(t, encodeLEEF(m, &buf)) {
+		assert.Equal(t, "LEEF:1.0|skewer|myapp||login|devTime=1518635094000\tmsg=user a=b logged in\tsev=7", buf.String())
+	}
+
+	m.SetProperty("leef", "product", "Pro|duct")
+	m.SetProperty("leef", "devTime", "Feb 14 2018 19:04:54")
+	m.SetProperty("leef", "devTimeFormat", "MMM dd yyyy HH:mm:ss")
+	m.SetProperty("leef", "src", "10.0.0.1\t")
+	buf.Reset()
+	if assert.NoError(t, encodeLEEF(m, &buf)) {
+		assert.Equal(t, "LEEF:1.0|skewer|Pro\\|duct||login|devTime=Feb 14 2018 19:04:54\tdevTimeFormat=MMM dd yyyy HH:mm:ss\tmsg=user a=b logged in\tsev=7\tsrc=10.0.0.1\\t", buf.String())
+	}
+}
+
+func TestEncodeSyslogEnvelope(t *testing.T) {
+	m := securityMessage()
+	m.SetProperty("cef", "suser", "bob")
+	encode, err := GetEncoder(baseenc.RFC5424CEF)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var buf bytes.Buffer
+	if assert.NoError(t, encode(m, &buf)) {
+		assert.Equal(t, "<11>1 2018-02-14T19:04:54Z myhost myapp 42 login - CEF:0|skewer|myapp||login|user a=b logged in|7|dvchost=myhost dvcpid=42 rt=1518635094000 suser=bob", buf.String())
+	}
+	// the envelope does not alter the message
+	assert.Equal(t, "bob", m.GetProperty("cef", "suser"))
+}
@@ -52,6 +52,13 @@ var MimeTypes = map[baseenc.Format]string{
 	baseenc.File:         PlainMimetype,
 	baseenc.GELF:         JsonMimetype,
 	baseenc.Protobuf:     ProtobufMimetype,
+	baseenc.CEF:          PlainMimetype,
+	baseenc.LEEF:         PlainMimetype,
+	baseenc.RFC3164CEF:   PlainMimetype,
+	baseenc.RFC5424CEF:   PlainMimetype,
+	baseenc.RFC3164LEEF:  PlainMimetype,
+	baseenc.RFC5424LEEF:  PlainMimetype,
+	baseenc.Logfmt:       PlainMimetype,
 }
 
 var encoders = map[baseenc.Format]Encoder{
@@ -66,6 +73,13 @@ var encoders = map[baseenc.Format]Encoder{
 	baseenc.File:         encodeFile,
 	baseenc.GELF:         encodeGELF,
 	baseenc.Protobuf:     encodePB,
+	baseenc.CEF:          encodeCEF,
+	baseenc.LEEF:         encodeLEEF,
+	baseenc.RFC3164CEF:   syslogEnvelope(encodeMsgCEF, encodeMsg3164),
+	baseenc.RFC5424CEF:   syslogEnvelope(encodeMsgCEF, encodeMsg5424),
+	baseenc.RFC3164LEEF:  syslogEnvelope(encodeMsgLEEF, encodeMsg3164),
+	baseenc.RFC5424LEEF:  syslogEnvelope(encodeMsgLEEF, encodeMsg5424),
+	baseenc.Logfmt:       encodeLogfmt,
 }
 
 // Encoder is the function type that represents encoders
@@ -0,0 +1,100 @@
+package encoders
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/valyala/bytebufferpool"
+)
+
+func encodeLogfmt(v interface{}, w io.Writer) error {
+	if v == nil {
+		return nil
+	}
+	switch val := v.(type) {
+	case *model.FullMessage:
+		return encodeMsgLogfmt(val.Fields, w)
+	case *model.SyslogMessage:
+		return encodeMsgLogfmt(val, w)
+	default:
+		return defaultEncode(v, w)
+	}
+}
+
+func validLogfmtKey(k string) bool {
+	if len(k) == 0 {
+		return false
+	}
+	return strings.IndexFunc(k, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError
+	}) == -1
+}
+
+func writeLogfmtPair(buf *bytebufferpool.ByteBuffer, key, value string) {
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	needsQuote := len(value) == 0 || strings.IndexFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError
+	}) != -1
+	if needsQuote {
+		buf.WriteString(strconv.Quote(value))
+	} else {
+		buf.WriteString(value)
+	}
+}
+
+// encodeMsgLogfmt writes the syslog fields with the well-known logfmt keys,
+// then the properties. Properties from the "logfmt" domain are written as is,
+// the others are prefixed by their domain.
+func encodeMsgLogfmt(m *model.SyslogMessage, w io.Writer) (err error) {
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	if m.TimeReportedNum != 0 {
+		writeLogfmtPair(buf, "ts", time.Unix(0, m.TimeReportedNum).UTC().Format(time.RFC3339Nano))
+	}
+	writeLogfmtPair(buf, "level", m.Severity.String())
+	writeLogfmtPair(buf, "facility", m.Facility.String())
+	if len(m.HostName) > 0 {
+		writeLogfmtPair(buf, "host", m.HostName)
+	}
+	if len(m.AppName) > 0 {
+		writeLogfmtPair(buf, "app", m.AppName)
+	}
+	if len(m.ProcId) > 0 {
+		writeLogfmtPair(buf, "pid", m.ProcId)
+	}
+	if len(m.MsgId) > 0 {
+		writeLogfmtPair(buf, "msgid", m.MsgId)
+	}
+	writeLogfmtPair(buf, "msg", m.Message)
+
+	props := m.Properties.GetMap()
+	domains := make([]string, 0, len(props))
+	for domain := range props {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		values := props[domain].GetMap()
+		for _, k := range sortedKeys(values) {
+			key := k
+			if domain != "logfmt" {
+				key = domain + "." + k
+			}
+			if validLogfmtKey(key) {
+				writeLogfmtPair(buf, key, values[k])
+			}
+		}
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
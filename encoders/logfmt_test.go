@@ -0,0 +1,38 @@
+package encoders
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeLogfmt(t *testing.T) {
+	m := model.Factory()
+	m.TimeReportedNum = time.Date(2018, 2, 14, 19, 4, 54, 123000000, time.UTC).UnixNano()
+	m.Severity = model.SWarning
+	m.Facility = model.Fdaemon
+	m.HostName = "myhost"
+	m.AppName = "myapp"
+	m.Message = `disk "sda" is full`
+	m.SetProperty("logfmt", "path", "/var/log")
+	m.SetProperty("logfmt", "empty", "")
+	m.SetProperty("logfmt", "bad key", "dropped")
+	m.SetProperty("geoip", "country", "FR")
+
+	var buf bytes.Buffer
+	if assert.NoError(t, encodeLogfmt(m, &buf)) {
+		assert.Equal(
+			t,
+			`ts=2018-02-14T19:04:54.123Z level=warning facility=daemon host=myhost app=myapp msg="disk \"sda\" is full" geoip.country=FR empty="" path=/var/log`,
+			buf.String(),
+		)
+	}
+
+	buf.Reset()
+	if assert.NoError(t, encodeLogfmt(model.Factory(), &buf)) {
+		assert.Equal(t, `level=emerg facility=kern msg=""`, buf.String())
+	}
+}
@@ -0,0 +1,96 @@
+package enrich
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// reverseDNSTimeout bounds a reverse DNS query.
+	reverseDNSTimeout = 2 * time.Second
+	// maxReverseDNSEntries bounds the size of the reverse DNS cache.
+	maxReverseDNSEntries = 100000
+	// maxReverseDNSQueries bounds the number of concurrent reverse DNS
+	// queries.
+	maxReverseDNSQueries = 64
+)
+
+type dnsEntry struct {
+	name    string
+	expires time.Time
+	pending bool
+}
+
+// reverseCache holds the results of the reverse DNS queries, including the
+// failures, for all the enrichers.
+var reverseCache = struct {
+	sync.Mutex
+	entries map[string]dnsEntry
+}{entries: map[string]dnsEntry{}}
+
+// reverseQueries limits the concurrent reverse DNS queries.
+var reverseQueries = make(chan struct{}, maxReverseDNSQueries)
+
+// lookupAddr is replaced by the tests.
+var lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+	return net.DefaultResolver.LookupAddr(ctx, addr)
+}
+
+// reverseDNS returns the cached name of the IP address ip, or an empty
+// string. The names that are not known yet, or that have expired, are
+// resolved in the background, so that the messages are not delayed: the
+// next messages from ip get the new name.
+func reverseDNS(ip string, ttl time.Duration) string {
+	now := time.Now()
+	reverseCache.Lock()
+	defer reverseCache.Unlock()
+	entry, ok := reverseCache.entries[ip]
+	if ok && (entry.pending || now.Before(entry.expires)) {
+		return entry.name
+	}
+	select {
+	case reverseQueries <- struct{}{}:
+	default:
+		// too many queries already, ip will be resolved later
+		return entry.name
+	}
+	entry.pending = true
+	setReverseEntry(ip, entry, now)
+	go resolve(ip, ttl)
+	return entry.name
+}
+
+// resolve queries the name of ip, and caches it for ttl.
+func resolve(ip string, ttl time.Duration) {
+	defer func() { <-reverseQueries }()
+	ctx, cancel := context.WithTimeout(context.Background(), reverseDNSTimeout)
+	names, err := lookupAddr(ctx, ip)
+	cancel()
+	now := time.Now()
+	entry := dnsEntry{expires: now.Add(ttl)}
+	if err == nil && len(names) > 0 {
+		entry.name = strings.TrimSuffix(names[0], ".")
+	}
+	reverseCache.Lock()
+	setReverseEntry(ip, entry, now)
+	reverseCache.Unlock()
+}
+
+// setReverseEntry caches entry for ip. The expired entries are removed when
+// the cache is full. The reverseCache lock must be held.
+func setReverseEntry(ip string, entry dnsEntry, now time.Time) {
+	if len(reverseCache.entries) >= maxReverseDNSEntries {
+		for k, e := range reverseCache.entries {
+			if !e.pending && now.After(e.expires) {
+				delete(reverseCache.entries, k)
+			}
+		}
+		if len(reverseCache.entries) >= maxReverseDNSEntries {
+			reverseCache.entries = map[string]dnsEntry{}
+		}
+	}
+	reverseCache.entries[ip] = entry
+}
@@ -0,0 +1,156 @@
+// Package enrich adds context to the messages: the columns of a lookup table
+// keyed on a message field, GeoIP data for the IP addresses found in the
+// properties, and the reverse DNS of the client.
+package enrich
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/expr"
+	"github.com/stephane-martin/skewer/model"
+)
+
+type property struct {
+	domain string
+	key    string
+}
+
+// Enricher enriches the messages according to an enrichment configuration.
+type Enricher struct {
+	namespace  string
+	key        *expr.Program
+	table      table
+	geoip      *maxminddb.Reader
+	geoipProps []property
+	reverseDNS bool
+	dnsTTL     time.Duration
+	generation uint64
+	logger     log15.Logger
+}
+
+// New creates an Enricher. The lookup files that can not be used are logged,
+// the other parts of the enrichment still apply.
+func New(config conf.EnrichmentConfig, logger log15.Logger) *Enricher {
+	e := Enricher{
+		namespace:  config.Namespace,
+		reverseDNS: config.ReverseDNS,
+		dnsTTL:     config.ReverseDNSTTL,
+		generation: Generation(),
+		logger:     logger.New("enrichment", config.Name),
+	}
+	if len(e.namespace) == 0 {
+		e.namespace = "enrich"
+	}
+	if e.dnsTTL <= 0 {
+		e.dnsTTL = 10 * time.Minute
+	}
+
+	if len(config.LookupFile) > 0 {
+		name, err := conf.LookupName(config.LookupFile)
+		if err == nil {
+			e.key, err = expr.Compile(config.LookupKey)
+		}
+		if err == nil {
+			e.table, err = loadTable(name)
+		}
+		if err != nil {
+			e.key = nil
+			e.table = nil
+			e.logger.Warn("The lookup table can not be used", "error", err)
+		}
+	}
+
+	if len(config.GeoIPDatabase) > 0 {
+		name, err := conf.LookupName(config.GeoIPDatabase)
+		if err == nil {
+			e.geoip, err = loadDatabase(name)
+		}
+		if err != nil {
+			e.logger.Warn("The GeoIP database can not be used", "error", err)
+		}
+		for _, prop := range config.GeoIPProperties {
+			domain, key, err := conf.SplitProperty(prop)
+			if err != nil {
+				e.logger.Warn("Invalid GeoIP property", "error", err)
+				continue
+			}
+			e.geoipProps = append(e.geoipProps, property{domain: domain, key: key})
+		}
+	}
+	return &e
+}
+
+// Obsolete returns true when the lookup files have been replaced since the
+// enricher was created.
+func (e *Enricher) Obsolete() bool {
+	return e.generation != Generation()
+}
+
+// Enrich writes the results of the lookups in the properties of m, under the
+// namespace of the enrichment.
+func (e *Enricher) Enrich(m *model.FullMessage) {
+	if m == nil || m.Fields == nil {
+		return
+	}
+	fields := m.Fields
+
+	if e.table != nil {
+		key := strings.ToLower(strings.TrimSpace(e.key.String(fields)))
+		for column, value := range e.table[key] {
+			fields.SetProperty(e.namespace, column, value)
+		}
+	}
+
+	if e.geoip != nil {
+		for _, prop := range e.geoipProps {
+			ip := net.ParseIP(strings.TrimSpace(fields.GetProperty(prop.domain, prop.key)))
+			if ip == nil {
+				continue
+			}
+			offset, err := e.geoip.LookupOffset(ip)
+			if err != nil {
+				e.logger.Debug("GeoIP lookup failed", "ip", ip.String(), "error", err)
+				continue
+			}
+			if offset == maxminddb.NotFound {
+				continue
+			}
+			var record interface{}
+			err = e.geoip.Decode(offset, &record)
+			if err != nil {
+				e.logger.Debug("GeoIP lookup failed", "ip", ip.String(), "error", err)
+				continue
+			}
+			geoProperties(record, func(name, value string) {
+				fields.SetProperty(e.namespace, prop.key+"."+name, value)
+			})
+		}
+	}
+
+	if e.reverseDNS {
+		if ip := clientIP(m.ClientAddr); ip != "" {
+			if name := reverseDNS(ip, e.dnsTTL); name != "" {
+				fields.SetProperty(e.namespace, "client_hostname", name)
+			}
+		}
+	}
+}
+
+// clientIP returns the IP address of the client, without the port, or an
+// empty string when the client is not known by its address.
+func clientIP(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,163 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMessage(hostname, client string) *model.FullMessage {
+	full := model.FullFactory()
+	full.Fields.HostName = hostname
+	full.ClientAddr = client
+	return full
+}
+
+// setFiles writes the lookup files to a temporary directory, and gives them
+// to the enrichers.
+func setFiles(t *testing.T, contents map[string][]byte) {
+	dir := t.TempDir()
+	digests := map[string]string{}
+	for name, content := range contents {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		digests[name] = name
+	}
+	SetFiles(dir, digests)
+}
+
+func TestLookupTables(t *testing.T) {
+	setFiles(t, map[string][]byte{
+		"hosts.csv": []byte("# owners\nhost, team, env\nWeb1, frontend, prod\ndb1,dba\n"),
+		"apps.json": []byte(`{"nginx": {"team": "frontend", "port": 80, "tags": ["a"], "none": null}}`),
+	})
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+
+	e := New(conf.EnrichmentConfig{Name: "hosts", Namespace: "ctx", LookupFile: "hosts.csv", LookupKey: "hostname"}, logger)
+	m := newMessage("web1", "")
+	e.Enrich(m)
+	assert.Equal(t, "frontend", m.Fields.GetProperty("ctx", "team"))
+	assert.Equal(t, "prod", m.Fields.GetProperty("ctx", "env"))
+
+	m = newMessage("db1", "")
+	e.Enrich(m)
+	assert.Equal(t, "dba", m.Fields.GetProperty("ctx", "team"))
+	assert.Equal(t, "", m.Fields.GetProperty("ctx", "env"))
+
+	m = newMessage("unknown", "")
+	e.Enrich(m)
+	assert.Len(t, m.Fields.Properties.Map, 0)
+
+	e = New(conf.EnrichmentConfig{Name: "apps", LookupFile: "apps.json", LookupKey: "app_name"}, logger)
+	m = newMessage("web1", "")
+	m.Fields.AppName = "NGINX"
+	e.Enrich(m)
+	assert.Equal(t, "frontend", m.Fields.GetProperty("enrich", "team"))
+	assert.Equal(t, "80", m.Fields.GetProperty("enrich", "port"))
+	assert.Equal(t, `["a"]`, m.Fields.GetProperty("enrich", "tags"))
+	assert.Equal(t, "", m.Fields.GetProperty("enrich", "none"))
+
+	// the enrichers become obsolete when the files change
+	assert.False(t, e.Obsolete())
+	SetFiles("", nil)
+	assert.True(t, e.Obsolete())
+	e = New(conf.EnrichmentConfig{Name: "apps", LookupFile: "apps.json", LookupKey: "app_name"}, logger)
+	m = newMessage("web1", "")
+	m.Fields.AppName = "nginx"
+	e.Enrich(m)
+	assert.Len(t, m.Fields.Properties.Map, 0)
+}
+
+func TestGeoProperties(t *testing.T) {
+	record := map[string]interface{}{
+		"country": map[string]interface{}{
+			"iso_code": "FR",
+			"names":    map[string]interface{}{"en": "France", "fr": "France"},
+		},
+		"city":                     map[string]interface{}{"names": map[string]interface{}{"en": "Paris"}},
+		"location":                 map[string]interface{}{"latitude": 48.8534, "longitude": 2.3488},
+		"autonomous_system_number": uint64(3215),
+		"continent":                "not a map",
+	}
+	props := map[string]string{}
+	geoProperties(record, func(name, value string) {
+		props[name] = value
+	})
+	assert.Equal(t, map[string]string{
+		"country_code": "FR",
+		"country":      "France",
+		"city":         "Paris",
+		"latitude":     "48.8534",
+		"longitude":    "2.3488",
+		"asn":          "3215",
+	}, props)
+}
+
+func TestReverseDNS(t *testing.T) {
+	reverseCache.Lock()
+	reverseCache.entries = map[string]dnsEntry{}
+	reverseCache.Unlock()
+	var mu sync.Mutex
+	queries := 0
+	release := make(chan struct{})
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		mu.Lock()
+		queries++
+		mu.Unlock()
+		<-release
+		if addr == "192.0.2.1" {
+			return []string{"host1.example.org."}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	defer func() {
+		lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+			return net.DefaultResolver.LookupAddr(ctx, addr)
+		}
+	}()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	e := New(conf.EnrichmentConfig{Name: "dns", ReverseDNS: true, ReverseDNSTTL: time.Hour}, logger)
+	hostname := func(client string) string {
+		m := newMessage("", client)
+		e.Enrich(m)
+		return m.Fields.GetProperty("enrich", "client_hostname")
+	}
+
+	// the messages do not wait for the DNS
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "", hostname("192.0.2.1:5000"))
+		assert.Equal(t, "", hostname("192.0.2.2"))
+		assert.Equal(t, "", hostname("localhost"))
+	}
+	close(release)
+	for deadline := time.Now().Add(5 * time.Second); hostname("192.0.2.1") == ""; {
+		if time.Now().After(deadline) {
+			t.Fatal("the client name has not been resolved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "host1.example.org", hostname("192.0.2.1:5000"))
+	assert.Equal(t, "", hostname("192.0.2.2"))
+	// the results and the failures are cached
+	mu.Lock()
+	assert.Equal(t, 2, queries)
+	mu.Unlock()
+}
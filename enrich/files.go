@@ -0,0 +1,108 @@
+package enrich
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// files holds the names of the lookup files of the configuration, relative
+// to the configuration directory dir, and the tables and databases parsed
+// from them. The enrichers are created with the files that are current at
+// that time.
+var files = struct {
+	sync.Mutex
+	dir        string
+	digests    map[string]string
+	generation uint64
+	tables     map[string]tableResult
+	databases  map[string]databaseResult
+}{
+	digests:   map[string]string{},
+	tables:    map[string]tableResult{},
+	databases: map[string]databaseResult{},
+}
+
+type tableResult struct {
+	table table
+	err   error
+}
+
+type databaseResult struct {
+	db  *maxminddb.Reader
+	err error
+}
+
+// SetFiles replaces the lookup files. They are read from dir, and digests
+// gives a digest of their content by name. The enrichers that were created
+// with the previous files become obsolete.
+func SetFiles(dir string, digests map[string]string) {
+	if digests == nil {
+		digests = map[string]string{}
+	}
+	files.Lock()
+	files.dir = dir
+	files.digests = digests
+	files.tables = map[string]tableResult{}
+	files.databases = map[string]databaseResult{}
+	files.generation++
+	files.Unlock()
+}
+
+// Generation returns a number that changes each time the lookup files are
+// replaced.
+func Generation() uint64 {
+	files.Lock()
+	defer files.Unlock()
+	return files.generation
+}
+
+// loadTable returns the lookup table parsed from the file name. The table is
+// parsed once for all the enrichers.
+func loadTable(name string) (table, error) {
+	files.Lock()
+	defer files.Unlock()
+	if res, ok := files.tables[name]; ok {
+		return res.table, res.err
+	}
+	var res tableResult
+	content, err := readFile(name)
+	if err == nil {
+		res.table, res.err = parseTable(name, content)
+	} else {
+		res.err = err
+	}
+	files.tables[name] = res
+	return res.table, res.err
+}
+
+// loadDatabase returns the reader of the GeoIP database name. The database
+// is read in memory instead of being mapped, as the enrichers that use it
+// are not closed when the files are replaced.
+func loadDatabase(name string) (*maxminddb.Reader, error) {
+	files.Lock()
+	defer files.Unlock()
+	if res, ok := files.databases[name]; ok {
+		return res.db, res.err
+	}
+	var res databaseResult
+	content, err := readFile(name)
+	if err == nil {
+		res.db, res.err = maxminddb.FromBytes(content)
+	} else {
+		res.err = err
+	}
+	files.databases[name] = res
+	return res.db, res.err
+}
+
+// readFile returns the content of the lookup file name. The files lock must
+// be held.
+func readFile(name string) ([]byte, error) {
+	if _, ok := files.digests[name]; !ok {
+		return nil, errNotLoaded(name)
+	}
+	return ioutil.ReadFile(filepath.Join(files.dir, filepath.FromSlash(name)))
+}
@@ -0,0 +1,46 @@
+package enrich
+
+import (
+	"strconv"
+)
+
+// geoFields are the fields of the GeoIP2/GeoLite2 City, Country and ASN
+// databases that are written in the properties.
+var geoFields = []struct {
+	name string
+	path []string
+}{
+	{"country_code", []string{"country", "iso_code"}},
+	{"country", []string{"country", "names", "en"}},
+	{"continent", []string{"continent", "code"}},
+	{"city", []string{"city", "names", "en"}},
+	{"latitude", []string{"location", "latitude"}},
+	{"longitude", []string{"location", "longitude"}},
+	{"asn", []string{"autonomous_system_number"}},
+	{"as_org", []string{"autonomous_system_organization"}},
+}
+
+// geoProperties extracts the known fields from a GeoIP record.
+func geoProperties(record interface{}, f func(name, value string)) {
+	for _, field := range geoFields {
+		v := record
+		for _, k := range field.path {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				v = nil
+				break
+			}
+			v = m[k]
+		}
+		switch x := v.(type) {
+		case string:
+			f(field.name, x)
+		case uint64:
+			f(field.name, strconv.FormatUint(x, 10))
+		case int64:
+			f(field.name, strconv.FormatInt(x, 10))
+		case float64:
+			f(field.name, strconv.FormatFloat(x, 'f', -1, 64))
+		}
+	}
+}
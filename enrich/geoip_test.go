@@ -0,0 +1,141 @@
+package enrich
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+// the helpers below write a small IPv4 database, in the MaxMind DB format.
+
+const (
+	typeString = 2
+	typeDouble = 3
+	typeUint32 = 6
+	typeMap    = 7
+
+	dataSectionSeparator = 16
+)
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+func encode(v interface{}) []byte {
+	ctrl := func(typ int, size int) []byte {
+		return []byte{byte(typ<<5 | size)}
+	}
+	switch x := v.(type) {
+	case string:
+		return append(ctrl(typeString, len(x)), x...)
+	case uint32:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, x)
+		return append(ctrl(typeUint32, 4), b...)
+	case float64:
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, math.Float64bits(x))
+		return append(ctrl(typeDouble, 8), b...)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b := ctrl(typeMap, len(x))
+		for _, k := range keys {
+			b = append(b, encode(k)...)
+			b = append(b, encode(x[k])...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+// writeDB returns a database with 24 bits records, that holds data for a
+// single network.
+func writeDB(cidr string, data map[string]interface{}) []byte {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	ip := ipnet.IP.To4()
+	prefix, _ := ipnet.Mask.Size()
+	// one node per bit of the prefix, the other branches are empty
+	count := prefix
+	var tree []byte
+	for i := 0; i < prefix; i++ {
+		next := uint32(i + 1)
+		if i == prefix-1 {
+			next = uint32(count + dataSectionSeparator)
+		}
+		records := [2]uint32{uint32(count), uint32(count)}
+		records[(ip[i/8]>>uint(7-i%8))&1] = next
+		for _, r := range records {
+			tree = append(tree, byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(tree)
+	buf.Write(make([]byte, dataSectionSeparator))
+	buf.Write(encode(data))
+	buf.Write(metadataMarker)
+	buf.Write(encode(map[string]interface{}{
+		"node_count":    uint32(count),
+		"record_size":   uint32(24),
+		"ip_version":    uint32(4),
+		"database_type": "Test",
+	}))
+	return buf.Bytes()
+}
+
+func TestGeoIP(t *testing.T) {
+	setFiles(t, map[string][]byte{
+		"geo.mmdb": writeDB("192.0.2.0/24", map[string]interface{}{
+			"country":                  map[string]interface{}{"iso_code": "FR"},
+			"location":                 map[string]interface{}{"latitude": 48.85, "longitude": 2.35},
+			"autonomous_system_number": uint32(64512),
+		}),
+		"broken.mmdb": []byte("not a database"),
+	})
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+
+	e := New(conf.EnrichmentConfig{
+		Name:            "geo",
+		Namespace:       "geo",
+		GeoIPDatabase:   "geo.mmdb",
+		GeoIPProperties: []string{"net.src"},
+	}, logger)
+	enrich := func(ip string) map[string]string {
+		m := newMessage("", "")
+		m.Fields.SetProperty("net", "src", ip)
+		e.Enrich(m)
+		if props, ok := m.Fields.Properties.Map["geo"]; ok {
+			return props.Map
+		}
+		return nil
+	}
+	assert.Equal(t, map[string]string{
+		"src.country_code": "FR",
+		"src.latitude":     "48.85",
+		"src.longitude":    "2.35",
+		"src.asn":          "64512",
+	}, enrich("192.0.2.10"))
+	assert.Empty(t, enrich("198.51.100.1"))
+	assert.Empty(t, enrich("not an IP"))
+
+	e = New(conf.EnrichmentConfig{
+		Name:            "broken",
+		Namespace:       "geo",
+		GeoIPDatabase:   "broken.mmdb",
+		GeoIPProperties: []string{"net.src"},
+	}, logger)
+	assert.Empty(t, enrich("192.0.2.10"))
+}
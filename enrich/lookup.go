@@ -0,0 +1,100 @@
+package enrich
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// table maps the lowercased keys to the columns of a lookup file.
+type table map[string]map[string]string
+
+func errNotLoaded(name string) error {
+	return eerrors.Errorf("The lookup file '%s' has not been loaded", name)
+}
+
+func parseTable(name string, content []byte) (table, error) {
+	var t table
+	var err error
+	switch strings.ToLower(path.Ext(name)) {
+	case ".csv":
+		t, err = parseCSV(content)
+	case ".json":
+		t, err = parseJSON(content)
+	default:
+		err = eerrors.New("Unknown format")
+	}
+	if err != nil {
+		return nil, eerrors.Wrapf(err, "Error parsing lookup file '%s'", name)
+	}
+	return t, nil
+}
+
+// parseCSV reads a CSV file. The first line gives the names of the columns,
+// the first column is the key.
+func parseCSV(content []byte) (table, error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+	header, err := r.Read()
+	if err == io.EOF {
+		return table{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(header) < 2 {
+		return nil, eerrors.New("The CSV header must have a key column and at least a value column")
+	}
+	t := table{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(strings.TrimSpace(record[0]))
+		if len(key) == 0 {
+			continue
+		}
+		columns := make(map[string]string, len(header)-1)
+		for i := 1; i < len(header) && i < len(record); i++ {
+			columns[strings.TrimSpace(header[i])] = strings.TrimSpace(record[i])
+		}
+		t[key] = columns
+	}
+}
+
+// parseJSON reads a JSON object, that maps the keys to objects. The values
+// that are not strings are written in JSON.
+func parseJSON(content []byte) (table, error) {
+	var obj map[string]map[string]json.RawMessage
+	err := json.Unmarshal(content, &obj)
+	if err != nil {
+		return nil, err
+	}
+	t := make(table, len(obj))
+	for key, raw := range obj {
+		columns := make(map[string]string, len(raw))
+		for column, value := range raw {
+			var s string
+			if json.Unmarshal(value, &s) != nil {
+				if bytes.Equal(value, []byte("null")) {
+					continue
+				}
+				s = string(value)
+			}
+			columns[column] = s
+		}
+		t[strings.ToLower(strings.TrimSpace(key))] = columns
+	}
+	return t, nil
+}
@@ -0,0 +1,480 @@
+// Package expr evaluates the filter expressions natively, without a
+// javascript virtual machine. The syntax is described in the syntax package.
+package expr
+
+import (
+	"hash/fnv"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/stephane-martin/skewer/expr/syntax"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+type boolFunc func(*model.SyslogMessage) bool
+type numFunc func(*model.SyslogMessage) float64
+type strFunc func(*model.SyslogMessage) string
+
+// Program is a compiled expression.
+type Program struct {
+	source string
+	typ    syntax.Type
+	b      boolFunc
+	n      numFunc
+	s      strFunc
+}
+
+// Compile parses an expression and compiles it to golang closures.
+func Compile(source string) (*Program, error) {
+	node, err := syntax.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	p := Program{source: source, typ: node.Type()}
+	switch node.Type() {
+	case syntax.Bool:
+		p.b = compileBool(node)
+	case syntax.Number:
+		p.n = compileNum(node)
+	case syntax.String:
+		p.s = compileStr(node)
+	default:
+		return nil, eerrors.Errorf("The expression '%s' is a %s", source, node.Type())
+	}
+	return &p, nil
+}
+
+// Source returns the source of the expression.
+func (p *Program) Source() string {
+	return p.source
+}
+
+// Type returns the type of the expression result.
+func (p *Program) Type() syntax.Type {
+	return p.typ
+}
+
+// Bool evaluates the expression as a bool. A number is true when it is not 0,
+// a string when it is not empty.
+func (p *Program) Bool(m *model.SyslogMessage) bool {
+	switch p.typ {
+	case syntax.Bool:
+		return p.b(m)
+	case syntax.Number:
+		return p.n(m) != 0
+	default:
+		return len(p.s(m)) > 0
+	}
+}
+
+// Number evaluates the expression as a number. A string that is not a
+// number is 0.
+func (p *Program) Number(m *model.SyslogMessage) float64 {
+	switch p.typ {
+	case syntax.Bool:
+		if p.b(m) {
+			return 1
+		}
+		return 0
+	case syntax.Number:
+		return p.n(m)
+	default:
+		return toNumber(p.s(m))
+	}
+}
+
+// String evaluates the expression as a string.
+func (p *Program) String(m *model.SyslogMessage) string {
+	switch p.typ {
+	case syntax.Bool:
+		return strconv.FormatBool(p.b(m))
+	case syntax.Number:
+		return formatNumber(p.n(m))
+	default:
+		return p.s(m)
+	}
+}
+
+func formatNumber(n float64) string {
+	if n == math.Trunc(n) && math.Abs(n) < 1e15 {
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+func toNumber(s string) float64 {
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func compileBool(node syntax.Node) boolFunc {
+	switch n := node.(type) {
+	case *syntax.Literal:
+		v := n.Bool
+		return func(*model.SyslogMessage) bool { return v }
+	case *syntax.Unary:
+		x := compileBool(n.X)
+		return func(m *model.SyslogMessage) bool { return !x(m) }
+	case *syntax.Cond:
+		c, t, e := compileBool(n.Cond), compileBool(n.Then), compileBool(n.Else)
+		return func(m *model.SyslogMessage) bool {
+			if c(m) {
+				return t(m)
+			}
+			return e(m)
+		}
+	case *syntax.Call:
+		return compileBoolCall(n)
+	case *syntax.Binary:
+		return compileBoolBinary(n)
+	}
+	panic("unexpected bool expression")
+}
+
+func compileBoolBinary(n *syntax.Binary) boolFunc {
+	switch n.Op {
+	case "&&":
+		x, y := compileBool(n.X), compileBool(n.Y)
+		return func(m *model.SyslogMessage) bool { return x(m) && y(m) }
+	case "||":
+		x, y := compileBool(n.X), compileBool(n.Y)
+		return func(m *model.SyslogMessage) bool { return x(m) || y(m) }
+	case "=~":
+		x, re := compileStr(n.X), n.Regexp
+		return func(m *model.SyslogMessage) bool { return re.MatchString(x(m)) }
+	case "!~":
+		x, re := compileStr(n.X), n.Regexp
+		return func(m *model.SyslogMessage) bool { return !re.MatchString(x(m)) }
+	case "in":
+		return compileIn(n.X, n.Y.(*syntax.ListLiteral))
+	}
+	switch n.X.Type() {
+	case syntax.Number:
+		x, y := compileNum(n.X), compileNum(n.Y)
+		switch n.Op {
+		case "==":
+			return func(m *model.SyslogMessage) bool { return x(m) == y(m) }
+		case "!=":
+			return func(m *model.SyslogMessage) bool { return x(m) != y(m) }
+		case "<":
+			return func(m *model.SyslogMessage) bool { return x(m) < y(m) }
+		case "<=":
+			return func(m *model.SyslogMessage) bool { return x(m) <= y(m) }
+		case ">":
+			return func(m *model.SyslogMessage) bool { return x(m) > y(m) }
+		case ">=":
+			return func(m *model.SyslogMessage) bool { return x(m) >= y(m) }
+		}
+	case syntax.String:
+		x, y := compileStr(n.X), compileStr(n.Y)
+		switch n.Op {
+		case "==":
+			return func(m *model.SyslogMessage) bool { return x(m) == y(m) }
+		case "!=":
+			return func(m *model.SyslogMessage) bool { return x(m) != y(m) }
+		case "<":
+			return func(m *model.SyslogMessage) bool { return x(m) < y(m) }
+		case "<=":
+			return func(m *model.SyslogMessage) bool { return x(m) <= y(m) }
+		case ">":
+			return func(m *model.SyslogMessage) bool { return x(m) > y(m) }
+		case ">=":
+			return func(m *model.SyslogMessage) bool { return x(m) >= y(m) }
+		}
+	case syntax.Bool:
+		x, y := compileBool(n.X), compileBool(n.Y)
+		if n.Op == "==" {
+			return func(m *model.SyslogMessage) bool { return x(m) == y(m) }
+		}
+		return func(m *model.SyslogMessage) bool { return x(m) != y(m) }
+	}
+	panic("unexpected comparison")
+}
+
+// compileIn builds a set with the elements of the list. With a string, the
+// elements that are networks match the IP addresses they contain.
+func compileIn(x syntax.Node, list *syntax.ListLiteral) boolFunc {
+	if x.Type() == syntax.Number {
+		set := make(map[float64]bool, len(list.Elems))
+		for _, elem := range list.Elems {
+			set[elem.Number] = true
+		}
+		f := compileNum(x)
+		return func(m *model.SyslogMessage) bool { return set[f(m)] }
+	}
+	set := make(map[string]bool, len(list.Elems))
+	var networks []*net.IPNet
+	for _, elem := range list.Elems {
+		set[elem.String] = true
+		if _, network, err := net.ParseCIDR(elem.String); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	f := compileStr(x)
+	return func(m *model.SyslogMessage) bool {
+		s := f(m)
+		if set[s] {
+			return true
+		}
+		if len(networks) == 0 {
+			return false
+		}
+		ip := net.ParseIP(strings.TrimSpace(s))
+		if ip == nil {
+			return false
+		}
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func compileBoolCall(n *syntax.Call) boolFunc {
+	if n.Func == "exists" {
+		field := n.Args[0].(*syntax.Field)
+		domain, key := field.Domain, field.Key
+		return func(m *model.SyslogMessage) bool {
+			props := m.Properties.Map[domain]
+			if props == nil {
+				return false
+			}
+			_, ok := props.Map[key]
+			return ok
+		}
+	}
+	x, y := compileStr(n.Args[0]), compileStr(n.Args[1])
+	switch n.Func {
+	case "contains":
+		return func(m *model.SyslogMessage) bool { return strings.Contains(x(m), y(m)) }
+	case "starts_with":
+		return func(m *model.SyslogMessage) bool { return strings.HasPrefix(x(m), y(m)) }
+	case "ends_with":
+		return func(m *model.SyslogMessage) bool { return strings.HasSuffix(x(m), y(m)) }
+	}
+	panic("unexpected function")
+}
+
+func compileNum(node syntax.Node) numFunc {
+	switch n := node.(type) {
+	case *syntax.Literal:
+		v := n.Number
+		return func(*model.SyslogMessage) float64 { return v }
+	case *syntax.Field:
+		return numField(n.Name)
+	case *syntax.Unary:
+		x := compileNum(n.X)
+		return func(m *model.SyslogMessage) float64 { return -x(m) }
+	case *syntax.Cond:
+		c, t, e := compileBool(n.Cond), compileNum(n.Then), compileNum(n.Else)
+		return func(m *model.SyslogMessage) float64 {
+			if c(m) {
+				return t(m)
+			}
+			return e(m)
+		}
+	case *syntax.Call:
+		return compileNumCall(n)
+	case *syntax.Binary:
+		x, y := compileNum(n.X), compileNum(n.Y)
+		switch n.Op {
+		case "+":
+			return func(m *model.SyslogMessage) float64 { return x(m) + y(m) }
+		case "-":
+			return func(m *model.SyslogMessage) float64 { return x(m) - y(m) }
+		case "*":
+			return func(m *model.SyslogMessage) float64 { return x(m) * y(m) }
+		case "/":
+			return func(m *model.SyslogMessage) float64 {
+				d := y(m)
+				if d == 0 {
+					return 0
+				}
+				return x(m) / d
+			}
+		case "%":
+			return func(m *model.SyslogMessage) float64 {
+				d := y(m)
+				if d == 0 {
+					return 0
+				}
+				return math.Mod(x(m), d)
+			}
+		}
+	}
+	panic("unexpected number expression")
+}
+
+func numField(name string) numFunc {
+	switch name {
+	case "severity":
+		return func(m *model.SyslogMessage) float64 { return float64(m.Severity) }
+	case "facility":
+		return func(m *model.SyslogMessage) float64 { return float64(m.Facility) }
+	case "priority":
+		return func(m *model.SyslogMessage) float64 { return float64(m.Priority) }
+	case "version":
+		return func(m *model.SyslogMessage) float64 { return float64(m.Version) }
+	case "time_reported":
+		return func(m *model.SyslogMessage) float64 { return float64(m.TimeReportedNum) / 1e9 }
+	case "time_generated":
+		return func(m *model.SyslogMessage) float64 { return float64(m.TimeGeneratedNum) / 1e9 }
+	}
+	panic("unexpected number field")
+}
+
+func compileNumCall(n *syntax.Call) numFunc {
+	switch n.Func {
+	case "len":
+		x := compileStr(n.Args[0])
+		return func(m *model.SyslogMessage) float64 { return float64(len(x(m))) }
+	case "hash":
+		x := compileStr(n.Args[0])
+		return func(m *model.SyslogMessage) float64 {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(x(m)))
+			return float64(h.Sum32() & math.MaxInt32)
+		}
+	case "num":
+		x := compileStr(n.Args[0])
+		return func(m *model.SyslogMessage) float64 { return toNumber(x(m)) }
+	}
+	panic("unexpected function")
+}
+
+func compileStr(node syntax.Node) strFunc {
+	switch n := node.(type) {
+	case *syntax.Literal:
+		v := n.String
+		return func(*model.SyslogMessage) string { return v }
+	case *syntax.Field:
+		return strField(n)
+	case *syntax.Cond:
+		c, t, e := compileBool(n.Cond), compileStr(n.Then), compileStr(n.Else)
+		return func(m *model.SyslogMessage) string {
+			if c(m) {
+				return t(m)
+			}
+			return e(m)
+		}
+	case *syntax.Call:
+		return compileStrCall(n)
+	case *syntax.Binary:
+		// concatenation
+		x, y := toStr(n.X), toStr(n.Y)
+		return func(m *model.SyslogMessage) string { return x(m) + y(m) }
+	}
+	panic("unexpected string expression")
+}
+
+// toStr compiles a string or number expression to a string.
+func toStr(node syntax.Node) strFunc {
+	if node.Type() == syntax.Number {
+		x := compileNum(node)
+		return func(m *model.SyslogMessage) string { return formatNumber(x(m)) }
+	}
+	return compileStr(node)
+}
+
+func strField(f *syntax.Field) strFunc {
+	switch f.Name {
+	case "hostname":
+		return func(m *model.SyslogMessage) string { return m.HostName }
+	case "app_name":
+		return func(m *model.SyslogMessage) string { return m.AppName }
+	case "proc_id":
+		return func(m *model.SyslogMessage) string { return m.ProcId }
+	case "msg_id":
+		return func(m *model.SyslogMessage) string { return m.MsgId }
+	case "structured":
+		return func(m *model.SyslogMessage) string { return m.Structured }
+	case "message":
+		return func(m *model.SyslogMessage) string { return m.Message }
+	case "props":
+		domain, key := f.Domain, f.Key
+		return func(m *model.SyslogMessage) string { return m.GetProperty(domain, key) }
+	}
+	panic("unexpected string field")
+}
+
+func compileStrCall(n *syntax.Call) strFunc {
+	if n.Func == "str" {
+		return toStr(n.Args[0])
+	}
+	x := compileStr(n.Args[0])
+	switch n.Func {
+	case "lower":
+		return func(m *model.SyslogMessage) string { return strings.ToLower(x(m)) }
+	case "upper":
+		return func(m *model.SyslogMessage) string { return strings.ToUpper(x(m)) }
+	case "trim":
+		return func(m *model.SyslogMessage) string { return strings.TrimSpace(x(m)) }
+	case "template":
+		return func(m *model.SyslogMessage) string { return Template(x(m)) }
+	}
+	panic("unexpected function")
+}
+
+func isAlnum(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHexWord(w string) bool {
+	digit := false
+	for i := 0; i < len(w); i++ {
+		c := w[i]
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F'):
+		default:
+			return false
+		}
+	}
+	return digit
+}
+
+// Template replaces the variable parts of s by "*": the numbers (with their
+// unit, if any, kept) and the hexadecimal identifiers (words made of hex
+// digits, with at least a digit).
+// The messages that only differ by a pid, a duration or an address have the
+// same template.
+func Template(s string) string {
+	var b strings.Builder
+	i := 0
+	for i < len(s) {
+		if !isAlnum(s[i]) {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && isAlnum(s[j]) {
+			j++
+		}
+		k := i
+		for k < j && s[k] >= '0' && s[k] <= '9' {
+			k++
+		}
+		switch {
+		case isHexWord(s[i:j]):
+			b.WriteByte('*')
+		case k > i:
+			// a number with a unit, like 20ms
+			b.WriteByte('*')
+			b.WriteString(s[k:j])
+		default:
+			b.WriteString(s[i:j])
+		}
+		i = j
+	}
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMessage() *model.SyslogMessage {
+	m := model.Factory()
+	m.Severity = model.SWarning
+	m.Facility = model.Fauth
+	m.AppName = "sshd"
+	m.HostName = "host1"
+	m.Message = "Failed password for root"
+	m.TimeReportedNum = 1518635094 * 1000000000
+	m.SetProperty("skewer", "client", "10.1.2.3")
+	return m
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`severity <= 4 && app_name =~ "^sshd" && props.skewer.client in ["10.0.0.0/8"]`, "true"},
+		{`props.skewer.client in ["192.168.0.0/16", "127.0.0.1"]`, "false"},
+		{`props.skewer.client in ["10.1.2.3"]`, "true"},
+		{`severity <= "err"`, "false"},
+		{`facility in ["auth", "authpriv"]`, "true"},
+		{`"logs-" + lower(app_name) + "-" + severity`, "logs-sshd-4"},
+		{`severity < 4 ? "alerts" : "logs"`, "logs"},
+		{`exists(props.skewer.client) && !exists(props.skewer.nope)`, "true"},
+		{`contains(message, "password") && starts_with(message, "Failed") && ends_with(message, "root")`, "true"},
+		{`len(hostname) * 2 + 1`, "11"},
+		{`7 / 2`, "3.5"},
+		{`7 % 0`, "0"},
+		{`time_reported`, "1518635094"},
+		{`num("12") + 1`, "13"},
+		{`str(severity) + "!"`, "4!"},
+		{`upper(props["skewer"]["client"])`, "10.1.2.3"},
+		{`message !~ 'root$'`, "false"},
+		{`template("pid 1234 took 5.2s, id=4f3a9c user42 from 10.1.2.3")`, "pid * took *.*s, id=* user42 from *.*.*.*"},
+	}
+	m := testMessage()
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			p, err := Compile(test.src)
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.expected, p.String(m))
+			}
+		})
+	}
+}
+
+func TestConversions(t *testing.T) {
+	m := testMessage()
+	p, err := Compile(`hash(hostname) % 4`)
+	if assert.NoError(t, err) {
+		n := p.Number(m)
+		assert.True(t, n >= 0 && n < 4)
+		assert.Equal(t, n, p.Number(m))
+	}
+	p, err = Compile(`app_name`)
+	if assert.NoError(t, err) {
+		assert.True(t, p.Bool(m))
+		assert.Equal(t, float64(0), p.Number(m))
+	}
+	_, err = Compile(`[1, 2]`)
+	assert.Error(t, err)
+}
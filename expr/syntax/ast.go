@@ -0,0 +1,213 @@
+package syntax
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Type is the static type of an expression.
+type Type int
+
+const (
+	Bool Type = iota + 1
+	Number
+	String
+	List
+)
+
+func (t Type) String() string {
+	switch t {
+	case Bool:
+		return "bool"
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case List:
+		return "list"
+	default:
+		return "unknown"
+	}
+}
+
+// Node is a node of the syntax tree of an expression.
+type Node interface {
+	Type() Type
+	Pos() int
+}
+
+// Literal is a bool, number or string constant.
+type Literal struct {
+	Position int
+	Typ      Type
+	Bool     bool
+	Number   float64
+	String   string
+}
+
+func (n *Literal) Type() Type { return n.Typ }
+func (n *Literal) Pos() int   { return n.Position }
+
+// ListLiteral is a list of constants, the right operand of "in".
+type ListLiteral struct {
+	Position int
+	Elems    []*Literal
+}
+
+func (n *ListLiteral) Type() Type { return List }
+func (n *ListLiteral) Pos() int   { return n.Position }
+
+// Field is a field of the message. For the properties, Name is "props" and
+// Domain and Key tell which property.
+type Field struct {
+	Position int
+	Typ      Type
+	Name     string
+	Domain   string
+	Key      string
+}
+
+func (n *Field) Type() Type { return n.Typ }
+func (n *Field) Pos() int   { return n.Position }
+
+// Unary is "!x" or "-x".
+type Unary struct {
+	Position int
+	Typ      Type
+	Op       string
+	X        Node
+}
+
+func (n *Unary) Type() Type { return n.Typ }
+func (n *Unary) Pos() int   { return n.Position }
+
+// Binary is "x op y". For "=~" and "!~", Regexp is the compiled right operand.
+type Binary struct {
+	Position int
+	Typ      Type
+	Op       string
+	X        Node
+	Y        Node
+	Regexp   *regexp.Regexp
+}
+
+func (n *Binary) Type() Type { return n.Typ }
+func (n *Binary) Pos() int   { return n.Position }
+
+// Cond is "cond ? then : else".
+type Cond struct {
+	Position int
+	Cond     Node
+	Then     Node
+	Else     Node
+}
+
+func (n *Cond) Type() Type { return n.Then.Type() }
+func (n *Cond) Pos() int   { return n.Position }
+
+// Call is a call of a builtin function.
+type Call struct {
+	Position int
+	Typ      Type
+	Func     string
+	Args     []Node
+}
+
+func (n *Call) Type() Type { return n.Typ }
+func (n *Call) Pos() int   { return n.Position }
+
+type fieldDef struct {
+	name string
+	typ  Type
+}
+
+// fields are the message fields that expressions can use, with their
+// aliases.
+var fields = map[string]fieldDef{
+	"severity":       {"severity", Number},
+	"facility":       {"facility", Number},
+	"priority":       {"priority", Number},
+	"version":        {"version", Number},
+	"time_reported":  {"time_reported", Number},
+	"time_generated": {"time_generated", Number},
+	"hostname":       {"hostname", String},
+	"host_name":      {"hostname", String},
+	"app_name":       {"app_name", String},
+	"appname":        {"app_name", String},
+	"proc_id":        {"proc_id", String},
+	"procid":         {"proc_id", String},
+	"msg_id":         {"msg_id", String},
+	"msgid":          {"msg_id", String},
+	"structured":     {"structured", String},
+	"message":        {"message", String},
+}
+
+type funcDef struct {
+	args   []Type
+	result Type
+}
+
+// funcs are the builtin functions.
+var funcs = map[string]funcDef{
+	"lower":       {[]Type{String}, String},
+	"upper":       {[]Type{String}, String},
+	"trim":        {[]Type{String}, String},
+	"template":    {[]Type{String}, String},
+	"contains":    {[]Type{String, String}, Bool},
+	"starts_with": {[]Type{String, String}, Bool},
+	"ends_with":   {[]Type{String, String}, Bool},
+	"len":         {[]Type{String}, Number},
+	"hash":        {[]Type{String}, Number},
+	"num":         {[]Type{String}, Number},
+	"str":         {[]Type{Number}, String},
+	"exists":      {[]Type{String}, Bool},
+}
+
+// severities and facilities are the names that can be compared with the
+// severity and facility fields. They follow model.Severities and
+// model.Facilities.
+var severities = map[string]float64{
+	"emerg":   0,
+	"alert":   1,
+	"crit":    2,
+	"err":     3,
+	"error":   3,
+	"warning": 4,
+	"warn":    4,
+	"notice":  5,
+	"info":    6,
+	"debug":   7,
+}
+
+var facilities = map[string]float64{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"clock":    9,
+	"authpriv": 10,
+	"ftp":      11,
+	"ntp":      12,
+	"logaudit": 13,
+	"logalert": 14,
+	"cron":     15,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// Severity returns the number of a severity name.
+func Severity(name string) (int, bool) {
+	n, ok := severities[strings.ToLower(name)]
+	return int(n), ok
+}
@@ -0,0 +1,136 @@
+package syntax
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+type tokenKind int
+
+const (
+	tEOF tokenKind = iota
+	tIdent
+	tNumber
+	tString
+	tOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	num  float64
+	str  string
+}
+
+// ops are the operators and punctuation, longest first.
+var ops = []string{
+	"&&", "||", "==", "!=", "<=", ">=", "=~", "!~",
+	"<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", ".", "?", ":",
+}
+
+func syntaxError(pos int, format string, args ...interface{}) error {
+	return eerrors.WithTypes(
+		eerrors.Errorf("Syntax error at position %d: %s", pos, fmt.Sprintf(format, args...)),
+		"Expression",
+	)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+Loop:
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tIdent, text: src[start:i], pos: start})
+		case isDigit(c):
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			if i+1 < len(src) && src[i] == '.' && isDigit(src[i+1]) {
+				i++
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				j := i + 1
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				if j < len(src) && isDigit(src[j]) {
+					i = j
+					for i < len(src) && isDigit(src[i]) {
+						i++
+					}
+				}
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, syntaxError(start, "invalid number '%s'", src[start:i])
+			}
+			tokens = append(tokens, token{kind: tNumber, text: src[start:i], pos: start, num: n})
+		case c == '"':
+			start := i
+			i++
+			for i < len(src) && src[i] != '"' {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(src) {
+				return nil, syntaxError(start, "unterminated string")
+			}
+			i++
+			s, err := strconv.Unquote(src[start:i])
+			if err != nil {
+				return nil, syntaxError(start, "invalid string %s", src[start:i])
+			}
+			tokens = append(tokens, token{kind: tString, text: src[start:i], pos: start, str: s})
+		case c == '\'':
+			// single quoted strings have no escapes, for the regexps
+			start := i
+			end := strings.IndexByte(src[i+1:], '\'')
+			if end < 0 {
+				return nil, syntaxError(start, "unterminated string")
+			}
+			i += end + 2
+			tokens = append(tokens, token{kind: tString, text: src[start:i], pos: start, str: src[start+1 : i-1]})
+		default:
+			for _, op := range ops {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tOp, text: op, pos: i})
+					i += len(op)
+					continue Loop
+				}
+			}
+			if c == '=' {
+				return nil, syntaxError(i, "unexpected '=', use '==' to compare")
+			}
+			return nil, syntaxError(i, "unexpected character '%c'", c)
+		}
+	}
+	tokens = append(tokens, token{kind: tEOF, pos: len(src)})
+	return tokens, nil
+}
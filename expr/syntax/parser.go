@@ -0,0 +1,478 @@
+package syntax
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Parse parses and type checks an expression.
+//
+// The expressions use the message fields (severity, facility, priority,
+// version, time_reported, time_generated, hostname, app_name, proc_id,
+// msg_id, structured, message) and the properties (props.domain.key, or
+// props["domain"]["key"]). The operators are, by increasing precedence:
+//
+//	c ? a : b
+//	||
+//	&&
+//	== != < <= > >= =~ !~ in
+//	+ -
+//	* / %
+//	! - (unary)
+//
+// The severity and the facility can be compared with their names, like
+// severity <= "warning". The right operand of "in" is a list of constants.
+// When the left operand is an IP address, the list may contain networks in
+// CIDR notation.
+func Parse(src string) (Node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{tokens: tokens}
+	node, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tEOF {
+		return nil, syntaxError(p.peek().pos, "unexpected '%s'", p.peek().text)
+	}
+	return node, nil
+}
+
+// Check parses an expression and checks that its type is one of types.
+func Check(src string, types ...Type) (Node, error) {
+	node, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range types {
+		if node.Type() == t {
+			return node, nil
+		}
+	}
+	return nil, syntaxError(0, "the expression is a %s", node.Type())
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tOp {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.isOp(op) {
+		t := p.peek()
+		if t.kind == tEOF {
+			return syntaxError(t.pos, "expected '%s', found the end of the expression", op)
+		}
+		return syntaxError(t.pos, "expected '%s', found '%s'", op, t.text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseExpr() (Node, error) {
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("?") {
+		return cond, nil
+	}
+	pos := p.next().pos
+	then, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	err = p.expect(":")
+	if err != nil {
+		return nil, err
+	}
+	els, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if cond.Type() != Bool {
+		return nil, syntaxError(pos, "the condition is a %s, not a bool", cond.Type())
+	}
+	if then.Type() != els.Type() || then.Type() == List {
+		return nil, syntaxError(pos, "the alternatives have different types (%s and %s)", then.Type(), els.Type())
+	}
+	return &Cond{Position: pos, Cond: cond, Then: then, Else: els}, nil
+}
+
+func (p *parser) parseOr() (Node, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	return p.parseLogical("&&", p.parseComparison)
+}
+
+func (p *parser) parseLogical(op string, operand func() (Node, error)) (Node, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(op) {
+		pos := p.next().pos
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if x.Type() != Bool || y.Type() != Bool {
+			return nil, syntaxError(pos, "the operands of '%s' must be bools", op)
+		}
+		x = &Binary{Position: pos, Typ: Bool, Op: op, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseComparison() (Node, error) {
+	x, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == tIdent && t.text == "in":
+		p.next()
+		return p.parseIn(x, t.pos)
+	case p.isOp("=~", "!~"):
+		p.next()
+		y, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return regexpMatch(x, y, t.text, t.pos)
+	case p.isOp("==", "!=", "<", "<=", ">", ">="):
+		p.next()
+		y, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return compare(x, y, t.text, t.pos)
+	default:
+		return x, nil
+	}
+}
+
+func (p *parser) parseIn(x Node, pos int) (Node, error) {
+	y, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	list, ok := y.(*ListLiteral)
+	if !ok {
+		return nil, syntaxError(y.Pos(), "the right operand of 'in' must be a list")
+	}
+	if x.Type() != String && x.Type() != Number {
+		return nil, syntaxError(pos, "the left operand of 'in' is a %s", x.Type())
+	}
+	for i, elem := range list.Elems {
+		if x.Type() == Number {
+			list.Elems[i], err = namedNumber(x, elem)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if list.Elems[i].Type() != x.Type() {
+			return nil, syntaxError(elem.Pos(), "the list of 'in' contains a %s, not a %s", elem.Type(), x.Type())
+		}
+	}
+	return &Binary{Position: pos, Typ: Bool, Op: "in", X: x, Y: list}, nil
+}
+
+func regexpMatch(x, y Node, op string, pos int) (Node, error) {
+	lit, ok := y.(*Literal)
+	if !ok || lit.Type() != String {
+		return nil, syntaxError(y.Pos(), "the right operand of '%s' must be a string constant", op)
+	}
+	if x.Type() != String {
+		return nil, syntaxError(pos, "the left operand of '%s' is a %s", op, x.Type())
+	}
+	re, err := regexp.Compile(lit.String)
+	if err != nil {
+		return nil, syntaxError(y.Pos(), "invalid regexp: %s", err)
+	}
+	return &Binary{Position: pos, Typ: Bool, Op: op, X: x, Y: y, Regexp: re}, nil
+}
+
+func compare(x, y Node, op string, pos int) (Node, error) {
+	var err error
+	if lit, ok := y.(*Literal); ok {
+		y, err = namedNumber(x, lit)
+	} else if lit, ok := x.(*Literal); ok {
+		x, err = namedNumber(y, lit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if x.Type() != y.Type() {
+		return nil, syntaxError(pos, "cannot compare a %s with a %s", x.Type(), y.Type())
+	}
+	switch x.Type() {
+	case Number, String:
+	case Bool:
+		if op != "==" && op != "!=" {
+			return nil, syntaxError(pos, "the bools can only be compared with '==' and '!='")
+		}
+	default:
+		return nil, syntaxError(pos, "cannot compare lists")
+	}
+	return &Binary{Position: pos, Typ: Bool, Op: op, X: x, Y: y}, nil
+}
+
+// namedNumber converts the name of a severity or of a facility to its
+// number, when lit is compared with that field.
+func namedNumber(field Node, lit *Literal) (*Literal, error) {
+	f, ok := field.(*Field)
+	if !ok || lit.Type() != String {
+		return lit, nil
+	}
+	var names map[string]float64
+	switch f.Name {
+	case "severity":
+		names = severities
+	case "facility":
+		names = facilities
+	default:
+		return lit, nil
+	}
+	n, ok := names[strings.ToLower(lit.String)]
+	if !ok {
+		return nil, syntaxError(lit.Pos(), "unknown %s '%s'", f.Name, lit.String)
+	}
+	return &Literal{Position: lit.Position, Typ: Number, Number: n}, nil
+}
+
+func (p *parser) parseAdditive() (Node, error) {
+	x, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+", "-") {
+		t := p.next()
+		y, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		typ := Number
+		switch {
+		case t.text == "+" && (x.Type() == String || y.Type() == String):
+			// concatenation, the numbers are formatted
+			if (x.Type() != String && x.Type() != Number) || (y.Type() != String && y.Type() != Number) {
+				return nil, syntaxError(t.pos, "cannot concatenate a %s and a %s", x.Type(), y.Type())
+			}
+			typ = String
+		case x.Type() != Number || y.Type() != Number:
+			return nil, syntaxError(t.pos, "the operands of '%s' must be numbers", t.text)
+		}
+		x = &Binary{Position: t.pos, Typ: typ, Op: t.text, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseMultiplicative() (Node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*", "/", "%") {
+		t := p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if x.Type() != Number || y.Type() != Number {
+			return nil, syntaxError(t.pos, "the operands of '%s' must be numbers", t.text)
+		}
+		x = &Binary{Position: t.pos, Typ: Number, Op: t.text, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if !p.isOp("!", "-") {
+		return p.parsePrimary()
+	}
+	t := p.next()
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if t.text == "!" {
+		if x.Type() != Bool {
+			return nil, syntaxError(t.pos, "the operand of '!' must be a bool")
+		}
+		return &Unary{Position: t.pos, Typ: Bool, Op: "!", X: x}, nil
+	}
+	if x.Type() != Number {
+		return nil, syntaxError(t.pos, "the operand of '-' must be a number")
+	}
+	return &Unary{Position: t.pos, Typ: Number, Op: "-", X: x}, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tNumber:
+		return &Literal{Position: t.pos, Typ: Number, Number: t.num}, nil
+	case tString:
+		return &Literal{Position: t.pos, Typ: String, String: t.str}, nil
+	case tIdent:
+		return p.parseIdent(t)
+	case tOp:
+		switch t.text {
+		case "(":
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			return p.parseList(t.pos)
+		}
+		return nil, syntaxError(t.pos, "unexpected '%s'", t.text)
+	default:
+		return nil, syntaxError(t.pos, "unexpected end of the expression")
+	}
+}
+
+func (p *parser) parseIdent(t token) (Node, error) {
+	switch t.text {
+	case "true", "false":
+		return &Literal{Position: t.pos, Typ: Bool, Bool: t.text == "true"}, nil
+	case "props":
+		domain, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		key, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		return &Field{Position: t.pos, Typ: String, Name: "props", Domain: domain, Key: key}, nil
+	}
+	if p.isOp("(") {
+		return p.parseCall(t)
+	}
+	def, ok := fields[t.text]
+	if !ok {
+		return nil, syntaxError(t.pos, "unknown field '%s'", t.text)
+	}
+	return &Field{Position: t.pos, Typ: def.typ, Name: def.name}, nil
+}
+
+// parseSelector parses .name or ["name"] after props.
+func (p *parser) parseSelector() (string, error) {
+	t := p.next()
+	if t.kind == tOp && t.text == "." {
+		name := p.next()
+		if name.kind != tIdent {
+			return "", syntaxError(name.pos, "expected a property name after '.'")
+		}
+		return name.text, nil
+	}
+	if t.kind == tOp && t.text == "[" {
+		name := p.next()
+		if name.kind != tString {
+			return "", syntaxError(name.pos, "expected a property name as a string after '['")
+		}
+		return name.str, p.expect("]")
+	}
+	return "", syntaxError(t.pos, "expected props.domain.key")
+}
+
+func (p *parser) parseCall(t token) (Node, error) {
+	def, ok := funcs[t.text]
+	if !ok {
+		return nil, syntaxError(t.pos, "unknown function '%s'", t.text)
+	}
+	p.next()
+	var args []Node
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			err := p.expect(",")
+			if err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	if len(args) != len(def.args) {
+		return nil, syntaxError(t.pos, "%s() takes %d arguments", t.text, len(def.args))
+	}
+	for i, arg := range args {
+		if arg.Type() != def.args[i] {
+			return nil, syntaxError(arg.Pos(), "the argument %d of %s() must be a %s", i+1, t.text, def.args[i])
+		}
+	}
+	if t.text == "exists" {
+		if f, ok := args[0].(*Field); !ok || f.Name != "props" {
+			return nil, syntaxError(args[0].Pos(), "the argument of exists() must be a property")
+		}
+	}
+	return &Call{Position: t.pos, Typ: def.result, Func: t.text, Args: args}, nil
+}
+
+func (p *parser) parseList(pos int) (Node, error) {
+	list := &ListLiteral{Position: pos}
+	for !p.isOp("]") {
+		if len(list.Elems) > 0 {
+			err := p.expect(",")
+			if err != nil {
+				return nil, err
+			}
+		}
+		elem, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lit, ok := elem.(*Literal)
+		if !ok {
+			if u, isUnary := elem.(*Unary); isUnary && u.Op == "-" {
+				lit, ok = u.X.(*Literal)
+				if ok {
+					lit = &Literal{Position: u.Position, Typ: Number, Number: -lit.Number}
+				}
+			}
+		}
+		if !ok {
+			return nil, syntaxError(elem.Pos(), "the lists can only contain constants")
+		}
+		list.Elems = append(list.Elems, lit)
+	}
+	p.next()
+	return list, nil
+}
@@ -0,0 +1,67 @@
+package syntax
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTypes(t *testing.T) {
+	tests := []struct {
+		src string
+		typ Type
+	}{
+		{`severity <= 4 && app_name =~ "^sshd" && props.skewer.client in ["10.0.0.0/8"]`, Bool},
+		{`severity <= "warning"`, Bool},
+		{`facility in ["auth", "authpriv"]`, Bool},
+		{`"logs-" + lower(app_name)`, String},
+		{`props["my-domain"]["my-key"]`, String},
+		{`hash(hostname) % 12`, Number},
+		{`severity < 4 ? "alerts" : "logs-" + severity`, String},
+		{`!(message =~ 'a\d+')`, Bool},
+		{`exists(props.a.b) || contains(message, "x")`, Bool},
+		{`-1.5e3 * (2 + priority)`, Number},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			node, err := Parse(test.src)
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.typ, node.Type())
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		`severity = 4`,
+		`severity <= "nope"`,
+		`unknown == 1`,
+		`app_name =~ "("`,
+		`app_name =~ message`,
+		`severity && true`,
+		`app_name in "x"`,
+		`app_name in [1]`,
+		`message == 1`,
+		`true ? 1 : "x"`,
+		`lower(1)`,
+		`exists(message)`,
+		`nope(message)`,
+		`(severity`,
+		`severity 4`,
+		`"unterminated`,
+		`props.a`,
+	} {
+		_, err := Parse(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	_, err := Check(`severity < 4`, Bool)
+	assert.NoError(t, err)
+	_, err = Check(`app_name`, Bool)
+	assert.Error(t, err)
+	_, err = Check(`hostname`, String, Number)
+	assert.NoError(t, err)
+}
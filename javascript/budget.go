@@ -0,0 +1,82 @@
+package javascript
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/conf"
+)
+
+// TimeoutCounter counts the JS function calls that exceeded their time or
+// stack budget. It has to be registered by the processes that run JS
+// functions.
+var TimeoutCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_js_timeouts_total",
+		Help: "total number of times a JS function exceeded its time or stack budget",
+	},
+	[]string{"function", "budget"},
+)
+
+type interruptedMarker struct{}
+
+// call executes the JS function f within the given budget.
+func (e *Environment) call(funcname string, budget conf.JSBudgetConfig, f goja.Callable, args ...goja.Value) (goja.Value, error) {
+	return e.guard(funcname, budget, func() (goja.Value, error) {
+		return f(nil, args...)
+	})
+}
+
+// runString executes the JS code src within the given budget.
+func (e *Environment) runString(name string, budget conf.JSBudgetConfig, src string) (goja.Value, error) {
+	return e.guard(name, budget, func() (goja.Value, error) {
+		return e.runtime.RunString(src)
+	})
+}
+
+// guard runs some JS code within the given budget. The code is interrupted
+// when it runs longer than the time budget, and when it nests more calls than
+// the stack budget.
+func (e *Environment) guard(funcname string, budget conf.JSBudgetConfig, run func() (goja.Value, error)) (goja.Value, error) {
+	if budget.JSMaxStack > 0 {
+		e.runtime.SetMaxCallStackSize(budget.JSMaxStack)
+	} else {
+		e.runtime.SetMaxCallStackSize(math.MaxInt32)
+	}
+	if budget.JSTimeout > 0 {
+		var mu sync.Mutex
+		done := false
+		timer := time.AfterFunc(budget.JSTimeout, func() {
+			mu.Lock()
+			if !done {
+				e.runtime.Interrupt(interruptedMarker{})
+			}
+			mu.Unlock()
+		})
+		defer func() {
+			mu.Lock()
+			done = true
+			mu.Unlock()
+			timer.Stop()
+			// the timer may have fired after the code has returned
+			e.runtime.ClearInterrupt()
+		}()
+	}
+
+	v, err := run()
+	if err == nil {
+		return v, nil
+	}
+	switch err.(type) {
+	case *goja.InterruptedError:
+		TimeoutCounter.WithLabelValues(funcname, "time").Inc()
+		return nil, jsTimeoutError(funcname, budget.JSTimeout)
+	case *goja.StackOverflowError:
+		TimeoutCounter.WithLabelValues(funcname, "stack").Inc()
+		return nil, jsStackError(funcname, budget.JSMaxStack)
+	}
+	return nil, err
+}
@@ -1,6 +1,8 @@
 package javascript
 
 import (
+	"time"
+
 	"github.com/dop251/goja"
 	"github.com/stephane-martin/skewer/utils/eerrors"
 )
@@ -71,3 +73,23 @@ func jsDecodingError(msg string, decoderName string) error {
 		"Decoding", "Javascript",
 	)
 }
+
+func jsTimeoutError(funcname string, timeout time.Duration) error {
+	return eerrors.WithTypes(
+		eerrors.Errorf("The JS function '%s' did not return within %s", funcname, timeout),
+		"Javascript", "Budget", "Timeout",
+	)
+}
+
+func jsStackError(funcname string, maxStack int) error {
+	return eerrors.WithTypes(
+		eerrors.Errorf("The JS function '%s' exceeded the maximum call stack size (%d)", funcname, maxStack),
+		"Javascript", "Budget",
+	)
+}
+
+// IsBudgetExceeded returns true when err was returned because a JS function
+// ran out of time or nested too many calls.
+func IsBudgetExceeded(err error) bool {
+	return eerrors.Is("Budget", err)
+}
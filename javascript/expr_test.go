@@ -0,0 +1,110 @@
+package javascript
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const benchFilterExpr = `severity <= 4 && app_name =~ "^sshd" && props.skewer.client in ["10.0.0.0/8"]`
+
+const benchFilterJS = `var net = "10.0.0.0/8";
+function FilterMessages(m) {
+	var client = m.Properties.skewer ? m.Properties.skewer.client : "";
+	if (m.Severity <= 4 && /^sshd/.test(m.Appname) && ip.inCIDR(client, net)) {
+		return FILTER.PASS;
+	}
+	return FILTER.DROPPED;
+}`
+
+func benchMessage() *model.SyslogMessage {
+	m := model.Factory()
+	m.Severity = model.SWarning
+	m.AppName = "sshd"
+	m.HostName = "host1"
+	m.Message = "Failed password for root"
+	m.SetProperty("skewer", "client", "10.1.2.3")
+	return m
+}
+
+func TestFilterExpressions(t *testing.T) {
+	config := conf.FilterSubConfig{
+		FilterExpr:          benchFilterExpr,
+		TopicExpr:           `"logs-" + app_name`,
+		TopicTmpl:           "topic-{{.AppName}}",
+		PartitionKeyExpr:    `hostname`,
+		PartitionNumberExpr: `severity % 3`,
+	}
+	env := NewFilterEnvironment(config, testLogger())
+	// no javascript virtual machine is needed
+	assert.Nil(t, env.runtime)
+	assert.False(t, env.Obsolete())
+
+	m := benchMessage()
+	result, err := env.FilterMessage(m)
+	assert.NoError(t, err)
+	assert.Equal(t, PASS, result)
+	topic, err := env.Topic(m)
+	assert.NoError(t, err)
+	assert.Equal(t, "logs-sshd", topic)
+	key, err := env.PartitionKey(m)
+	assert.NoError(t, err)
+	assert.Equal(t, "host1", key)
+	number, err := env.PartitionNumber(m)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), number)
+
+	m.SetProperty("skewer", "client", "192.168.1.1")
+	result, err = env.FilterMessage(m)
+	assert.NoError(t, err)
+	assert.Equal(t, DROPPED, result)
+
+	// the expression is applied before the javascript filter
+	config.FilterFunc = `function FilterMessages(m) { m.Message = "js"; return FILTER.PASS; }`
+	env = NewFilterEnvironment(config, testLogger())
+	result, err = env.FilterMessage(m)
+	assert.NoError(t, err)
+	assert.Equal(t, DROPPED, result)
+	m.SetProperty("skewer", "client", "10.1.2.3")
+	result, err = env.FilterMessage(m)
+	assert.NoError(t, err)
+	assert.Equal(t, PASS, result)
+	assert.Equal(t, "js", m.Message)
+}
+
+func TestSameResults(t *testing.T) {
+	exprEnv := NewFilterEnvironment(conf.FilterSubConfig{FilterExpr: benchFilterExpr}, testLogger())
+	jsEnv := NewFilterEnvironment(conf.FilterSubConfig{FilterFunc: benchFilterJS, JSBudgetConfig: testBudget(conf.JSPolicyError)}, testLogger())
+	for _, client := range []string{"10.1.2.3", "192.168.1.1", ""} {
+		for _, severity := range []model.Severity{model.Serr, model.Sdebug} {
+			m := benchMessage()
+			m.Severity = severity
+			m.SetProperty("skewer", "client", client)
+			r1, err := exprEnv.FilterMessage(m)
+			assert.NoError(t, err)
+			r2, err := jsEnv.FilterMessage(m)
+			assert.NoError(t, err)
+			assert.Equal(t, r1, r2, "client: %s, severity: %d", client, severity)
+		}
+	}
+}
+
+func BenchmarkFilterExpr(b *testing.B) {
+	env := NewFilterEnvironment(conf.FilterSubConfig{FilterExpr: benchFilterExpr}, testLogger())
+	m := benchMessage()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = env.FilterMessage(m)
+	}
+}
+
+func BenchmarkFilterJS(b *testing.B) {
+	env := NewFilterEnvironment(conf.FilterSubConfig{FilterFunc: benchFilterJS, JSBudgetConfig: testBudget(conf.JSPolicyError)}, testLogger())
+	m := benchMessage()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = env.FilterMessage(m)
+	}
+}
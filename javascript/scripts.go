@@ -0,0 +1,166 @@
+package javascript
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// scripts holds the script files of the configuration, by path relative to
+// the configuration directory. The environments are created with the
+// scripts that are current at that time.
+var scripts = struct {
+	sync.Mutex
+	files      map[string]string
+	generation uint64
+}{files: map[string]string{}}
+
+// SetScripts replaces the script files. The environments that were created
+// with the previous scripts become obsolete: ScriptsGeneration tells when
+// they have to be recreated.
+func SetScripts(files map[string]string) {
+	if files == nil {
+		files = map[string]string{}
+	}
+	scripts.Lock()
+	scripts.files = files
+	scripts.generation++
+	scripts.Unlock()
+}
+
+// ScriptsGeneration returns a number that changes each time the script files
+// are replaced.
+func ScriptsGeneration() uint64 {
+	scripts.Lock()
+	defer scripts.Unlock()
+	return scripts.generation
+}
+
+func currentScripts() (map[string]string, uint64) {
+	scripts.Lock()
+	defer scripts.Unlock()
+	return scripts.files, scripts.generation
+}
+
+// Obsolete returns true when the script files have been replaced since the
+// environment was created.
+func (e *Environment) Obsolete() bool {
+	if e.runtime == nil {
+		// no javascript
+		return false
+	}
+	return e.generation != ScriptsGeneration()
+}
+
+// loadFunc runs the code of a javascript setting, and returns the JS
+// function funcname that the code defines.
+func (e *Environment) loadFunc(setting, funcname string, budget conf.JSBudgetConfig) (goja.Callable, error) {
+	code, name, err := e.resolve(setting)
+	if err != nil {
+		return nil, err
+	}
+	var v goja.Value
+	if len(name) > 0 {
+		v, err = e.runScript(name, code, funcname, budget)
+	} else {
+		_, err = e.runString(funcname, budget, code)
+		v = e.runtime.Get(funcname)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v == nil || goja.IsUndefined(v) {
+		return nil, objectNotFoundError(funcname)
+	}
+	f, ok := goja.AssertFunction(v)
+	if !ok {
+		return nil, notAFunctionError(funcname)
+	}
+	return f, nil
+}
+
+// resolve returns the code of a javascript setting, that is either inline
+// code or the path of a script file. For a script file, the name of the
+// file is also returned.
+func (e *Environment) resolve(setting string) (code string, name string, err error) {
+	setting = strings.TrimSpace(setting)
+	if !conf.IsScriptPath(setting) {
+		return setting, "", nil
+	}
+	name, err = conf.ScriptName(setting)
+	if err != nil {
+		return "", "", err
+	}
+	code, ok := e.scripts[name]
+	if !ok {
+		return "", "", eerrors.Errorf("The script file '%s' was not loaded", name)
+	}
+	return code, name, nil
+}
+
+// runScript runs a script file, in its own scope. The script provides the
+// JS function funcname.
+func (e *Environment) runScript(name, code, funcname string, budget conf.JSBudgetConfig) (goja.Value, error) {
+	wrapped := fmt.Sprintf(
+		"(function(require) {\n%s\n;return typeof %s === 'undefined' ? undefined : %s;\n})",
+		code, funcname, funcname,
+	)
+	prg, err := goja.Compile(name, wrapped, false)
+	if err != nil {
+		return nil, err
+	}
+	f, err := e.guard(funcname, budget, func() (goja.Value, error) {
+		return e.runtime.RunProgram(prg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	call, ok := goja.AssertFunction(f)
+	if !ok {
+		return nil, notAFunctionError(name)
+	}
+	return e.call(funcname, budget, call, e.runtime.ToValue(e.require(name)))
+}
+
+// require returns the CommonJS require() function for the script base.
+func (e *Environment) require(base string) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		name, err := conf.RequireName(base, call.Argument(0).String())
+		if err != nil {
+			panic(e.runtime.NewGoError(err))
+		}
+		if module, ok := e.modules[name]; ok {
+			return module.Get("exports")
+		}
+		code, ok := e.scripts[name]
+		if !ok {
+			panic(e.runtime.NewGoError(eerrors.Errorf("Cannot find module '%s'", name)))
+		}
+		wrapped := fmt.Sprintf("(function(exports, require, module) {\n%s\n})", code)
+		prg, err := goja.Compile(name, wrapped, false)
+		if err != nil {
+			panic(e.runtime.NewGoError(err))
+		}
+		f, err := e.runtime.RunProgram(prg)
+		if err != nil {
+			panic(err)
+		}
+		module := e.runtime.NewObject()
+		exports := e.runtime.NewObject()
+		_ = module.Set("exports", exports)
+		_ = module.Set("id", name)
+		// the module is cached before it runs, for circular requires
+		e.modules[name] = module
+		fn, _ := goja.AssertFunction(f)
+		_, err = fn(nil, exports, e.runtime.ToValue(e.require(name)), module)
+		if err != nil {
+			delete(e.modules, name)
+			panic(err)
+		}
+		return module.Get("exports")
+	}
+}
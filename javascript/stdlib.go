@@ -0,0 +1,325 @@
+package javascript
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// dateLayouts are the named layouts that dates.parse accepts, besides the
+// golang layouts.
+var dateLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+}
+
+const jsNewDate = `(function(ms) { return new Date(ms); })`
+
+// registerStdlib defines the helpers that the filters and the parsers can
+// use: log, ip, crypto, parse, dates and properties.
+func (e *Environment) registerStdlib() {
+	e.cidrs = map[string]*net.IPNet{}
+	v, _ := e.runtime.RunString(jsNewDate)
+	e.jsNewDate, _ = goja.AssertFunction(v)
+
+	e.runtime.Set("log", e.object(map[string]func(goja.FunctionCall) goja.Value{
+		"debug": e.jsLog(e.logger.Debug),
+		"info":  e.jsLog(e.logger.Info),
+		"warn":  e.jsLog(e.logger.Warn),
+		"error": e.jsLog(e.logger.Error),
+	}))
+	e.runtime.Set("ip", e.object(map[string]func(goja.FunctionCall) goja.Value{
+		"parse":     e.jsParseIP,
+		"version":   e.jsIPVersion,
+		"isPrivate": e.jsIsPrivate,
+		"inCIDR":    e.jsInCIDR,
+	}))
+	e.runtime.Set("crypto", e.object(map[string]func(goja.FunctionCall) goja.Value{
+		"sha256":     e.jsSHA256,
+		"hmacSHA256": e.jsHMACSHA256,
+	}))
+	e.runtime.Set("parse", e.object(map[string]func(goja.FunctionCall) goja.Value{
+		"json":   e.jsParseJSON,
+		"logfmt": e.jsParseLogfmt,
+		"kv":     e.jsParseKV,
+	}))
+	e.runtime.Set("dates", e.object(map[string]func(goja.FunctionCall) goja.Value{
+		"parse": e.jsParseDate,
+	}))
+	e.runtime.Set("properties", e.object(map[string]func(goja.FunctionCall) goja.Value{
+		"get": e.jsGetProperty,
+		"set": e.jsSetProperty,
+		"has": e.jsHasProperty,
+		"del": e.jsDelProperty,
+	}))
+}
+
+func (e *Environment) object(funcs map[string]func(goja.FunctionCall) goja.Value) *goja.Object {
+	obj := e.runtime.NewObject()
+	for name, f := range funcs {
+		_ = obj.Set(name, f)
+	}
+	return obj
+}
+
+// throw raises a JS exception from a golang error.
+func (e *Environment) throw(err error) {
+	panic(e.runtime.NewGoError(err))
+}
+
+// jsLog returns a JS function log.xxx(msg, key1, value1, ...).
+func (e *Environment) jsLog(logf func(string, ...interface{})) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		ctx := make([]interface{}, 0, len(call.Arguments))
+		if len(call.Arguments) > 1 {
+			for _, arg := range call.Arguments[1:] {
+				ctx = append(ctx, arg.Export())
+			}
+		}
+		logf(call.Argument(0).String(), ctx...)
+		return goja.Undefined()
+	}
+}
+
+func argIP(call goja.FunctionCall) net.IP {
+	return net.ParseIP(strings.TrimSpace(call.Argument(0).String()))
+}
+
+// jsParseIP returns the normalized form of an IP address, or null.
+func (e *Environment) jsParseIP(call goja.FunctionCall) goja.Value {
+	ip := argIP(call)
+	if ip == nil {
+		return goja.Null()
+	}
+	return e.runtime.ToValue(ip.String())
+}
+
+// jsIPVersion returns 4 or 6, or 0 when the argument is not an IP address.
+func (e *Environment) jsIPVersion(call goja.FunctionCall) goja.Value {
+	ip := argIP(call)
+	switch {
+	case ip == nil:
+		return e.runtime.ToValue(0)
+	case ip.To4() != nil:
+		return e.runtime.ToValue(4)
+	default:
+		return e.runtime.ToValue(6)
+	}
+}
+
+func (e *Environment) jsIsPrivate(call goja.FunctionCall) goja.Value {
+	ip := argIP(call)
+	return e.runtime.ToValue(ip != nil && (ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()))
+}
+
+// jsInCIDR tells whether an IP address belongs to a network, or to one of the
+// networks of an array.
+func (e *Environment) jsInCIDR(call goja.FunctionCall) goja.Value {
+	ip := argIP(call)
+	if ip == nil {
+		return e.runtime.ToValue(false)
+	}
+	var cidrs []string
+	switch arg := call.Argument(1).Export().(type) {
+	case string:
+		cidrs = []string{arg}
+	case []interface{}:
+		for _, c := range arg {
+			if s, ok := c.(string); ok {
+				cidrs = append(cidrs, s)
+			}
+		}
+	case []string:
+		cidrs = arg
+	}
+	for _, c := range cidrs {
+		network, err := e.cidr(c)
+		if err != nil {
+			e.throw(err)
+		}
+		if network.Contains(ip) {
+			return e.runtime.ToValue(true)
+		}
+	}
+	return e.runtime.ToValue(false)
+}
+
+// cidr parses a network, and caches the result for the next calls.
+func (e *Environment) cidr(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if network, ok := e.cidrs[s]; ok {
+		return network, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	e.cidrs[s] = network
+	return network, nil
+}
+
+func (e *Environment) jsSHA256(call goja.FunctionCall) goja.Value {
+	sum := sha256.Sum256([]byte(call.Argument(0).String()))
+	return e.runtime.ToValue(hex.EncodeToString(sum[:]))
+}
+
+// jsHMACSHA256 computes hmacSHA256(key, value), to pseudonymise a value.
+func (e *Environment) jsHMACSHA256(call goja.FunctionCall) goja.Value {
+	mac := hmac.New(sha256.New, []byte(call.Argument(0).String()))
+	_, _ = mac.Write([]byte(call.Argument(1).String()))
+	return e.runtime.ToValue(hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (e *Environment) jsParseJSON(call goja.FunctionCall) goja.Value {
+	var v interface{}
+	err := json.Unmarshal([]byte(call.Argument(0).String()), &v)
+	if err != nil {
+		e.throw(eerrors.Wrap(err, "Invalid JSON"))
+	}
+	return e.runtime.ToValue(v)
+}
+
+func (e *Environment) jsParseLogfmt(call goja.FunctionCall) goja.Value {
+	return e.parseKV(call.Argument(0).String(), "", "=")
+}
+
+// jsParseKV parses key/value pairs: parse.kv(s, pairSep, kvSep). The pairs
+// are separated by whitespace and the keys by "=" by default.
+func (e *Environment) jsParseKV(call goja.FunctionCall) goja.Value {
+	pairSep := ""
+	kvSep := "="
+	if arg := call.Argument(1); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+		pairSep = arg.String()
+	}
+	if arg := call.Argument(2); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+		kvSep = arg.String()
+	}
+	if len(kvSep) == 0 {
+		e.throw(eerrors.New("Empty key/value separator"))
+	}
+	return e.parseKV(call.Argument(0).String(), pairSep, kvSep)
+}
+
+func (e *Environment) parseKV(s, pairSep, kvSep string) goja.Value {
+	obj := e.runtime.NewObject()
+	err := utils.ParseLogfmt([]byte(strings.TrimSpace(s)), pairSep, kvSep, func(key, value string) {
+		_ = obj.Set(key, value)
+	})
+	if err != nil {
+		e.throw(err)
+	}
+	return obj
+}
+
+// jsParseDate parses strictly a date: dates.parse(s, layout, location). The
+// layout is a golang layout or the name of a golang layout constant, like
+// "RFC3339". The location is used when the layout has no timezone (default:
+// UTC).
+func (e *Environment) jsParseDate(call goja.FunctionCall) goja.Value {
+	layout := call.Argument(1).String()
+	if named, ok := dateLayouts[layout]; ok {
+		layout = named
+	}
+	loc := time.UTC
+	if arg := call.Argument(2); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+		var err error
+		loc, err = time.LoadLocation(arg.String())
+		if err != nil {
+			e.throw(err)
+		}
+	}
+	t, err := time.ParseInLocation(layout, strings.TrimSpace(call.Argument(0).String()), loc)
+	if err != nil {
+		e.throw(err)
+	}
+	d, err := e.jsNewDate(nil, e.runtime.ToValue(t.UnixNano()/int64(time.Millisecond)))
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// properties returns the properties of a JS message. The properties are
+// converted to a golang map if needed, so that the helpers modify them in
+// place.
+func (e *Environment) properties(call goja.FunctionCall) map[string]map[string]string {
+	msg := call.Argument(0).ToObject(e.runtime)
+	v := msg.Get("Properties")
+	if v != nil {
+		if props, ok := v.Export().(map[string]map[string]string); ok && props != nil {
+			return props
+		}
+	}
+	props := make(map[string]map[string]string)
+	if v != nil && !goja.IsUndefined(v) && !goja.IsNull(v) {
+		err := e.runtime.ExportTo(v, &props)
+		if err != nil {
+			e.throw(eerrors.Wrap(err, "Invalid message properties"))
+		}
+		if props == nil {
+			props = make(map[string]map[string]string)
+		}
+	}
+	_ = msg.Set("Properties", props)
+	return props
+}
+
+// jsGetProperty returns properties.get(m, domain, key), or undefined.
+func (e *Environment) jsGetProperty(call goja.FunctionCall) goja.Value {
+	props := e.properties(call)
+	value, ok := props[call.Argument(1).String()][call.Argument(2).String()]
+	if !ok {
+		return goja.Undefined()
+	}
+	return e.runtime.ToValue(value)
+}
+
+func (e *Environment) jsSetProperty(call goja.FunctionCall) goja.Value {
+	props := e.properties(call)
+	domain := call.Argument(1).String()
+	if props[domain] == nil {
+		props[domain] = make(map[string]string)
+	}
+	props[domain][call.Argument(2).String()] = call.Argument(3).String()
+	return goja.Undefined()
+}
+
+func (e *Environment) jsHasProperty(call goja.FunctionCall) goja.Value {
+	props := e.properties(call)
+	_, ok := props[call.Argument(1).String()][call.Argument(2).String()]
+	return e.runtime.ToValue(ok)
+}
+
+// jsDelProperty removes a property: properties.del(m, domain, key). Without
+// a key, the whole domain is removed.
+func (e *Environment) jsDelProperty(call goja.FunctionCall) goja.Value {
+	props := e.properties(call)
+	domain := call.Argument(1).String()
+	if key := call.Argument(2); goja.IsUndefined(key) {
+		delete(props, domain)
+	} else {
+		delete(props[domain], key.String())
+	}
+	return goja.Undefined()
+}
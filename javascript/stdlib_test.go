@@ -0,0 +1,89 @@
+package javascript
+
+import (
+	"testing"
+
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStdlib(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected interface{}
+	}{
+		{"ip parse", `ip.parse(" 10.0.0.1 ")`, "10.0.0.1"},
+		{"ip parse invalid", `ip.parse("nope")`, nil},
+		{"ip version", `ip.version("::1") * 10 + ip.version("1.2.3.4")`, int64(64)},
+		{"ip private", `ip.isPrivate("192.168.1.1") && !ip.isPrivate("8.8.8.8")`, true},
+		{"cidr string", `ip.inCIDR("10.1.2.3", "10.0.0.0/8")`, true},
+		{"cidr array", `ip.inCIDR("172.16.0.1", ["10.0.0.0/8", "172.16.0.0/12"])`, true},
+		{"cidr miss", `ip.inCIDR("8.8.8.8", ["10.0.0.0/8"])`, false},
+		{"sha256", `crypto.sha256("abc")`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"hmac", `crypto.hmacSHA256("key", "The quick brown fox jumps over the lazy dog")`, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{"json", `parse.json('{"a": {"b": [1, 2]}}').a.b[1]`, int64(2)},
+		{"logfmt", `var o = parse.logfmt('level=info msg="hello world" admin'); o.msg + "|" + o.admin`, "hello world|true"},
+		{"kv", `var o = parse.kv("a:1;b:2", ";", ":"); o.a + o.b`, "12"},
+		{"date", `dates.parse("2018-02-14T19:04:54Z", "RFC3339").getTime()`, int64(1518635094000)},
+		{"date location", `dates.parse("2018-02-14 20:04:54", "2006-01-02 15:04:05", "Europe/Paris").getTime()`, int64(1518635094000)},
+		{"log", `log.info("hello", "key", 1); true`, true},
+	}
+	env := NewParsersEnvironment(testLogger())
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := env.runString(test.name, testBudget(conf.JSPolicyError), test.code)
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.expected, v.Export())
+			}
+		})
+	}
+}
+
+func TestStdlibErrors(t *testing.T) {
+	env := NewParsersEnvironment(testLogger())
+	for _, code := range []string{
+		`parse.json("{")`,
+		`dates.parse("2018-02-14", "RFC3339")`,
+		`ip.inCIDR("10.0.0.1", "10.0.0.0/33")`,
+	} {
+		_, err := env.runString("error", testBudget(conf.JSPolicyError), code)
+		assert.Error(t, err, code)
+	}
+	// the exceptions can be caught by the JS code
+	v, err := env.runString("catch", testBudget(conf.JSPolicyError), `(function() { try { parse.json("{"); return false; } catch (e) { return true; } })()`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, true, v.Export())
+	}
+}
+
+func TestProperties(t *testing.T) {
+	filter := `function FilterMessages(m) {
+	if (properties.has(m, "app", "drop")) {
+		return FILTER.DROPPED;
+	}
+	properties.set(m, "enrich", "user", properties.get(m, "app", "user").toUpperCase());
+	properties.del(m, "app", "user");
+	properties.del(m, "tmp");
+	return FILTER.PASS;
+}`
+	env := NewFilterEnvironment(conf.FilterSubConfig{FilterFunc: filter, JSBudgetConfig: testBudget(conf.JSPolicyError)}, testLogger())
+	m := model.Factory()
+	m.SetProperty("app", "user", "bob")
+	m.SetProperty("app", "other", "x")
+	m.SetProperty("tmp", "a", "b")
+	result, err := env.FilterMessage(m)
+	assert.NoError(t, err)
+	assert.Equal(t, PASS, result)
+	assert.Equal(t, "BOB", m.GetProperty("enrich", "user"))
+	assert.Equal(t, "", m.GetProperty("app", "user"))
+	assert.Equal(t, "x", m.GetProperty("app", "other"))
+	assert.Equal(t, "", m.GetProperty("tmp", "a"))
+
+	m = model.Factory()
+	m.SetProperty("app", "drop", "true")
+	result, err = env.FilterMessage(m)
+	assert.NoError(t, err)
+	assert.Equal(t, DROPPED, result)
+}
@@ -3,12 +3,17 @@ package javascript
 import (
 	"bytes"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 	"unicode/utf8"
 
 	"github.com/dop251/goja"
 	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/expr"
 	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/utils/eerrors"
 )
@@ -38,6 +43,17 @@ function NewEmptySyslogMessage() {
 	return new SyslogMessage(0, 0, 0, 1, n, n, "", "", "", "", "", "", {});
 }
 
+function CopySyslogMessage(m) {
+	var props = {};
+	for (var domain in m.Properties) {
+		props[domain] = {};
+		for (var key in m.Properties[domain]) {
+			props[domain][key] = m.Properties[domain][key];
+		}
+	}
+	return new SyslogMessage(m.Priority, m.Facility, m.Severity, m.Version, m.TimeReported.getTime(), m.TimeGenerated.getTime(), m.Hostname, m.Appname, m.Procid, m.Msgid, m.Structured, m.Message, props);
+}
+
 function SyslogMessageToGo(m) {
 	return new SyslogMessage(m.Priority, m.Facility, m.Severity, m.Version, m.TimeReported.getTime(), m.TimeGenerated.getTime(), m.Hostname, m.Appname, m.Procid, m.Msgid, m.Structured, m.Message, m.Properties);
 }
@@ -78,22 +94,85 @@ type iSyslogMessage struct {
 
 type ParsersEnvironment interface {
 	GetParser(name string) (func(m []byte) ([]*model.SyslogMessage, error), error)
-	AddParser(name string, parserFunc string) error
+	AddParser(name string, parserFunc string, budget conf.JSBudgetConfig) error
 }
 
 func NewParsersEnvironment(logger log15.Logger) *Environment {
-	return newEnv("", "", "", "", "", "", logger)
+	e := newEnv(conf.JSBudgetConfig{}, logger)
+	e.initRuntime()
+	return e
 }
 
 type FilterEnvironment interface {
-	FilterMessage(m *model.SyslogMessage) (result *model.SyslogMessage, filterResult FilterResult, err error)
-	PartitionKey(m model.SyslogMessage) (partitionKey string, errs []error)
-	PartitionNumber(m model.SyslogMessage) (partitionNumber int32, errs []error)
-	Topic(m *model.SyslogMessage) (topic string, errs []error)
+	FilterMessage(m *model.SyslogMessage) (filterResult FilterResult, err error)
+	FilterMessageMulti(m *model.SyslogMessage) (extras []*model.SyslogMessage, filterResult FilterResult, err error)
+	PartitionKey(m *model.SyslogMessage) (partitionKey string, err error)
+	PartitionNumber(m *model.SyslogMessage) (partitionNumber int32, err error)
+	Topic(m *model.SyslogMessage) (topic string, err error)
+	Obsolete() bool
 }
 
-func NewFilterEnvironment(filterFunc, topicFunc, topicTmpl, partitionKeyFunc, partitionKeyTmpl, partitionNumberFunc string, logger log15.Logger) *Environment {
-	return newEnv(filterFunc, topicFunc, topicTmpl, partitionKeyFunc, partitionKeyTmpl, partitionNumberFunc, logger)
+// NewFilterEnvironment returns the environment that filters the messages
+// and computes their topic and partition, as described by config. The
+// javascript virtual machine is only created when config uses javascript
+// functions: the native expressions are evaluated in Go.
+func NewFilterEnvironment(config conf.FilterSubConfig, logger log15.Logger) *Environment {
+	e := newEnv(config.JSBudgetConfig, logger)
+
+	if len(config.TopicTmpl) > 0 {
+		t, err := template.New("topic").Parse(config.TopicTmpl)
+		if err == nil {
+			e.topicTmpl = t
+		}
+	}
+	if len(config.PartitionTmpl) > 0 {
+		t, err := template.New("pkey").Parse(config.PartitionTmpl)
+		if err == nil {
+			e.partitionKeyTmpl = t
+		}
+	}
+
+	e.filterExpr = e.compileExpr("filter_expr", config.FilterExpr)
+	e.topicExpr = e.compileExpr("topic_expr", config.TopicExpr)
+	e.partitionKeyExpr = e.compileExpr("partition_key_expr", config.PartitionKeyExpr)
+	e.partitionNumberExpr = e.compileExpr("partition_number_expr", config.PartitionNumberExpr)
+
+	if !config.HasJS() {
+		return e
+	}
+	e.initRuntime()
+
+	topicFunc := strings.TrimSpace(config.TopicFunc)
+	partitionKeyFunc := strings.TrimSpace(config.PartitionFunc)
+	filterFunc := strings.TrimSpace(config.FilterFunc)
+	partitionNumberFunc := strings.TrimSpace(config.PartitionNumberFunc)
+
+	if len(topicFunc) > 0 {
+		err := e.setTopicFunc(topicFunc)
+		if err != nil {
+			e.logger.Warn("Error setting the JS Topic() func", "error", err)
+		}
+	}
+	if len(partitionKeyFunc) > 0 {
+		err := e.setPartitionKeyFunc(partitionKeyFunc)
+		if err != nil {
+			e.logger.Warn("Error setting the JS PartitionKey() func", "error", err)
+		}
+	}
+	if len(filterFunc) > 0 {
+		err := e.setFilterMessagesFunc(filterFunc)
+		if err != nil {
+			e.logger.Warn("Error setting the JS Filter() func", "error", err)
+		}
+	}
+	if len(partitionNumberFunc) > 0 {
+		err := e.setPartitionNumberFunc(partitionNumberFunc)
+		if err != nil {
+			e.logger.Warn("Error setting the JS PartitionNumber() func", "error", err)
+		}
+	}
+
+	return e
 }
 
 type Environment struct {
@@ -106,8 +185,19 @@ type Environment struct {
 	jsPartitionKey      goja.Callable
 	jsPartitionNumber   goja.Callable
 	jsParsers           map[string]goja.Callable
+	jsNewDate           goja.Callable
+	parserBudgets       map[string]conf.JSBudgetConfig
+	budget              conf.JSBudgetConfig
+	scripts             map[string]string
+	modules             map[string]*goja.Object
+	generation          uint64
+	cidrs               map[string]*net.IPNet
 	topicTmpl           *template.Template
 	partitionKeyTmpl    *template.Template
+	filterExpr          *expr.Program
+	topicExpr           *expr.Program
+	partitionKeyExpr    *expr.Program
+	partitionNumberExpr *expr.Program
 }
 
 type ConcreteParser struct {
@@ -129,7 +219,24 @@ func (p *ConcreteParser) Parse(rawMessage []byte) ([]*model.SyslogMessage, error
 		return nil, nil
 	}
 	jsRawMessage := p.env.runtime.ToValue(string(rawMessage))
-	jsParsedMessage, err := jsParser(nil, jsRawMessage)
+	budget := p.env.parserBudgets[p.name]
+	jsParsedMessage, err := p.env.call(p.name, budget, jsParser, jsRawMessage)
+	if IsBudgetExceeded(err) {
+		p.env.logger.Warn("JS parser exceeded its budget", "parser", p.name, "error", err, "policy", budget.JSTimeoutPolicy)
+		switch budget.JSTimeoutPolicy {
+		case conf.JSPolicyDrop:
+			return nil, nil
+		case conf.JSPolicyPass:
+			// the raw message is passed as is
+			m := model.Factory()
+			m.TimeReportedNum = time.Now().UnixNano()
+			m.TimeGeneratedNum = m.TimeReportedNum
+			m.Message = string(rawMessage)
+			return []*model.SyslogMessage{m}, nil
+		default:
+			return nil, DecodingError(err)
+		}
+	}
 	if err != nil {
 		if jserr, ok := err.(*goja.Exception); ok {
 			message, ok := jserr.Value().Export().(string)
@@ -147,64 +254,40 @@ func (p *ConcreteParser) Parse(rawMessage []byte) ([]*model.SyslogMessage, error
 	return []*model.SyslogMessage{parsedMessage}, nil
 }
 
-func newEnv(filterFunc, topicFunc, topicTmpl, partitionKeyFunc, partitionKeyTmpl, partitionNumberFunc string, logger log15.Logger) *Environment {
-
+func newEnv(budget conf.JSBudgetConfig, logger log15.Logger) *Environment {
 	e := Environment{}
 	e.logger = logger.New("class", "Environment")
-
-	if len(topicTmpl) > 0 {
-		t, err := template.New("topic").Parse(topicTmpl)
-		if err == nil {
-			e.topicTmpl = t
-		}
-	}
-	if len(partitionKeyTmpl) > 0 {
-		t, err := template.New("pkey").Parse(partitionKeyTmpl)
-		if err == nil {
-			e.partitionKeyTmpl = t
-		}
-	}
-
+	e.budget = budget
 	e.jsParsers = map[string]goja.Callable{}
+	e.parserBudgets = map[string]conf.JSBudgetConfig{}
+	return &e
+}
+
+// initRuntime creates the javascript virtual machine.
+func (e *Environment) initRuntime() {
+	e.scripts, e.generation = currentScripts()
+	e.modules = map[string]*goja.Object{}
 
 	e.runtime = goja.New()
 	_, _ = e.runtime.RunString(jsSyslogMessage)
+	e.runtime.Set("require", e.require(""))
+	e.registerStdlib()
 	v := e.runtime.Get("NewSyslogMessage")
 	e.jsNewSyslogMessage, _ = goja.AssertFunction(v)
 	v = e.runtime.Get("SyslogMessageToGo")
 	e.jsSyslogMessageToGo, _ = goja.AssertFunction(v)
+}
 
-	topicFunc = strings.TrimSpace(topicFunc)
-	partitionKeyFunc = strings.TrimSpace(partitionKeyFunc)
-	filterFunc = strings.TrimSpace(filterFunc)
-	partitionNumberFunc = strings.TrimSpace(partitionNumberFunc)
-
-	if len(topicFunc) > 0 {
-		err := e.setTopicFunc(topicFunc)
-		if err != nil {
-			e.logger.Warn("Error setting the JS Topic() func", "error", err)
-		}
-	}
-	if len(partitionKeyFunc) > 0 {
-		err := e.setPartitionKeyFunc(partitionKeyFunc)
-		if err != nil {
-			e.logger.Warn("Error setting the JS PartitionKey() func", "error", err)
-		}
-	}
-	if len(filterFunc) > 0 {
-		err := e.setFilterMessagesFunc(filterFunc)
-		if err != nil {
-			e.logger.Warn("Error setting the JS Filter() func", "error", err)
-		}
+func (e *Environment) compileExpr(name, source string) *expr.Program {
+	if len(strings.TrimSpace(source)) == 0 {
+		return nil
 	}
-	if len(partitionNumberFunc) > 0 {
-		err := e.setPartitionNumberFunc(partitionNumberFunc)
-		if err != nil {
-			e.logger.Warn("Error setting the JS PartitionNumber() func", "error", err)
-		}
+	p, err := expr.Compile(source)
+	if err != nil {
+		e.logger.Warn("Error compiling expression", "name", name, "error", err)
+		return nil
 	}
-
-	return &e
+	return p
 }
 
 func (e *Environment) GetParser(name string) (func(m []byte) ([]*model.SyslogMessage, error), error) {
@@ -216,7 +299,7 @@ func (e *Environment) GetParser(name string) (func(m []byte) ([]*model.SyslogMes
 	return c.Parse, nil
 }
 
-func (e *Environment) AddParser(name string, parserFunc string) error {
+func (e *Environment) AddParser(name string, parserFunc string, budget conf.JSBudgetConfig) error {
 	name = strings.TrimSpace(name)
 	parserFunc = strings.TrimSpace(parserFunc)
 	if len(name) == 0 {
@@ -225,99 +308,63 @@ func (e *Environment) AddParser(name string, parserFunc string) error {
 	if len(parserFunc) == 0 {
 		return fmt.Errorf("Empty parser function")
 	}
-	_, err := e.runtime.RunString(parserFunc)
+	parser, err := e.loadFunc(parserFunc, name, budget)
 	if err != nil {
 		return err
 	}
-	v := e.runtime.Get(name)
-	if v == nil {
-		return objectNotFoundError(name)
-	}
-	parser, b := goja.AssertFunction(v)
-	if !b {
-		return notAFunctionError(name)
-	}
 	e.jsParsers[name] = parser
+	e.parserBudgets[name] = budget
 	return nil
 }
 
 func (e *Environment) setTopicFunc(f string) error {
-	_, err := e.runtime.RunString(f)
+	jsTopic, err := e.loadFunc(f, "Topic", e.budget)
 	if err != nil {
 		return err
 	}
-	v := e.runtime.Get("Topic")
-	if v == nil {
-		return objectNotFoundError("Topic")
-	}
-	jsTopic, b := goja.AssertFunction(v)
-	if !b {
-		return notAFunctionError("Topic")
-	}
 	e.jsTopic = jsTopic
 	return nil
 }
 
 func (e *Environment) setPartitionKeyFunc(f string) error {
-	_, err := e.runtime.RunString(f)
+	jsPartitionKey, err := e.loadFunc(f, "PartitionKey", e.budget)
 	if err != nil {
 		return err
 	}
-	v := e.runtime.Get("PartitionKey")
-	if v == nil {
-		return objectNotFoundError("PartitionKey")
-	}
-	jsPartitionKey, b := goja.AssertFunction(v)
-	if !b {
-		return notAFunctionError("PartitionKey")
-	}
 	e.jsPartitionKey = jsPartitionKey
 	return nil
 }
 
 func (e *Environment) setPartitionNumberFunc(f string) error {
-	_, err := e.runtime.RunString(f)
+	jsPartitionNumber, err := e.loadFunc(f, "PartitionNumber", e.budget)
 	if err != nil {
 		return err
 	}
-	v := e.runtime.Get("PartitionNumber")
-	if v == nil {
-		return objectNotFoundError("PartitionNumber")
-	}
-	jsPartitionNumber, b := goja.AssertFunction(v)
-	if !b {
-		return notAFunctionError("PartitionNumber")
-	}
 	e.jsPartitionNumber = jsPartitionNumber
 	return nil
 }
 
 func (e *Environment) setFilterMessagesFunc(f string) error {
-	_, err := e.runtime.RunString(f)
+	jsFilterMessages, err := e.loadFunc(f, "FilterMessages", e.budget)
 	if err != nil {
 		return err
 	}
-	v := e.runtime.Get("FilterMessages")
-	if v == nil {
-		return objectNotFoundError("FilterMessages")
-	}
-	jsFilter, b := goja.AssertFunction(v)
-	if !b {
-		return notAFunctionError("FilterMessages")
-	}
-	e.jsFilterMessages = jsFilter
+	e.jsFilterMessages = jsFilterMessages
 	return nil
 }
 
 func (e *Environment) Topic(m *model.SyslogMessage) (topic string, err error) {
 	errs := make([]error, 0)
 
-	if e.jsTopic != nil {
+	if e.topicExpr != nil {
+		topic = e.topicExpr.String(m)
+	}
+	if len(topic) == 0 && e.jsTopic != nil {
 		var jsMessage goja.Value
 		var jsTopic goja.Value
 		jsMessage, err = e.toJsMessage(m)
 		if err == nil {
-			jsTopic, err = e.jsTopic(nil, jsMessage)
+			jsTopic, err = e.call("Topic", e.budget, e.jsTopic, jsMessage)
 			if err == nil {
 				topic = jsTopic.String()
 			} else {
@@ -350,10 +397,13 @@ func (e *Environment) PartitionKey(m *model.SyslogMessage) (partitionKey string,
 	var jsMessage goja.Value
 	var jsPartitionKey goja.Value
 
-	if e.jsPartitionKey != nil {
+	if e.partitionKeyExpr != nil {
+		partitionKey = e.partitionKeyExpr.String(m)
+	}
+	if len(partitionKey) == 0 && e.jsPartitionKey != nil {
 		jsMessage, err = e.toJsMessage(m)
 		if err == nil {
-			jsPartitionKey, err = e.jsPartitionKey(nil, jsMessage)
+			jsPartitionKey, err = e.call("PartitionKey", e.budget, e.jsPartitionKey, jsMessage)
 			if err == nil {
 				partitionKey = jsPartitionKey.String()
 			} else {
@@ -380,10 +430,13 @@ func (e *Environment) PartitionNumber(m *model.SyslogMessage) (partitionNumber i
 	var jsMessage goja.Value
 	var jsPartitionNumber goja.Value
 
+	if e.partitionNumberExpr != nil {
+		return int32(e.partitionNumberExpr.Number(m)), nil
+	}
 	if e.jsPartitionNumber != nil {
 		jsMessage, err = e.toJsMessage(m)
 		if err == nil {
-			jsPartitionNumber, err = e.jsPartitionNumber(nil, jsMessage)
+			jsPartitionNumber, err = e.call("PartitionNumber", e.budget, e.jsPartitionNumber, jsMessage)
 			if err == nil {
 				partitionNumber = int32(jsPartitionNumber.ToInteger())
 			} else {
@@ -396,51 +449,129 @@ func (e *Environment) PartitionNumber(m *model.SyslogMessage) (partitionNumber i
 	return partitionNumber, eerrors.Combine(errs...)
 }
 
+// FilterMessage runs the filter on m. When the filter returns several
+// messages, only the first one is kept: the extra messages are freed, with a
+// warning. It is used where the messages can not be stashed, like the direct
+// RELP sources.
 func (e *Environment) FilterMessage(m *model.SyslogMessage) (filterResult FilterResult, err error) {
+	extras, filterResult, err := e.FilterMessageMulti(m)
+	if len(extras) > 0 {
+		e.logger.Warn("The JS filter returned several messages, only the first one is kept", "nb", len(extras)+1)
+		for _, extra := range extras {
+			model.Free(extra)
+		}
+	}
+	return filterResult, err
+}
+
+// FilterMessageMulti runs the filter on m. The messages that do not match
+// the filter expression are dropped first. The filter function returns a
+// FILTER code, or an array of messages. With an array, the first message
+// replaces m and the next ones are returned as extras, with a PASS result. An
+// empty array drops m.
+func (e *Environment) FilterMessageMulti(m *model.SyslogMessage) (extras []*model.SyslogMessage, filterResult FilterResult, err error) {
 	var jsMessage goja.Value
 	var resJsMessage goja.Value
 	var result *model.SyslogMessage
 
-	if e.jsFilterMessages == nil {
-		return PASS, nil
-	}
 	if m == nil {
-		return DROPPED, nil
+		return nil, DROPPED, nil
+	}
+	if e.filterExpr != nil && !e.filterExpr.Bool(m) {
+		return nil, DROPPED, nil
+	}
+	if e.jsFilterMessages == nil {
+		return nil, PASS, nil
 	}
 	jsMessage, err = e.toJsMessage(m)
 	if err != nil {
-		return FILTER_ERROR, go2jsError(executingJSErrorFactory(err, "NewSyslogMessage"))
+		return nil, FILTER_ERROR, go2jsError(executingJSErrorFactory(err, "NewSyslogMessage"))
+	}
+	resJsMessage, err = e.call("FilterMessages", e.budget, e.jsFilterMessages, jsMessage)
+	if IsBudgetExceeded(err) {
+		e.logger.Warn("JS filter exceeded its budget", "error", err, "policy", e.budget.JSTimeoutPolicy)
+		switch e.budget.JSTimeoutPolicy {
+		case conf.JSPolicyDrop:
+			return nil, DROPPED, nil
+		case conf.JSPolicyPass:
+			// the changes made by the filter to jsMessage are discarded
+			return nil, PASS, nil
+		default:
+			return nil, FILTER_ERROR, err
+		}
 	}
-	resJsMessage, err = e.jsFilterMessages(nil, jsMessage)
 	if err != nil {
-		return FILTER_ERROR, executingJSErrorFactory(err, "FilterMessages")
+		return nil, FILTER_ERROR, executingJSErrorFactory(err, "FilterMessages")
+	}
+
+	if messages, ok := jsArray(resJsMessage); ok {
+		return e.fromJsMessages(m, messages)
 	}
 
 	filterResult = FilterResult(resJsMessage.ToInteger())
 	switch filterResult {
 	case DROPPED:
-		return DROPPED, nil
+		return nil, DROPPED, nil
 	case REJECTED:
-		return REJECTED, nil
+		return nil, REJECTED, nil
 	case FILTER_ERROR:
-		return FILTER_ERROR, nil
+		return nil, FILTER_ERROR, nil
 	case PASS:
 		result, err = e.fromJsMessage(jsMessage)
 		if err != nil {
-			return FILTER_ERROR, js2goError(err)
+			return nil, FILTER_ERROR, js2goError(err)
 		}
 		if result != nil {
 			*m = *result
 			model.Free(result)
 		}
-		return PASS, nil
+		return nil, PASS, nil
 
 	default:
-		return FILTER_ERROR, jsvmError(eerrors.Errorf("JS filter function returned an invalid result: %d", int64(filterResult)))
+		return nil, FILTER_ERROR, jsvmError(eerrors.Errorf("JS filter function returned an invalid result: %d", int64(filterResult)))
 	}
 
 }
 
+// jsArray returns the elements of v when v is a JS array.
+func jsArray(v goja.Value) ([]goja.Value, bool) {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return nil, false
+	}
+	if _, ok := obj.Export().([]interface{}); !ok {
+		return nil, false
+	}
+	length := int(obj.Get("length").ToInteger())
+	values := make([]goja.Value, 0, length)
+	for i := 0; i < length; i++ {
+		values = append(values, obj.Get(strconv.Itoa(i)))
+	}
+	return values, true
+}
+
+// fromJsMessages converts the messages returned by a filter: the first one
+// replaces m, the next ones are returned as extras.
+func (e *Environment) fromJsMessages(m *model.SyslogMessage, messages []goja.Value) (extras []*model.SyslogMessage, filterResult FilterResult, err error) {
+	if len(messages) == 0 {
+		return nil, DROPPED, nil
+	}
+	results := make([]*model.SyslogMessage, 0, len(messages))
+	for _, jsMessage := range messages {
+		result, err := e.fromJsMessage(jsMessage)
+		if err != nil {
+			for _, r := range results {
+				model.Free(r)
+			}
+			return nil, FILTER_ERROR, js2goError(err)
+		}
+		results = append(results, result)
+	}
+	*m = *results[0]
+	model.Free(results[0])
+	return results[1:], PASS, nil
+}
+
 func (e *Environment) toJsMessage(m *model.SyslogMessage) (sm goja.Value, err error) {
 	p := e.runtime.ToValue(int(m.Priority))
 	f := e.runtime.ToValue(int(m.Facility))
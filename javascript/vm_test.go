@@ -0,0 +1,223 @@
+package javascript
+
+import (
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testLogger() log15.Logger {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	return logger
+}
+
+func testBudget(policy string) conf.JSBudgetConfig {
+	return conf.JSBudgetConfig{
+		JSTimeout:       100 * time.Millisecond,
+		JSMaxStack:      100,
+		JSTimeoutPolicy: policy,
+	}
+}
+
+func TestFilterBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		policy string
+		result FilterResult
+	}{
+		{"loop drop", `function FilterMessages(m) { m.Message = "changed"; while (true) {} }`, conf.JSPolicyDrop, DROPPED},
+		{"loop pass", `function FilterMessages(m) { m.Message = "changed"; while (true) {} }`, conf.JSPolicyPass, PASS},
+		{"loop error", `function FilterMessages(m) { m.Message = "changed"; while (true) {} }`, conf.JSPolicyError, FILTER_ERROR},
+		{"recursion drop", `function f(n) { return f(n+1); } function FilterMessages(m) { return f(0); }`, conf.JSPolicyDrop, DROPPED},
+		{"recursion error", `function f(n) { return f(n+1); } function FilterMessages(m) { return f(0); }`, conf.JSPolicyError, FILTER_ERROR},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := NewFilterEnvironment(conf.FilterSubConfig{FilterFunc: test.filter, JSBudgetConfig: testBudget(test.policy)}, testLogger())
+			m := model.Factory()
+			m.Message = "original"
+			start := time.Now()
+			result, err := env.FilterMessage(m)
+			if test.policy == conf.JSPolicyError {
+				assert.True(t, IsBudgetExceeded(err))
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.result, result)
+			assert.Equal(t, "original", m.Message)
+			assert.True(t, time.Since(start) < 5*time.Second)
+
+			// the environment is still usable after the interruption
+			v, err := env.runString("check", testBudget(test.policy), "1 + 1")
+			if assert.NoError(t, err) {
+				assert.Equal(t, int64(2), v.ToInteger())
+			}
+		})
+	}
+}
+
+func TestTopicTimeout(t *testing.T) {
+	config := conf.FilterSubConfig{
+		TopicFunc:      `function Topic(m) { while (true) {} }`,
+		TopicTmpl:      "topic-{{.AppName}}",
+		JSBudgetConfig: testBudget(conf.JSPolicyError),
+	}
+	env := NewFilterEnvironment(config, testLogger())
+	m := model.Factory()
+	m.AppName = "app"
+	topic, err := env.Topic(m)
+	assert.True(t, IsBudgetExceeded(err))
+	// the template is used instead
+	assert.Equal(t, "topic-app", topic)
+}
+
+func TestParserBudget(t *testing.T) {
+	parser := `function loop(raw) { while (true) {} }`
+	tests := []struct {
+		policy   string
+		messages int
+		err      bool
+	}{
+		{conf.JSPolicyDrop, 0, false},
+		{conf.JSPolicyPass, 1, false},
+		{conf.JSPolicyError, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			env := NewParsersEnvironment(testLogger())
+			if !assert.NoError(t, env.AddParser("loop", parser, testBudget(test.policy))) {
+				return
+			}
+			parse, err := env.GetParser("loop")
+			if !assert.NoError(t, err) {
+				return
+			}
+			msgs, err := parse([]byte("raw message"))
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if assert.Len(t, msgs, test.messages) && test.messages > 0 {
+				assert.Equal(t, "raw message", msgs[0].Message)
+			}
+		})
+	}
+}
+
+func TestLoadTimeout(t *testing.T) {
+	env := NewParsersEnvironment(testLogger())
+	err := env.AddParser("loop", `while (true) {}`, testBudget(conf.JSPolicyError))
+	assert.True(t, IsBudgetExceeded(err))
+}
+
+func TestScriptFiles(t *testing.T) {
+	SetScripts(map[string]string{
+		"filters/drop.js": `
+var helpers = require("./lib/helpers");
+function FilterMessages(m) {
+	if (helpers.isDebug(m)) {
+		return FILTER.DROPPED;
+	}
+	m.Message = helpers.prefix + m.Message;
+	return FILTER.PASS;
+}`,
+		"filters/lib/helpers.js": `
+var severities = require("lib/severities");
+exports.isDebug = function(m) { return m.Severity === severities.DEBUG; };
+exports.prefix = "filtered: ";`,
+		"lib/severities.js": `module.exports = { DEBUG: 7 };`,
+	})
+	defer SetScripts(nil)
+
+	env := NewFilterEnvironment(conf.FilterSubConfig{FilterFunc: "filters/drop.js", JSBudgetConfig: testBudget(conf.JSPolicyError)}, testLogger())
+	m := model.Factory()
+	m.Message = "hello"
+	result, err := env.FilterMessage(m)
+	assert.NoError(t, err)
+	assert.Equal(t, PASS, result)
+	assert.Equal(t, "filtered: hello", m.Message)
+
+	m.Severity = 7
+	result, err = env.FilterMessage(m)
+	assert.NoError(t, err)
+	assert.Equal(t, DROPPED, result)
+
+	assert.False(t, env.Obsolete())
+	SetScripts(map[string]string{})
+	assert.True(t, env.Obsolete())
+}
+
+func TestScriptMissingModule(t *testing.T) {
+	SetScripts(map[string]string{
+		"parser.js": `var x = require("./missing"); function P(raw) { return NewEmptySyslogMessage(); }`,
+	})
+	defer SetScripts(nil)
+
+	env := NewParsersEnvironment(testLogger())
+	assert.Error(t, env.AddParser("P", "parser.js", testBudget(conf.JSPolicyError)))
+}
+
+func TestFilterMessageMulti(t *testing.T) {
+	filter := `function FilterMessages(m) {
+	if (m.Message === "drop") {
+		return [];
+	}
+	if (m.Message === "same") {
+		return FILTER.PASS;
+	}
+	var parts = m.Message.split(";");
+	var msgs = [];
+	for (var i = 0; i < parts.length; i++) {
+		var n = CopySyslogMessage(m);
+		n.Message = parts[i];
+		properties.set(n, "split", "index", String(i));
+		msgs.push(n);
+	}
+	return msgs;
+}`
+	env := NewFilterEnvironment(conf.FilterSubConfig{FilterFunc: filter, JSBudgetConfig: testBudget(conf.JSPolicyError)}, testLogger())
+
+	m := model.Factory()
+	m.Message = "a;b;c"
+	m.AppName = "app"
+	m.SetProperty("orig", "key", "value")
+	extras, result, err := env.FilterMessageMulti(m)
+	assert.NoError(t, err)
+	assert.Equal(t, PASS, result)
+	assert.Equal(t, "a", m.Message)
+	assert.Equal(t, "0", m.GetProperty("split", "index"))
+	if assert.Len(t, extras, 2) {
+		for i, extra := range extras {
+			assert.Equal(t, []string{"b", "c"}[i], extra.Message)
+			assert.Equal(t, "app", extra.AppName)
+			assert.Equal(t, "value", extra.GetProperty("orig", "key"))
+			assert.Equal(t, []string{"1", "2"}[i], extra.GetProperty("split", "index"))
+		}
+	}
+
+	m.Message = "drop"
+	extras, result, err = env.FilterMessageMulti(m)
+	assert.NoError(t, err)
+	assert.Equal(t, DROPPED, result)
+	assert.Empty(t, extras)
+
+	m.Message = "same"
+	extras, result, err = env.FilterMessageMulti(m)
+	assert.NoError(t, err)
+	assert.Equal(t, PASS, result)
+	assert.Empty(t, extras)
+
+	// FilterMessage only keeps the first message
+	m.Message = "x;y"
+	result, err = env.FilterMessage(m)
+	assert.NoError(t, err)
+	assert.Equal(t, PASS, result)
+	assert.Equal(t, "x", m.Message)
+}
@@ -0,0 +1,272 @@
+// Package logmetrics derives Prometheus counters and histograms from the
+// messages.
+package logmetrics
+
+import (
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/expr"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// DroppedCounter counts the observations that were not recorded because a
+// metric reached its cardinality limit. It has to be registered by the
+// processes that derive metrics.
+var DroppedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_log_metrics_dropped_total",
+		Help: "total number of log metrics observations dropped by the cardinality limits",
+	},
+	[]string{"metric"},
+)
+
+// metric is a registered metric. It is shared by the destinations, that set
+// the destination label.
+type metric struct {
+	sync.Mutex
+	config    conf.LogMetricConfig
+	maxSeries int
+	series    map[string]bool
+	counter   *prometheus.CounterVec
+	histogram *prometheus.HistogramVec
+	dropped   prometheus.Counter
+}
+
+func (mt *metric) collector() prometheus.Collector {
+	if mt.counter != nil {
+		return mt.counter
+	}
+	return mt.histogram
+}
+
+// observe records a value, unless it would create a series beyond the
+// cardinality limit.
+func (mt *metric) observe(labels []string, value float64) {
+	key := strings.Join(labels, "\xff")
+	mt.Lock()
+	if !mt.series[key] {
+		if len(mt.series) >= mt.maxSeries {
+			mt.Unlock()
+			mt.dropped.Inc()
+			return
+		}
+		mt.series[key] = true
+	}
+	mt.Unlock()
+	if mt.counter != nil {
+		mt.counter.WithLabelValues(labels...).Add(value)
+		return
+	}
+	mt.histogram.WithLabelValues(labels...).Observe(value)
+}
+
+var (
+	metricsMu sync.Mutex
+	metrics   = map[string]*metric{}
+)
+
+// register returns the metric defined by config, and registers it if needed.
+// When the definition of the metric has changed, the previous metric is
+// replaced.
+func register(config conf.LogMetricConfig, labelNames []string, registerer prometheus.Registerer) (*metric, error) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if mt, ok := metrics[config.Name]; ok {
+		if reflect.DeepEqual(mt.config, config) {
+			return mt, nil
+		}
+		registerer.Unregister(mt.collector())
+		delete(metrics, config.Name)
+	}
+	mt := metric{
+		config:    config,
+		maxSeries: config.MaxSeries,
+		series:    make(map[string]bool),
+		dropped:   DroppedCounter.WithLabelValues(config.Name),
+	}
+	if mt.maxSeries <= 0 {
+		mt.maxSeries = 1000
+	}
+	if config.Type == "histogram" {
+		buckets := config.Buckets
+		if len(buckets) == 0 {
+			buckets = prometheus.DefBuckets
+		}
+		mt.histogram = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{Name: config.Name, Help: config.Help, Buckets: buckets},
+			labelNames,
+		)
+	} else {
+		mt.counter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{Name: config.Name, Help: config.Help},
+			labelNames,
+		)
+	}
+	err := registerer.Register(mt.collector())
+	if err != nil {
+		return nil, err
+	}
+	metrics[config.Name] = &mt
+	return &mt, nil
+}
+
+type label struct {
+	value *expr.Program
+	// group is the index of the regexp group that gives the label, when > 0
+	group int
+}
+
+type measure struct {
+	metric *metric
+	match  *expr.Program
+	re     *regexp.Regexp
+	value  *expr.Program
+	group  int
+	labels []label
+}
+
+// Deriver derives the metrics of a log metrics configuration from the
+// messages sent to a destination.
+type Deriver struct {
+	dest     string
+	measures []measure
+}
+
+// New creates a Deriver for the messages sent to the destination dest. The
+// metrics are registered in registerer. The invalid metrics are logged and
+// ignored.
+func New(config conf.LogMetricsConfig, dest string, registerer prometheus.Registerer, logger log15.Logger) *Deriver {
+	d := Deriver{dest: dest}
+	for _, metricConf := range config.Metrics {
+		ms, err := newMeasure(metricConf, registerer)
+		if err != nil {
+			logger.Warn("Invalid log metric", "log_metrics", config.Name, "metric", metricConf.Name, "error", err)
+			continue
+		}
+		d.measures = append(d.measures, ms)
+	}
+	return &d
+}
+
+func newMeasure(config conf.LogMetricConfig, registerer prometheus.Registerer) (ms measure, err error) {
+	if len(config.Match) > 0 {
+		ms.match, err = expr.Compile(config.Match)
+		if err != nil {
+			return ms, err
+		}
+	}
+	if len(config.Regexp) > 0 {
+		ms.re, err = regexp.Compile(config.Regexp)
+		if err != nil {
+			return ms, err
+		}
+		ms.group = subexpIndex(ms.re, "value")
+	}
+	if len(config.Value) > 0 {
+		ms.value, err = expr.Compile(config.Value)
+		if err != nil {
+			return ms, err
+		}
+	}
+
+	// sort the labels, so that the label names are always the same
+	names := make([]string, 0, len(config.Labels)+1)
+	for name := range config.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := config.Labels[name]
+		if strings.HasPrefix(value, "$") {
+			group := subexpIndex(ms.re, value[1:])
+			if group <= 0 {
+				return ms, eerrors.Errorf("Unknown regexp group '%s'", value[1:])
+			}
+			ms.labels = append(ms.labels, label{group: group})
+			continue
+		}
+		p, err := expr.Compile(value)
+		if err != nil {
+			return ms, err
+		}
+		ms.labels = append(ms.labels, label{value: p})
+	}
+	names = append(names, "destination")
+
+	ms.metric, err = register(config, names, registerer)
+	return ms, err
+}
+
+// subexpIndex returns the index of the group called name, or -1.
+func subexpIndex(re *regexp.Regexp, name string) int {
+	if re == nil {
+		return -1
+	}
+	for i, n := range re.SubexpNames() {
+		if i > 0 && n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Measure records the metrics of m.
+func (d *Deriver) Measure(m *model.SyslogMessage) {
+	if m == nil {
+		return
+	}
+	for i := range d.measures {
+		d.measures[i].measure(m, d.dest)
+	}
+}
+
+func (ms *measure) measure(m *model.SyslogMessage, dest string) {
+	if ms.match != nil && !ms.match.Bool(m) {
+		return
+	}
+	var groups []string
+	if ms.re != nil {
+		groups = ms.re.FindStringSubmatch(m.Message)
+		if groups == nil {
+			return
+		}
+	}
+	value := 1.0
+	switch {
+	case ms.value != nil:
+		value = ms.value.Number(m)
+	case ms.group > 0:
+		v, err := strconv.ParseFloat(groups[ms.group], 64)
+		if err != nil {
+			return
+		}
+		value = v
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	if ms.metric.counter != nil && value < 0 {
+		// counters can not decrease
+		return
+	}
+	labels := make([]string, 0, len(ms.labels)+1)
+	for _, l := range ms.labels {
+		if l.group > 0 {
+			labels = append(labels, groups[l.group])
+			continue
+		}
+		labels = append(labels, l.value.String(m))
+	}
+	labels = append(labels, dest)
+	ms.metric.observe(labels, value)
+}
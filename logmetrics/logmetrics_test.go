@@ -0,0 +1,145 @@
+package logmetrics
+
+import (
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDeriver(registry *prometheus.Registry, metrics ...conf.LogMetricConfig) *Deriver {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	for i := range metrics {
+		if metrics[i].Help == "" {
+			metrics[i].Help = "test"
+		}
+	}
+	return New(conf.LogMetricsConfig{Name: "test", Metrics: metrics}, "stderr", registry, logger)
+}
+
+func message(severity model.Severity, app, text string) *model.SyslogMessage {
+	m := model.Factory()
+	m.Severity = severity
+	m.AppName = app
+	m.Message = text
+	return m
+}
+
+func gather(t *testing.T, registry *prometheus.Registry, name string) []*dto.Metric {
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()
+		}
+	}
+	return nil
+}
+
+func labels(m *dto.Metric) map[string]string {
+	res := map[string]string{}
+	for _, pair := range m.GetLabel() {
+		res[pair.GetName()] = pair.GetValue()
+	}
+	return res
+}
+
+func TestCounter(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	d := newDeriver(registry, conf.LogMetricConfig{
+		Name:   "test_log_errors_total",
+		Match:  `severity <= "err"`,
+		Labels: map[string]string{"app": "app_name"},
+	}, conf.LogMetricConfig{
+		Name:   "test_http_bytes_total",
+		Regexp: `status=(?P<status>\d+) bytes=(?P<value>\d+)`,
+		Labels: map[string]string{"status": "$status"},
+	})
+
+	d.Measure(message(model.Serr, "nginx", "upstream timed out"))
+	d.Measure(message(model.Scrit, "nginx", "status=502 bytes=100"))
+	d.Measure(message(model.Sinfo, "nginx", "status=200 bytes=1000"))
+	d.Measure(message(model.Sinfo, "nginx", "status=200 bytes=500"))
+	d.Measure(message(model.Serr, "sshd", "no status"))
+
+	errors := gather(t, registry, "test_log_errors_total")
+	if assert.Len(t, errors, 2) {
+		for _, m := range errors {
+			l := labels(m)
+			assert.Equal(t, "stderr", l["destination"])
+			switch l["app"] {
+			case "nginx":
+				assert.Equal(t, float64(2), m.GetCounter().GetValue())
+			case "sshd":
+				assert.Equal(t, float64(1), m.GetCounter().GetValue())
+			default:
+				t.Errorf("unexpected app label: %s", l["app"])
+			}
+		}
+	}
+	bytes := gather(t, registry, "test_http_bytes_total")
+	if assert.Len(t, bytes, 2) {
+		for _, m := range bytes {
+			switch labels(m)["status"] {
+			case "200":
+				assert.Equal(t, float64(1500), m.GetCounter().GetValue())
+			case "502":
+				assert.Equal(t, float64(100), m.GetCounter().GetValue())
+			}
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	d := newDeriver(registry, conf.LogMetricConfig{
+		Name:    "test_request_seconds",
+		Type:    "histogram",
+		Value:   "num(props.nginx.request_time)",
+		Buckets: []float64{0.1, 1},
+	})
+	for _, v := range []string{"0.05", "0.5", "2", "0.08"} {
+		m := message(model.Sinfo, "nginx", "")
+		m.SetProperty("nginx", "request_time", v)
+		d.Measure(m)
+	}
+	metrics := gather(t, registry, "test_request_seconds")
+	if assert.Len(t, metrics, 1) {
+		h := metrics[0].GetHistogram()
+		assert.Equal(t, uint64(4), h.GetSampleCount())
+		assert.InDelta(t, 2.63, h.GetSampleSum(), 1e-9)
+		assert.Equal(t, uint64(2), h.GetBucket()[0].GetCumulativeCount())
+		assert.Equal(t, uint64(3), h.GetBucket()[1].GetCumulativeCount())
+	}
+}
+
+func TestCardinality(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	d := newDeriver(registry, conf.LogMetricConfig{
+		Name:      "test_apps_total",
+		Labels:    map[string]string{"app": "app_name"},
+		MaxSeries: 2,
+	})
+	for _, app := range []string{"a", "b", "c", "a", "d"} {
+		d.Measure(message(model.Sinfo, app, ""))
+	}
+	assert.Len(t, gather(t, registry, "test_apps_total"), 2)
+
+	var metric dto.Metric
+	assert.NoError(t, DroppedCounter.WithLabelValues("test_apps_total").Write(&metric))
+	assert.Equal(t, float64(2), metric.GetCounter().GetValue())
+
+	// the pipelines share the metric, and its limit
+	d = newDeriver(registry, conf.LogMetricConfig{
+		Name:      "test_apps_total",
+		Labels:    map[string]string{"app": "app_name"},
+		MaxSeries: 2,
+	})
+	d.Measure(message(model.Sinfo, "a", ""))
+	assert.Len(t, gather(t, registry, "test_apps_total"), 2)
+}
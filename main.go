@@ -9,7 +9,6 @@ import (
 	"os/signal"
 	"runtime"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
@@ -230,32 +229,29 @@ func execServeParent() error {
 		return fatalError("Provide a non-privileged user with --uid flag", nil)
 	}
 
-	binderSockets := map[string]spair{}
+	// the logger sockets are kept for the whole life of the parent, so that
+	// they can be given to the next serve child after a graceful upgrade
 	loggerSockets := map[string]spair{}
-
+	loggerChildFiles := map[string]*os.File{}
 	for _, h := range base.Handles {
-		if h.Type == base.Binder {
-			binderSockets[h.Service], err = getSocketPair(syscall.SOCK_STREAM)
-		} else {
+		if h.Type != base.Binder {
 			loggerSockets[h.Service], err = getSocketPair(syscall.SOCK_DGRAM)
-		}
-		if err != nil {
-			return fatalError("Can't create the required socketpairs", err)
+			if err != nil {
+				return fatalError("Can't create the required socketpairs", err)
+			}
+			loggerChildFiles[h.Service] = os.NewFile(loggerSockets[h.Service].child, h.Service)
 		}
 	}
 
-	binderParents := []uintptr{}
-	for _, s := range binderSockets {
-		binderParents = append(binderParents, s.parent)
-	}
 	binderCtx, binderCancel := context.WithCancel(context.Background())
-	binderWg, err := binder.Server(binderCtx, binderParents, boxsecret, logger) // returns immediately
+	bindr, err := binder.Server(binderCtx, nil, boxsecret, logger) // returns immediately
 	if err != nil {
+		binderCancel()
 		return fatalError("Error setting the root binder", err)
 	}
 	defer func() {
 		binderCancel()
-		binderWg.Wait()
+		bindr.Wait()
 	}()
 
 	remoteLoggerConn := []*net.UnixConn{}
@@ -271,33 +267,129 @@ func execServeParent() error {
 
 	logger.Debug("Target user", "uid", numuid, "gid", numgid)
 
+	start := func() (*serveChildProc, error) {
+		return startServeChild(ring, bindr, loggerChildFiles, numuid, numgid)
+	}
+	child, err := start()
+	if err != nil {
+		return err
+	}
+
+	sigChan := make(chan os.Signal, 10)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGINT, syscall.SIGUSR1, syscall.SIGUSR2)
+	logger.Debug("PIDs", "parent", os.Getpid(), "child", child.cmd.Process.Pid)
+	terminating := false
+
+	for {
+		select {
+		case <-child.exited:
+			_ = child.deadMan.Close()
+			if code, ok := child.state.Sys().(syscall.WaitStatus); ok {
+				status := code.ExitStatus()
+				if status == 0 {
+					return nil
+				}
+				return fatalError("Serve child returned a non-zero exit status", nil)
+			}
+			return nil
+		case sig := <-sigChan:
+			logger.Debug("parent received signal", "signal", sig)
+			switch sig {
+			case syscall.SIGTERM:
+				if !terminating {
+					terminating = true
+					_ = child.cmd.Process.Signal(sig)
+				}
+			case syscall.SIGHUP:
+				// reload configuration
+				_ = child.cmd.Process.Signal(sig)
+			case syscall.SIGUSR1:
+				// log rotation
+				logging.SetupLogging(rootlogger, cmd.LoglevelFlag, cmd.LogjsonFlag, cmd.SyslogFlag, cmd.LogfilenameFlag)
+				logging.SetupLogging(logger, cmd.LoglevelFlag, cmd.LogjsonFlag, cmd.SyslogFlag, cmd.LogfilenameFlag)
+				logger.Info("log rotation")
+			case syscall.SIGUSR2:
+				// graceful upgrade
+				if !terminating {
+					child, terminating, err = upgradeServeChild(child, bindr, start, sigChan, logger)
+					if err != nil {
+						return fatalError("Graceful upgrade failed", err)
+					}
+				}
+			case syscall.SIGINT:
+			default:
+				logger.Info("Unsupported signal", "signal", sig)
+			}
+		}
+	}
+}
+
+// serveChildProc is a serve child process, started by the parent.
+type serveChildProc struct {
+	cmd     *exec.Cmd
+	deadMan *os.File
+	ready   chan struct{}
+	exited  chan struct{}
+	state   *os.ProcessState
+}
+
+// startServeChild starts a new serve child process, with the executable
+// that is currently installed. The child gets new binder sockets and the
+// existing logger sockets.
+func startServeChild(ring kring.Ring, bindr *binder.Binder, loggerChildFiles map[string]*os.File, numuid, numgid int) (*serveChildProc, error) {
+	binderSockets := map[string]spair{}
+	binderParents := []uintptr{}
+	var err error
+	for _, h := range base.Handles {
+		if h.Type == base.Binder {
+			binderSockets[h.Service], err = getSocketPair(syscall.SOCK_STREAM)
+			if err != nil {
+				return nil, fatalError("Can't create the required socketpairs", err)
+			}
+			binderParents = append(binderParents, binderSockets[h.Service].parent)
+		}
+	}
+	err = bindr.Serve(binderParents)
+	if err != nil {
+		return nil, fatalError("Error setting the root binder", err)
+	}
+
 	// execute child under the new user
 	exe, err := osext.Executable() // custom Executable() function to support OpenBSD
 	if err != nil {
-		return fatalError("Error getting executable name", err)
+		return nil, fatalError("Error getting executable name", err)
 	}
 
 	extraFiles := []*os.File{}
+	binderChildFiles := []*os.File{}
 	for _, h := range base.Handles {
 		if h.Type == base.Binder {
-			extraFiles = append(extraFiles, os.NewFile(binderSockets[h.Service].child, h.Service))
+			f := os.NewFile(binderSockets[h.Service].child, h.Service)
+			binderChildFiles = append(binderChildFiles, f)
+			extraFiles = append(extraFiles, f)
 		} else {
-			extraFiles = append(extraFiles, os.NewFile(loggerSockets[h.Service].child, h.Service))
+			extraFiles = append(extraFiles, loggerChildFiles[h.Service])
 		}
 	}
 	rRingSecretPipe, wRingSecretPipe, err := os.Pipe()
 	if err != nil {
-		return fatalError("Error creating ring-secret pipe", err)
+		return nil, fatalError("Error creating ring-secret pipe", err)
 	}
 	extraFiles = append(extraFiles, rRingSecretPipe)
 	// the dead man pipe is used by the child to detect that the parent had disappeared
 	rDeadManPipe, wDeadManPipe, err := os.Pipe()
 	if err != nil {
-		return fatalError("Error creating dead man pipe", err)
+		return nil, fatalError("Error creating dead man pipe", err)
 	}
 	extraFiles = append(extraFiles, rDeadManPipe)
+	// the child writes to the ready pipe when its services have started
+	rReadyPipe, wReadyPipe, err := os.Pipe()
+	if err != nil {
+		return nil, fatalError("Error creating ready pipe", err)
+	}
+	extraFiles = append(extraFiles, wReadyPipe)
 
-	childProcess := exec.Cmd{
+	childProcess := &exec.Cmd{
 		Args:       append([]string{"skewer-child"}, os.Args[1:]...),
 		Path:       exe,
 		Stdin:      nil,
@@ -318,56 +410,125 @@ func execServeParent() error {
 	err = childProcess.Start()
 	_ = rRingSecretPipe.Close()
 	_ = rDeadManPipe.Close()
+	_ = wReadyPipe.Close()
+	for _, f := range binderChildFiles {
+		_ = f.Close()
+	}
 	if err != nil {
-		return fatalError("Error starting child", err)
+		_ = wRingSecretPipe.Close()
+		_ = wDeadManPipe.Close()
+		_ = rReadyPipe.Close()
+		return nil, fatalError("Error starting child", err)
 	}
 
-	for _, h := range base.Handles {
-		if h.Type == base.Binder {
-			_ = syscall.Close(int(binderSockets[h.Service].child))
-		} else {
-			_ = syscall.Close(int(loggerSockets[h.Service].child))
-		}
-	}
 	_ = ring.WriteRingPass(wRingSecretPipe)
 	_ = wRingSecretPipe.Close()
 
-	sigChan := make(chan os.Signal, 10)
-	once := sync.Once{}
+	child := &serveChildProc{
+		cmd:     childProcess,
+		deadMan: wDeadManPipe,
+		ready:   make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
 	go func() {
-		for sig := range sigChan {
-			logger.Debug("parent received signal", "signal", sig)
-			switch sig {
-			case syscall.SIGTERM:
-				once.Do(func() { _ = childProcess.Process.Signal(sig) })
-				return
-			case syscall.SIGHUP:
-				// reload configuration
-				_ = childProcess.Process.Signal(sig)
-			case syscall.SIGUSR1:
-				// log rotation
-				logging.SetupLogging(rootlogger, cmd.LoglevelFlag, cmd.LogjsonFlag, cmd.SyslogFlag, cmd.LogfilenameFlag)
-				logging.SetupLogging(logger, cmd.LoglevelFlag, cmd.LogjsonFlag, cmd.SyslogFlag, cmd.LogfilenameFlag)
-				logger.Info("log rotation")
-			case syscall.SIGINT:
-			default:
-				logger.Info("Unsupported signal", "signal", sig)
-			}
+		dummy := make([]byte, 1)
+		n, _ := rReadyPipe.Read(dummy)
+		_ = rReadyPipe.Close()
+		if n == 1 {
+			close(child.ready)
 		}
 	}()
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGINT, syscall.SIGUSR1)
-	logger.Debug("PIDs", "parent", os.Getpid(), "child", childProcess.Process.Pid)
-
-	state, _ := childProcess.Process.Wait()
-	_ = wDeadManPipe.Close()
-	if code, ok := state.Sys().(syscall.WaitStatus); ok {
-		status := code.ExitStatus()
-		if status == 0 {
-			return nil
+	go func() {
+		child.state, _ = childProcess.Process.Wait()
+		close(child.exited)
+	}()
+	return child, nil
+}
+
+// upgradeTimeout bounds each step of a graceful upgrade: the stop of the
+// current serve child, and the start of the new one.
+const upgradeTimeout = 30 * time.Second
+
+// upgradeServeChild replaces the serve child by a new one, possibly running
+// a new skewer executable. The binder holds the listening sockets in the
+// meantime, so that no client is refused and no datagram is lost. The old
+// child stops first, as two children can not share the Store.
+//
+// A SIGTERM received during the upgrade is honored: the returned child is
+// then already stopping, and terminating is true.
+func upgradeServeChild(old *serveChildProc, bindr *binder.Binder, start func() (*serveChildProc, error), sigChan <-chan os.Signal, logger log15.Logger) (child *serveChildProc, terminating bool, err error) {
+	logger.Info("Graceful upgrade: stopping the current serve child", "pid", old.cmd.Process.Pid)
+	bindr.Hold()
+	defer bindr.Release()
+
+	_ = old.cmd.Process.Signal(syscall.SIGTERM)
+	timeout := time.NewTimer(upgradeTimeout)
+	defer timeout.Stop()
+	killed := false
+Stop:
+	for {
+		select {
+		case <-old.exited:
+			break Stop
+		case <-timeout.C:
+			if !killed {
+				logger.Warn("Graceful upgrade: the current serve child did not stop in time, killing it", "pid", old.cmd.Process.Pid)
+				_ = old.cmd.Process.Kill()
+				killed = true
+			}
+		case sig := <-sigChan:
+			if upgradeSignal(sig, logger) {
+				// the old child is already stopping: do not start a new one
+				terminating = true
+			}
 		}
-		return fatalError("Serve child returned a non-zero exit status", nil)
 	}
-	return nil
+	_ = old.deadMan.Close()
+	if !old.state.Success() {
+		logger.Warn("The previous serve child did not stop cleanly", "state", old.state.String())
+	}
+	if terminating {
+		return old, true, nil
+	}
+
+	child, err = start()
+	if err != nil {
+		return nil, false, err
+	}
+	timeout.Reset(upgradeTimeout)
+	for {
+		select {
+		case <-child.ready:
+			logger.Info("Graceful upgrade: the new serve child is ready", "pid", child.cmd.Process.Pid)
+			return child, false, nil
+		case <-child.exited:
+			logger.Warn("Graceful upgrade: the new serve child has stopped")
+			return child, false, nil
+		case <-timeout.C:
+			logger.Warn("Graceful upgrade: the new serve child is not ready yet", "pid", child.cmd.Process.Pid)
+			return child, false, nil
+		case sig := <-sigChan:
+			if upgradeSignal(sig, logger) {
+				_ = child.cmd.Process.Signal(sig)
+				return child, true, nil
+			}
+		}
+	}
+}
+
+// upgradeSignal handles a signal received during a graceful upgrade. It
+// returns true for SIGTERM. The other signals are ignored until the upgrade
+// is done.
+func upgradeSignal(sig os.Signal, logger log15.Logger) bool {
+	logger.Debug("parent received signal during graceful upgrade", "signal", sig)
+	switch sig {
+	case syscall.SIGTERM:
+		return true
+	case syscall.SIGINT:
+	default:
+		logger.Info("Signal ignored during graceful upgrade", "signal", sig)
+	}
+	return false
 }
 
 func execParent() error {
@@ -64,6 +64,11 @@ type RawUDPMessage struct {
 	RawMessage
 	Message [65536]byte
 	Size    int
+	// credentials of the sender, on unix sockets with SO_PASSCRED
+	HasCreds bool
+	Pid      int32
+	Uid      uint32
+	Gid      uint32
 }
 
 type DeferedRequest struct {
@@ -100,7 +105,9 @@ func RawTCPFree(raw *RawTCPMessage) {
 }
 
 func RawUDPFactory() (raw *RawUDPMessage) {
-	return rawUDPPool.Get().(*RawUDPMessage)
+	raw = rawUDPPool.Get().(*RawUDPMessage)
+	raw.HasCreds = false
+	return raw
 }
 
 func RawUDPFree(raw *RawUDPMessage) {
@@ -0,0 +1,110 @@
+package redact
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// validator tells whether the match s[start:end] of a detector is really the
+// data that the detector looks for.
+type validator func(s string, start, end int) bool
+
+type detector struct {
+	re    *regexp.Regexp
+	valid validator
+}
+
+// detectors are the builtin detectors. When a regexp has a group, only the
+// group is redacted.
+var detectors = map[string][]detector{
+	"email": {
+		{re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)},
+	},
+	"ip": {
+		{re: regexp.MustCompile(`\d{1,3}(?:\.\d{1,3}){3}`), valid: validIPv4},
+		{re: regexp.MustCompile(`(?i)[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}`), valid: validIPv6},
+	},
+	"credit_card": {
+		{re: regexp.MustCompile(`\d(?:[ -]?\d){12,18}`), valid: validCard},
+	},
+	"token": {
+		// key=value, key: value
+		{re: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|auth)\b["']?\s*[:=]\s*["']?([^\s"'&,;]+)`)},
+		// HTTP authorization
+		{re: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]+=*)`)},
+		// JSON web tokens
+		{re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]+`)},
+		// AWS access keys
+		{re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	},
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isolated tells whether s[start:end] is not a part of a larger word.
+func isolated(s string, start, end int) bool {
+	return (start == 0 || !isWordByte(s[start-1])) && (end == len(s) || !isWordByte(s[end]))
+}
+
+func validIPv4(s string, start, end int) bool {
+	if !isolated(s, start, end) {
+		return false
+	}
+	// not a part of a longer dotted number, like a version
+	if start >= 2 && s[start-1] == '.' && isDigit(s[start-2]) {
+		return false
+	}
+	if end+1 < len(s) && s[end] == '.' && isDigit(s[end+1]) {
+		return false
+	}
+	return net.ParseIP(s[start:end]) != nil
+}
+
+func validIPv6(s string, start, end int) bool {
+	candidate := s[start:end]
+	if len(strings.Trim(candidate, ":")) < 2 {
+		return false
+	}
+	if start > 0 && (isWordByte(s[start-1]) || s[start-1] == ':') {
+		return false
+	}
+	if end < len(s) && (isWordByte(s[end]) || s[end] == ':' || s[end] == '.') {
+		return false
+	}
+	return net.ParseIP(candidate) != nil
+}
+
+// validCard checks the length and the Luhn checksum of a card number.
+func validCard(s string, start, end int) bool {
+	if !isolated(s, start, end) {
+		return false
+	}
+	var digits []byte
+	for i := start; i < end; i++ {
+		if isDigit(s[i]) {
+			digits = append(digits, s[i]-'0')
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i])
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
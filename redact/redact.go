@@ -0,0 +1,248 @@
+// Package redact removes the personal data from the messages: emails, IP
+// addresses, credit card numbers, tokens, and the matches of custom regexps.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+)
+
+// RedactionCounter counts the redacted values, by redaction, by rule and by
+// destination. It has to be registered by the processes that redact messages.
+var RedactionCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_redactions_total",
+		Help: "total number of redacted values",
+	},
+	[]string{"redaction", "rule", "destination"},
+)
+
+type mode int
+
+const (
+	mask mode = iota
+	hash
+	drop
+)
+
+func parseMode(s string) mode {
+	switch s {
+	case "hash":
+		return hash
+	case "drop":
+		return drop
+	default:
+		return mask
+	}
+}
+
+type rule struct {
+	name    string
+	re      *regexp.Regexp
+	valid   validator
+	mode    mode
+	counter prometheus.Counter
+}
+
+type property struct {
+	domain string
+	key    string
+}
+
+// Redactor redacts the messages according to a redaction configuration.
+type Redactor struct {
+	name       string
+	rules      []rule
+	message    bool
+	structured bool
+	props      []property
+	mask       string
+	key        []byte
+}
+
+// New creates a Redactor for the messages sent to the destination dest. The
+// invalid rules are logged and ignored.
+func New(config conf.RedactionConfig, dest string, logger log15.Logger) *Redactor {
+	r := Redactor{
+		name: config.Name,
+		mask: config.Mask,
+		key:  []byte(config.HashKey),
+	}
+	if len(r.mask) == 0 {
+		r.mask = "[REDACTED]"
+	}
+	defaultMode := parseMode(config.Mode)
+
+	// the custom rules first, as they are more specific
+	for _, ruleConf := range config.Rules {
+		re, err := regexp.Compile(ruleConf.Regexp)
+		if err != nil {
+			logger.Warn("Invalid redaction rule", "redaction", config.Name, "rule", ruleConf.Name, "error", err)
+			continue
+		}
+		m := defaultMode
+		if len(ruleConf.Mode) > 0 {
+			m = parseMode(ruleConf.Mode)
+		}
+		r.rules = append(r.rules, rule{
+			name:    ruleConf.Name,
+			re:      re,
+			mode:    m,
+			counter: RedactionCounter.WithLabelValues(config.Name, ruleConf.Name, dest),
+		})
+	}
+	for _, name := range config.Detectors {
+		dets, ok := detectors[name]
+		if !ok {
+			logger.Warn("Unknown redaction detector", "redaction", config.Name, "detector", name)
+			continue
+		}
+		for _, det := range dets {
+			r.rules = append(r.rules, rule{
+				name:    name,
+				re:      det.re,
+				valid:   det.valid,
+				mode:    defaultMode,
+				counter: RedactionCounter.WithLabelValues(config.Name, name, dest),
+			})
+		}
+	}
+
+	for _, field := range config.Fields {
+		switch field {
+		case "message":
+			r.message = true
+		case "structured":
+			r.structured = true
+		}
+	}
+	for _, prop := range config.Properties {
+		domain, key, err := conf.SplitProperty(prop)
+		if err != nil {
+			logger.Warn("Invalid redaction property", "redaction", config.Name, "error", err)
+			continue
+		}
+		r.props = append(r.props, property{domain: domain, key: key})
+	}
+	return &r
+}
+
+// Redact redacts the fields and the properties of m. When m is retried, its
+// values have been counted by the first attempt, and they are not counted
+// again.
+func (r *Redactor) Redact(m *model.SyslogMessage, retried bool) {
+	if m == nil {
+		return
+	}
+	if r.message {
+		m.Message, _ = r.redact(m.Message, retried)
+	}
+	if r.structured {
+		m.Structured, _ = r.redact(m.Structured, retried)
+	}
+	for _, prop := range r.props {
+		inner := m.Properties.Map[prop.domain]
+		if inner == nil {
+			continue
+		}
+		if prop.key == "*" {
+			for key := range inner.Map {
+				r.redactProperty(inner.Map, key, retried)
+			}
+			continue
+		}
+		r.redactProperty(inner.Map, prop.key, retried)
+	}
+}
+
+func (r *Redactor) redactProperty(props map[string]string, key string, retried bool) {
+	value, ok := props[key]
+	if !ok {
+		return
+	}
+	value, dropped := r.redact(value, retried)
+	if dropped {
+		delete(props, key)
+		return
+	}
+	props[key] = value
+}
+
+// redact applies the rules to s. dropped is true when a rule in drop mode
+// matched: the whole field has to be removed.
+func (r *Redactor) redact(s string, retried bool) (result string, dropped bool) {
+	if len(s) == 0 {
+		return s, false
+	}
+	for i := range r.rules {
+		s, dropped = r.apply(&r.rules[i], s, retried)
+		if dropped {
+			return "", true
+		}
+	}
+	return s, false
+}
+
+func (r *Redactor) apply(rl *rule, s string, retried bool) (string, bool) {
+	matches := rl.re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, false
+	}
+	var b strings.Builder
+	last := 0
+	count := 0
+	for _, loc := range matches {
+		start, end := loc[0], loc[1]
+		if len(loc) >= 4 {
+			// only the first group is redacted
+			start, end = loc[2], loc[3]
+		}
+		if start < 0 || start == end {
+			continue
+		}
+		if rl.valid != nil && !rl.valid(s, start, end) {
+			continue
+		}
+		if s[start:end] == r.mask {
+			// already redacted
+			continue
+		}
+		count++
+		if rl.mode == drop {
+			if !retried {
+				rl.counter.Inc()
+			}
+			return "", true
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(r.replacement(rl.mode, s[start:end]))
+		last = end
+	}
+	if count == 0 {
+		return s, false
+	}
+	b.WriteString(s[last:])
+	if !retried {
+		rl.counter.Add(float64(count))
+	}
+	return b.String(), false
+}
+
+// replacement returns the mask, or the keyed hash of the value so that the
+// redacted values can still be joined.
+func (r *Redactor) replacement(m mode, value string) string {
+	if m != hash {
+		return r.mask
+	}
+	mac := hmac.New(sha256.New, r.key)
+	_, _ = mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,150 @@
+// Package sample keeps a part of the messages, with rates that depend on
+// the messages, and sheds the less severe messages when the queues grow.
+package sample
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/expr"
+	"github.com/stephane-martin/skewer/expr/syntax"
+	"github.com/stephane-martin/skewer/model"
+)
+
+// SampledCounter counts the dropped messages, by sampling and by
+// destination. It has to be registered by the processes that sample
+// messages.
+var SampledCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_sampled_total",
+		Help: "total number of messages dropped by the samplings",
+	},
+	[]string{"sampling", "destination"},
+)
+
+type rule struct {
+	match *expr.Program
+	rate  float64
+}
+
+// Sampler samples the messages according to a sampling configuration. It is
+// not safe for concurrent use.
+type Sampler struct {
+	rules          []rule
+	key            *expr.Program
+	storeWatermark int64
+	destWatermark  int64
+	shedRate       float64
+	shedSeverity   model.Severity
+	shedding       bool
+	counter        prometheus.Counter
+}
+
+// New creates a Sampler for the messages sent to the destination dest. The
+// invalid rules are logged and ignored.
+func New(config conf.SamplingConfig, dest string, logger log15.Logger) *Sampler {
+	s := Sampler{
+		storeWatermark: config.StoreWatermark,
+		destWatermark:  config.DestWatermark,
+		shedRate:       0.1,
+		shedSeverity:   model.SWarning,
+		counter:        SampledCounter.WithLabelValues(config.Name, dest),
+	}
+	if config.ShedRate != nil {
+		s.shedRate = *config.ShedRate
+	}
+	if severity, ok := syntax.Severity(config.ShedSeverity); ok {
+		s.shedSeverity = model.Severity(severity)
+	}
+	for _, ruleConf := range config.Rules {
+		p, err := expr.Compile(ruleConf.Match)
+		if err != nil {
+			logger.Warn("Invalid sampling rule", "sampling", config.Name, "match", ruleConf.Match, "error", err)
+			continue
+		}
+		s.rules = append(s.rules, rule{match: p, rate: ruleConf.Rate})
+	}
+	if len(config.Key) > 0 {
+		p, err := expr.Compile(config.Key)
+		if err != nil {
+			logger.Warn("Invalid sampling key", "sampling", config.Name, "error", err)
+		} else {
+			s.key = p
+		}
+	}
+	return &s
+}
+
+// SetLoad tells the Sampler how many messages the Store holds, and how many
+// wait to be sent to the destination. Shedding starts when one of them
+// exceeds its watermark.
+func (s *Sampler) SetLoad(stored, waiting int64) {
+	s.shedding = (s.storeWatermark > 0 && stored > s.storeWatermark) ||
+		(s.destWatermark > 0 && waiting > s.destWatermark)
+}
+
+// Shedding tells whether the Sampler is shedding messages.
+func (s *Sampler) Shedding() bool {
+	return s.shedding
+}
+
+// Rate returns the probability that m is kept.
+func (s *Sampler) Rate(m *model.SyslogMessage) float64 {
+	rate := 1.0
+	for _, r := range s.rules {
+		if r.match.Bool(m) {
+			rate = r.rate
+			break
+		}
+	}
+	if s.shedding && m.Severity > s.shedSeverity {
+		rate *= s.shedRate
+	}
+	return rate
+}
+
+// Keep tells whether m is kept. The kept messages that were sampled get the
+// sampling.sample_rate property, so that the counts can be weighted.
+func (s *Sampler) Keep(m *model.FullMessage) bool {
+	if m == nil || m.Fields == nil {
+		return true
+	}
+	rate := s.Rate(m.Fields)
+	if rate >= 1 {
+		return true
+	}
+	if s.draw(m) >= rate {
+		s.counter.Inc()
+		return false
+	}
+	m.Fields.SetProperty("sampling", "sample_rate", strconv.FormatFloat(rate, 'g', -1, 64))
+	return true
+}
+
+// draw returns a number in [0, 1). With a key, the number only depends on the
+// value of the key, so that the messages with the same key are kept or
+// dropped together. Otherwise it depends on the UID of the message, so that
+// a retried message gets the same decision.
+func (s *Sampler) draw(m *model.FullMessage) float64 {
+	h := fnv.New64a()
+	if s.key == nil {
+		_, _ = h.Write([]byte(m.Uid))
+	} else {
+		_, _ = h.Write([]byte(s.key.String(m.Fields)))
+	}
+	return float64(mix(h.Sum64())>>11) / float64(uint64(1)<<53)
+}
+
+// mix spreads the bits of the FNV hash, whose high bits barely change for
+// keys that only differ at the end (the finalizer of MurmurHash3).
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
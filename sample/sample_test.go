@@ -0,0 +1,114 @@
+package sample
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSampler(config conf.SamplingConfig) *Sampler {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	if config.ShedSeverity == "" {
+		config.ShedSeverity = "warning"
+	}
+	return New(config, "stderr", logger)
+}
+
+func message(severity model.Severity, app, request string) *model.FullMessage {
+	m := model.FullFactory()
+	m.Fields = model.Factory()
+	m.Fields.Severity = severity
+	m.Fields.AppName = app
+	m.Fields.SetProperty("http", "request_id", request)
+	return m
+}
+
+func TestRate(t *testing.T) {
+	s := newSampler(conf.SamplingConfig{
+		Name: "rates",
+		Rules: []conf.SamplingRuleConfig{
+			{Match: `app_name == "chatty"`, Rate: 0},
+			{Match: `severity >= "info"`, Rate: 0.5},
+		},
+		DestWatermark: 100,
+	})
+	tests := []struct {
+		severity model.Severity
+		app      string
+		rate     float64
+		shed     float64
+	}{
+		{model.Serr, "nginx", 1, 1},
+		{model.SWarning, "nginx", 1, 1},
+		{model.Snotice, "nginx", 1, 0.1},
+		{model.Sinfo, "nginx", 0.5, 0.05},
+		{model.Sdebug, "chatty", 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d %s", test.severity, test.app), func(t *testing.T) {
+			m := message(test.severity, test.app, "")
+			s.SetLoad(1000, 100)
+			assert.False(t, s.Shedding())
+			assert.InDelta(t, test.rate, s.Rate(m.Fields), 1e-9)
+			s.SetLoad(0, 101)
+			assert.True(t, s.Shedding())
+			assert.InDelta(t, test.shed, s.Rate(m.Fields), 1e-9)
+		})
+	}
+}
+
+func TestKeep(t *testing.T) {
+	s := newSampler(conf.SamplingConfig{
+		Name:  "keep",
+		Rules: []conf.SamplingRuleConfig{{Match: "true", Rate: 0.3}},
+		Key:   "props.http.request_id",
+	})
+	kept := 0
+	for i := 0; i < 2000; i++ {
+		request := fmt.Sprintf("req-%d", i)
+		m := message(model.Sinfo, "nginx", request)
+		keep := s.Keep(m)
+		if keep {
+			kept++
+			assert.Equal(t, "0.3", m.Fields.GetProperty("sampling", "sample_rate"))
+		}
+		// the messages of a request are kept or dropped together
+		for j := 0; j < 3; j++ {
+			assert.Equal(t, keep, s.Keep(message(model.Sdebug, "nginx", request)))
+		}
+	}
+	assert.InDelta(t, 600, kept, 100)
+
+	// without a key, a retried message gets the same decision
+	s = newSampler(conf.SamplingConfig{
+		Name:  "uid",
+		Rules: []conf.SamplingRuleConfig{{Match: "true", Rate: 0.3}},
+	})
+	kept = 0
+	for i := 0; i < 2000; i++ {
+		m := message(model.Sinfo, "nginx", "")
+		m.Uid = utils.NewUid()
+		keep := s.Keep(m)
+		if keep {
+			kept++
+		}
+		for j := 0; j < 3; j++ {
+			retried := message(model.Sinfo, "nginx", "")
+			retried.Uid = m.Uid
+			assert.Equal(t, keep, s.Keep(retried))
+		}
+	}
+	assert.InDelta(t, 600, kept, 100)
+
+	// the messages that are not sampled have no sample_rate
+	s = newSampler(conf.SamplingConfig{Name: "none"})
+	m := message(model.Sdebug, "nginx", "")
+	assert.True(t, s.Keep(m))
+	assert.Equal(t, "", m.Fields.GetProperty("sampling", "sample_rate"))
+}
@@ -2,8 +2,6 @@ package base
 
 import (
 	"io"
-	"os"
-	"strings"
 	"sync"
 
 	"github.com/inconshreveable/log15"
@@ -12,12 +10,11 @@ import (
 )
 
 type BaseService struct {
-	ParserConfigs   []conf.ParserConfig
-	Logger          log15.Logger
-	Binder          binder.Client
-	UnixSocketPaths []string
-	Connections     map[io.Closer]bool
-	QueueSize       uint64
+	ParserConfigs []conf.ParserConfig
+	Logger        log15.Logger
+	Binder        binder.Client
+	Connections   map[io.Closer]bool
+	QueueSize     uint64
 
 	connMutex   sync.Mutex
 	statusMutex sync.Mutex
@@ -61,22 +58,12 @@ func (s *BaseService) CloseConnections() {
 		_ = conn.Close()
 		delete(s.Connections, conn)
 	}
-	for _, path := range s.UnixSocketPaths {
-		if !strings.HasPrefix(path, "@") {
-			err := os.Remove(path)
-			if err != nil {
-				s.Logger.Warn("Error deleting unix socket path", "error", err)
-			}
-		}
-	}
 	s.Connections = map[io.Closer]bool{}
-	s.UnixSocketPaths = []string{}
 	s.connMutex.Unlock()
 }
 
 func (s *BaseService) ClearConnections() {
 	s.connMutex.Lock()
 	s.Connections = map[io.Closer]bool{}
-	s.UnixSocketPaths = []string{}
 	s.connMutex.Unlock()
 }
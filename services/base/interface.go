@@ -29,3 +29,19 @@ func CountClientConnection(t Types, client string, port int, path string) {
 func CountParsingError(t Types, client string, parserName string) {
 	ParsingErrorCounter.WithLabelValues(Types2Names[t], client, parserName).Inc()
 }
+
+func CountRejectedClient(t Types, client string, reason string) {
+	RejectedClientCounter.WithLabelValues(Types2Names[t], client, reason).Inc()
+}
+
+func CountRateLimited(t Types, client string, action string) {
+	RateLimitedCounter.WithLabelValues(Types2Names[t], client, action).Inc()
+}
+
+func CountDTLSHandshake(client string, status string) {
+	DTLSHandshakeCounter.WithLabelValues(client, status).Inc()
+}
+
+func AddDTLSSessions(port int, delta float64) {
+	DTLSSessionsGauge.WithLabelValues(strconv.FormatInt(int64(port), 10)).Add(delta)
+}
@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/javascript"
 )
 
 var Registry *prometheus.Registry
@@ -12,6 +13,10 @@ var Once sync.Once
 var IncomingMsgsCounter *prometheus.CounterVec
 var ClientConnectionCounter *prometheus.CounterVec
 var ParsingErrorCounter *prometheus.CounterVec
+var RejectedClientCounter *prometheus.CounterVec
+var RateLimitedCounter *prometheus.CounterVec
+var DTLSHandshakeCounter *prometheus.CounterVec
+var DTLSSessionsGauge *prometheus.GaugeVec
 
 func InitRegistry() {
 	IncomingMsgsCounter = prometheus.NewCounterVec(
@@ -38,10 +43,47 @@ func InitRegistry() {
 		[]string{"provider", "client", "parsername"},
 	)
 
+	RejectedClientCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_rejected_clients_total",
+			Help: "total number of times a client was rejected by the access rules",
+		},
+		[]string{"provider", "client", "reason"},
+	)
+
+	RateLimitedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_rate_limited_messages_total",
+			Help: "total number of messages that exceeded the client rate limits",
+		},
+		[]string{"provider", "client", "action"},
+	)
+
+	DTLSHandshakeCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "skw_dtls_handshakes_total",
+			Help: "total number of DTLS handshakes with the UDP clients",
+		},
+		[]string{"client", "status"},
+	)
+
+	DTLSSessionsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "skw_dtls_sessions",
+			Help: "number of open DTLS sessions",
+		},
+		[]string{"port"},
+	)
+
 	Registry = prometheus.NewRegistry()
 	Registry.MustRegister(
 		ClientConnectionCounter,
 		IncomingMsgsCounter,
 		ParsingErrorCounter,
+		RejectedClientCounter,
+		RateLimitedCounter,
+		DTLSHandshakeCounter,
+		DTLSSessionsGauge,
+		javascript.TimeoutCounter,
 	)
 }
@@ -18,6 +18,7 @@ import (
 func Configure(t base.Types, c conf.BaseConfig) (res conf.BaseConfig) {
 	res = conf.NewBaseConf()
 	res.Main.EncryptIPC = c.Main.EncryptIPC
+	res.Scripts = c.Scripts
 	switch t {
 	case base.TCP:
 		res.TCPSource = c.TCPSource
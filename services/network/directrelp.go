@@ -203,6 +203,7 @@ type DirectRelpServiceImpl struct {
 	forwarder           *ackForwarder
 	parserEnv           *decoders.ParsersEnv
 	collectors          []prometheus.Collector
+	relpDrainer
 }
 
 func NewDirectRelpServiceImpl(confined bool, reporter *base.Reporter, b binder.Client, logger log15.Logger) *DirectRelpServiceImpl {
@@ -217,6 +218,7 @@ func NewDirectRelpServiceImpl(confined bool, reporter *base.Reporter, b binder.C
 	s.StreamingService.BaseService.Binder = b
 	s.StreamingService.handler = DirectRelpHandler{Server: &s}
 	s.StreamingService.confined = confined
+	s.StreamingService.typ = base.DirectRELP
 	s.StatusChan = make(chan RelpServerStatus, 10)
 	return &s
 }
@@ -255,6 +257,7 @@ func (s *DirectRelpServiceImpl) Start() ([]model.ListenerInfo, error) {
 	s.parsedMessagesQueue = message.NewRing(s.QueueSize)
 	s.rawQ = tcp.NewRing(s.QueueSize)
 	s.configs = map[utils.MyULID]conf.DirectRELPSourceConfig{}
+	s.resetDrainer()
 
 	for _, l := range s.UnixListeners {
 		s.configs[l.Conf.ConfID] = conf.DirectRELPSourceConfig(l.Conf)
@@ -342,6 +345,7 @@ func (s *DirectRelpServiceImpl) doStop(final bool, wait bool) {
 	}
 
 	s.resetTCPListeners() // makes the listeners stop
+	s.drain(relpDrainTimeout, s.Logger)
 	// no more message will arrive in rawMessagesQueue
 	if s.rawQ != nil {
 		s.rawQ.Dispose()
@@ -566,21 +570,13 @@ func (s *DirectRelpServiceImpl) pushOne(message *model.FullMessage, envs *map[ut
 	var err error
 
 	e, haveEnv := (*envs)[message.ConfId]
-	if !haveEnv {
+	if !haveEnv || e.Obsolete() {
 		config, haveConfig := s.configs[message.ConfId]
 		if !haveConfig {
 			s.Logger.Warn("Could not find the configuration for a message", "confId", message.ConfId, "txnr", message.Txnr)
 			return
 		}
-		(*envs)[message.ConfId] = javascript.NewFilterEnvironment(
-			config.FilterFunc,
-			config.TopicFunc,
-			config.TopicTmpl,
-			config.PartitionFunc,
-			config.PartitionTmpl,
-			config.PartitionNumberFunc,
-			s.Logger,
-		)
+		(*envs)[message.ConfId] = javascript.NewFilterEnvironment(config.FilterSubConfig, s.Logger)
 		e = (*envs)[message.ConfId]
 	}
 
@@ -602,11 +598,8 @@ func (s *DirectRelpServiceImpl) pushOne(message *model.FullMessage, envs *map[ut
 		s.Logger.Info("Error calculating the partition number", "error", joinedErr.Error(), "txnr", message.Txnr)
 	}
 
+	// an error comes with a FILTER_ERROR result
 	filterResult, err := e.FilterMessage(message.Fields)
-	if err != nil {
-		s.Logger.Warn("Error happened filtering message", "error", err)
-		return
-	}
 
 	switch filterResult {
 	case javascript.DROPPED:
@@ -655,6 +648,9 @@ func (h DirectRelpHandler) HandleConnection(conn net.Conn, c conf.TCPSourceConfi
 	s := h.Server
 	s.AddConnection(conn)
 	connID := s.forwarder.AddConn(s.QueueSize)
+	dconn := &drainableConn{Conn: conn}
+	s.addDrainable(connID, dconn)
+	defer s.removeDrainable(connID)
 	props := eprops(conn)
 	l := makeLogger(s.Logger, props, "directrelp")
 	l.Info("New client")
@@ -679,7 +675,14 @@ func (h DirectRelpHandler) HandleConnection(conn net.Conn, c conf.TCPSourceConfi
 			s.RemoveConnection(conn)
 			wg.Done()
 		}()
-		err := scan(l, s.forwarder, s.rawQ, conn, config.Timeout, config.ConfID, connID, s.MaxMessageSize, config.DecoderBaseConfig, props)
+		err := scan(l, s.forwarder, s.rawQ, dconn, config.Timeout, config.ConfID, connID, s.MaxMessageSize, config.MaxWindow, config.DecoderBaseConfig, props, s.policy(config.ConfID))
+		if dconn.isDrained() {
+			// the service is stopping: the client resends the
+			// unanswered transactions after it has reconnected
+			s.closeDrained(s.forwarder, connID, conn)
+			l.Debug("Direct RELP session has been drained")
+			return
+		}
 		if err != nil && !eerrors.HasFileClosed(err) {
 			rerr = eerrors.Wrapf(err, "Error scanning Direct RELP stream: %s", connID.String())
 		}
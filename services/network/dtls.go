@@ -0,0 +1,285 @@
+package network
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/dtls/v2"
+	"github.com/pion/transport/v2/deadline"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/acl"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+const dtlsHandshakeTimeout = 30 * time.Second
+const defaultDTLSSessionTimeout = 5 * time.Minute
+
+// maxPendingDTLSHandshakes limits the number of DTLS sessions of a listener
+// that are still in the handshake phase. A session is created for each new
+// source address, so that datagrams with spoofed addresses could otherwise
+// allocate sessions without limit.
+const maxPendingDTLSHandshakes = 64
+
+var errDTLSPeerClosed = eerrors.New("DTLS peer connection is closed")
+
+// dtlsPeerConn is the connection to one DTLS peer over the shared UDP socket
+// of a listener. The listener dispatches the datagrams of the peer to it.
+type dtlsPeerConn struct {
+	pc           net.PacketConn
+	remote       net.Addr
+	in           chan []byte
+	done         chan struct{}
+	once         sync.Once
+	readDeadline *deadline.Deadline
+	onClose      func()
+}
+
+func newDTLSPeerConn(pc net.PacketConn, remote net.Addr, onClose func()) *dtlsPeerConn {
+	return &dtlsPeerConn{
+		pc:           pc,
+		remote:       remote,
+		in:           make(chan []byte, 128),
+		done:         make(chan struct{}),
+		readDeadline: deadline.New(),
+		onClose:      onClose,
+	}
+}
+
+// push delivers a datagram to the peer. Like the kernel does for UDP, the
+// datagram is dropped if the session does not keep up.
+func (c *dtlsPeerConn) push(p []byte) {
+	select {
+	case c.in <- p:
+	case <-c.done:
+	default:
+	}
+}
+
+func (c *dtlsPeerConn) Read(b []byte) (int, error) {
+	select {
+	case p := <-c.in:
+		return copy(b, p), nil
+	case <-c.done:
+		return 0, io.EOF
+	case <-c.readDeadline.Done():
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *dtlsPeerConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, errDTLSPeerClosed
+	default:
+	}
+	return c.pc.WriteTo(b, c.remote)
+}
+
+func (c *dtlsPeerConn) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+		c.onClose()
+	})
+	return nil
+}
+
+func (c *dtlsPeerConn) LocalAddr() net.Addr {
+	return c.pc.LocalAddr()
+}
+
+func (c *dtlsPeerConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *dtlsPeerConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *dtlsPeerConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	return nil
+}
+
+func (c *dtlsPeerConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// handleDTLSConnection serves syslog over DTLS (RFC 6012) on a UDP socket.
+// A DTLS session is tracked for each peer address.
+func (s *UdpServiceImpl) handleDTLSConnection(conn net.PacketConn, config conf.UDPSourceConfig, policy *acl.Policy) (err error) {
+	tlsConf, err := utils.NewTLSConfig("", config.CAFile, config.CAPath, config.CertFile, config.KeyFile, false, s.confined)
+	if err != nil {
+		return eerrors.Wrap(err, "Error creating TLS configuration")
+	}
+	tlsConf.ClientAuth = config.GetClientAuthType()
+	err = utils.SetFingerprints(tlsConf, config.TLSFingerprints, true)
+	if err != nil {
+		return eerrors.Wrap(err, "Error setting up TLS fingerprints")
+	}
+	dtlsConf := utils.NewDTLSConfig(tlsConf, true)
+
+	s.AddConnection(conn)
+	defer s.RemoveConnection(conn)
+	defer s.Logger.Debug("End of DTLS listener")
+
+	localPort, _ := localPacketPort(conn)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	peers := make(map[string]*dtlsPeerConn)
+	pending := 0
+	handshaked := func() {
+		mu.Lock()
+		pending--
+		mu.Unlock()
+	}
+
+	defer func() {
+		mu.Lock()
+		current := make([]*dtlsPeerConn, 0, len(peers))
+		for _, peer := range peers {
+			current = append(current, peer)
+		}
+		mu.Unlock()
+		for _, peer := range current {
+			_ = peer.Close()
+		}
+		wg.Wait()
+	}()
+
+	buf := make([]byte, 65536)
+	for {
+		n, remote, err := conn.ReadFrom(buf)
+		if err != nil {
+			if eerrors.HasFileClosed(err) {
+				return io.EOF
+			}
+			return eerrors.Wrap(err, "Error reading DTLS socket")
+		}
+		key := remote.String()
+		mu.Lock()
+		peer, ok := peers[key]
+		if !ok {
+			if !policy.AllowedAddr(remote) {
+				mu.Unlock()
+				base.CountRejectedClient(base.UDP, strings.Split(key, ":")[0], "address")
+				continue
+			}
+			if pending >= maxPendingDTLSHandshakes {
+				mu.Unlock()
+				base.CountRejectedClient(base.UDP, strings.Split(key, ":")[0], "handshakes")
+				continue
+			}
+			pending++
+			peer = newDTLSPeerConn(conn, remote, func() {
+				mu.Lock()
+				delete(peers, key)
+				mu.Unlock()
+			})
+			peers[key] = peer
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.handleDTLSSession(peer, dtlsConf, config, policy, localPort, handshaked)
+			}()
+		}
+		mu.Unlock()
+		peer.push(append([]byte(nil), buf[:n]...))
+	}
+}
+
+// handleDTLSSession serves a DTLS peer. handshaked is called when the
+// handshake is over, whether it succeeded or not.
+func (s *UdpServiceImpl) handleDTLSSession(peer *dtlsPeerConn, dtlsConf *dtls.Config, config conf.UDPSourceConfig, policy *acl.Policy, localPort int, handshaked func()) {
+	defer peer.Close()
+	client := strings.Split(peer.RemoteAddr().String(), ":")[0]
+	logger := s.Logger.New("client", client, "port", localPort)
+
+	ctx, cancel := context.WithTimeout(context.Background(), dtlsHandshakeTimeout)
+	dconn, err := dtls.ServerWithContext(ctx, peer, dtlsConf)
+	cancel()
+	handshaked()
+	if err != nil {
+		base.CountDTLSHandshake(client, "failure")
+		logger.Info("DTLS handshake failed", "error", err)
+		return
+	}
+	defer dconn.Close()
+	base.CountDTLSHandshake(client, "success")
+
+	if policy.ChecksCertificates() {
+		var cert *x509.Certificate
+		certs := dconn.ConnectionState().PeerCertificates
+		if len(certs) > 0 {
+			cert, _ = x509.ParseCertificate(certs[0])
+		}
+		if !policy.AllowedCertificate(cert) {
+			base.CountRejectedClient(base.UDP, client, "certificate")
+			logger.Info("Rejected client", "reason", "certificate")
+			return
+		}
+	}
+
+	base.AddDTLSSessions(localPort, 1)
+	defer base.AddDTLSSessions(localPort, -1)
+	logger.Debug("New DTLS session")
+
+	timeout := config.DTLSSessionTimeout
+	if timeout <= 0 {
+		timeout = defaultDTLSSessionTimeout
+	}
+	buf := make([]byte, 65536)
+	for {
+		_ = dconn.SetReadDeadline(time.Now().Add(timeout))
+		n, err := dconn.Read(buf)
+		if err != nil {
+			// idle session, close_notify from the peer, or closed listener
+			logger.Debug("End of DTLS session", "error", err)
+			return
+		}
+		// a DTLS record holds one or more octet counted syslog messages
+		// (RFC 6012 section 5.3)
+		data := buf[:n]
+		for len(data) > 0 {
+			advance, token, err := OctetSplit(data, true)
+			if err != nil || advance == 0 {
+				logger.Info("Invalid syslog frame in DTLS record", "error", err)
+				break
+			}
+			data = data[advance:]
+			if len(token) == 0 {
+				continue
+			}
+			admitted, err := admit(policy, base.UDP, client, len(token))
+			if err != nil {
+				logger.Info("Closing DTLS session", "error", err)
+				return
+			}
+			if !admitted {
+				continue
+			}
+			raw := model.RawUDPFactory()
+			raw.Size = copy(raw.Message[:], token)
+			raw.LocalPort = localPort
+			raw.UnixSocketPath = ""
+			raw.Decoder = config.DecoderBaseConfig
+			raw.ConfID = config.ConfID
+			raw.Client = client
+			err = s.rawMessagesQueue.Put(raw)
+			if err != nil {
+				logger.Warn("Failed to enqueue new raw DTLS message", "error", err)
+				return
+			}
+			base.CountIncomingMessage(base.UDP, client, localPort, "")
+		}
+	}
+}
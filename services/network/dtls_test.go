@@ -0,0 +1,141 @@
+package network
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/pion/dtls/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSelfSigned writes a self-signed certificate and its key in dir.
+func writeSelfSigned(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+// dtlsListener starts a DTLS listener on the loopback.
+func dtlsListener(t *testing.T) (*UdpServiceImpl, net.PacketConn) {
+	// the services of the package share base.Once: initialize the RELP
+	// metrics too, for the RELP tests
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	s, err := NewUdpService(&base.ProviderEnv{Logger: logger})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var c conf.BaseConfig
+	c.Main.InputQueueSize = 16
+	s.SetConf(c)
+
+	var config conf.UDPSourceConfig
+	config.Format = "rfc5424"
+	config.TLSEnabled = true
+	config.CertFile, config.KeyFile = writeSelfSigned(t, t.TempDir())
+	policy, err := config.AccessControlConfig.Policy()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	go func() {
+		_ = s.handleDTLSConnection(conn, config, policy)
+	}()
+	return s, conn
+}
+
+func TestDTLS(t *testing.T) {
+	s, conn := dtlsListener(t)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := dtls.DialWithContext(ctx, "udp", conn.LocalAddr().(*net.UDPAddr), &dtls.Config{InsecureSkipVerify: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer client.Close()
+
+	// one DTLS record may hold several octet counted messages
+	_, err = client.Write([]byte("5 hello7 goodbye"))
+	assert.NoError(t, err)
+	for _, expected := range []string{"hello", "goodbye"} {
+		raw, err := s.rawMessagesQueue.Poll(5 * time.Second)
+		if !assert.NoError(t, err) || !assert.NotNil(t, raw) {
+			return
+		}
+		assert.Equal(t, expected, string(raw.Message[:raw.Size]))
+		assert.Equal(t, "127.0.0.1", raw.Client)
+	}
+}
+
+func TestDTLSPendingHandshakes(t *testing.T) {
+	_, conn := dtlsListener(t)
+	defer conn.Close()
+	rejected := func() float64 {
+		var metric dto.Metric
+		var c prometheus.Counter = base.RejectedClientCounter.WithLabelValues(base.Types2Names[base.UDP], "127.0.0.1", "handshakes")
+		assert.NoError(t, c.Write(&metric))
+		return metric.GetCounter().GetValue()
+	}
+	before := rejected()
+
+	// each source address that never completes its handshake holds a
+	// pending session, until the handshake timeout
+	for i := 0; i < maxPendingDTLSHandshakes+3; i++ {
+		peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer peer.Close()
+		_, err = peer.WriteTo([]byte("not a DTLS record"), conn.LocalAddr())
+		assert.NoError(t, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for rejected()-before < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, float64(3), rejected()-before)
+}
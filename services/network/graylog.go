@@ -1,13 +1,18 @@
 package network
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"compress/zlib"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
 	"net"
+	"net/http"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,6 +25,8 @@ import (
 	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/services/base"
 	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/proxyproto"
 )
 
 type GraylogStatus int
@@ -40,6 +47,10 @@ const (
 	chunkedDataLen   = gelf.ChunkSize - chunkedHeaderLen
 )
 
+// defaultGelfMaxSize is the maximum size of a GELF message received on TCP
+// or HTTP, when max_input_message_size is not set.
+const defaultGelfMaxSize = 1024 * 1024
+
 func initGraylogRegistry() {
 	base.Once.Do(func() {
 		base.InitRegistry()
@@ -56,6 +67,8 @@ type GraylogSvcImpl struct {
 	fatalOnce      *sync.Once
 	readers        map[*gelf.Reader]bool
 	readersMu      sync.Mutex
+	confined       bool
+	maxMessageSize int
 }
 
 func NewGraylogService(env *base.ProviderEnv) (base.Provider, error) {
@@ -68,6 +81,7 @@ func NewGraylogService(env *base.ProviderEnv) (base.Provider, error) {
 	s.BaseService.Init()
 	s.BaseService.Logger = env.Logger.New("class", "GraylogService")
 	s.BaseService.Binder = env.Binder
+	s.confined = env.Confined
 	return &s, nil
 }
 
@@ -77,6 +91,7 @@ func (s *GraylogSvcImpl) Type() base.Types {
 
 func (s *GraylogSvcImpl) SetConf(c conf.BaseConfig) {
 	s.Configs = c.GraylogSource
+	s.maxMessageSize = c.Main.MaxInputMessageSize
 }
 
 func (s *GraylogSvcImpl) Gather() ([]*dto.MetricFamily, error) {
@@ -92,12 +107,12 @@ func (s *GraylogSvcImpl) Start() (infos []model.ListenerInfo, err error) {
 	s.fatalErrorChan = make(chan struct{})
 	s.fatalOnce = &sync.Once{}
 	s.ClearConnections()
-	infos = s.ListenPacket()
+	infos = append(s.ListenPacket(), s.ListenStream()...)
 	if len(infos) > 0 {
 		s.status = GraylogStarted
-		s.Logger.Info("Listening on UDP", "nb_services", len(infos))
+		s.Logger.Info("Listening on Graylog", "nb_services", len(infos))
 	} else {
-		s.Logger.Debug("The UDP service has not been started: no listening port")
+		s.Logger.Debug("The Graylog service has not been started: no listening port")
 	}
 	return infos, nil
 }
@@ -128,8 +143,10 @@ func (s *GraylogSvcImpl) Stop() {
 
 func (s *GraylogSvcImpl) ListenPacket() []model.ListenerInfo {
 	infos := []model.ListenerInfo{}
-	s.UnixSocketPaths = []string{}
 	for _, syslogConf := range s.Configs {
+		if syslogConf.GetTransport() != "udp" {
+			continue
+		}
 		if len(syslogConf.UnixSocketPath) > 0 {
 			conn, err := s.Binder.ListenPacket("unixgram", syslogConf.UnixSocketPath, 65536)
 			if err != nil {
@@ -145,7 +162,6 @@ func (s *GraylogSvcImpl) ListenPacket() []model.ListenerInfo {
 					UnixSocketPath: syslogConf.UnixSocketPath,
 					Protocol:       "graylog",
 				})
-				s.UnixSocketPaths = append(s.UnixSocketPaths, syslogConf.UnixSocketPath)
 				s.wg.Add(1)
 				go s.handleConnection(conn, syslogConf)
 			}
@@ -261,10 +277,10 @@ func (s *GraylogSvcImpl) handleConnection(conn net.PacketConn, config conf.Grayl
 				continue
 			}
 			// rebuild message
-			full, err = fromChunks(chunks[msgid], total)
+			full, err = fromChunks(chunks[msgid], total, s.maxSize())
 			delete(chunks, msgid)
 		} else {
-			full, err = fullMsg(cBuf[:n])
+			full, err = fullMsg(cBuf[:n], s.maxSize())
 		}
 
 		client = "localhost"
@@ -277,20 +293,237 @@ func (s *GraylogSvcImpl) handleConnection(conn net.PacketConn, config conf.Grayl
 			logger.Warn("Error decoding full GELF message", "error", err)
 			continue
 		}
+		s.stash(full, gen.Uid(), config, client, localPort, path)
+	}
+}
+
+func (s *GraylogSvcImpl) stash(full *model.FullMessage, uid utils.MyULID, config conf.GraylogSourceConfig, client string, localPort int, path string) {
+	full.Uid = uid
+	full.ConfId = config.ConfID
+	full.SourceType = "graylog"
+	full.SourcePath = path
+	full.SourcePort = int32(localPort)
+	full.ClientAddr = client
+	s.stasher.Stash(full)
+	base.CountIncomingMessage(base.Graylog, client, localPort, path)
+	model.FullFree(full)
+}
+
+func (s *GraylogSvcImpl) maxSize() int {
+	if s.maxMessageSize > 0 {
+		return s.maxMessageSize
+	}
+	return defaultGelfMaxSize
+}
+
+// ListenStream starts the listeners of the Graylog sources that receive GELF
+// on TCP or HTTP.
+func (s *GraylogSvcImpl) ListenStream() []model.ListenerInfo {
+	infos := []model.ListenerInfo{}
+	for _, syslogConf := range s.Configs {
+		transport := syslogConf.GetTransport()
+		if transport == "udp" {
+			continue
+		}
+		var tlsConf *tls.Config
+		if syslogConf.TLSEnabled {
+			var err error
+			tlsConf, err = utils.NewTLSConfig("", syslogConf.CAFile, syslogConf.CAPath, syslogConf.CertFile, syslogConf.KeyFile, false, s.confined)
+			if err != nil {
+				s.Logger.Warn("Error creating TLS configuration", "error", err)
+				continue
+			}
+			tlsConf.ClientAuth = syslogConf.GetClientAuthType()
+		}
+		if len(syslogConf.UnixSocketPath) > 0 {
+			l, err := s.Binder.Listen("unix", syslogConf.UnixSocketPath)
+			if err != nil {
+				s.Logger.Warn("Error listening on stream unix socket", "path", syslogConf.UnixSocketPath, "error", err)
+				continue
+			}
+			s.Logger.Debug(
+				"Graylog listener",
+				"protocol", "graylog",
+				"transport", transport,
+				"path", syslogConf.UnixSocketPath,
+			)
+			infos = append(infos, model.ListenerInfo{
+				UnixSocketPath: syslogConf.UnixSocketPath,
+				Protocol:       "graylog",
+			})
+			s.serveStream(l, tlsConf, syslogConf, 0, syslogConf.UnixSocketPath)
+			continue
+		}
+		listenAddrs, _ := syslogConf.GetListenAddrs()
+		for port, listenAddr := range listenAddrs {
+			var l net.Listener
+			var err error
+			if syslogConf.KeepAlive {
+				l, err = s.Binder.ListenKeepAlive("tcp", listenAddr, syslogConf.KeepAlivePeriod)
+			} else {
+				l, err = s.Binder.Listen("tcp", listenAddr)
+			}
+			if err != nil {
+				s.Logger.Warn("Error listening on stream (Graylog)", "listen_addr", listenAddr, "error", err)
+				continue
+			}
+			if syslogConf.ProxyProtocol {
+				// the client address is given by the PROXY header
+				l = proxyproto.NewListener(l, syslogConf.Timeout)
+			}
+			s.Logger.Debug(
+				"Graylog listener",
+				"protocol", "graylog",
+				"transport", transport,
+				"bind_addr", syslogConf.BindAddr,
+				"port", port,
+			)
+			infos = append(infos, model.ListenerInfo{
+				BindAddr: syslogConf.BindAddr,
+				Port:     port,
+				Protocol: "graylog",
+			})
+			s.serveStream(l, tlsConf, syslogConf, port, "")
+		}
+	}
+	return infos
+}
+
+func (s *GraylogSvcImpl) serveStream(l net.Listener, tlsConf *tls.Config, config conf.GraylogSourceConfig, localPort int, path string) {
+	if tlsConf != nil {
+		l = tls.NewListener(l, tlsConf)
+	}
+	s.wg.Add(1)
+	if config.GetTransport() == "http" {
+		server := &http.Server{
+			Handler:     http.HandlerFunc(s.gelfHandler(config, localPort, path)),
+			ReadTimeout: config.Timeout,
+			ErrorLog:    log.New(s, "", 0),
+		}
+		// closing the server closes the listener and the client connections
+		s.AddConnection(server)
+		go s.serveHTTP(server, l)
+	} else {
+		s.AddConnection(l)
+		go s.acceptTCP(l, config, localPort, path)
+	}
+}
+
+func (s *GraylogSvcImpl) acceptTCP(l net.Listener, config conf.GraylogSourceConfig, localPort int, path string) {
+	defer func() {
+		s.RemoveConnection(l)
+		s.wg.Done()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !eerrors.HasFileClosed(err) {
+				s.Logger.Warn("Accept error", "error", err)
+			}
+			return
+		}
+		s.wg.Add(1)
+		go s.handleStreamConnection(conn, config, localPort, path)
+	}
+}
+
+// handleStreamConnection reads the GELF messages of a TCP client. The
+// messages are delimited by a null byte.
+func (s *GraylogSvcImpl) handleStreamConnection(conn net.Conn, config conf.GraylogSourceConfig, localPort int, path string) {
+	s.AddConnection(conn)
+	defer func() {
+		s.RemoveConnection(conn)
+		s.wg.Done()
+	}()
+
+	client := "localhost"
+	if remote := conn.RemoteAddr(); remote != nil && len(path) == 0 {
+		client = strings.Split(remote.String(), ":")[0]
+	}
+	logger := s.Logger.New("protocol", "graylog", "transport", "tcp", "client", client, "local_port", localPort, "unix_socket_path", path)
+	logger.Debug("New client")
+	gen := utils.NewGenerator()
+
+	timeout := config.Timeout
+	if timeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	scanner := utils.WithRecover(bufio.NewScanner(conn))
+	scanner.Buffer(make([]byte, 0, 65536), s.maxSize())
+	scanner.Split(makeLFTCPSplit("\x00"))
+
+	for scanner.Scan() {
+		if timeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+		full, err := fullMsg(scanner.Bytes(), s.maxSize())
+		if err != nil {
+			base.CountParsingError(base.Graylog, client, "graylog")
+			logger.Warn("Error decoding full GELF message", "error", err)
+			continue
+		}
+		s.stash(full, gen.Uid(), config, client, localPort, path)
+	}
+	err := scanner.Err()
+	if err != nil && !eerrors.HasFileClosed(err) {
+		logger.Info("Error reading TCP Graylog", "error", err)
+	}
+}
 
-		full.Uid = gen.Uid()
-		full.ConfId = config.ConfID
-		full.SourceType = "graylog"
-		full.SourcePath = path
-		full.SourcePort = int32(localPort)
-		full.ClientAddr = client
-		s.stasher.Stash(full)
-		base.CountIncomingMessage(base.Graylog, client, localPort, path)
-		model.FullFree(full)
+func (s *GraylogSvcImpl) serveHTTP(server *http.Server, l net.Listener) {
+	defer func() {
+		s.RemoveConnection(server)
+		s.wg.Done()
+	}()
+	err := server.Serve(l)
+	if err != nil && err != http.ErrServerClosed && !eerrors.HasFileClosed(err) {
+		s.Logger.Warn("Error serving GELF HTTP", "error", err)
 	}
 }
 
-func fromChunks(chunks map[uint8]([]byte), total uint8) (*model.FullMessage, error) {
+// gelfHandler handles the GELF HTTP requests, like the /gelf endpoint of a
+// Graylog server. The request body is a GELF message, optionally compressed
+// with gzip or zlib.
+func (s *GraylogSvcImpl) gelfHandler(config conf.GraylogSourceConfig, localPort int, path string) func(http.ResponseWriter, *http.Request) {
+	gen := utils.NewGenerator()
+	var genMu sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || len(client) == 0 {
+			client = "localhost"
+		}
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, int64(s.maxSize())))
+		_ = r.Body.Close()
+		if err != nil {
+			s.Logger.Warn("Error reading GELF request body", "error", err, "client", client)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		full, err := fullMsg(body, s.maxSize())
+		if err != nil {
+			base.CountParsingError(base.Graylog, client, "graylog")
+			s.Logger.Warn("Error decoding full GELF message", "error", err, "client", client)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		genMu.Lock()
+		uid := gen.Uid()
+		genMu.Unlock()
+		s.stash(full, uid, config, client, localPort, path)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (s *GraylogSvcImpl) Write(p []byte) (int, error) {
+	s.Logger.Debug(string(bytes.TrimSpace(p)))
+	return len(p), nil
+}
+
+func fromChunks(chunks map[uint8]([]byte), total uint8, maxSize int) (*model.FullMessage, error) {
 	var i uint8
 	full := make([]byte, 0, int(total)*gelf.ChunkSize)
 	for i = 0; i < total; i++ {
@@ -300,10 +533,12 @@ func fromChunks(chunks map[uint8]([]byte), total uint8) (*model.FullMessage, err
 		}
 		full = append(full, chunk...)
 	}
-	return fullMsg(full)
+	return fullMsg(full, maxSize)
 }
 
-func fullMsg(buf []byte) (full *model.FullMessage, err error) {
+// fullMsg decodes a GELF message. A compressed message is decompressed up to
+// maxSize bytes.
+func fullMsg(buf []byte, maxSize int) (full *model.FullMessage, err error) {
 	if len(buf) < 2 {
 		return nil, fmt.Errorf("GELF message was too short")
 	}
@@ -326,7 +561,7 @@ func fullMsg(buf []byte) (full *model.FullMessage, err error) {
 	}
 
 	gelfmsg := &gelf.Message{}
-	if err := json.NewDecoder(reader).Decode(gelfmsg); err != nil {
+	if err := json.NewDecoder(io.LimitReader(reader, int64(maxSize))).Decode(gelfmsg); err != nil {
 		return nil, fmt.Errorf("json.Unmarshal: %s", err)
 	}
 	return decoders.FullFromGelfMessage(gelfmsg), nil
@@ -0,0 +1,190 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func gelfJSON(short string) string {
+	return fmt.Sprintf(`{"version":"1.1","host":"example.org","short_message":"%s","level":5}`, short)
+}
+
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write([]byte(s))
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+func zlibbed(s string) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = w.Write([]byte(s))
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+func TestFullMsg(t *testing.T) {
+	long := gelfJSON(strings.Repeat("a", 1024*1024))
+	tests := []struct {
+		name string
+		buf  []byte
+		err  bool
+	}{
+		{"plain", []byte(gelfJSON("hello")), false},
+		{"gzip", gzipped(gelfJSON("hello")), false},
+		{"zlib", zlibbed(gelfJSON("hello")), false},
+		{"too short", []byte("{"), true},
+		{"not JSON", []byte("hello"), true},
+		{"gzip over the limit", gzipped(long), true},
+		{"zlib over the limit", zlibbed(long), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			full, err := fullMsg(test.buf, 4096)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, "hello", full.Fields.Message)
+			assert.Equal(t, "example.org", full.Fields.HostName)
+		})
+	}
+}
+
+// graylogService returns a Graylog service whose stashed messages are sent
+// to the returned channel.
+func graylogService(t *testing.T) (*GraylogSvcImpl, <-chan *model.FullMessage) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	r, w, err := os.Pipe()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	reporter := base.NewReporter("graylog", logger, w)
+	reporter.SetSecret(nil)
+	reporter.Start()
+	t.Cleanup(reporter.Stop)
+
+	messages := make(chan *model.FullMessage, 16)
+	go func() {
+		defer r.Close()
+		scanner := bufio.NewScanner(r)
+		scanner.Split(utils.MakeDecryptSplit(nil))
+		for scanner.Scan() {
+			full := &model.FullMessage{}
+			if full.Unmarshal(scanner.Bytes()) == nil {
+				messages <- full
+			}
+		}
+	}()
+
+	p, err := NewGraylogService(&base.ProviderEnv{Logger: logger, Reporter: reporter})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	s := p.(*GraylogSvcImpl)
+	var c conf.BaseConfig
+	c.Main.MaxInputMessageSize = 4096
+	s.SetConf(c)
+	return s, messages
+}
+
+func receiveGelf(t *testing.T, messages <-chan *model.FullMessage) *model.FullMessage {
+	t.Helper()
+	select {
+	case full := <-messages:
+		return full
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message has been stashed")
+		return nil
+	}
+}
+
+func TestGraylogTCPNullDelimited(t *testing.T) {
+	s, messages := graylogService(t)
+	server, client := net.Pipe()
+	config := conf.GraylogSourceConfig{ConfID: utils.NewUid()}
+	s.wg.Add(1)
+	go s.handleStreamConnection(server, config, 12201, "")
+
+	go func() {
+		// a message that can not be decoded is skipped
+		payload := gelfJSON("one") + "\x00not GELF\x00" + gelfJSON("two") + "\x00"
+		_, _ = client.Write([]byte(payload))
+		_ = client.Close()
+	}()
+	// the reporter does not keep the order of the messages
+	received := []string{}
+	for i := 0; i < 2; i++ {
+		full := receiveGelf(t, messages)
+		received = append(received, full.Fields.Message)
+		assert.Equal(t, "graylog", full.SourceType)
+		assert.Equal(t, config.ConfID, full.ConfId)
+		assert.Equal(t, int32(12201), full.SourcePort)
+	}
+	assert.ElementsMatch(t, []string{"one", "two"}, received)
+	s.wg.Wait()
+	select {
+	case full := <-messages:
+		t.Fatalf("unexpected message: %s", full.Fields.Message)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestGelfHandler(t *testing.T) {
+	s, messages := graylogService(t)
+	handler := s.gelfHandler(conf.GraylogSourceConfig{}, 12201, "")
+
+	tests := []struct {
+		name   string
+		method string
+		body   []byte
+		status int
+	}{
+		{"plain", "POST", []byte(gelfJSON("hello")), http.StatusAccepted},
+		{"gzip", "POST", gzipped(gelfJSON("hello")), http.StatusAccepted},
+		{"zlib", "POST", zlibbed(gelfJSON("hello")), http.StatusAccepted},
+		{"method", "GET", nil, http.StatusMethodNotAllowed},
+		{"not GELF", "POST", []byte("hello"), http.StatusBadRequest},
+		{"body too large", "POST", []byte(gelfJSON(strings.Repeat("a", 8192))), http.StatusBadRequest},
+		{"decompressed body too large", "POST", gzipped(gelfJSON(strings.Repeat("a", 8192))), http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/gelf", bytes.NewReader(test.body))
+			req.RemoteAddr = "192.0.2.1:40000"
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			assert.Equal(t, test.status, rec.Code)
+			if test.status != http.StatusAccepted {
+				return
+			}
+			full := receiveGelf(t, messages)
+			assert.Equal(t, "hello", full.Fields.Message)
+			assert.Equal(t, "192.0.2.1", full.ClientAddr)
+		})
+	}
+}
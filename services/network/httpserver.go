@@ -3,6 +3,7 @@ package network
 import (
 	"bytes"
 	"context"
+	"crypto/x509"
 	"io"
 	"log"
 	"net"
@@ -20,7 +21,9 @@ import (
 	"github.com/stephane-martin/skewer/services/base"
 	"github.com/stephane-martin/skewer/sys/binder"
 	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/acl"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/proxyproto"
 	"github.com/stephane-martin/skewer/utils/queue/tcp"
 	"github.com/valyala/bytebufferpool"
 	"go.uber.org/atomic"
@@ -237,8 +240,12 @@ func isSetupError(err error) bool {
 }
 
 func (s *HTTPServiceImpl) startOne(config conf.HTTPServerSourceConfig) error {
+	policy, err := config.AccessControlConfig.Policy()
+	if err != nil {
+		return setupError(eerrors.Wrap(err, "Invalid access rules"))
+	}
 	server := &http.Server{
-		Handler:           http.HandlerFunc(s.handler(config)),
+		Handler:           http.HandlerFunc(s.handler(config, policy)),
 		ReadTimeout:       config.ReadTimeout,
 		ReadHeaderTimeout: config.ReadTimeout,
 		WriteTimeout:      config.WriteTimeout,
@@ -257,11 +264,18 @@ func (s *HTTPServiceImpl) startOne(config conf.HTTPServerSourceConfig) error {
 			return setupError(eerrors.Wrap(err, "Error setting up TLS configuration"))
 		}
 		tlsConf.ClientAuth = config.GetClientAuthType()
+		err = utils.SetFingerprints(tlsConf, config.TLSFingerprints, true)
+		if err != nil {
+			return setupError(eerrors.Wrap(err, "Error setting up TLS fingerprints"))
+		}
 		server.TLSConfig = tlsConf
 		listener, err := getListener(s.binder, config.BindAddr, config.Port, !config.DisableConnKeepAlive, config.ConnKeepAlivePeriod)
 		if err != nil {
 			return setupError(eerrors.Wrap(err, "Error creating TCP listener"))
 		}
+		if config.ProxyProtocol {
+			listener = proxyproto.NewListener(listener, config.ReadTimeout)
+		}
 		defer listener.Close()
 		serve = func() error { return server.ServeTLS(listener, "", "") }
 	} else {
@@ -269,6 +283,9 @@ func (s *HTTPServiceImpl) startOne(config conf.HTTPServerSourceConfig) error {
 		if err != nil {
 			return setupError(eerrors.Wrap(err, "Error creating TCP listener"))
 		}
+		if config.ProxyProtocol {
+			listener = proxyproto.NewListener(listener, config.ReadTimeout)
+		}
 		defer listener.Close()
 		serve = func() error { return server.Serve(listener) }
 	}
@@ -282,7 +299,7 @@ func (s *HTTPServiceImpl) startOne(config conf.HTTPServerSourceConfig) error {
 		server.Close()
 	}()
 
-	err := serve()
+	err = serve()
 	if err == http.ErrServerClosed {
 		return nil
 	}
@@ -311,9 +328,58 @@ func releaseBody(buf **bytebufferpool.ByteBuffer) {
 	}
 }
 
-func (s *HTTPServiceImpl) handler(config conf.HTTPServerSourceConfig) func(http.ResponseWriter, *http.Request) {
+// allowedRequest applies the access rules of the source to the client of a request.
+func allowedRequest(policy *acl.Policy, r *http.Request, client string) bool {
+	if !policy.AllowedIP(net.ParseIP(client)) {
+		base.CountRejectedClient(base.HTTPServer, client, "address")
+		return false
+	}
+	if !policy.ChecksCertificates() {
+		return true
+	}
+	var cert *x509.Certificate
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert = r.TLS.PeerCertificates[0]
+	}
+	if !policy.AllowedCertificate(cert) {
+		base.CountRejectedClient(base.HTTPServer, client, "certificate")
+		return false
+	}
+	return true
+}
+
+// admitRequest applies the rate limits of the source to the messages of a
+// request. When the request is refused, it writes the response and returns
+// false.
+func admitRequest(policy *acl.Policy, w http.ResponseWriter, client string, nb int, size int) bool {
+	wait, ok := policy.Admit(client, nb, size)
+	if ok {
+		if wait > 0 {
+			base.CountRateLimited(base.HTTPServer, client, acl.Slow.String())
+			time.Sleep(wait)
+		}
+		return true
+	}
+	base.CountRateLimited(base.HTTPServer, client, policy.Action.String())
+	if policy.Action == acl.Close {
+		w.Header().Set("Connection", "close")
+	}
+	w.WriteHeader(http.StatusTooManyRequests)
+	return false
+}
+
+func (s *HTTPServiceImpl) handler(config conf.HTTPServerSourceConfig, policy *acl.Policy) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		base.CountClientConnection(base.HTTPServer, r.RemoteAddr, config.Port, "")
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if !allowedRequest(policy, r, client) {
+			s.logger.Info("Rejected client", "client", client)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
 		bodyBuf, err := getBody(r.Body, w, config.MaxBodySize)
 		if err != nil {
 			s.logger.Warn("Error reading request body", "error", err)
@@ -343,6 +409,10 @@ func (s *HTTPServiceImpl) handler(config conf.HTTPServerSourceConfig) func(http.
 				return
 			}
 
+			if !admitRequest(policy, w, client, 1, len(tmp)) {
+				return
+			}
+
 			tracker := s.addTracker(1, func() { w.WriteHeader(http.StatusCreated) }, func() { w.WriteHeader(http.StatusBadRequest) })
 			defer s.removeTracker(tracker.connID)
 
@@ -397,6 +467,10 @@ func (s *HTTPServiceImpl) handler(config conf.HTTPServerSourceConfig) func(http.
 			return
 		}
 
+		if !admitRequest(policy, w, client, len(byteMsgs), bodyBuf.Len()) {
+			return
+		}
+
 		tracker := s.addTracker(int64(len(byteMsgs)), func() { w.WriteHeader(http.StatusCreated) }, func() { w.WriteHeader(http.StatusBadRequest) })
 		defer s.removeTracker(tracker.connID)
 
@@ -10,6 +10,7 @@ import (
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/looplab/fsm"
@@ -22,6 +23,7 @@ import (
 	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/services/base"
 	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/acl"
 	"github.com/stephane-martin/skewer/utils/eerrors"
 	"github.com/stephane-martin/skewer/utils/queue/intq"
 	"github.com/stephane-martin/skewer/utils/queue/tcp"
@@ -79,10 +81,11 @@ const (
 )
 
 type ackForwarder struct {
-	succ sync.Map
-	fail sync.Map
-	comm sync.Map
-	next uint32
+	succ    sync.Map
+	fail    sync.Map
+	comm    sync.Map
+	pending sync.Map
+	next    uint32
 }
 
 func newAckForwarder() *ackForwarder {
@@ -110,10 +113,29 @@ func bytes2txnr(b []byte) int32 {
 
 func (f *ackForwarder) Received(connID utils.MyULID, txnr int32) {
 	if c, ok := f.comm.Load(connID); ok {
-		_ = c.(*intq.Ring).Put(txnr)
+		if c.(*intq.Ring).Put(txnr) == nil {
+			if p, ok := f.pending.Load(connID); ok {
+				atomic.AddInt64(p.(*int64), 1)
+			}
+		}
 	}
 }
 
+// Answered records that the response to a transaction has been sent.
+func (f *ackForwarder) Answered(connID utils.MyULID) {
+	if p, ok := f.pending.Load(connID); ok {
+		atomic.AddInt64(p.(*int64), -1)
+	}
+}
+
+// Pending returns the number of transactions that have not been answered.
+func (f *ackForwarder) Pending(connID utils.MyULID) int64 {
+	if p, ok := f.pending.Load(connID); ok {
+		return atomic.LoadInt64(p.(*int64))
+	}
+	return 0
+}
+
 func (f *ackForwarder) NextToCommit(connID utils.MyULID) int32 {
 	if c, ok := f.comm.Load(connID); ok {
 		next, err := c.(*intq.Ring).Poll(time.Nanosecond)
@@ -189,6 +211,7 @@ func (f *ackForwarder) AddConn(qsize uint64) utils.MyULID {
 	f.succ.Store(connID, intq.NewRing(qsize))
 	f.fail.Store(connID, intq.NewRing(qsize))
 	f.comm.Store(connID, intq.NewRing(qsize))
+	f.pending.Store(connID, new(int64))
 	return connID
 }
 
@@ -202,12 +225,14 @@ func (f *ackForwarder) RemoveConn(connID utils.MyULID) {
 		f.fail.Delete(connID)
 	}
 	f.comm.Delete(connID)
+	f.pending.Delete(connID)
 }
 
 func (f *ackForwarder) RemoveAll() {
 	f.succ = sync.Map{}
 	f.fail = sync.Map{}
 	f.comm = sync.Map{}
+	f.pending = sync.Map{}
 }
 
 type meta struct {
@@ -228,6 +253,7 @@ type RelpService struct {
 	configs        map[utils.MyULID]conf.RELPSourceConfig
 	forwarder      *ackForwarder
 	parserEnv      *decoders.ParsersEnv
+	relpDrainer
 }
 
 func NewRelpService(env *base.ProviderEnv) (base.Provider, error) {
@@ -244,6 +270,7 @@ func NewRelpService(env *base.ProviderEnv) (base.Provider, error) {
 	s.StreamingService.BaseService.Binder = env.Binder
 	s.StreamingService.handler = RelpHandler{Server: &s}
 	s.StreamingService.confined = env.Confined
+	s.StreamingService.typ = base.RELP
 	return &s, nil
 }
 
@@ -275,6 +302,8 @@ func (s *RelpService) Start() ([]model.ListenerInfo, error) {
 	}
 	s.Logger.Info("Listening on RELP", "nb_services", len(infos))
 
+	s.resetDrainer()
+
 	s.configs = make(map[utils.MyULID]conf.RELPSourceConfig, len(s.UnixListeners)+len(s.TCPListeners))
 	for _, l := range s.UnixListeners {
 		s.configs[l.Conf.ConfID] = conf.RELPSourceConfig(l.Conf)
@@ -307,6 +336,7 @@ func (s *RelpService) Start() ([]model.ListenerInfo, error) {
 
 func (s *RelpService) Stop() {
 	s.resetTCPListeners() // makes the listeners stop
+	s.drain(relpDrainTimeout, s.Logger)
 	s.CloseConnections()
 	// no more message will arrive in rawMessagesQueue
 	if s.rawQ != nil {
@@ -450,12 +480,14 @@ func (s *RelpService) handleResponses(conn net.Conn, connID utils.MyULID, client
 				err = writeSuccess(conn, next)
 				if err == nil {
 					successes[next] = false
+					s.forwarder.Answered(connID)
 					countRelpAnswer(client, 200)
 				}
 			} else if failures[next] {
 				err = writeFailure(conn, next)
 				if err == nil {
 					failures[next] = false
+					s.forwarder.Answered(connID)
 					countRelpAnswer(client, 500)
 				}
 			} else {
@@ -485,6 +517,9 @@ func (h RelpHandler) HandleConnection(conn net.Conn, c conf.TCPSourceConfig) (er
 	s := h.Server
 	s.AddConnection(conn)
 	connID := s.forwarder.AddConn(s.ACKQueueSize)
+	dconn := &drainableConn{Conn: conn}
+	s.addDrainable(connID, dconn)
+	defer s.removeDrainable(connID)
 	props := eprops(conn)
 	l := makeLogger(s.Logger, props, "relp")
 	l.Info("New client")
@@ -509,7 +544,14 @@ func (h RelpHandler) HandleConnection(conn net.Conn, c conf.TCPSourceConfig) (er
 			s.RemoveConnection(conn)
 			wg.Done()
 		}()
-		e := scan(l, s.forwarder, s.rawQ, conn, config.Timeout, config.ConfID, connID, s.MaxMessageSize, config.DecoderBaseConfig, props)
+		e := scan(l, s.forwarder, s.rawQ, dconn, config.Timeout, config.ConfID, connID, s.MaxMessageSize, config.MaxWindow, config.DecoderBaseConfig, props, s.policy(config.ConfID))
+		if dconn.isDrained() {
+			// the service is stopping: the client resends the
+			// unanswered transactions after it has reconnected
+			s.closeDrained(s.forwarder, connID, conn)
+			l.Debug("RELP session has been drained")
+			return
+		}
 		if e != nil && !eerrors.HasFileClosed(e) {
 			err = eerrors.Wrap(e, "RELP scanning error")
 		}
@@ -519,14 +561,15 @@ func (h RelpHandler) HandleConnection(conn net.Conn, c conf.TCPSourceConfig) (er
 	return err
 }
 
-func scan(l log15.Logger, f *ackForwarder, rawq *tcp.Ring, c net.Conn, tout time.Duration, cfid, cnid utils.MyULID, msiz int, dc conf.DecoderBaseConfig, props tcpProps) (err error) {
+func scan(l log15.Logger, f *ackForwarder, rawq *tcp.Ring, c net.Conn, tout time.Duration, cfid, cnid utils.MyULID, msiz int, window int, dc conf.DecoderBaseConfig, props tcpProps, policy *acl.Policy) (err error) {
 	var previous = int32(-1)
 	var command string
 	var txnr int32
 	var splits [][]byte
 	var data []byte
 
-	machine := newMachine(l, f, rawq, c, cfid, cnid, msiz, dc, props)
+	session := &relpSession{}
+	machine := newMachine(l, f, rawq, c, session, cfid, cnid, msiz, dc, props)
 
 	if tout > 0 {
 		_ = c.SetReadDeadline(time.Now().Add(tout))
@@ -553,6 +596,39 @@ func scan(l log15.Logger, f *ackForwarder, rawq *tcp.Ring, c net.Conn, tout time
 			data = bytes.TrimSpace(splits[2])
 		}
 
+		if command == "syslog" && machine.Is("opened") {
+			// negotiate always agrees on syslog: only the window can refuse
+			// the transaction
+			if window > 0 && f.Pending(cnid) >= int64(window) {
+				// the client will get a negative answer for the message
+				countRelpProtocolError(props.Client)
+				l.Warn("Refused RELP transaction", "txnr", txnr, "command", command, "reason", "window exceeded")
+				f.Received(cnid, txnr)
+				f.ForwardFail(cnid, txnr)
+				if tout > 0 {
+					_ = c.SetReadDeadline(time.Now().Add(tout))
+				}
+				continue
+			}
+		}
+
+		if command == "syslog" && len(data) > 0 {
+			var admitted bool
+			admitted, err = admit(policy, base.RELP, props.Client, len(data))
+			if err != nil {
+				return err
+			}
+			if !admitted {
+				// the client will get a negative answer for the message
+				f.Received(cnid, txnr)
+				f.ForwardFail(cnid, txnr)
+				if tout > 0 {
+					_ = c.SetReadDeadline(time.Now().Add(tout))
+				}
+				continue
+			}
+		}
+
 		err = machine.Event(command, txnr, data)
 		if err != nil {
 			switch err.(type) {
@@ -565,6 +641,9 @@ func scan(l log15.Logger, f *ackForwarder, rawq *tcp.Ring, c net.Conn, tout time
 			case fsm.InternalError:
 				countRelpProtocolError(props.Client)
 				return eerrors.Wrap(err, "Internal RELP state machine error")
+			case fsm.CanceledError:
+				countRelpProtocolError(props.Client)
+				return eerrors.Wrap(err.(fsm.CanceledError).Err, "RELP session refused")
 			case fsm.NoTransitionError:
 				// syslog does not change opened/closed state
 				// nothing to do
@@ -586,7 +665,7 @@ func scan(l log15.Logger, f *ackForwarder, rawq *tcp.Ring, c net.Conn, tout time
 	return err
 }
 
-func newMachine(l log15.Logger, fwder *ackForwarder, rawq *tcp.Ring, conn io.Writer, confID, connID utils.MyULID, msiz int, dc conf.DecoderBaseConfig, props tcpProps) *fsm.FSM {
+func newMachine(l log15.Logger, fwder *ackForwarder, rawq *tcp.Ring, conn io.Writer, session *relpSession, confID, connID utils.MyULID, msiz int, dc conf.DecoderBaseConfig, props tcpProps) *fsm.FSM {
 	factory := makeRawTCPFactory(props, confID, dc)
 	// TODO: PERF: fsm protects internal variables (states, events) with mutexes. We don't really need the mutexes here.
 	return fsm.NewFSM(
@@ -626,11 +705,19 @@ func newMachine(l log15.Logger, fwder *ackForwarder, rawq *tcp.Ring, conn io.Wri
 				l.Debug("Received 'close' command")
 				e.Err = io.EOF
 			},
-			"enter_opened": func(e *fsm.Event) {
+			"before_open": func(e *fsm.Event) {
 				txnr := e.Args[0].(int32)
 				data := e.Args[1].([]byte)
-				fmt.Fprintf(conn, "%d rsp %d 200 OK\n%s\n", txnr, len(data)+7, string(data))
 				l.Debug("Received 'open' command")
+				answer, err := session.negotiate(data)
+				if err != nil {
+					answer = []byte(fmt.Sprintf("500 %s", err.Error()))
+					fmt.Fprintf(conn, "%d rsp %d %s\n0 serverclose 0\n", txnr, len(answer), answer)
+					e.Cancel(err)
+					return
+				}
+				l.Debug("RELP session is opened", "relp_version", session.version, "relp_software", session.software)
+				fmt.Fprintf(conn, "%d rsp %d %s\n", txnr, len(answer), answer)
 			},
 		},
 	)
@@ -0,0 +1,213 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/queue/tcp"
+	"github.com/stretchr/testify/assert"
+)
+
+// the open offers sent by rsyslog omrelp (librelp)
+const omrelpOffers = "relp_version=0\nrelp_software=librelp,1.2.16,http://librelp.adiscon.com\ncommands=syslog"
+
+func TestRelpNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		offers string
+		answer string
+		err    bool
+	}{
+		{"omrelp", omrelpOffers, "200 OK\nrelp_version=0\nrelp_software=skewer\ncommands=syslog", false},
+		{"newer version", "relp_version=1\ncommands=syslog", "200 OK\nrelp_version=0\nrelp_software=skewer\ncommands=syslog", false},
+		{"unknown commands", "relp_version=0\ncommands=foo,syslog,bar", "200 OK\nrelp_version=0\nrelp_software=skewer\ncommands=syslog", false},
+		{"no commands offer", "relp_version=0", "200 OK\nrelp_version=0\nrelp_software=skewer\ncommands=syslog", false},
+		{"unknown offer", "relp_version=0\nfoo\ncommands=syslog", "200 OK\nrelp_version=0\nrelp_software=skewer\ncommands=syslog", false},
+		{"no version", "commands=syslog", "", true},
+		{"bad version", "relp_version=x\ncommands=syslog", "", true},
+		{"no supported command", "relp_version=0\ncommands=foo", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := &relpSession{}
+			answer, err := session.negotiate([]byte(test.offers))
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, test.answer, string(answer))
+			assert.True(t, session.commands["syslog"])
+		})
+	}
+}
+
+func relpFrame(txnr int, command string, data string) string {
+	if len(data) == 0 {
+		return fmt.Sprintf("%d %s 0\n", txnr, command)
+	}
+	return fmt.Sprintf("%d %s %d %s\n", txnr, command, len(data), data)
+}
+
+type relpResult struct {
+	output string
+	f      *ackForwarder
+	connID utils.MyULID
+	rawq   *tcp.Ring
+}
+
+// relpTranscript plays the client side of a RELP session against scan, and
+// returns what the server has written.
+func relpTranscript(t *testing.T, window int, frames ...string) relpResult {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	res := relpResult{f: newAckForwarder(), rawq: tcp.NewRing(16)}
+	res.connID = res.f.AddConn(16)
+	server, client := net.Pipe()
+
+	output := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(client)
+		output <- b
+	}()
+	done := make(chan struct{})
+	go func() {
+		_ = scan(logger, res.f, res.rawq, server, 0, res.connID, res.connID, 0, window, conf.DecoderBaseConfig{Format: "rfc5424"}, tcpProps{Client: "test"}, nil)
+		_ = server.Close()
+		close(done)
+	}()
+	for _, frame := range frames {
+		_, err := client.Write([]byte(frame))
+		if err != nil {
+			// the server has closed the session
+			break
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scan has not returned")
+	}
+	res.output = string(<-output)
+	return res
+}
+
+const testRelpMessage = "<13>1 2018-01-01T00:00:00Z host app - - - hello"
+
+const testRelpAnswer = "200 OK\nrelp_version=0\nrelp_software=skewer\ncommands=syslog"
+
+func TestRelpTranscriptOmrelp(t *testing.T) {
+	res := relpTranscript(
+		t, 0,
+		relpFrame(1, "open", omrelpOffers),
+		relpFrame(2, "syslog", testRelpMessage),
+		relpFrame(3, "syslog", testRelpMessage),
+		relpFrame(4, "close", ""),
+	)
+	assert.Equal(t, fmt.Sprintf("1 rsp %d %s\n4 rsp 0\n0 serverclose 0\n", len(testRelpAnswer), testRelpAnswer), res.output)
+	assert.Equal(t, uint64(2), res.rawq.Len())
+	assert.Equal(t, int64(2), res.f.Pending(res.connID))
+}
+
+func TestRelpTranscriptRefusedOpen(t *testing.T) {
+	res := relpTranscript(
+		t, 0,
+		relpFrame(1, "open", "relp_software=foo\ncommands=syslog"),
+		relpFrame(2, "syslog", testRelpMessage),
+	)
+	answer := "500 relp_version offer is missing"
+	assert.Equal(t, fmt.Sprintf("1 rsp %d %s\n0 serverclose 0\n", len(answer), answer), res.output)
+	assert.Equal(t, uint64(0), res.rawq.Len())
+}
+
+func TestRelpTranscriptWindow(t *testing.T) {
+	res := relpTranscript(
+		t, 2,
+		relpFrame(1, "open", omrelpOffers),
+		relpFrame(2, "syslog", testRelpMessage),
+		relpFrame(3, "syslog", testRelpMessage),
+		relpFrame(4, "syslog", testRelpMessage),
+		relpFrame(5, "close", ""),
+	)
+	assert.True(t, bytes.HasSuffix([]byte(res.output), []byte("5 rsp 0\n0 serverclose 0\n")))
+	// the third transaction exceeds the window: it is not processed and
+	// gets a negative answer
+	assert.Equal(t, uint64(2), res.rawq.Len())
+	succ, fail := res.f.GetSuccAndFail(res.connID)
+	assert.Equal(t, int32(-1), succ)
+	assert.Equal(t, int32(4), fail)
+}
+
+func TestRelpDrain(t *testing.T) {
+	initRelpRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	f := newAckForwarder()
+	connID := f.AddConn(16)
+	rawq := tcp.NewRing(16)
+	server, client := net.Pipe()
+	d := &relpDrainer{}
+	dconn := &drainableConn{Conn: server}
+	d.addDrainable(connID, dconn)
+
+	output := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(client)
+		output <- b
+	}()
+	go func() {
+		defer d.removeDrainable(connID)
+		_ = scan(logger, f, rawq, dconn, 0, connID, connID, 0, 0, conf.DecoderBaseConfig{Format: "rfc5424"}, tcpProps{Client: "test"}, nil)
+		if dconn.isDrained() {
+			d.closeDrained(f, connID, server)
+		}
+		_ = server.Close()
+	}()
+	_, err := client.Write([]byte(relpFrame(1, "open", omrelpOffers) + relpFrame(2, "syslog", testRelpMessage)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); f.Pending(connID) != 1; {
+		if time.Now().After(deadline) {
+			t.Fatal("the transaction was not received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		d.drain(5*time.Second, logger)
+		close(drained)
+	}()
+	// the pending transaction must be answered before the session closes
+	select {
+	case <-drained:
+		t.Fatal("drain has not waited for the pending transaction")
+	case <-time.After(100 * time.Millisecond):
+	}
+	f.Answered(connID)
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain has not returned")
+	}
+	out := string(<-output)
+	assert.Equal(t, fmt.Sprintf("1 rsp %d %s\n0 serverclose 0\n", len(testRelpAnswer), testRelpAnswer), out)
+	assert.Equal(t, uint64(1), rawq.Len())
+
+	// a connection that arrives while draining is drained right away
+	late := &drainableConn{Conn: server}
+	d.addDrainable(utils.NewUid(), late)
+	assert.True(t, late.isDrained())
+}
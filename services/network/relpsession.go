@@ -0,0 +1,228 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// http://www.rsyslog.com/doc/relp.html
+
+const (
+	relpVersion  = 0
+	relpSoftware = "skewer"
+)
+
+// relpCommands lists the RELP commands that the server supports, besides
+// open and close.
+var relpCommands = []string{"syslog"}
+
+// relpOffer is an offer of the RELP open command, like relp_version=0.
+type relpOffer struct {
+	Name  string
+	Value string
+}
+
+// parseRelpOffers parses the data of the RELP open command. There is one
+// offer per line. The value of the offer is optional.
+func parseRelpOffers(data []byte) (offers []relpOffer) {
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		parts := bytes.SplitN(line, []byte{'='}, 2)
+		offer := relpOffer{Name: string(bytes.TrimSpace(parts[0]))}
+		if len(parts) == 2 {
+			offer.Value = string(bytes.TrimSpace(parts[1]))
+		}
+		offers = append(offers, offer)
+	}
+	return offers
+}
+
+// relpSession holds the parameters that the client and the server agreed on
+// when the session was opened.
+type relpSession struct {
+	version  int
+	software string
+	commands map[string]bool
+}
+
+// negotiate answers the offers of the RELP open command. It returns the
+// data of the 200 response, or an error when the session can not be opened.
+func (s *relpSession) negotiate(data []byte) ([]byte, error) {
+	var version, commands, software string
+	var hasVersion, hasCommands bool
+	for _, offer := range parseRelpOffers(data) {
+		switch offer.Name {
+		case "relp_version":
+			version, hasVersion = offer.Value, true
+		case "commands":
+			commands, hasCommands = offer.Value, true
+		case "relp_software":
+			software = offer.Value
+		default:
+			// unknown offers are ignored
+		}
+	}
+	if !hasVersion {
+		return nil, eerrors.New("relp_version offer is missing")
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil || v < 0 {
+		return nil, eerrors.Errorf("invalid relp_version: '%s'", version)
+	}
+	// the session uses the lowest of the versions
+	if v > relpVersion {
+		v = relpVersion
+	}
+
+	s.version = v
+	s.software = software
+	s.commands = make(map[string]bool, len(relpCommands))
+	if hasCommands {
+		for _, command := range strings.Split(commands, ",") {
+			command = strings.TrimSpace(command)
+			for _, supported := range relpCommands {
+				if command == supported {
+					s.commands[command] = true
+				}
+			}
+		}
+		if len(s.commands) == 0 {
+			return nil, eerrors.Errorf("no supported command in '%s'", commands)
+		}
+	} else {
+		// an old client that does not tell the commands it uses
+		for _, supported := range relpCommands {
+			s.commands[supported] = true
+		}
+	}
+
+	agreed := make([]string, 0, len(s.commands))
+	for _, supported := range relpCommands {
+		if s.commands[supported] {
+			agreed = append(agreed, supported)
+		}
+	}
+	return []byte(fmt.Sprintf(
+		"200 OK\nrelp_version=%d\nrelp_software=%s\ncommands=%s",
+		s.version, relpSoftware, strings.Join(agreed, ","),
+	)), nil
+}
+
+// relpDrainTimeout bounds the time given to the RELP clients to get the
+// answers to their pending transactions when the service stops. The
+// controller kills a plugin that does not stop within 5 seconds.
+const relpDrainTimeout = 3 * time.Second
+
+// drainableConn is a RELP client connection that can be told to stop
+// reading new transactions.
+type drainableConn struct {
+	net.Conn
+	mu      sync.Mutex
+	drained bool
+}
+
+func (c *drainableConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.drained {
+		return nil
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+// drain interrupts the pending read of the connection.
+func (c *drainableConn) drain() {
+	c.mu.Lock()
+	c.drained = true
+	_ = c.Conn.SetReadDeadline(time.Now())
+	c.mu.Unlock()
+}
+
+func (c *drainableConn) isDrained() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.drained
+}
+
+// relpDrainer tracks the RELP client connections, so that the sessions can
+// be closed cleanly with a serverclose command when the service stops.
+type relpDrainer struct {
+	drainMu       sync.Mutex
+	draining      bool
+	drainDeadline time.Time
+	drainables    map[utils.MyULID]*drainableConn
+}
+
+func (d *relpDrainer) resetDrainer() {
+	d.drainMu.Lock()
+	d.draining = false
+	d.drainables = make(map[utils.MyULID]*drainableConn)
+	d.drainMu.Unlock()
+}
+
+// drain stops reading new transactions from the clients. The transactions
+// that have already been received are answered, then the clients are asked
+// to reconnect with a serverclose command.
+func (d *relpDrainer) drain(timeout time.Duration, logger log15.Logger) {
+	deadline := time.Now().Add(timeout)
+	d.drainMu.Lock()
+	d.draining = true
+	d.drainDeadline = deadline
+	for _, c := range d.drainables {
+		c.drain()
+	}
+	d.drainMu.Unlock()
+
+	for time.Now().Before(deadline) {
+		d.drainMu.Lock()
+		remaining := len(d.drainables)
+		d.drainMu.Unlock()
+		if remaining == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	logger.Warn("Some RELP sessions have not been drained")
+}
+
+func (d *relpDrainer) addDrainable(connID utils.MyULID, c *drainableConn) {
+	d.drainMu.Lock()
+	if d.drainables == nil {
+		d.drainables = make(map[utils.MyULID]*drainableConn)
+	}
+	d.drainables[connID] = c
+	if d.draining {
+		c.drain()
+	}
+	d.drainMu.Unlock()
+}
+
+func (d *relpDrainer) removeDrainable(connID utils.MyULID) {
+	d.drainMu.Lock()
+	delete(d.drainables, connID)
+	d.drainMu.Unlock()
+}
+
+// closeDrained waits until the received transactions of a drained
+// connection have been answered, then sends the serverclose command.
+func (d *relpDrainer) closeDrained(f *ackForwarder, connID utils.MyULID, c net.Conn) {
+	d.drainMu.Lock()
+	deadline := d.drainDeadline
+	d.drainMu.Unlock()
+	for f.Pending(connID) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, _ = fmt.Fprint(c, "0 serverclose 0\n")
+}
@@ -2,14 +2,18 @@ package network
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/stephane-martin/skewer/conf"
 	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/services/base"
 	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/acl"
 	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stephane-martin/skewer/utils/proxyproto"
 )
 
 type StreamHandler interface {
@@ -37,6 +41,8 @@ type StreamingService struct {
 	wgroup         sync.WaitGroup
 	MaxMessageSize int
 	confined       bool
+	typ            base.Types
+	policies       map[utils.MyULID]*acl.Policy
 }
 
 func (s *StreamingService) init() {
@@ -44,13 +50,21 @@ func (s *StreamingService) init() {
 	s.TCPListeners = []TCPListenerConf{}
 	s.UnixListeners = []UnixListenerConf{}
 	s.SourceConfigs = []conf.TCPSourceConfig{}
+	s.policies = map[utils.MyULID]*acl.Policy{}
 }
 
 func (s *StreamingService) initTCPListeners() []model.ListenerInfo {
 	s.ClearConnections()
 	s.TCPListeners = []TCPListenerConf{}
 	s.UnixListeners = []UnixListenerConf{}
+	s.policies = map[utils.MyULID]*acl.Policy{}
 	for _, syslogConf := range s.SourceConfigs {
+		policy, err := syslogConf.AccessControlConfig.Policy()
+		if err != nil {
+			s.Logger.Warn("Invalid access rules", "error", err)
+			continue
+		}
+		s.policies[syslogConf.ConfID] = policy
 		if len(syslogConf.UnixSocketPath) > 0 {
 			l, err := s.Binder.Listen("unix", syslogConf.UnixSocketPath)
 			if err != nil {
@@ -62,7 +76,6 @@ func (s *StreamingService) initTCPListeners() []model.ListenerInfo {
 					Conf:     syslogConf,
 				}
 				s.UnixListeners = append(s.UnixListeners, lc)
-				s.UnixSocketPaths = append(s.UnixSocketPaths, syslogConf.UnixSocketPath)
 			}
 		} else {
 			listenAddrs, _ := syslogConf.GetListenAddrs()
@@ -77,6 +90,10 @@ func (s *StreamingService) initTCPListeners() []model.ListenerInfo {
 				if err != nil {
 					s.Logger.Warn("Error listening on stream (TCP or RELP)", "listen_addr", listenAddr, "error", err)
 				} else {
+					if syslogConf.ProxyProtocol {
+						// the client address is given by the PROXY header
+						l = proxyproto.NewListener(l, syslogConf.Timeout)
+					}
 					s.Logger.Debug("Listener", "protocol", "stream", "addr", listenAddr, "format", syslogConf.Format)
 					lc := TCPListenerConf{
 						Listener: l,
@@ -119,6 +136,64 @@ func (s *StreamingService) handleConnection(conn net.Conn, config conf.TCPSource
 	return s.handler.HandleConnection(conn, config)
 }
 
+func (s *StreamingService) policy(confID utils.MyULID) *acl.Policy {
+	return s.policies[confID]
+}
+
+// checkClient applies the access rules of the source to a new connection.
+// When the client certificate has to be checked, the TLS handshake is done
+// here.
+func (s *StreamingService) checkClient(conn net.Conn, config conf.TCPSourceConfig) error {
+	policy := s.policy(config.ConfID)
+	client := eprops(conn).Client
+	if !policy.AllowedAddr(conn.RemoteAddr()) {
+		base.CountRejectedClient(s.typ, client, "address")
+		return eerrors.Errorf("Client address is not allowed: '%s'", client)
+	}
+	if !policy.ChecksCertificates() {
+		return nil
+	}
+	var cert *x509.Certificate
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if config.Timeout > 0 {
+			_ = conn.SetDeadline(time.Now().Add(config.Timeout))
+		}
+		err := tlsConn.Handshake()
+		if err != nil {
+			return eerrors.Wrap(err, "TLS handshake error")
+		}
+		_ = conn.SetDeadline(time.Time{})
+		certs := tlsConn.ConnectionState().PeerCertificates
+		if len(certs) > 0 {
+			cert = certs[0]
+		}
+	}
+	if !policy.AllowedCertificate(cert) {
+		base.CountRejectedClient(s.typ, client, "certificate")
+		return eerrors.Errorf("Client certificate is not allowed: '%s'", client)
+	}
+	return nil
+}
+
+// admit applies the rate limits of policy to a message received from
+// client. It returns false when the message must be dropped, and an error
+// when the connection must be closed.
+func admit(policy *acl.Policy, t base.Types, client string, size int) (bool, error) {
+	wait, ok := policy.Admit(client, 1, size)
+	if ok {
+		if wait > 0 {
+			base.CountRateLimited(t, client, acl.Slow.String())
+			time.Sleep(wait)
+		}
+		return true, nil
+	}
+	base.CountRateLimited(t, client, policy.Action.String())
+	if policy.Action == acl.Close {
+		return false, eerrors.Errorf("Rate limit exceeded by client '%s'", client)
+	}
+	return false, nil
+}
+
 func (s *StreamingService) AcceptUnix(lc UnixListenerConf) error {
 	var wg sync.WaitGroup
 	defer wg.Wait()
@@ -131,7 +206,13 @@ func (s *StreamingService) AcceptUnix(lc UnixListenerConf) error {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err := s.handleConnection(conn, lc.Conf)
+			err := s.checkClient(conn, lc.Conf)
+			if err != nil {
+				s.Logger.Info("Rejected client", "error", err)
+				_ = conn.Close()
+				return
+			}
+			err = s.handleConnection(conn, lc.Conf)
 			if err != nil && !eerrors.HasFileClosed(err) {
 				s.Logger.Warn("Unix connection error", "error", err)
 			}
@@ -157,12 +238,23 @@ func (s *StreamingService) AcceptTCP(lc TCPListenerConf) error {
 				continue
 			}
 			tlsConf.ClientAuth = lc.Conf.GetClientAuthType()
+			err = utils.SetFingerprints(tlsConf, lc.Conf.TLSFingerprints, true)
+			if err != nil {
+				s.Logger.Warn("Error setting up TLS fingerprints", "error", err)
+				continue
+			}
 			c = tls.Server(c, tlsConf)
 		}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err := s.handleConnection(c, lc.Conf)
+			err := s.checkClient(c, lc.Conf)
+			if err != nil {
+				s.Logger.Info("Rejected client", "error", err)
+				_ = c.Close()
+				return
+			}
+			err = s.handleConnection(c, lc.Conf)
 			if err != nil && !eerrors.HasFileClosed(err) {
 				s.Logger.Warn("TCP connection error", "error", err)
 			}
@@ -48,6 +48,7 @@ func NewTcpService(env *base.ProviderEnv) (*TcpServiceImpl, error) {
 	s.StreamingService.BaseService.Binder = env.Binder
 	s.StreamingService.handler = tcpHandler{Server: &s}
 	s.StreamingService.confined = env.Confined
+	s.StreamingService.typ = base.TCP
 	return &s, nil
 }
 
@@ -232,6 +233,7 @@ func (h tcpHandler) HandleConnection(conn net.Conn, config conf.TCPSourceConfig)
 	logger := makeLogger(s.Logger, props, "tcp")
 	logger.Info("New client")
 	factory := makeRawTCPFactory(props, config.ConfID, config.DecoderBaseConfig)
+	policy := s.policy(config.ConfID)
 	clientCounter(base.TCP, props)
 
 	timeout := config.Timeout
@@ -240,18 +242,28 @@ func (h tcpHandler) HandleConnection(conn net.Conn, config conf.TCPSourceConfig)
 	}
 	scanner := utils.WithRecover(bufio.NewScanner(conn))
 	scanner.Buffer(make([]byte, 0, s.MaxMessageSize), s.MaxMessageSize)
-	if config.LineFraming {
+	switch config.GetFraming() {
+	case "lf":
 		scanner.Split(makeLFTCPSplit(config.FrameDelimiter))
-	} else {
+	case "octet":
+		scanner.Split(OctetSplit)
+	default:
 		scanner.Split(TcpSplit)
 	}
 
 	for scanner.Scan() {
+		buf := scanner.Bytes()
+		admitted := len(buf) > 0
+		if admitted {
+			admitted, err = admit(policy, base.TCP, props.Client, len(buf))
+			if err != nil {
+				return err
+			}
+		}
 		if timeout > 0 {
 			_ = conn.SetReadDeadline(time.Now().Add(timeout))
 		}
-		buf := scanner.Bytes()
-		if len(buf) == 0 {
+		if !admitted {
 			continue
 		}
 		if s.MaxMessageSize > 0 && len(buf) > s.MaxMessageSize {
@@ -333,6 +345,39 @@ func TcpSplit(data []byte, atEOF bool) (advance int, token []byte, eoferr error)
 
 }
 
+// OctetSplit splits a stream framed by octet counting only, as described
+// in RFC 6587 section 3.4.1 and required by RFC 5425: "MSG-LEN SP SYSLOG-MSG".
+func OctetSplit(data []byte, atEOF bool) (advance int, token []byte, eoferr error) {
+	if atEOF {
+		eoferr = io.EOF
+	}
+	if len(data) == 0 {
+		return 0, nil, eoferr
+	}
+	sp := bytes.IndexByte(data, ' ')
+	if sp == -1 {
+		if len(data) > 10 {
+			return 0, nil, eerrors.New("Octet counting framing: MSG-LEN is too long")
+		}
+		return 0, nil, eoferr
+	}
+	if sp == 0 || sp > 10 || data[0] == '0' {
+		return 0, nil, eerrors.New("Octet counting framing: invalid MSG-LEN")
+	}
+	datalen := 0
+	for _, c := range data[:sp] {
+		if c < '0' || c > '9' {
+			return 0, nil, eerrors.New("Octet counting framing: MSG-LEN is not a number")
+		}
+		datalen = datalen*10 + int(c-'0')
+	}
+	advance = sp + 1 + datalen
+	if len(data) < advance {
+		return 0, nil, eoferr
+	}
+	return advance, data[sp+1 : advance], nil
+}
+
 type tcpProps struct {
 	LocalPort    int
 	LocalPortStr string
@@ -0,0 +1,44 @@
+package network
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOctetSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		tokens []string
+		err    bool
+	}{
+		{name: "one", stream: "5 hello", tokens: []string{"hello"}},
+		{name: "several", stream: "5 hello3 foo11 hello world", tokens: []string{"hello", "foo", "hello world"}},
+		{name: "keep newlines", stream: "6 hello\n2 \n\n", tokens: []string{"hello\n", "\n\n"}},
+		// an incomplete frame at the end of the stream is dropped
+		{name: "truncated", stream: "5 hello10 foo", tokens: []string{"hello"}},
+		{name: "not a number", stream: "<13>1 hello", err: true},
+		{name: "leading zero", stream: "05 hello", err: true},
+		{name: "no length", stream: " hello", err: true},
+		{name: "length too long", stream: "12345678901", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := bufio.NewScanner(strings.NewReader(tt.stream))
+			scanner.Split(OctetSplit)
+			var tokens []string
+			for scanner.Scan() {
+				tokens = append(tokens, scanner.Text())
+			}
+			assert.Equal(t, tt.tokens, tokens)
+			if tt.err {
+				assert.Error(t, scanner.Err())
+			} else {
+				assert.NoError(t, scanner.Err())
+			}
+		})
+	}
+}
@@ -3,17 +3,21 @@ package network
 import (
 	"io"
 	"net"
+	"os"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stephane-martin/skewer/conf"
 	"github.com/stephane-martin/skewer/decoders"
 	"github.com/stephane-martin/skewer/model"
 	"github.com/stephane-martin/skewer/services/base"
+	"github.com/stephane-martin/skewer/sys"
 	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/acl"
 	"github.com/stephane-martin/skewer/utils/eerrors"
 	"github.com/stephane-martin/skewer/utils/queue/udp"
 )
@@ -33,6 +37,8 @@ type UdpServiceImpl struct {
 	fatalOnce        *sync.Once
 	parserEnv        *decoders.ParsersEnv
 	rawMessagesQueue *udp.Ring
+	confined         bool
+	hostname         string
 }
 
 func NewUdpService(env *base.ProviderEnv) (*UdpServiceImpl, error) {
@@ -44,6 +50,8 @@ func NewUdpService(env *base.ProviderEnv) (*UdpServiceImpl, error) {
 	s.BaseService.Init()
 	s.BaseService.Logger = env.Logger.New("class", "UdpServer")
 	s.BaseService.Binder = env.Binder
+	s.confined = env.Confined
+	s.hostname, _ = os.Hostname()
 	return &s, nil
 }
 
@@ -92,6 +100,19 @@ func (s *UdpServiceImpl) ParseOne(raw *model.RawUDPMessage, gen *utils.Generator
 		if syslogMsg == nil {
 			continue
 		}
+		if len(raw.UnixSocketPath) > 0 && len(syslogMsg.HostName) == 0 {
+			// the local programs do not send the hostname
+			syslogMsg.HostName = s.hostname
+		}
+		if raw.HasCreds {
+			pid := strconv.FormatInt(int64(raw.Pid), 10)
+			if len(syslogMsg.ProcId) == 0 {
+				syslogMsg.ProcId = pid
+			}
+			syslogMsg.SetProperty("credentials", "pid", pid)
+			syslogMsg.SetProperty("credentials", "uid", strconv.FormatUint(uint64(raw.Uid), 10))
+			syslogMsg.SetProperty("credentials", "gid", strconv.FormatUint(uint64(raw.Gid), 10))
+		}
 		full := model.FullFactoryFrom(syslogMsg)
 		full.Uid = gen.Uid()
 		full.ConfId = raw.ConfID
@@ -176,9 +197,19 @@ func (s *UdpServiceImpl) Stop() {
 
 func (s *UdpServiceImpl) ListenPacket(c chan model.ListenerInfo) {
 	var wg sync.WaitGroup
-	s.UnixSocketPaths = []string{}
 
 	for _, syslogConf := range s.UdpConfigs {
+		policy, err := syslogConf.AccessControlConfig.Policy()
+		if err != nil {
+			s.Logger.Warn("Invalid access rules", "error", err)
+			continue
+		}
+		// there is no connection to slow down or to close: the packets
+		// over the limits are always dropped. The DTLS sessions keep the
+		// configured action.
+		if !syslogConf.TLSEnabled || len(syslogConf.UnixSocketPath) > 0 {
+			policy.Action = acl.Drop
+		}
 		if len(syslogConf.UnixSocketPath) > 0 {
 			conn, err := s.Binder.ListenPacket("unixgram", syslogConf.UnixSocketPath, 65536)
 			if err != nil {
@@ -195,11 +226,10 @@ func (s *UdpServiceImpl) ListenPacket(c chan model.ListenerInfo) {
 				UnixSocketPath: syslogConf.UnixSocketPath,
 				Protocol:       "udp",
 			}
-			s.UnixSocketPaths = append(s.UnixSocketPaths, syslogConf.UnixSocketPath)
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				err := s.handleConnection(conn, syslogConf)
+				err := s.handleConnection(conn, syslogConf, policy)
 				if err != nil && !eerrors.HasFileClosed(err) {
 					s.Logger.Warn("Unix datagram connection error", "error", err)
 				}
@@ -223,6 +253,7 @@ func (s *UdpServiceImpl) ListenPacket(c chan model.ListenerInfo) {
 					"bind_addr", syslogConf.BindAddr,
 					"port", port,
 					"format", syslogConf.Format,
+					"dtls", syslogConf.TLSEnabled,
 				)
 				c <- model.ListenerInfo{
 					BindAddr: syslogConf.BindAddr,
@@ -232,7 +263,12 @@ func (s *UdpServiceImpl) ListenPacket(c chan model.ListenerInfo) {
 				wg.Add(1)
 				go func() {
 					defer wg.Done()
-					err := s.handleConnection(conn, syslogConf)
+					var err error
+					if syslogConf.TLSEnabled {
+						err = s.handleDTLSConnection(conn, syslogConf, policy)
+					} else {
+						err = s.handleConnection(conn, syslogConf, policy)
+					}
 					if err != nil && !eerrors.HasFileClosed(err) {
 						s.Logger.Warn("UDP connection error", "error", err)
 					}
@@ -244,27 +280,75 @@ func (s *UdpServiceImpl) ListenPacket(c chan model.ListenerInfo) {
 	wg.Wait()
 }
 
-func (s *UdpServiceImpl) handleConnection(conn net.PacketConn, config conf.UDPSourceConfig) (err error) {
-	var localPort int
-	var path string
+// unixMsgConn is a unix datagram socket that can receive the credentials of
+// the senders.
+type unixMsgConn interface {
+	syscall.Conn
+	ReadMsgUnix(b, oob []byte) (n, oobn, flags int, addr *net.UnixAddr, err error)
+}
 
-	s.AddConnection(conn)
-	defer s.RemoveConnection(conn)
-	defer s.Logger.Debug("End of UDP connection")
+// credentialsReader returns a function that reads a datagram together with
+// the credentials of its sender.
+func credentialsReader(conn unixMsgConn) func() (*model.RawUDPMessage, net.Addr, error) {
+	oob := make([]byte, sys.CredentialsOOBSize)
+	return func() (*model.RawUDPMessage, net.Addr, error) {
+		raw := model.RawUDPFactory()
+		n, oobn, _, addr, err := conn.ReadMsgUnix(raw.Message[:], oob)
+		raw.Size = n
+		if err == nil {
+			raw.Pid, raw.Uid, raw.Gid, raw.HasCreds = sys.ParseCredentials(oob[:oobn])
+		}
+		if addr == nil {
+			return raw, nil, err
+		}
+		return raw, addr, err
+	}
+}
 
+// localPacketPort returns the local port of a UDP socket, or the path of a
+// unix datagram socket.
+func localPacketPort(conn net.PacketConn) (localPort int, path string) {
 	local := conn.LocalAddr()
 	if local != nil {
 		l := local.String()
 		s := strings.Split(l, ":")
-		localPort, err = strconv.Atoi(s[len(s)-1])
+		port, err := strconv.Atoi(s[len(s)-1])
 		if err != nil {
 			path = strings.TrimSpace(l)
+		} else {
+			localPort = port
+		}
+	}
+	return localPort, path
+}
+
+func (s *UdpServiceImpl) handleConnection(conn net.PacketConn, config conf.UDPSourceConfig, policy *acl.Policy) (err error) {
+	s.AddConnection(conn)
+	defer s.RemoveConnection(conn)
+	defer s.Logger.Debug("End of UDP connection")
+
+	localPort, path := localPacketPort(conn)
+
+	read := func() (*model.RawUDPMessage, net.Addr, error) {
+		return model.RawUDPFromConn(conn)
+	}
+	if config.PassCredentials {
+		uconn, ok := conn.(unixMsgConn)
+		if ok {
+			err = sys.EnablePassCred(uconn)
+		} else {
+			err = eerrors.New("Not a unix socket")
+		}
+		if err == nil {
+			read = credentialsReader(uconn)
+		} else {
+			s.Logger.Warn("Can not receive the credentials of the senders", "path", path, "error", err)
 		}
 	}
 
 	// Syslog UDP server
 	for {
-		rawmsg, remote, err := model.RawUDPFromConn(conn)
+		rawmsg, remote, err := read()
 		if err != nil {
 			if eerrors.HasFileClosed(err) {
 				return io.EOF
@@ -284,6 +368,16 @@ func (s *UdpServiceImpl) handleConnection(conn net.PacketConn, config conf.UDPSo
 		} else {
 			rawmsg.Client = strings.Split(remote.String(), ":")[0]
 		}
+		if !policy.AllowedAddr(remote) {
+			base.CountRejectedClient(base.UDP, rawmsg.Client, "address")
+			model.RawUDPFree(rawmsg)
+			continue
+		}
+		if _, ok := policy.Admit(rawmsg.Client, 1, rawmsg.Size); !ok {
+			base.CountRateLimited(base.UDP, rawmsg.Client, acl.Drop.String())
+			model.RawUDPFree(rawmsg)
+			continue
+		}
 		err = s.rawMessagesQueue.Put(rawmsg)
 		if err != nil {
 			return eerrors.WithTypes(eerrors.Wrap(err, "Failed to enqueue new raw UDP message"))
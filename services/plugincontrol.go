@@ -35,6 +35,8 @@ var STARTED = []byte("started")
 var STOP = []byte("stop")
 var STOPPED = []byte("stopped")
 var CONF = []byte("conf")
+var SCRIPTS = []byte("scripts")
+var LOOKUPS = []byte("lookups")
 var CONFERROR = []byte("conferror")
 var SHUTDOWN = []byte("shutdown")
 var STARTERROR = []byte("starterror")
@@ -495,6 +497,40 @@ func (s *Controller) listen(secret *memguard.LockedBuffer) chan infosAndError {
 	return startErrorChan
 }
 
+// ReloadScripts gives the new script files to the controlled plugin, that
+// uses them without restarting.
+func (s *Controller) ReloadScripts(scripts map[string]string) error {
+	s.conf.Scripts = scripts
+	s.startedMu.Lock()
+	started := s.started
+	s.startedMu.Unlock()
+	if !started {
+		return nil
+	}
+	b, err := json.Marshal(scripts)
+	if err != nil {
+		return eerrors.Wrap(err, "Error serializing scripts")
+	}
+	return eerrors.Wrapf(s.W(SCRIPTS, b), "Error sending scripts to plugin '%s'", s.name)
+}
+
+// ReloadLookups gives the digests of the new lookup files to the controlled
+// plugin, that reads them again without restarting.
+func (s *Controller) ReloadLookups(lookups map[string]string) error {
+	s.conf.Lookups = lookups
+	s.startedMu.Lock()
+	started := s.started
+	s.startedMu.Unlock()
+	if !started {
+		return nil
+	}
+	b, err := json.Marshal(lookups)
+	if err != nil {
+		return eerrors.Wrap(err, "Error serializing lookup files")
+	}
+	return eerrors.Wrapf(s.W(LOOKUPS, b), "Error sending lookup files to plugin '%s'", s.name)
+}
+
 // Start asks the controlled plugin to start the operations.
 func (s *Controller) Start() (infos []model.ListenerInfo, err error) {
 	s.createdMu.Lock()
@@ -749,6 +785,7 @@ func (s *Controller) Create(optsfuncs ...func(*PluginCreateOpts)) error {
 			err = s.cmd.Namespaced().
 				Dumpable(opts.dumpable).
 				StorePath(opts.storePath).
+				ConfPath(opts.confDir).
 				FileDestTemplate(opts.fileDestTmpl).
 				CertFiles(opts.certFiles).
 				CertPaths(opts.certPaths).
@@ -6,11 +6,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"sync"
 
+	"github.com/awnumar/memguard"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/enrich"
+	"github.com/stephane-martin/skewer/javascript"
 	"github.com/stephane-martin/skewer/services/base"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
@@ -31,6 +36,29 @@ func Wout(header []byte, msg []byte) (err error) {
 	return eerrors.Wrap(err, "error writing to stdout of plugin provider")
 }
 
+// maxCommandSize bounds the size of the commands that a plugin receives. The
+// configuration is one command, with the scripts.
+const maxCommandSize = 64 * 1024 * 1024
+
+// commandScanner returns a scanner of the signed commands that the controller
+// writes to r.
+func commandScanner(ctx context.Context, r io.Reader, signpubkey *memguard.LockedBuffer) *utils.RecoverScanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 65536), maxCommandSize)
+	s := utils.WithRecover(utils.WithContext(ctx, scanner))
+	s.Split(utils.MakeSignSplit(signpubkey))
+	return s
+}
+
+// lookupDir returns the directory of the lookup files. The confined plugins
+// see the configuration directory under /tmp/conf.
+func lookupDir(c conf.BaseConfig, confined bool) string {
+	if confined && len(c.LookupDir) > 0 {
+		return filepath.Join("/tmp", "conf", c.LookupDir)
+	}
+	return c.LookupDir
+}
+
 func Launch(ctx context.Context, typ base.Types, opts ...ProviderOpt) (err error) {
 	name := base.Types2Names[typ]
 
@@ -71,8 +99,7 @@ func Launch(ctx context.Context, typ base.Types, opts ...ProviderOpt) (err error
 		return err
 	}
 
-	scanner := utils.WithRecover(utils.WithContext(fatalctx, bufio.NewScanner(os.Stdin)))
-	scanner.Split(utils.MakeSignSplit(signpubkey))
+	scanner := commandScanner(fatalctx, os.Stdin, signpubkey)
 
 	for scanner.Scan() {
 		parts := bytes.SplitN(scanner.Bytes(), space, 2)
@@ -153,10 +180,35 @@ func Launch(ctx context.Context, typ base.Types, opts ...ProviderOpt) (err error
 			if err == nil {
 				globalConf = c
 				hasConf = true
+				javascript.SetScripts(c.Scripts)
+				enrich.SetFiles(lookupDir(c, env.Confined), c.Lookups)
 			} else {
 				_ = Wout(CONFERROR, []byte(err.Error()))
 				return err
 			}
+		case "scripts":
+			// the script files have changed: the JS environments are
+			// recreated, the service is not restarted
+			scripts := map[string]string{}
+			err = json.Unmarshal(parts[1], &scripts)
+			if err != nil {
+				_ = Wout(CONFERROR, []byte(err.Error()))
+				return err
+			}
+			globalConf.Scripts = scripts
+			javascript.SetScripts(scripts)
+			env.Logger.Info("The scripts have been reloaded", "type", name)
+		case "lookups":
+			// the lookup files have changed: the enrichers are recreated
+			lookups := map[string]string{}
+			err = json.Unmarshal(parts[1], &lookups)
+			if err != nil {
+				_ = Wout(CONFERROR, []byte(err.Error()))
+				return err
+			}
+			globalConf.Lookups = lookups
+			enrich.SetFiles(lookupDir(globalConf, env.Confined), lookups)
+			env.Logger.Info("The lookup files have been reloaded", "type", name)
 		case "gathermetrics":
 			families, err := svc.Gather()
 			if err != nil {
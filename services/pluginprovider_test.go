@@ -0,0 +1,65 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/awnumar/memguard"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+)
+
+// signed returns a command, in the format of utils.SigWriter. The private key
+// stays in the Go heap, as ed25519 can not sign with a memguard buffer.
+func signed(priv ed25519.PrivateKey, header string, message []byte) []byte {
+	p := append([]byte(header+" "), message...)
+	signature := ed25519.Sign(priv, p)
+	b := []byte(fmt.Sprintf("%010d %010d ", len(p), len(signature)))
+	b = append(b, p...)
+	return append(b, signature...)
+}
+
+func TestCommandScannerLargeConf(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkey, err := memguard.NewImmutableFromBytes(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := conf.BaseConfig{Lookups: map[string]string{}}
+	for i := 0; i < 2000; i++ {
+		c.Lookups[fmt.Sprintf("tables/%04d.csv", i)] = strings.Repeat("a", 64)
+	}
+	cb, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, len(cb) > 64*1024)
+
+	var buf bytes.Buffer
+	buf.Write(signed(priv, string(CONF), cb))
+	buf.Write(signed(priv, "start", []byte("now")))
+
+	scanner := commandScanner(context.Background(), &buf, pubkey)
+	if !scanner.Scan() {
+		t.Fatalf("the configuration has not been read: %v", scanner.Err())
+	}
+	parts := bytes.SplitN(scanner.Bytes(), space, 2)
+	assert.Equal(t, "conf", string(parts[0]))
+	var received conf.BaseConfig
+	if assert.NoError(t, json.Unmarshal(parts[1], &received)) {
+		assert.Equal(t, c.Lookups, received.Lookups)
+	}
+	assert.True(t, scanner.Scan())
+	assert.Equal(t, "start now", string(scanner.Bytes()))
+	assert.False(t, scanner.Scan())
+	assert.NoError(t, scanner.Err())
+}
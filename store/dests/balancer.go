@@ -0,0 +1,336 @@
+package dests
+
+import (
+	"context"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/valyala/bytebufferpool"
+)
+
+var ErrNoTarget = eerrors.New("No remote server is available")
+
+// destClient is what the balancer needs from the TCP, UDP and RELP clients.
+type destClient interface {
+	Send(ctx context.Context, msg *model.FullMessage) error
+	Close() error
+}
+
+// target is one of the remote servers of a destination.
+type target struct {
+	hostport string
+	clt      destClient
+	// for the TCP destination, the last message that was sent to the
+	// target, and that has not been ACKed yet. Protected by the balancer
+	// mutex.
+	previousUid utils.MyULID
+}
+
+// splitTarget splits a host:port target. The target of a unix socket
+// destination is empty.
+func splitTarget(hostport string) (string, int) {
+	if len(hostport) == 0 {
+		return "", 0
+	}
+	host, port, _ := net.SplitHostPort(hostport)
+	p, _ := strconv.Atoi(port)
+	return host, p
+}
+
+// balancer distributes the messages of a destination among several remote
+// servers.
+//
+// - failover: the messages are sent to the first available server, in the
+// configuration order
+// - roundrobin: the messages are sent to each available server in turn
+// - hash: the server is chosen by rendezvous hashing on a message template,
+// so that the messages with the same key go to the same server as long as
+// it is available
+//
+// When a server fails, it is put aside. The servers that are put aside are
+// probed every probe_interval, by trying to connect again.
+type balancer struct {
+	logger   log15.Logger
+	name     string
+	strategy string
+	targets  []*target
+	next     int
+	keyTmpl  *template.Template
+	connect  func(ctx context.Context, t *target) (destClient, error)
+	mu       sync.Mutex
+
+	probeInterval time.Duration
+}
+
+func newBalancer(name string, logger log15.Logger, config conf.TcpUdpRelpDestBaseConfig, connect func(context.Context, *target) (destClient, error)) (*balancer, error) {
+	b := &balancer{
+		logger:        logger,
+		name:          name,
+		strategy:      config.Strategy,
+		connect:       connect,
+		probeInterval: config.ProbeInterval,
+	}
+	if b.strategy == "hash" {
+		tmpl, err := template.New("hashkey").Parse(config.HashKeyTmpl)
+		if err != nil {
+			return nil, eerrors.Wrap(err, "Invalid hash key template")
+		}
+		b.keyTmpl = tmpl
+	}
+	if len(config.UnixSocketPath) > 0 {
+		b.targets = []*target{{previousUid: utils.ZeroULID}}
+	} else {
+		hostports, err := config.Targets()
+		if err != nil {
+			return nil, err
+		}
+		for _, hostport := range hostports {
+			b.targets = append(b.targets, &target{hostport: hostport, previousUid: utils.ZeroULID})
+		}
+	}
+	return b, nil
+}
+
+// start connects to the targets. It fails if no target is available.
+func (b *balancer) start(ctx context.Context) error {
+	var lastErr error
+	for _, t := range b.targets {
+		lastErr = b.probe(ctx, t)
+	}
+	if b.available() == 0 {
+		return lastErr
+	}
+
+	if b.probeInterval > 0 && len(b.targets) > 1 {
+		go func() {
+			ticker := time.NewTicker(b.probeInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					b.probeAll(ctx)
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// probe tries to connect to a target that is not available.
+func (b *balancer) probe(ctx context.Context, t *target) error {
+	clt, err := b.connect(ctx, t)
+	if err != nil {
+		connCounter.WithLabelValues(b.name, "fail").Inc()
+		b.logger.Info("Remote server is not available", "target", t.hostport, "error", err)
+		return err
+	}
+	connCounter.WithLabelValues(b.name, "success").Inc()
+	b.mu.Lock()
+	t.clt = clt
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *balancer) probeAll(ctx context.Context) {
+	b.mu.Lock()
+	down := make([]*target, 0, len(b.targets))
+	for _, t := range b.targets {
+		if t.clt == nil {
+			down = append(down, t)
+		}
+	}
+	b.mu.Unlock()
+	for _, t := range down {
+		if ctx.Err() != nil {
+			return
+		}
+		if b.probe(ctx, t) == nil {
+			b.logger.Info("Remote server is available again", "target", t.hostport)
+		}
+	}
+}
+
+func (b *balancer) available() (n int) {
+	b.mu.Lock()
+	for _, t := range b.targets {
+		if t.clt != nil {
+			n++
+		}
+	}
+	b.mu.Unlock()
+	return n
+}
+
+func (b *balancer) hashKey(msg *model.FullMessage) string {
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+	err := b.keyTmpl.Execute(buf, msg.Fields)
+	if err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// pick chooses the target for msg. It returns a nil target when no target
+// is available.
+func (b *balancer) pick(msg *model.FullMessage) (*target, destClient) {
+	var key string
+	if b.keyTmpl != nil {
+		key = b.hashKey(msg)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.strategy {
+	case "roundrobin":
+		for i := range b.targets {
+			t := b.targets[(b.next+i)%len(b.targets)]
+			if t.clt != nil {
+				b.next = (b.next + i + 1) % len(b.targets)
+				return t, t.clt
+			}
+		}
+	case "hash":
+		var best *target
+		var bestScore uint64
+		for _, t := range b.targets {
+			if t.clt == nil {
+				continue
+			}
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(t.hostport))
+			_, _ = h.Write([]byte(key))
+			score := h.Sum64()
+			if best == nil || score > bestScore {
+				best, bestScore = t, score
+			}
+		}
+		if best != nil {
+			return best, best.clt
+		}
+	default:
+		for _, t := range b.targets {
+			if t.clt != nil {
+				return t, t.clt
+			}
+		}
+	}
+	return nil, nil
+}
+
+// swapPrevious records uid as the last message sent to t, and returns the
+// message that was previously recorded.
+func (b *balancer) swapPrevious(t *target, uid utils.MyULID) utils.MyULID {
+	b.mu.Lock()
+	previous := t.previousUid
+	t.previousUid = uid
+	b.mu.Unlock()
+	return previous
+}
+
+// pending returns the last messages sent to the targets that were not
+// acknowledged yet, and forgets them.
+func (b *balancer) pending() []utils.MyULID {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	uids := make([]utils.MyULID, 0, len(b.targets))
+	for _, t := range b.targets {
+		if t.previousUid != utils.ZeroULID {
+			uids = append(uids, t.previousUid)
+			t.previousUid = utils.ZeroULID
+		}
+	}
+	return uids
+}
+
+// down puts a target aside after clt has failed. The client is closed, so
+// the messages that were in flight on it get NACKed. down returns false
+// when clt was not in use anymore.
+func (b *balancer) down(t *target, clt destClient, err error) bool {
+	b.mu.Lock()
+	if t.clt != clt {
+		// already replaced by a new connection, or closed
+		b.mu.Unlock()
+		return false
+	}
+	t.clt = nil
+	b.mu.Unlock()
+	connCounter.WithLabelValues(b.name, "down").Inc()
+	b.logger.Warn("Remote server has failed", "target", t.hostport, "error", err)
+	go func() {
+		_ = clt.Close()
+	}()
+	return true
+}
+
+func (b *balancer) Close() error {
+	b.mu.Lock()
+	clts := make([]destClient, 0, len(b.targets))
+	for _, t := range b.targets {
+		if t.clt != nil {
+			clts = append(clts, t.clt)
+			t.clt = nil
+		}
+	}
+	b.mu.Unlock()
+	c := eerrors.ChainErrors()
+	for _, clt := range clts {
+		c.Append(clt.Close())
+	}
+	errs := c.Sum()
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// sendBalanced sends each message to the target chosen by the balancer.
+// sent is called after a message was written to a target, failed when a
+// target has failed. When no target is available, the remaining messages
+// are NACKed and the destination stops.
+func (base *baseDestination) sendBalanced(ctx context.Context, b *balancer, msgs []model.OutputMsg, sent func(*target, utils.MyULID), failed func(*target)) eerrors.ErrorSlice {
+	var msg *model.FullMessage
+	var uid utils.MyULID
+	c := eerrors.ChainErrors()
+	for len(msgs) > 0 {
+		msg = msgs[0].Message
+		uid = msg.Uid
+		t, clt := b.pick(msg)
+		if t == nil {
+			c.Append(ErrNoTarget)
+			base.NACKRemaining(msgs)
+			base.dofatal(ErrNoTarget)
+			return c.Sum()
+		}
+		msgs = msgs[1:]
+		err := clt.Send(ctx, msg)
+		model.FullFree(msg)
+		if err == nil {
+			if sent != nil {
+				sent(t, uid)
+			}
+			continue
+		}
+		c.Append(err)
+		if IsEncodingError(err) {
+			base.PermError(uid)
+			continue
+		}
+		base.NACK(uid)
+		b.down(t, clt, err)
+		if failed != nil {
+			failed(t)
+		}
+	}
+	return c.Sum()
+}
@@ -0,0 +1,390 @@
+package dests
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	hostport string
+}
+
+func (c *fakeClient) Send(ctx context.Context, msg *model.FullMessage) error {
+	return nil
+}
+
+func (c *fakeClient) Close() error {
+	return nil
+}
+
+func newTestBalancer(t *testing.T, strategy string) *balancer {
+	InitRegistry()
+	config := conf.TcpUdpRelpDestBaseConfig{
+		Hosts:       []string{"a", "b:1515", "c"},
+		Port:        1514,
+		Strategy:    strategy,
+		HashKeyTmpl: "{{.HostName}}",
+	}
+	connect := func(ctx context.Context, t *target) (destClient, error) {
+		return &fakeClient{hostport: t.hostport}, nil
+	}
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	b, err := newBalancer("test", logger, config, connect)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.NoError(t, b.start(context.Background()))
+	return b
+}
+
+func pickHost(b *balancer, hostname string) string {
+	tgt, _ := b.pick(&model.FullMessage{Fields: &model.SyslogMessage{HostName: hostname}})
+	if tgt == nil {
+		return ""
+	}
+	return tgt.hostport
+}
+
+func TestBalancerFailover(t *testing.T) {
+	b := newTestBalancer(t, "failover")
+	assert.Equal(t, "a:1514", pickHost(b, ""))
+	first := b.targets[0]
+	b.down(first, first.clt, ErrNoTarget)
+	assert.Equal(t, "b:1515", pickHost(b, ""))
+	// the first server is back
+	b.probeAll(context.Background())
+	assert.Equal(t, "a:1514", pickHost(b, ""))
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	b := newTestBalancer(t, "roundrobin")
+	assert.Equal(t, []string{"a:1514", "b:1515", "c:1514", "a:1514"}, []string{pickHost(b, ""), pickHost(b, ""), pickHost(b, ""), pickHost(b, "")})
+	second := b.targets[1]
+	b.down(second, second.clt, ErrNoTarget)
+	assert.Equal(t, []string{"c:1514", "a:1514", "c:1514"}, []string{pickHost(b, ""), pickHost(b, ""), pickHost(b, "")})
+}
+
+func TestBalancerHash(t *testing.T) {
+	b := newTestBalancer(t, "hash")
+	hosts := []string{"web1", "web2", "db1", "db2", "mail", "proxy"}
+	before := map[string]string{}
+	for _, h := range hosts {
+		before[h] = pickHost(b, h)
+		assert.Equal(t, before[h], pickHost(b, h))
+	}
+	// only the keys of the failed server move
+	var failed *target
+	for _, tgt := range b.targets {
+		if tgt.hostport == before["web1"] {
+			failed = tgt
+		}
+	}
+	b.down(failed, failed.clt, ErrNoTarget)
+	for _, h := range hosts {
+		after := pickHost(b, h)
+		assert.NotEqual(t, failed.hostport, after)
+		if before[h] != failed.hostport {
+			assert.Equal(t, before[h], after)
+		}
+	}
+}
+
+// ackRecorder records the store callbacks.
+type ackRecorder struct {
+	mu    sync.Mutex
+	acks  []utils.MyULID
+	nacks []utils.MyULID
+}
+
+func (r *ackRecorder) ack(uid utils.MyULID, dest conf.DestinationType) {
+	r.mu.Lock()
+	r.acks = append(r.acks, uid)
+	r.mu.Unlock()
+}
+
+func (r *ackRecorder) nack(uid utils.MyULID, dest conf.DestinationType) {
+	r.mu.Lock()
+	r.nacks = append(r.nacks, uid)
+	r.mu.Unlock()
+}
+
+func (r *ackRecorder) get() (acks, nacks []utils.MyULID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]utils.MyULID(nil), r.acks...), append([]utils.MyULID(nil), r.nacks...)
+}
+
+func testEnv(config conf.BaseConfig, r *ackRecorder) *Env {
+	InitRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	return BuildEnv().Logger(logger).Config(config).Callbacks(r.ack, r.nack, r.nack)
+}
+
+func testMessages(n int) ([]model.OutputMsg, []utils.MyULID) {
+	msgs := make([]model.OutputMsg, 0, n)
+	uids := make([]utils.MyULID, 0, n)
+	for i := 0; i < n; i++ {
+		msg := model.FullFactory()
+		msg.Uid = utils.NewUid()
+		msg.Fields.HostName = "host"
+		msg.Fields.AppName = "app"
+		msg.Fields.Message = "message " + strconv.Itoa(i)
+		msgs = append(msgs, model.OutputMsg{Message: msg})
+		uids = append(uids, msg.Uid)
+	}
+	return msgs, uids
+}
+
+// lineServer accepts connections and sends the received lines to the
+// returned channel. stop closes the listener and the connections.
+func lineServer(t *testing.T) (addr string, lines chan string, stop func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	lines = make(chan string, 100)
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+	stop = func() {
+		_ = l.Close()
+		mu.Lock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+		mu.Unlock()
+	}
+	return l.Addr().String(), lines, stop
+}
+
+func tcpDestConfig(hosts ...string) conf.BaseConfig {
+	var c conf.BaseConfig
+	c.TCPDest.Hosts = hosts
+	c.TCPDest.Strategy = "failover"
+	c.TCPDest.Format = "rfc5424"
+	c.TCPDest.LineFraming = true
+	c.TCPDest.FrameDelimiter = '\n'
+	c.TCPDest.ConnTimeout = time.Second
+	return c
+}
+
+func TestTCPDestinationAcks(t *testing.T) {
+	addr, lines, stop := lineServer(t)
+	defer stop()
+	r := &ackRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d, err := NewTCPDestination(ctx, testEnv(tcpDestConfig(addr), r))
+	if !assert.NoError(t, err) {
+		return
+	}
+	msgs, uids := testMessages(3)
+	assert.Empty(t, d.Send(ctx, msgs))
+	for i := 0; i < 3; i++ {
+		select {
+		case line := <-lines:
+			assert.Contains(t, line, "message "+strconv.Itoa(i))
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+	}
+	// a message is ACKed when the next one could be sent
+	acks, nacks := r.get()
+	assert.Equal(t, uids[:2], acks)
+	assert.Empty(t, nacks)
+	// the last one is NACKed on Close, as we don't know if it was delivered
+	_ = d.Close()
+	acks, nacks = r.get()
+	assert.Equal(t, uids[:2], acks)
+	assert.Equal(t, uids[2:], nacks)
+}
+
+func TestTCPDestinationFailover(t *testing.T) {
+	addr1, lines1, stop1 := lineServer(t)
+	addr2, lines2, stop2 := lineServer(t)
+	defer stop2()
+	r := &ackRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d, err := NewTCPDestination(ctx, testEnv(tcpDestConfig(addr1, addr2), r))
+	if !assert.NoError(t, err) {
+		return
+	}
+	msgs, _ := testMessages(1)
+	assert.Empty(t, d.Send(ctx, msgs))
+	<-lines1
+
+	// the first server goes away: after a few writes, the client notices
+	// the broken connection and the messages go to the second server
+	stop1()
+	sent := 1
+	deadline := time.Now().Add(5 * time.Second)
+	received := false
+	for !received && time.Now().Before(deadline) {
+		msgs, _ = testMessages(1)
+		_ = d.Send(ctx, msgs)
+		sent++
+		select {
+		case <-lines2:
+			received = true
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	assert.True(t, received)
+	_ = d.Close()
+	// every message was either ACKed or NACKed
+	acks, nacks := r.get()
+	assert.Equal(t, sent, len(acks)+len(nacks))
+	assert.NotEmpty(t, nacks)
+}
+
+// relpServer is a minimal RELP server. The syslog messages that contain
+// "refuse" are answered with a 500 code.
+func relpServer(t *testing.T) (addr string, stop func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				scanner.Split(utils.RelpSplit)
+				for scanner.Scan() {
+					fields := strings.SplitN(scanner.Text(), " ", 3)
+					switch {
+					case fields[1] == "close":
+						_, _ = fmt.Fprintf(conn, "%s rsp 0\n", fields[0])
+						_ = conn.Close()
+						return
+					case strings.Contains(scanner.Text(), "refuse"):
+						_, _ = fmt.Fprintf(conn, "%s rsp 6 500 KO\n", fields[0])
+					default:
+						_, _ = fmt.Fprintf(conn, "%s rsp 6 200 OK\n", fields[0])
+					}
+				}
+			}()
+		}
+	}()
+	stop = func() {
+		_ = l.Close()
+		mu.Lock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+		mu.Unlock()
+	}
+	return l.Addr().String(), stop
+}
+
+func relpDestConfig(hosts ...string) conf.BaseConfig {
+	var c conf.BaseConfig
+	c.RELPDest.Hosts = hosts
+	c.RELPDest.Strategy = "failover"
+	c.RELPDest.Format = "rfc5424"
+	c.RELPDest.ConnTimeout = time.Second
+	c.RELPDest.RelpTimeout = 5 * time.Second
+	return c
+}
+
+// waitAcks waits until n messages were ACKed or NACKed.
+func waitAcks(t *testing.T, r *ackRecorder, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		acks, nacks := r.get()
+		if len(acks)+len(nacks) >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout waiting for the acknowledgments")
+}
+
+func TestRELPDestinationNACK(t *testing.T) {
+	addr1, stop1 := relpServer(t)
+	defer stop1()
+	addr2, stop2 := relpServer(t)
+	defer stop2()
+	r := &ackRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d, err := NewRELPDestination(ctx, testEnv(relpDestConfig(addr1, addr2), r))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer d.Close()
+	b := d.(*RELPDestination).b
+
+	msgs, uids := testMessages(2)
+	assert.Empty(t, d.Send(ctx, msgs))
+	waitAcks(t, r, 2)
+	acks, nacks := r.get()
+	assert.Equal(t, uids, acks)
+	assert.Empty(t, nacks)
+
+	// the first server refuses a message: it is NACKed, and the first
+	// server is put aside
+	msgs, uids = testMessages(1)
+	msgs[0].Message.Fields.Message = "refuse"
+	assert.Empty(t, d.Send(ctx, msgs))
+	waitAcks(t, r, 3)
+	_, nacks = r.get()
+	assert.Equal(t, uids, nacks)
+	assert.Equal(t, 1, b.available())
+	tgt, _ := b.pick(msgs[0].Message)
+	if assert.NotNil(t, tgt) {
+		assert.Equal(t, addr2, tgt.hostport)
+	}
+
+	// the second server refuses a message too: no server is left, the
+	// destination stops
+	msgs, _ = testMessages(1)
+	msgs[0].Message.Fields.Message = "refuse"
+	assert.Empty(t, d.Send(ctx, msgs))
+	select {
+	case err := <-d.Fatal():
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the destination did not stop")
+	}
+}
@@ -80,7 +80,8 @@ func NewHTTPServerDestination(ctx context.Context, e *Env) (Destination, error)
 				// protobuf is not natively self delimited, so we use octet counting framing
 				d.contentType = encoders.OctetStreamMimetype
 				d.lineFraming = false
-			case baseenc.RFC5424, baseenc.RFC3164, baseenc.File:
+			case baseenc.RFC5424, baseenc.RFC3164, baseenc.File, baseenc.CEF, baseenc.LEEF,
+				baseenc.RFC3164CEF, baseenc.RFC5424CEF, baseenc.RFC3164LEEF, baseenc.RFC5424LEEF, baseenc.Logfmt:
 				d.contentType = encoders.PlainMimetype
 			default:
 				return nil, fmt.Errorf("Unknown format: '%d'", d.format)
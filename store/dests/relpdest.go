@@ -14,7 +14,7 @@ import (
 
 type RELPDestination struct {
 	*baseDestination
-	clt *clients.RELPClient
+	b *balancer
 }
 
 func NewRELPDestination(ctx context.Context, e *Env) (Destination, error) {
@@ -25,88 +25,115 @@ func NewRELPDestination(ctx context.Context, e *Env) (Destination, error) {
 	if err != nil {
 		return nil, err
 	}
-	clt := clients.NewRELPClient(e.logger).
-		Host(e.config.RELPDest.Host).
-		Port(e.config.RELPDest.Port).
-		Path(e.config.RELPDest.UnixSocketPath).
-		Format(d.format).
-		KeepAlive(e.config.RELPDest.KeepAlive).
-		KeepAlivePeriod(e.config.RELPDest.KeepAlivePeriod).
-		ConnTimeout(e.config.RELPDest.ConnTimeout).
-		RelpTimeout(e.config.RELPDest.RelpTimeout).
-		WindowSize(e.config.RELPDest.WindowSize).
-		FlushPeriod(e.config.RELPDest.FlushPeriod)
+	config := e.config.RELPDest
 
-	if e.config.RELPDest.TLSEnabled {
-		config, err := utils.NewTLSConfig(
-			e.config.RELPDest.Host,
-			e.config.RELPDest.CAFile,
-			e.config.RELPDest.CAPath,
-			e.config.RELPDest.CertFile,
-			e.config.RELPDest.KeyFile,
-			e.config.RELPDest.Insecure,
-			e.confined,
-		)
+	connect := func(ctx context.Context, t *target) (destClient, error) {
+		host, port := splitTarget(t.hostport)
+		clt := clients.NewRELPClient(e.logger).
+			Host(host).
+			Port(port).
+			Path(config.UnixSocketPath).
+			Format(d.format).
+			KeepAlive(config.KeepAlive).
+			KeepAlivePeriod(config.KeepAlivePeriod).
+			ConnTimeout(config.ConnTimeout).
+			RelpTimeout(config.RelpTimeout).
+			WindowSize(config.WindowSize).
+			FlushPeriod(config.FlushPeriod)
+
+		if config.TLSEnabled {
+			tlsConfig, err := utils.NewTLSConfig(
+				host,
+				config.CAFile,
+				config.CAPath,
+				config.CertFile,
+				config.KeyFile,
+				config.Insecure,
+				e.confined,
+			)
+			if err != nil {
+				return nil, err
+			}
+			err = utils.SetFingerprints(tlsConfig, config.TLSFingerprints, false)
+			if err != nil {
+				return nil, err
+			}
+			clt = clt.TLS(tlsConfig)
+		}
+
+		err := clt.Connect()
 		if err != nil {
 			return nil, err
 		}
-		clt = clt.TLS(config)
+		go d.handleAnswers(t, clt)
+		return clt, nil
 	}
 
-	err = clt.Connect()
+	d.b, err = newBalancer("relp", e.logger, config.TcpUdpRelpDestBaseConfig, connect)
+	if err != nil {
+		return nil, err
+	}
+	err = d.b.start(ctx)
 	if err != nil {
-		connCounter.WithLabelValues("relp", "fail").Inc()
 		return nil, err
 	}
-	connCounter.WithLabelValues("relp", "success").Inc()
-
-	d.clt = clt
 
-	rebind := e.config.RELPDest.Rebind
+	rebind := config.Rebind
 	if rebind > 0 {
 		go func() {
 			select {
 			case <-ctx.Done():
 				// the store service asked for stop
-				d.clt.Close()
+				d.b.Close()
 			case <-time.After(rebind):
 				d.dofatal(eerrors.Errorf("Rebind period has expired (%s)", rebind.String()))
 			}
 		}()
 	}
 
-	go func() {
-		ackChan := d.clt.Ack()
-		nackChan := d.clt.Nack()
-		var err error
-		var uid utils.MyULID
+	return d, nil
+}
+
+// handleAnswers forwards the RELP server answers to the store. When the
+// server NACKs a message, or when the connection is lost, the target is put
+// aside. The RELP client NACKs the messages that were in flight when the
+// connection was lost. When no other target is available, the destination
+// stops, so that the store can restart it.
+func (d *RELPDestination) handleAnswers(t *target, clt *clients.RELPClient) {
+	ackChan := clt.Ack()
+	nackChan := clt.Nack()
+	var err error
+	var uid utils.MyULID
 
-		for queue.WaitManyAckQueues(ackChan, nackChan) {
-			for {
-				uid, _, err = ackChan.Get()
-				if err != nil {
-					break
-				}
-				d.ACK(uid)
+	for queue.WaitManyAckQueues(ackChan, nackChan) {
+		for {
+			uid, _, err = ackChan.Get()
+			if err != nil || uid == utils.ZeroULID {
+				break
+			}
+			d.ACK(uid)
+		}
+		for {
+			uid, _, err = nackChan.Get()
+			if err != nil || uid == utils.ZeroULID {
+				break
 			}
-			for {
-				uid, _, err = nackChan.Get()
-				if err != nil {
-					break
-				}
-				d.NACK(uid)
-				d.dofatal(eerrors.Errorf("RELP server returned a NACK for UID '%s'", uid.String()))
+			d.NACK(uid)
+			nackErr := eerrors.Errorf("RELP server returned a NACK for UID '%s'", uid.String())
+			if d.b.down(t, clt, nackErr) && d.b.available() == 0 {
+				d.dofatal(nackErr)
 			}
 		}
-	}()
-
-	return d, nil
+	}
+	if d.b.down(t, clt, clients.ErrRELPClosed) && d.b.available() == 0 {
+		d.dofatal(clients.ErrRELPClosed)
+	}
 }
 
 func (d *RELPDestination) Close() (err error) {
-	return d.clt.Close()
+	return d.b.Close()
 }
 
 func (d *RELPDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
-	return d.ForEach(ctx, d.clt.Send, false, true, msgs)
+	return d.sendBalanced(ctx, d.b, msgs, nil, nil)
 }
@@ -15,8 +15,7 @@ var sp = []byte(" ")
 
 type TCPDestination struct {
 	*baseDestination
-	previousUid utils.MyULID
-	clt         *clients.SyslogTCPClient
+	b *balancer
 }
 
 func NewTCPDestination(ctx context.Context, e *Env) (Destination, error) {
@@ -27,50 +26,64 @@ func NewTCPDestination(ctx context.Context, e *Env) (Destination, error) {
 	if err != nil {
 		return nil, err
 	}
-	clt := clients.NewSyslogTCPClient(e.logger).
-		Host(e.config.TCPDest.Host).
-		Port(e.config.TCPDest.Port).
-		Path(e.config.TCPDest.UnixSocketPath).
-		Format(d.format).
-		KeepAlive(e.config.TCPDest.KeepAlive).
-		KeepAlivePeriod(e.config.TCPDest.KeepAlivePeriod).
-		LineFraming(e.config.TCPDest.LineFraming).
-		FrameDelimiter(e.config.TCPDest.FrameDelimiter).
-		ConnTimeout(e.config.TCPDest.ConnTimeout).
-		FlushPeriod(e.config.TCPDest.FlushPeriod)
+	config := e.config.TCPDest
 
-	if e.config.TCPDest.TLSEnabled {
-		config, err := utils.NewTLSConfig(
-			e.config.TCPDest.Host,
-			e.config.TCPDest.CAFile,
-			e.config.TCPDest.CAPath,
-			e.config.TCPDest.CertFile,
-			e.config.TCPDest.KeyFile,
-			e.config.TCPDest.Insecure,
-			e.confined,
-		)
+	connect := func(ctx context.Context, t *target) (destClient, error) {
+		host, port := splitTarget(t.hostport)
+		clt := clients.NewSyslogTCPClient(e.logger).
+			Host(host).
+			Port(port).
+			Path(config.UnixSocketPath).
+			Format(d.format).
+			KeepAlive(config.KeepAlive).
+			KeepAlivePeriod(config.KeepAlivePeriod).
+			LineFraming(config.GetLineFraming()).
+			FrameDelimiter(config.FrameDelimiter).
+			ConnTimeout(config.ConnTimeout).
+			FlushPeriod(config.FlushPeriod)
+
+		if config.TLSEnabled {
+			tlsConfig, err := utils.NewTLSConfig(
+				host,
+				config.CAFile,
+				config.CAPath,
+				config.CertFile,
+				config.KeyFile,
+				config.Insecure,
+				e.confined,
+			)
+			if err != nil {
+				return nil, err
+			}
+			err = utils.SetFingerprints(tlsConfig, config.TLSFingerprints, false)
+			if err != nil {
+				return nil, err
+			}
+			clt = clt.TLS(tlsConfig)
+		}
+		err := clt.Connect(ctx)
 		if err != nil {
 			return nil, err
 		}
-		clt = clt.TLS(config)
+		return clt, nil
 	}
 
-	err = clt.Connect(ctx)
+	d.b, err = newBalancer("tcp", e.logger, config.TcpUdpRelpDestBaseConfig, connect)
+	if err != nil {
+		return nil, err
+	}
+	err = d.b.start(ctx)
 	if err != nil {
-		connCounter.WithLabelValues("tcp", "fail").Inc()
 		return nil, err
 	}
-	connCounter.WithLabelValues("tcp", "success").Inc()
-
-	d.clt = clt
 
-	rebind := e.config.TCPDest.Rebind
+	rebind := config.Rebind
 	if rebind > 0 {
 		go func() {
 			select {
 			case <-ctx.Done():
 				// the store service asked for stop
-				d.clt.Close()
+				d.Close()
 			case <-time.After(rebind):
 				d.dofatal(eerrors.Errorf("Rebind period has expired (%s)", rebind.String()))
 			}
@@ -80,51 +93,33 @@ func NewTCPDestination(ctx context.Context, e *Env) (Destination, error) {
 	return d, nil
 }
 
-func (d *TCPDestination) sendOne(ctx context.Context, message *model.FullMessage) (err error) {
-	err = d.clt.Send(ctx, message)
-
-	if err == nil {
-		if d.previousUid != utils.ZeroULID {
-			d.ACK(d.previousUid)
-		}
-		d.previousUid = message.Uid
-		return nil
+// sent ACKs the previous message sent to the target: as TCP has no
+// application level acknowledgment, a message is considered delivered when
+// the next one could be written.
+func (d *TCPDestination) sent(t *target, uid utils.MyULID) {
+	previous := d.b.swapPrevious(t, uid)
+	if previous != utils.ZeroULID {
+		d.ACK(previous)
 	}
-	if IsEncodingError(err) {
-		d.PermError(message.Uid)
-		return err
-	}
-	// error writing to the TCP conn
-	d.NACK(message.Uid)
-	if d.previousUid != utils.ZeroULID {
-		d.NACK(d.previousUid)
-		d.previousUid = utils.ZeroULID
+}
+
+func (d *TCPDestination) failed(t *target) {
+	previous := d.b.swapPrevious(t, utils.ZeroULID)
+	if previous != utils.ZeroULID {
+		d.NACK(previous)
 	}
-	return err
 }
 
+// Close closes the connections. The last message sent to each target was
+// not acknowledged, so it is NACKed.
 func (d *TCPDestination) Close() error {
-	return d.clt.Close()
+	err := d.b.Close()
+	for _, uid := range d.b.pending() {
+		d.NACK(uid)
+	}
+	return err
 }
 
 func (d *TCPDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
-	var msg *model.FullMessage
-	var curErr error
-	c := eerrors.ChainErrors()
-	for len(msgs) > 0 {
-		msg = msgs[0].Message
-		msgs = msgs[1:]
-		// ACK, NACK and PermError for current message are handled by sendOne
-		curErr = d.sendOne(ctx, msg)
-		model.FullFree(msg)
-		if curErr != nil {
-			c.Append(curErr)
-			if !IsEncodingError(curErr) {
-				d.NACKRemaining(msgs)
-				d.dofatal(curErr)
-				return c.Sum()
-			}
-		}
-	}
-	return c.Sum()
+	return d.sendBalanced(ctx, d.b, msgs, d.sent, d.failed)
 }
@@ -7,12 +7,22 @@ import (
 	"github.com/stephane-martin/skewer/clients"
 	"github.com/stephane-martin/skewer/conf"
 	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
 )
 
 type UDPDestination struct {
 	*baseDestination
-	clt *clients.SyslogUDPClient
+	b *balancer
+}
+
+// udpClient adapts SyslogUDPClient to the balancer.
+type udpClient struct {
+	*clients.SyslogUDPClient
+}
+
+func (c udpClient) Send(ctx context.Context, msg *model.FullMessage) error {
+	return c.SyslogUDPClient.Send(msg)
 }
 
 func NewUDPDestination(ctx context.Context, e *Env) (Destination, error) {
@@ -23,27 +33,56 @@ func NewUDPDestination(ctx context.Context, e *Env) (Destination, error) {
 	if err != nil {
 		return nil, err
 	}
-	client := clients.NewSyslogUDPClient(e.logger).
-		Host(e.config.UDPDest.Host).
-		Port(e.config.UDPDest.Port).
-		Path(e.config.UDPDest.UnixSocketPath).
-		Format(d.format)
+	config := e.config.UDPDest
+
+	connect := func(ctx context.Context, t *target) (destClient, error) {
+		host, port := splitTarget(t.hostport)
+		client := clients.NewSyslogUDPClient(e.logger).
+			Host(host).
+			Port(port).
+			Path(config.UnixSocketPath).
+			Format(d.format)
+		if config.TLSEnabled && len(config.UnixSocketPath) == 0 {
+			tlsConfig, err := utils.NewTLSConfig(
+				host,
+				config.CAFile,
+				config.CAPath,
+				config.CertFile,
+				config.KeyFile,
+				config.Insecure,
+				e.confined,
+			)
+			if err != nil {
+				return nil, err
+			}
+			err = utils.SetFingerprints(tlsConfig, config.TLSFingerprints, false)
+			if err != nil {
+				return nil, err
+			}
+			client = client.TLS(tlsConfig)
+		}
+		err := client.Connect()
+		if err != nil {
+			return nil, err
+		}
+		return udpClient{SyslogUDPClient: client}, nil
+	}
 
-	err = client.Connect()
+	d.b, err = newBalancer("udp", e.logger, config.TcpUdpRelpDestBaseConfig, connect)
+	if err != nil {
+		return nil, err
+	}
+	err = d.b.start(ctx)
 	if err != nil {
-		connCounter.WithLabelValues("udp", "fail").Inc()
 		return nil, err
 	}
-	connCounter.WithLabelValues("udp", "success").Inc()
-
-	d.clt = client
 
-	rebind := e.config.UDPDest.Rebind
+	rebind := config.Rebind
 	if rebind > 0 {
 		go func() {
 			select {
 			case <-ctx.Done():
-				d.clt.Close()
+				d.b.Close()
 			case <-time.After(rebind):
 				d.dofatal(eerrors.Errorf("Rebind period has expired (%s)", rebind.String()))
 			}
@@ -54,13 +93,13 @@ func NewUDPDestination(ctx context.Context, e *Env) (Destination, error) {
 }
 
 func (d *UDPDestination) Close() error {
-	return d.clt.Close()
+	return d.b.Close()
 }
 
-func (d *UDPDestination) sendOne(ctx context.Context, msg *model.FullMessage) error {
-	return d.clt.Send(msg)
+func (d *UDPDestination) sent(t *target, uid utils.MyULID) {
+	d.ACK(uid)
 }
 
 func (d *UDPDestination) Send(ctx context.Context, msgs []model.OutputMsg) (err eerrors.ErrorSlice) {
-	return d.ForEach(ctx, d.sendOne, true, true, msgs)
+	return d.sendBalanced(ctx, d.b, msgs, d.sent, nil)
 }
@@ -4,12 +4,18 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/inconshreveable/log15"
 	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/enrich"
 	"github.com/stephane-martin/skewer/javascript"
+	"github.com/stephane-martin/skewer/logmetrics"
 	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/redact"
+	"github.com/stephane-martin/skewer/sample"
 	"github.com/stephane-martin/skewer/store/dests"
+	"github.com/stephane-martin/skewer/suppress"
 	"github.com/stephane-martin/skewer/sys/binder"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/eerrors"
@@ -25,15 +31,23 @@ type Forwarder struct {
 	desttype   conf.DestinationType
 	outputMsgs []model.OutputMsg
 	dest       dests.Destination
+	unfiltered map[utils.MyULID]utils.MyULID
+	redactors  []*redact.Redactor
+	rejected   map[utils.MyULID]struct{}
 }
 
 func NewForwarder(desttype conf.DestinationType, st *MessageStore, bc conf.BaseConfig, logger log15.Logger, bindr binder.Client) *Forwarder {
 	f := Forwarder{
-		logger:   logger.New("class", "forwarder"),
-		binder:   bindr,
-		store:    st,
-		conf:     bc,
-		desttype: desttype,
+		logger:     logger.New("class", "forwarder"),
+		binder:     bindr,
+		store:      st,
+		conf:       bc,
+		desttype:   desttype,
+		unfiltered: make(map[utils.MyULID]utils.MyULID),
+		rejected:   make(map[utils.MyULID]struct{}),
+	}
+	for _, redactConf := range bc.DestinationRedactions(desttype) {
+		f.redactors = append(f.redactors, redact.New(redactConf, conf.DestinationNames[desttype], f.logger))
 	}
 
 	return &f
@@ -74,8 +88,8 @@ func (fwder *Forwarder) Forward(ctx context.Context) (err error) {
 		}
 	}()
 
-	fwder.outputMsgs = make([]model.OutputMsg, fwder.conf.Store.BatchSize)
-	jsenvs := map[utils.MyULID]*javascript.Environment{}
+	fwder.outputMsgs = make([]model.OutputMsg, 0, fwder.conf.Store.BatchSize)
+	pipelines := map[utils.MyULID]*pipeline{}
 	outputs := fwder.store.Outputs(fwder.desttype)
 
 	var more bool
@@ -83,6 +97,8 @@ func (fwder *Forwarder) Forward(ctx context.Context) (err error) {
 	var stopping atomic.Bool
 	shutdown := false
 	var rerr error
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
 	go func() {
 		select {
@@ -102,6 +118,15 @@ func (fwder *Forwarder) Forward(ctx context.Context) (err error) {
 			return nil
 		case err := <-fwder.dest.Fatal():
 			return err
+		case <-ticker.C:
+			if stopping.Load() {
+				continue
+			}
+			fwder.updateLoad(pipelines)
+			errs := fwder.flushSuppressed(ctx, pipelines, fwder.dest)
+			if errs != nil {
+				fwder.logger.Warn("Errors forwarding the suppression summaries", "errors", errs)
+			}
 		case messages, more = <-outputs:
 			if !more || messages == nil {
 				return nil
@@ -113,7 +138,7 @@ func (fwder *Forwarder) Forward(ctx context.Context) (err error) {
 				}
 				return rerr
 			}
-			errs := fwder.fwdMsgs(ctx, messages, jsenvs, fwder.dest)
+			errs := fwder.fwdMsgs(ctx, messages, pipelines, fwder.dest)
 			if errs != nil {
 				fwder.logger.Warn("Errors forwarding messages", "errors", errs)
 			}
@@ -121,18 +146,19 @@ func (fwder *Forwarder) Forward(ctx context.Context) (err error) {
 	}
 }
 
-func (fwder *Forwarder) fwdMsgs(ctx context.Context, msgs []*model.FullMessage, envs map[utils.MyULID]*javascript.Environment, dest dests.Destination) (err eerrors.ErrorSlice) {
+func (fwder *Forwarder) fwdMsgs(ctx context.Context, msgs []*model.FullMessage, pipelines map[utils.MyULID]*pipeline, dest dests.Destination) (err eerrors.ErrorSlice) {
 
-	i := int(0)
+	outputs := fwder.outputMsgs[:0]
 
 Loop:
 	for _, m := range msgs {
 		if m == nil || m.Fields == nil {
 			continue Loop
 		}
-		env, ok := envs[m.ConfId]
-		if !ok {
-			// create the environment for the javascript virtual machine
+		p, ok := pipelines[m.ConfId]
+		if !ok || p.obsolete() {
+			// create the enricher and the environment for the javascript
+			// virtual machine
 			config, e := fwder.store.GetSyslogConfig(m.ConfId)
 			if e != nil {
 				fwder.logger.Warn(
@@ -143,52 +169,40 @@ Loop:
 				fwder.store.PermError(m.Uid, fwder.desttype)
 				continue Loop
 			}
-			envs[m.ConfId] = javascript.NewFilterEnvironment(
-				config.FilterFunc,
-				config.TopicFunc,
-				config.TopicTmpl,
-				config.PartitionFunc,
-				config.PartitionTmpl,
-				config.PartitionNumberFunc,
-				fwder.logger,
-			)
-			env = envs[m.ConfId]
-		}
-
-		topic := ""
-		partitionKey := ""
-		partitionNumber := int32(0)
-		var joinedErr error
-
-		_, ok1 := dest.(*dests.KafkaDestination)
-		_, ok2 := dest.(*dests.NATSDestination)
-		_, ok3 := dest.(*dests.RedisDestination)
-
-		if ok1 || ok2 || ok3 {
-			// only calculate proper Topic, PartitionKey and PartitionNumber if we are sending to Kafka or NATS
-			topic, joinedErr = env.Topic(m.Fields)
-			if joinedErr != nil {
-				fwder.logger.Info("Error calculating topic", "error", joinedErr.Error(), "uid", m.Uid)
-			}
-			if len(topic) == 0 {
-				topic = "default-topic"
-			}
-			partitionKey, joinedErr = env.PartitionKey(m.Fields)
-			if joinedErr != nil {
-				fwder.logger.Info("Error calculating the partition key", "error", err, "uid", m.Uid)
-			}
-			partitionNumber, joinedErr = env.PartitionNumber(m.Fields)
-			if joinedErr != nil {
-				fwder.logger.Info("Error calculating the partition number", "error", err, "uid", m.Uid)
+			previous := p
+			p = fwder.newPipeline(config)
+			if previous != nil && previous.suppressor != nil {
+				// the configuration is the same: the suppression windows
+				// go on, so that the repeats are still summarized
+				p.suppressor = previous.suppressor
 			}
+			pipelines[m.ConfId] = p
 		}
 
-		filterResult, e := env.FilterMessage(m.Fields)
-		if e != nil {
-			fwder.logger.Warn("Error happened filtering message", "error", e)
+		// a retried message has been processed already: it has been sampled,
+		// and its redactions have been counted. Unless the filter rejected it, it has passed
+		// the suppression and it has been measured too.
+		retried := fwder.store.Retried(m.Uid, fwder.desttype)
+		_, rejected := fwder.rejected[m.Uid]
+		delete(fwder.rejected, m.Uid)
+		passed := retried && !rejected
+		if p.enricher != nil {
+			p.enricher.Enrich(m)
+		}
+		if p.redactor != nil {
+			p.redactor.Redact(m.Fields, retried)
+		}
+		if p.sampler != nil && !retried && !p.sampler.Keep(m) {
+			fwder.store.ACK(m.Uid, fwder.desttype)
+			countFiltered(fwder.desttype, "sampled", m.Fields.GetProperty("skewer", "client"))
 			continue Loop
 		}
 
+		output := fwder.output(p.env, m, dest)
+
+		// an error comes with a FILTER_ERROR result
+		extras, filterResult, e := p.env.FilterMessageMulti(m.Fields)
+
 		switch filterResult {
 		case javascript.DROPPED:
 			fwder.store.ACK(m.Uid, fwder.desttype)
@@ -196,24 +210,280 @@ Loop:
 			continue Loop
 		case javascript.REJECTED:
 			fwder.store.NACK(m.Uid, fwder.desttype)
+			fwder.rejected[m.Uid] = struct{}{}
 			countFiltered(fwder.desttype, "rejected", m.Fields.GetProperty("skewer", "client"))
 			continue Loop
 		case javascript.PASS:
+			if p.suppressor != nil && !passed && !p.suppressor.Keep(m) {
+				fwder.store.ACK(m.Uid, fwder.desttype)
+				countFiltered(fwder.desttype, "suppressed", m.Fields.GetProperty("skewer", "client"))
+				continue Loop
+			}
+			if p.deriver != nil && !passed {
+				p.deriver.Measure(m.Fields)
+			}
 			countFiltered(fwder.desttype, "passing", m.Fields.GetProperty("skewer", "client"))
 		default:
 			fwder.store.PermError(m.Uid, fwder.desttype)
 			countFiltered(fwder.desttype, "unknown", m.Fields.GetProperty("skewer", "client"))
-			fwder.logger.Warn("Error happened processing message", "uid", m.Uid, "error", err)
+			fwder.logger.Warn("Error happened processing message", "uid", m.Uid, "error", e)
+			continue Loop
+		}
+
+		if len(extras) == 0 {
+			fwder.redact(m, passed)
+			outputs = append(outputs, output)
+			continue Loop
+		}
+		// the filter emitted several messages: they are all stashed, so that
+		// a retry does not run the filter again, and the original message
+		// is done
+		client := m.Fields.GetProperty("skewer", "client")
+		uid := m.Uid
+		stashed, e := fwder.stash(m, extras)
+		if e != nil {
+			// the message will be filtered again, and the extra messages
+			// produced again
+			fwder.logger.Warn("Error stashing the messages produced by the filter", "error", e, "uid", uid)
+			fwder.store.NACK(uid, fwder.desttype)
 			continue Loop
 		}
-		fwder.outputMsgs[i].PartitionKey = partitionKey
-		fwder.outputMsgs[i].PartitionNumber = partitionNumber
-		fwder.outputMsgs[i].Topic = topic
-		fwder.outputMsgs[i].Message = m
-		i++
+		fwder.store.ACK(uid, fwder.desttype)
+		for i, full := range stashed {
+			// the first stashed message is m
+			fwder.redact(full, passed && i == 0)
+			if i > 0 {
+				// the extra messages have not been suppressed nor measured
+				// with m
+				if p.suppressor != nil && !p.suppressor.Keep(full) {
+					fwder.store.ACK(full.Uid, fwder.desttype)
+					countFiltered(fwder.desttype, "suppressed", client)
+					continue
+				}
+				if p.deriver != nil {
+					p.deriver.Measure(full.Fields)
+				}
+				countFiltered(fwder.desttype, "extra", client)
+			}
+			outputs = append(outputs, fwder.output(p.env, full, dest))
+		}
 	}
-	if i == 0 {
+	fwder.outputMsgs = outputs
+	if len(outputs) == 0 {
 		return nil
 	}
-	return dest.Send(ctx, fwder.outputMsgs[:i])
+	return dest.Send(ctx, outputs)
+}
+
+// updateLoad gives the sizes of the queues to the samplers.
+func (fwder *Forwarder) updateLoad(pipelines map[utils.MyULID]*pipeline) {
+	stored, ready := fwder.store.QueueSizes(fwder.desttype)
+	for _, p := range pipelines {
+		if p.sampler == nil {
+			continue
+		}
+		shedding := p.sampler.Shedding()
+		p.sampler.SetLoad(stored, ready)
+		if p.sampler.Shedding() != shedding {
+			fwder.logger.Info("Sampling load shedding", "shedding", !shedding, "stored", stored, "ready", ready)
+		}
+	}
+}
+
+// flushSuppressed stashes and sends the summaries of the suppressions whose
+// windows are over.
+func (fwder *Forwarder) flushSuppressed(ctx context.Context, pipelines map[utils.MyULID]*pipeline, dest dests.Destination) (err eerrors.ErrorSlice) {
+	outputs := fwder.outputMsgs[:0]
+	for _, p := range pipelines {
+		if p.suppressor == nil {
+			continue
+		}
+		summaries := p.suppressor.Flush()
+		if len(summaries) == 0 {
+			continue
+		}
+		e := fwder.stashFull(summaries[0].ConfId, summaries)
+		if e != nil {
+			fwder.logger.Warn("Error stashing the suppression summaries", "error", e)
+			continue
+		}
+		for _, summary := range summaries {
+			fwder.redact(summary, false)
+			countFiltered(fwder.desttype, "summary", summary.Fields.GetProperty("skewer", "client"))
+			outputs = append(outputs, fwder.output(p.env, summary, dest))
+		}
+	}
+	fwder.outputMsgs = outputs
+	if len(outputs) == 0 {
+		return nil
+	}
+	return dest.Send(ctx, outputs)
+}
+
+// pipeline holds the processing of the messages of a source configuration.
+type pipeline struct {
+	env        *javascript.Environment
+	enricher   *enrich.Enricher
+	redactor   *redact.Redactor
+	suppressor *suppress.Suppressor
+	sampler    *sample.Sampler
+	deriver    *logmetrics.Deriver
+}
+
+func (p *pipeline) obsolete() bool {
+	return p.env.Obsolete() || (p.enricher != nil && p.enricher.Obsolete())
+}
+
+func (fwder *Forwarder) newPipeline(config *conf.FilterSubConfig) *pipeline {
+	p := pipeline{env: javascript.NewFilterEnvironment(*config, fwder.logger)}
+	if len(config.Enrich) > 0 {
+		enrichConf, ok := fwder.conf.Enrichment(config.Enrich)
+		if ok {
+			p.enricher = enrich.New(enrichConf, fwder.logger)
+		} else {
+			fwder.logger.Warn("Unknown enrichment", "name", config.Enrich)
+		}
+	}
+	if len(config.Redact) > 0 {
+		redactConf, ok := fwder.conf.Redaction(config.Redact)
+		if ok {
+			p.redactor = redact.New(redactConf, conf.DestinationNames[fwder.desttype], fwder.logger)
+		} else {
+			fwder.logger.Warn("Unknown redaction", "name", config.Redact)
+		}
+	}
+	if len(config.Suppress) > 0 {
+		suppressConf, ok := fwder.conf.Suppression(config.Suppress)
+		if ok {
+			p.suppressor = suppress.New(suppressConf, conf.DestinationNames[fwder.desttype], fwder.logger)
+		} else {
+			fwder.logger.Warn("Unknown suppression", "name", config.Suppress)
+		}
+	}
+	if len(config.Sample) > 0 {
+		sampleConf, ok := fwder.conf.Sampling(config.Sample)
+		if ok {
+			p.sampler = sample.New(sampleConf, conf.DestinationNames[fwder.desttype], fwder.logger)
+			p.sampler.SetLoad(fwder.store.QueueSizes(fwder.desttype))
+		} else {
+			fwder.logger.Warn("Unknown sampling", "name", config.Sample)
+		}
+	}
+	if len(config.LogMetrics) > 0 {
+		metricsConf, ok := fwder.conf.LogMetricsSet(config.LogMetrics)
+		if ok {
+			p.deriver = logmetrics.New(metricsConf, conf.DestinationNames[fwder.desttype], Registry, fwder.logger)
+		} else {
+			fwder.logger.Warn("Unknown log metrics", "name", config.LogMetrics)
+		}
+	}
+	return &p
+}
+
+// redact applies the redactions of the destination.
+func (fwder *Forwarder) redact(m *model.FullMessage, retried bool) {
+	for _, redactor := range fwder.redactors {
+		redactor.Redact(m.Fields, retried)
+	}
+}
+
+// output computes the Topic, PartitionKey and PartitionNumber of a message.
+func (fwder *Forwarder) output(env *javascript.Environment, m *model.FullMessage, dest dests.Destination) model.OutputMsg {
+	topic := ""
+	partitionKey := ""
+	partitionNumber := int32(0)
+	var joinedErr error
+
+	_, ok1 := dest.(*dests.KafkaDestination)
+	_, ok2 := dest.(*dests.NATSDestination)
+	_, ok3 := dest.(*dests.RedisDestination)
+
+	if ok1 || ok2 || ok3 {
+		// only calculate proper Topic, PartitionKey and PartitionNumber if we are sending to Kafka or NATS
+		topic, joinedErr = env.Topic(m.Fields)
+		if joinedErr != nil {
+			fwder.logger.Info("Error calculating topic", "error", joinedErr.Error(), "uid", m.Uid)
+		}
+		if len(topic) == 0 {
+			topic = "default-topic"
+		}
+		partitionKey, joinedErr = env.PartitionKey(m.Fields)
+		if joinedErr != nil {
+			fwder.logger.Info("Error calculating the partition key", "error", joinedErr, "uid", m.Uid)
+		}
+		partitionNumber, joinedErr = env.PartitionNumber(m.Fields)
+		if joinedErr != nil {
+			fwder.logger.Info("Error calculating the partition number", "error", joinedErr, "uid", m.Uid)
+		}
+	}
+	return model.OutputMsg{
+		Message:         m,
+		PartitionKey:    partitionKey,
+		PartitionNumber: partitionNumber,
+		Topic:           topic,
+	}
+}
+
+// stash stores in the Store the messages that the filter produced from m:
+// the filtered m first, then the extra messages. They get the configuration
+// of m without its filter, so that they are not filtered again when they are
+// retried. m keeps its UID, but not its fields.
+func (fwder *Forwarder) stash(m *model.FullMessage, extras []*model.SyslogMessage) ([]*model.FullMessage, error) {
+	stashed := make([]*model.FullMessage, 0, len(extras)+1)
+	// the fields of m now belong to the first stashed message
+	fields := append([]*model.SyslogMessage{m.Fields}, extras...)
+	m.Fields = nil
+	for _, f := range fields {
+		full := model.FullFactoryFrom(f)
+		full.ClientAddr = m.ClientAddr
+		full.SourceType = m.SourceType
+		full.SourcePath = m.SourcePath
+		full.SourcePort = m.SourcePort
+		full.ConnId = m.ConnId
+		stashed = append(stashed, full)
+	}
+	err := fwder.stashFull(m.ConfId, stashed)
+	if err != nil {
+		return nil, err
+	}
+	return stashed, nil
+}
+
+// stashFull stores msgs in the Store, with the configuration confID without
+// its filter. The messages are freed when they could not be stored.
+func (fwder *Forwarder) stashFull(confID utils.MyULID, msgs []*model.FullMessage) error {
+	unfilteredID, err := fwder.unfilteredConfID(confID)
+	if err == nil {
+		for _, full := range msgs {
+			full.ConfId = unfilteredID
+		}
+		err = fwder.store.Stash(fwder.desttype, msgs)
+	}
+	if err != nil {
+		for _, full := range msgs {
+			model.FullFree(full)
+		}
+		return err
+	}
+	return nil
+}
+
+// unfilteredConfID returns the ID of the configuration confID without its
+// filter. That configuration is stored if needed.
+func (fwder *Forwarder) unfilteredConfID(confID utils.MyULID) (utils.MyULID, error) {
+	if id, ok := fwder.unfiltered[confID]; ok {
+		return id, nil
+	}
+	config, err := fwder.store.GetSyslogConfig(confID)
+	if err != nil {
+		return "", err
+	}
+	unfiltered := config.Unfiltered()
+	id := unfiltered.CalculateID()
+	err = fwder.store.StoreSyslogConfig(id, unfiltered)
+	if err != nil {
+		return "", err
+	}
+	fwder.unfiltered[confID] = id
+	return id, nil
 }
@@ -0,0 +1,276 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/enrich"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/redact"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+// testDest is a destination that keeps the messages it is given.
+type testDest struct {
+	sent []*model.FullMessage
+}
+
+func (d *testDest) Send(ctx context.Context, msgs []model.OutputMsg) eerrors.ErrorSlice {
+	for _, msg := range msgs {
+		d.sent = append(d.sent, msg.Message)
+	}
+	return nil
+}
+
+func (d *testDest) Fatal() chan error                 { return nil }
+func (d *testDest) Close() error                      { return nil }
+func (d *testDest) ACK(utils.MyULID)                  {}
+func (d *testDest) NACK(utils.MyULID)                 {}
+func (d *testDest) PermError(utils.MyULID)            {}
+func (d *testDest) NACKAllSlice([]*model.FullMessage) {}
+
+func testForwarder(t *testing.T, s *MessageStore, bc conf.BaseConfig, config conf.FilterSubConfig) (*Forwarder, utils.MyULID) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	confID := config.CalculateID()
+	if err := s.StoreSyslogConfig(confID, config); err != nil {
+		t.Fatal(err)
+	}
+	return NewForwarder(conf.Stderr, s, bc, logger, nil), confID
+}
+
+// forward gives msgs to the forwarder, and returns the messages that it sends.
+func forward(t *testing.T, fwder *Forwarder, pipelines map[utils.MyULID]*pipeline, msgs ...*model.FullMessage) []*model.FullMessage {
+	t.Helper()
+	dest := &testDest{}
+	if errs := fwder.fwdMsgs(context.Background(), msgs, pipelines, dest); errs != nil {
+		t.Fatal(errs)
+	}
+	return dest.sent
+}
+
+func TestForwardRetriedExtra(t *testing.T) {
+	s := testStore(t)
+	waitReady(t, s)
+	fwder, confID := testForwarder(t, s, conf.BaseConfig{}, conf.FilterSubConfig{
+		FilterExpr: `app_name == "app"`,
+		FilterFunc: `function FilterMessages(m) {
+	var n = CopySyslogMessage(m);
+	n.Appname = "extra";
+	return [m, n];
+}`,
+	})
+	pipelines := map[utils.MyULID]*pipeline{}
+	dest := &testDest{}
+
+	m := testFull("message")
+	m.Uid = utils.NewUid()
+	m.ConfId = confID
+	m.Fields.AppName = "app"
+	if errs := fwder.fwdMsgs(context.Background(), []*model.FullMessage{m}, pipelines, dest); errs != nil {
+		t.Fatal(errs)
+	}
+	if len(dest.sent) != 2 {
+		t.Fatalf("%d messages have been sent", len(dest.sent))
+	}
+	extra := dest.sent[1]
+	if extra.Fields.AppName != "extra" {
+		t.Fatalf("unexpected extra message from %s", extra.Fields.AppName)
+	}
+
+	// the retried extra message does not go through the filter expression
+	s.NACK(extra.Uid, conf.Stderr)
+	retried := retryFailed(t, s, extra.Uid)
+	dest.sent = nil
+	if errs := fwder.fwdMsgs(context.Background(), []*model.FullMessage{retried}, pipelines, dest); errs != nil {
+		t.Fatal(errs)
+	}
+	if len(dest.sent) != 1 {
+		t.Fatalf("%d messages have been sent for the retry", len(dest.sent))
+	}
+	if dest.sent[0].Uid != extra.Uid || dest.sent[0].Fields.AppName != "extra" {
+		t.Fatalf("unexpected retried message from %s", dest.sent[0].Fields.AppName)
+	}
+}
+
+func TestForwardRetriedRedaction(t *testing.T) {
+	s := testStore(t)
+	waitReady(t, s)
+	bc := conf.BaseConfig{Redactions: []conf.RedactionConfig{
+		{Name: "emails", Detectors: []string{"email"}, Fields: []string{"message"}},
+	}}
+	fwder, confID := testForwarder(t, s, bc, conf.FilterSubConfig{Redact: "emails"})
+	pipelines := map[utils.MyULID]*pipeline{}
+	counter := redact.RedactionCounter.WithLabelValues("emails", "email", conf.DestinationNames[conf.Stderr])
+	count := func() float64 {
+		var metric dto.Metric
+		assert.NoError(t, counter.Write(&metric))
+		return metric.GetCounter().GetValue()
+	}
+	initial := count()
+
+	m := testFull("mail from bob@example.com")
+	m.ConfId = confID
+	if err := s.Stash(conf.Stderr, []*model.FullMessage{m}); err != nil {
+		t.Fatal(err)
+	}
+	sent := forward(t, fwder, pipelines, m)
+	if assert.Len(t, sent, 1) {
+		assert.Equal(t, "mail from [REDACTED]", sent[0].Fields.Message)
+	}
+	assert.Equal(t, initial+1, count())
+
+	// the retried message is redacted again, but not counted again
+	s.NACK(m.Uid, conf.Stderr)
+	retried := retryFailed(t, s, m.Uid)
+	assert.True(t, s.Retried(m.Uid, conf.Stderr))
+	sent = forward(t, fwder, pipelines, retried)
+	if assert.Len(t, sent, 1) {
+		assert.Equal(t, "mail from [REDACTED]", sent[0].Fields.Message)
+	}
+	assert.Equal(t, initial+1, count())
+
+	s.ACK(m.Uid, conf.Stderr)
+	waitFor(t, "the ACK", func() bool { return !s.Retried(m.Uid, conf.Stderr) })
+}
+
+func TestForwardSuppression(t *testing.T) {
+	s := testStore(t)
+	waitReady(t, s)
+	bc := conf.BaseConfig{
+		Enrichments:  []conf.EnrichmentConfig{{Name: "none"}},
+		Suppressions: []conf.SuppressionConfig{{Name: "throttle", Mode: "throttle", Max: 3, Window: time.Hour}},
+	}
+	fwder, confID := testForwarder(t, s, bc, conf.FilterSubConfig{Enrich: "none", Suppress: "throttle"})
+	pipelines := map[utils.MyULID]*pipeline{}
+	msgs := make([]*model.FullMessage, 5)
+	for i := range msgs {
+		msgs[i] = testFull("repeated")
+		msgs[i].ConfId = confID
+	}
+	if err := s.Stash(conf.Stderr, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, forward(t, fwder, pipelines, msgs[0], msgs[1]), 2)
+	// the retried message has passed already: it does not spend the budget
+	s.NACK(msgs[1].Uid, conf.Stderr)
+	retried := retryFailed(t, s, msgs[1].Uid)
+	assert.Len(t, forward(t, fwder, pipelines, retried), 1)
+	assert.Len(t, forward(t, fwder, pipelines, msgs[2]), 1)
+	assert.Len(t, forward(t, fwder, pipelines, msgs[3]), 0)
+
+	// the pipeline is replaced when the lookup files change, but the
+	// suppression goes on
+	enrich.SetFiles("", nil)
+	assert.Len(t, forward(t, fwder, pipelines, msgs[4]), 0)
+}
+
+func TestForwardSuppressedExtras(t *testing.T) {
+	s := testStore(t)
+	waitReady(t, s)
+	bc := conf.BaseConfig{
+		Suppressions: []conf.SuppressionConfig{{Name: "throttle", Mode: "throttle", Max: 2, Window: time.Hour}},
+	}
+	// the filter emits two copies of the message
+	fwder, confID := testForwarder(t, s, bc, conf.FilterSubConfig{
+		Suppress: "throttle",
+		FilterFunc: `function FilterMessages(m) {
+	return [m, CopySyslogMessage(m), CopySyslogMessage(m)];
+}`,
+	})
+	pipelines := map[utils.MyULID]*pipeline{}
+
+	m := testFull("repeated")
+	m.Uid = utils.NewUid()
+	m.ConfId = confID
+	assert.Len(t, forward(t, fwder, pipelines, m), 2)
+}
+
+func TestForwardRetriedSampling(t *testing.T) {
+	s := testStore(t)
+	waitReady(t, s)
+	noShedRate := 0.0
+	bc := conf.BaseConfig{
+		Samplings: []conf.SamplingConfig{{Name: "shed", StoreWatermark: 10, ShedRate: &noShedRate, ShedSeverity: "warning"}},
+	}
+	fwder, confID := testForwarder(t, s, bc, conf.FilterSubConfig{Sample: "shed"})
+	pipelines := map[utils.MyULID]*pipeline{}
+	msgs := make([]*model.FullMessage, 2)
+	for i := range msgs {
+		msgs[i] = testFull("info")
+		msgs[i].ConfId = confID
+		msgs[i].Fields.Severity = model.Sinfo
+	}
+	if err := s.Stash(conf.Stderr, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, forward(t, fwder, pipelines, msgs[0]), 1)
+	// the load is shed before the retry: the message has been sampled
+	// already, it is not dropped
+	pipelines[confID].sampler.SetLoad(100, 0)
+	s.NACK(msgs[0].Uid, conf.Stderr)
+	retried := retryFailed(t, s, msgs[0].Uid)
+	assert.Len(t, forward(t, fwder, pipelines, retried), 1)
+	assert.Len(t, forward(t, fwder, pipelines, msgs[1]), 0)
+}
+
+func TestForwardLogMetrics(t *testing.T) {
+	s := testStore(t)
+	waitReady(t, s)
+	bc := conf.BaseConfig{LogMetrics: []conf.LogMetricsConfig{{
+		Name:    "forwarded",
+		Metrics: []conf.LogMetricConfig{{Name: "test_forwarded_total", Help: "test", Type: "counter"}},
+	}}}
+	// the first message is rejected once
+	fwder, confID := testForwarder(t, s, bc, conf.FilterSubConfig{
+		LogMetrics: "forwarded",
+		FilterExpr: `message != "dropped"`,
+		FilterFunc: `var rejected = false;
+function FilterMessages(m) {
+	if (m.Message == "rejected" && !rejected) {
+		rejected = true;
+		return FILTER.REJECTED;
+	}
+	return FILTER.PASS;
+}`,
+	})
+	pipelines := map[utils.MyULID]*pipeline{}
+	count := func() float64 {
+		families, err := Registry.Gather()
+		assert.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() == "test_forwarded_total" {
+				return family.GetMetric()[0].GetCounter().GetValue()
+			}
+		}
+		return 0
+	}
+	initial := count()
+
+	passed, dropped, rejected := testFull("passed"), testFull("dropped"), testFull("rejected")
+	for _, m := range []*model.FullMessage{passed, dropped, rejected} {
+		m.ConfId = confID
+	}
+	if err := s.Stash(conf.Stderr, []*model.FullMessage{passed, dropped, rejected}); err != nil {
+		t.Fatal(err)
+	}
+	// only the messages that pass are measured
+	assert.Len(t, forward(t, fwder, pipelines, passed, dropped, rejected), 1)
+	assert.Equal(t, initial+1, count())
+
+	// the retried message is measured once, the rejected message when it
+	// passes
+	s.NACK(passed.Uid, conf.Stderr)
+	assert.Len(t, forward(t, fwder, pipelines, retryFailed(t, s, passed.Uid)), 1)
+	assert.Equal(t, initial+1, count())
+	assert.Len(t, forward(t, fwder, pipelines, retryFailed(t, s, rejected.Uid)), 1)
+	assert.Equal(t, initial+2, count())
+}
@@ -19,8 +19,14 @@ import (
 	"github.com/golang/snappy"
 	"github.com/inconshreveable/log15"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/javascript"
+	"github.com/stephane-martin/skewer/logmetrics"
 	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/redact"
+	"github.com/stephane-martin/skewer/sample"
+	"github.com/stephane-martin/skewer/suppress"
 	"github.com/stephane-martin/skewer/sys/kring"
 	"github.com/stephane-martin/skewer/utils"
 	"github.com/stephane-martin/skewer/utils/db"
@@ -110,7 +116,7 @@ func InitRegistry() {
 		)
 
 		Registry = prometheus.NewRegistry()
-		Registry.MustRegister(badgerGauge, ackCounter, messageFilterCounter, retrieveTimeSummary, lsmSize, vlogSize)
+		Registry.MustRegister(badgerGauge, ackCounter, messageFilterCounter, retrieveTimeSummary, lsmSize, vlogSize, javascript.TimeoutCounter, redact.RedactionCounter, suppress.SuppressedCounter, sample.SampledCounter, logmetrics.DroppedCounter)
 	})
 }
 
@@ -208,6 +214,11 @@ type MessageStore struct {
 	OutputsChans   map[conf.DestinationType]chan []*model.FullMessage
 	zeroMsgFlags   map[conf.DestinationType]*atomic.Bool
 
+	// retried holds the messages that have been pushed back from the
+	// failed queues, until they are ACKed or get a permanent error
+	retried     map[conf.DestinationType]map[utils.MyULID]struct{}
+	retriedLock sync.Mutex
+
 	ackQueue        *queue.AckQueue
 	nackQueue       *queue.AckQueue
 	permerrorsQueue *queue.AckQueue
@@ -216,6 +227,7 @@ type MessageStore struct {
 	BatchSize       uint32
 	addMissingMsgID bool
 	generator       *utils.Generator
+	generatorLock   sync.Mutex
 	uidsTmpBuf      []utils.MyULID
 }
 
@@ -602,6 +614,7 @@ func NewStore(ctx context.Context, cfg conf.StoreConfig, r kring.Ring, dests con
 		closedChan:      make(chan struct{}),
 		OutputsChans:    make(map[conf.DestinationType]chan []*model.FullMessage, len(conf.Destinations)),
 		zeroMsgFlags:    make(map[conf.DestinationType]*atomic.Bool, len(conf.Destinations)),
+		retried:         make(map[conf.DestinationType]map[utils.MyULID]struct{}, len(conf.Destinations)),
 		addMissingMsgID: cfg.AddMissingMsgID,
 		generator:       utils.NewGenerator(),
 		count:           utils.NewRefCount(),
@@ -637,6 +650,7 @@ func NewStore(ctx context.Context, cfg conf.StoreConfig, r kring.Ring, dests con
 	for _, dest := range conf.Destinations {
 		store.OutputsChans[dest] = make(chan []*model.FullMessage)
 		store.zeroMsgFlags[dest] = atomic.NewBool(false)
+		store.retried[dest] = make(map[utils.MyULID]struct{})
 	}
 
 	store.wg.Add(1)
@@ -993,51 +1007,52 @@ func (s *MessageStore) resetFailuresByDest(dest conf.DestinationType) (err error
 		return expiredUIDs, invalidUIDs
 	}
 
-	doReset := func() (nbExpired int, nbInvalid int, err error) {
+	doReset := func() (expired []utils.MyULID, nbInvalid int, err error) {
 		txn := db.NewNTransaction(s.badger, true)
 		defer txn.Discard()
 
 		expiredUIDs, invalidUIDs := iterate(txn)
 
 		if len(invalidUIDs) == 0 && len(expiredUIDs) == 0 {
-			return 0, 0, nil
+			return nil, 0, nil
 		}
 
 		if len(invalidUIDs) > 0 {
 			err := failedDB.DeleteMany(invalidUIDs, txn)
 			if err != nil {
-				return 0, 0, eerrors.Wrap(err, "Failed to delete invalid entries")
+				return nil, 0, eerrors.Wrap(err, "Failed to delete invalid entries")
 			}
 		}
 
 		if len(expiredUIDs) == 0 {
 			err := txn.Commit(nil)
 			if err != nil {
-				return 0, 0, err
+				return nil, 0, err
 			}
-			return 0, len(invalidUIDs), nil
+			return nil, len(invalidUIDs), nil
 		}
 
 		err = readyDB.AddManySame(expiredUIDs, "true", txn)
 		if err != nil {
-			return 0, 0, eerrors.Wrap(err, "Failed to push expired entries to the ready queue")
+			return nil, 0, eerrors.Wrap(err, "Failed to push expired entries to the ready queue")
 		}
 
 		err = failedDB.DeleteMany(expiredUIDs, txn)
 		if err != nil {
-			return 0, 0, eerrors.Wrap(err, "Failed to delete expired entries from the failed queue")
+			return nil, 0, eerrors.Wrap(err, "Failed to delete expired entries from the failed queue")
 		}
 
 		err = txn.Commit(nil)
 		if err != nil {
-			return 0, 0, err
+			return nil, 0, err
 		}
-		return len(expiredUIDs), len(invalidUIDs), nil
+		return expiredUIDs, len(invalidUIDs), nil
 	}
 
-	var nbExpired, nbInvalid int
+	var expired []utils.MyULID
+	var nbInvalid int
 	for {
-		nbExpired, nbInvalid, err = doReset()
+		expired, nbInvalid, err = doReset()
 		if err != badger.ErrConflict {
 			break
 		}
@@ -1045,12 +1060,19 @@ func (s *MessageStore) resetFailuresByDest(dest conf.DestinationType) (err error
 	if err != nil {
 		return eerrors.Wrap(err, "failed to reset expired failures")
 	}
+	nbExpired := len(expired)
+	s.retriedLock.Lock()
+	for _, uid := range expired {
+		s.retried[dest][uid] = struct{}{}
+	}
+	s.retriedLock.Unlock()
 	badgerGauge.WithLabelValues("ready", conf.DestinationNames[dest]).Add(float64(nbExpired))
 	badgerGauge.WithLabelValues("failed", conf.DestinationNames[dest]).Sub(float64(nbExpired + nbInvalid))
 	if nbInvalid > 0 {
 		s.logger.Info("Deleted some invalid entries", "nb", nbInvalid)
 	}
 	if nbExpired > 0 {
+		s.zeroMsgFlags[dest].Store(false)
 		s.logger.Debug("Pushed back expired failures to the ready queue", "nb", nbExpired)
 	}
 	return nil
@@ -1078,6 +1100,10 @@ func (s *MessageStore) PurgeBadger() (err error) {
 		for {
 			txn := db.NewNTransaction(s.badger, true)
 			err = s.backend.Messages.DeleteMany(uids, txn)
+			if err == nil {
+				err = txn.Commit(nil)
+			}
+			txn.Discard()
 			if err == nil {
 				break
 			}
@@ -1177,6 +1203,84 @@ func (s *MessageStore) Ingest(m map[utils.MyULID]string) (int, error) {
 	return length, err
 }
 
+// QueueSizes returns the number of messages in the Store, and the number of
+// messages that are ready to be sent to dest.
+func (s *MessageStore) QueueSizes(dest conf.DestinationType) (stored int64, ready int64) {
+	return gaugeValue(badgerGauge.WithLabelValues("messages", "")),
+		gaugeValue(badgerGauge.WithLabelValues("ready", conf.DestinationNames[dest]))
+}
+
+func gaugeValue(g prometheus.Gauge) int64 {
+	var metric dto.Metric
+	if g.Write(&metric) != nil {
+		return 0
+	}
+	return int64(metric.GetGauge().GetValue())
+}
+
+// Stash stores the extra messages that a filter produced for dest, under
+// fresh ULIDs. As the messages are being sent, they are referenced in the
+// sent queue of dest only: they follow the ACK/NACK bookkeeping of that
+// destination.
+func (s *MessageStore) Stash(dest conf.DestinationType, msgs []*model.FullMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	m := make(map[utils.MyULID]string, len(msgs))
+	uids := make([]utils.MyULID, 0, len(msgs))
+	w := snappy.NewBufferedWriter(ioutil.Discard)
+	for _, msg := range msgs {
+		msg.Uid = s.newUid()
+		b, err := msg.Marshal()
+		if err != nil {
+			return eerrors.Wrap(err, "Error marshaling a stashed message")
+		}
+		cv := compressPool.Get()
+		w.Reset(cv)
+		_, _ = w.Write(b)
+		w.Close()
+		m[msg.Uid] = cv.String()
+		compressPool.Put(cv)
+		uids = append(uids, msg.Uid)
+	}
+
+	for {
+		err := stashHelper(s.badger, s.backend, dest, m, uids)
+		if err == nil {
+			break
+		}
+		if err != badger.ErrConflict {
+			return eerrors.Wrap(err, "Error stashing messages")
+		}
+	}
+	badgerGauge.WithLabelValues("messages", "").Add(float64(len(uids)))
+	badgerGauge.WithLabelValues("sent", conf.DestinationNames[dest]).Add(float64(len(uids)))
+	for _, uid := range uids {
+		s.count.New(uid, 1)
+	}
+	return nil
+}
+
+func stashHelper(badg *badger.DB, bend *Backend, dest conf.DestinationType, m map[utils.MyULID]string, uids []utils.MyULID) error {
+	txn := db.NewNTransaction(badg, true)
+	defer txn.Discard()
+	err := bend.Messages.AddMany(m, txn)
+	if err != nil {
+		return err
+	}
+	err = bend.GetPartition(Sent, dest).AddManySame(uids, "true", txn)
+	if err != nil {
+		return err
+	}
+	return txn.Commit(nil)
+}
+
+func (s *MessageStore) newUid() utils.MyULID {
+	s.generatorLock.Lock()
+	defer s.generatorLock.Unlock()
+	return s.generator.Uid()
+}
+
 func retrieveIterHelper(msgsDB, readyDB db.Partition, batchsize uint32, txn *db.NTransaction, l log15.Logger) (fUIDs []utils.MyULID, messages []*model.FullMessage, invalid []utils.MyULID, keysNotFound int) {
 	messages = msgsSlicePool.Get().([]*model.FullMessage)[:0]
 	allUIDs := uidsPool.Get().([]utils.MyULID)[:0]
@@ -1367,9 +1471,28 @@ func (s *MessageStore) doACK(acks []queue.UidDest) (err error) {
 	for _, ack := range acks {
 		s.count.Dec(ack.Uid)
 	}
+	s.forgetRetried(acks)
 	return nil
 }
 
+// Retried tells whether the message uid has been pushed back from the failed
+// queue of dest: it has been forwarded to dest before.
+func (s *MessageStore) Retried(uid utils.MyULID, dest conf.DestinationType) bool {
+	s.retriedLock.Lock()
+	_, ok := s.retried[dest][uid]
+	s.retriedLock.Unlock()
+	return ok
+}
+
+// forgetRetried removes the messages that are done from the retried ones.
+func (s *MessageStore) forgetRetried(done []queue.UidDest) {
+	s.retriedLock.Lock()
+	for _, d := range done {
+		delete(s.retried[d.Dest], d.Uid)
+	}
+	s.retriedLock.Unlock()
+}
+
 func (s *MessageStore) NACK(uid utils.MyULID, dest conf.DestinationType) {
 	countACK(dest, "nack")
 	_ = s.nackQueue.Put(uid, dest)
@@ -1467,5 +1590,6 @@ func (s *MessageStore) doPermanentError(pes []queue.UidDest) (err error) {
 		badgerGauge.WithLabelValues("permerrors", conf.DestinationNames[dtype]).Add(float64(nb))
 		badgerGauge.WithLabelValues("sent", conf.DestinationNames[dtype]).Sub(float64(nb))
 	}
+	s.forgetRetried(pes)
 	return nil
 }
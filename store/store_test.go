@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T) *MessageStore {
+	InitRegistry()
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	cfg := conf.StoreConfig{
+		Dirname:          t.TempDir(),
+		MaxTableSize:     64 << 20,
+		ValueLogFileSize: 64 << 20,
+		BatchSize:        100,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := NewStore(ctx, cfg, nil, conf.Stderr, false, logger)
+	if !assert.NoError(t, err) {
+		cancel()
+		t.FailNow()
+	}
+	t.Cleanup(func() {
+		cancel()
+		s.WaitFinished()
+	})
+	return s
+}
+
+// waitReady waits until s forwards messages, that is once the messages left
+// in Sent by a previous run have been moved back to Ready.
+func waitReady(t *testing.T, s *MessageStore) {
+	t.Helper()
+	full := testFull("ready")
+	full.Uid = utils.NewUid()
+	b, err := full.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Ingest(map[utils.MyULID]string{full.Uid: string(b)}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msgs := <-s.Outputs(conf.Stderr):
+		for _, m := range msgs {
+			s.ACK(m.Uid, conf.Stderr)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the store does not forward messages")
+	}
+	// the message may have been counted again by the store initialization
+	sent := s.backend.GetPartition(Sent, conf.Stderr)
+	waitFor(t, "the ready message", func() bool { return !inPartition(s, sent, full.Uid) })
+	s.count.Remove(full.Uid)
+}
+
+func testFull(message string) *model.FullMessage {
+	full := model.FullFactory()
+	full.Fields.Message = message
+	full.ConfId = utils.NewUid()
+	return full
+}
+
+// inPartition tells whether uid is in the given partition.
+func inPartition(s *MessageStore, p db.Partition, uid utils.MyULID) bool {
+	txn := db.NewNTransaction(s.badger, false)
+	defer txn.Discard()
+	exists, _ := p.Exists(uid, txn)
+	return exists
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// retryFailed makes the failed message uid expire, and returns it when the
+// store forwards it again.
+func retryFailed(t *testing.T, s *MessageStore, uid utils.MyULID) *model.FullMessage {
+	t.Helper()
+	failed := s.backend.GetPartition(Failed, conf.Stderr)
+	waitFor(t, "the NACK", func() bool { return inPartition(s, failed, uid) })
+	txn := db.NewNTransaction(s.badger, true)
+	err := failed.Set(uid, string(utils.Time2Bytes(time.Now().Add(-time.Hour), nil)), txn)
+	if err == nil {
+		err = txn.Commit(nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.resetFailures(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msgs := <-s.Outputs(conf.Stderr):
+		if len(msgs) != 1 {
+			t.Fatalf("%d messages have been retried", len(msgs))
+		}
+		return msgs[0]
+	case <-time.After(10 * time.Second):
+		t.Fatal("the failed message has not been retried")
+		return nil
+	}
+}
+
+func TestStash(t *testing.T) {
+	s := testStore(t)
+	waitReady(t, s)
+	sent := s.backend.GetPartition(Sent, conf.Stderr)
+	failed := s.backend.GetPartition(Failed, conf.Stderr)
+
+	acked, nacked := testFull("acked"), testFull("nacked")
+	acked.Uid = utils.NewUid()
+	previous := acked.Uid
+	if !assert.NoError(t, s.Stash(conf.Stderr, []*model.FullMessage{acked, nacked})) {
+		return
+	}
+	// the stashed messages get fresh UIDs, and are being sent
+	assert.NotEqual(t, previous, acked.Uid)
+	assert.NotEqual(t, acked.Uid, nacked.Uid)
+	for _, uid := range []utils.MyULID{acked.Uid, nacked.Uid} {
+		assert.True(t, inPartition(s, s.backend.Messages, uid))
+		assert.True(t, inPartition(s, sent, uid))
+	}
+	assert.Empty(t, s.count.GC())
+
+	s.ACK(acked.Uid, conf.Stderr)
+	s.NACK(nacked.Uid, conf.Stderr)
+	waitFor(t, "the ACK", func() bool { return !inPartition(s, sent, acked.Uid) })
+	waitFor(t, "the NACK", func() bool { return inPartition(s, failed, nacked.Uid) })
+	assert.False(t, inPartition(s, sent, nacked.Uid))
+
+	// the acknowledged message is not referenced anymore: it is purged
+	assert.Equal(t, []utils.MyULID{acked.Uid}, s.count.GC())
+	assert.NoError(t, s.PurgeBadger())
+	assert.False(t, inPartition(s, s.backend.Messages, acked.Uid))
+	assert.True(t, inPartition(s, s.backend.Messages, nacked.Uid))
+
+	// the failed message is retried after a minute
+	retried := retryFailed(t, s, nacked.Uid)
+	assert.Equal(t, nacked.Uid, retried.Uid)
+	assert.Equal(t, "nacked", retried.Fields.Message)
+	s.ACK(retried.Uid, conf.Stderr)
+	waitFor(t, "the second ACK", func() bool { return !inPartition(s, sent, nacked.Uid) })
+	assert.Equal(t, []utils.MyULID{nacked.Uid}, s.count.GC())
+}
@@ -0,0 +1,189 @@
+// Package suppress collapses the repeated messages: the repeats are dropped
+// during a time window, and replaced by a summary message, or they are
+// throttled.
+package suppress
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/expr"
+	"github.com/stephane-martin/skewer/model"
+)
+
+// SuppressedCounter counts the dropped messages, by suppression and by
+// destination. It has to be registered by the processes that suppress
+// messages.
+var SuppressedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "skw_suppressed_total",
+		Help: "total number of messages dropped by the suppressions",
+	},
+	[]string{"suppression", "destination"},
+)
+
+type entry struct {
+	// first is the first message of the window, without its fields
+	first  model.FullMessage
+	fields model.SyslogMessage
+	// passed is the number of messages forwarded in the window
+	passed  int
+	dropped int
+	end     time.Time
+}
+
+// Suppressor drops the repeated messages according to a suppression
+// configuration. It is not safe for concurrent use.
+type Suppressor struct {
+	name     string
+	keys     []*expr.Program
+	throttle bool
+	window   time.Duration
+	max      int
+	maxKeys  int
+	entries  map[string]*entry
+	pending  []*model.FullMessage
+	counter  prometheus.Counter
+	now      func() time.Time
+}
+
+// New creates a Suppressor for the messages sent to the destination dest.
+// The invalid keys are logged and ignored.
+func New(config conf.SuppressionConfig, dest string, logger log15.Logger) *Suppressor {
+	s := Suppressor{
+		name:     config.Name,
+		throttle: config.Mode == "throttle",
+		window:   config.Window,
+		max:      config.Max,
+		maxKeys:  config.MaxKeys,
+		entries:  make(map[string]*entry),
+		counter:  SuppressedCounter.WithLabelValues(config.Name, dest),
+		now:      time.Now,
+	}
+	if s.window <= 0 {
+		s.window = 30 * time.Second
+	}
+	if s.max <= 0 {
+		s.max = 1
+	}
+	if s.maxKeys <= 0 {
+		s.maxKeys = 10000
+	}
+	for _, key := range config.Key {
+		p, err := expr.Compile(key)
+		if err != nil {
+			logger.Warn("Invalid suppression key", "suppression", config.Name, "key", key, "error", err)
+			continue
+		}
+		s.keys = append(s.keys, p)
+	}
+	return &s
+}
+
+func (s *Suppressor) key(m *model.SyslogMessage) string {
+	var b strings.Builder
+	for i, p := range s.keys {
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		b.WriteString(p.String(m))
+	}
+	return b.String()
+}
+
+// Keep tells whether m has to be forwarded. When it returns false, m is a
+// repeat and has to be dropped. The messages that are retried after a NACK
+// have passed already: they must not be given to Keep again, or they would
+// be counted twice.
+func (s *Suppressor) Keep(m *model.FullMessage) bool {
+	if m == nil || m.Fields == nil {
+		return true
+	}
+	now := s.now()
+	key := s.key(m.Fields)
+	e, ok := s.entries[key]
+	if ok && !now.Before(e.end) {
+		s.close(key, e, now)
+		ok = false
+	}
+	if !ok {
+		if len(s.entries) >= s.maxKeys {
+			s.expire(now)
+		}
+		if len(s.entries) < s.maxKeys {
+			s.entries[key] = s.open(m, now)
+		}
+		// when there are too many keys, the message is not tracked
+		return true
+	}
+	if s.throttle && e.passed < s.max {
+		e.passed++
+		return true
+	}
+	e.dropped++
+	s.counter.Inc()
+	return false
+}
+
+func (s *Suppressor) open(m *model.FullMessage, now time.Time) *entry {
+	e := entry{first: *m, passed: 1, end: now.Add(s.window)}
+	e.first.Fields = nil
+	if !s.throttle {
+		// keep a copy of the fields, for the summary
+		e.fields = *m.Fields
+		e.fields.Properties = model.Properties{}
+		e.fields.SetAllProperties(m.Fields.GetAllProperties())
+	}
+	return &e
+}
+
+// close ends the window of an entry.
+func (s *Suppressor) close(key string, e *entry, now time.Time) {
+	delete(s.entries, key)
+	if s.throttle || e.dropped == 0 {
+		return
+	}
+	s.pending = append(s.pending, s.summary(e, now))
+}
+
+func (s *Suppressor) expire(now time.Time) {
+	for key, e := range s.entries {
+		if !now.Before(e.end) {
+			s.close(key, e, now)
+		}
+	}
+}
+
+// summary builds the message that replaces the repeats of an entry.
+func (s *Suppressor) summary(e *entry, now time.Time) *model.FullMessage {
+	fields := model.Factory()
+	*fields = e.fields
+	fields.Message = fmt.Sprintf("last message repeated %d times", e.dropped)
+	fields.Structured = ""
+	fields.TimeReportedNum = now.UnixNano()
+	fields.TimeGeneratedNum = now.UnixNano()
+	fields.SetProperty("suppress", "name", s.name)
+	fields.SetProperty("suppress", "repeated", strconv.Itoa(e.dropped))
+	full := model.FullFactoryFrom(fields)
+	full.ClientAddr = e.first.ClientAddr
+	full.SourceType = e.first.SourceType
+	full.SourcePath = e.first.SourcePath
+	full.SourcePort = e.first.SourcePort
+	full.ConnId = e.first.ConnId
+	full.ConfId = e.first.ConfId
+	return full
+}
+
+// Flush ends the windows that are over, and returns the summary messages of
+// the messages that were dropped in dedup mode.
+func (s *Suppressor) Flush() []*model.FullMessage {
+	s.expire(s.now())
+	pending := s.pending
+	s.pending = nil
+	return pending
+}
@@ -0,0 +1,122 @@
+package suppress
+
+import (
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stephane-martin/skewer/conf"
+	"github.com/stephane-martin/skewer/model"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newSuppressor(config conf.SuppressionConfig) (*Suppressor, *clock) {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	if config.Key == nil {
+		config.Key = []string{"hostname", "app_name", "template(message)"}
+	}
+	if config.Window == 0 {
+		config.Window = 10 * time.Second
+	}
+	s := New(config, "stderr", logger)
+	c := &clock{t: time.Date(2018, 2, 14, 19, 4, 54, 0, time.UTC)}
+	s.now = c.now
+	return s, c
+}
+
+func message(uid, host, text string) *model.FullMessage {
+	m := model.FullFactory()
+	m.Uid = utils.MyULID(uid)
+	m.ConfId = utils.MyULID("conf")
+	m.ClientAddr = "10.1.2.3"
+	m.Fields = model.Factory()
+	m.Fields.HostName = host
+	m.Fields.AppName = "cron"
+	m.Fields.Message = text
+	m.Fields.SetProperty("skewer", "client", "10.1.2.3")
+	return m
+}
+
+func TestDedup(t *testing.T) {
+	s, c := newSuppressor(conf.SuppressionConfig{Name: "dedup", Mode: "dedup"})
+
+	assert.True(t, s.Keep(message("1", "web1", "job 1234 done")))
+	assert.False(t, s.Keep(message("2", "web1", "job 5678 done")))
+	assert.False(t, s.Keep(message("3", "web1", "job 42 done")))
+	assert.True(t, s.Keep(message("4", "web2", "job 42 done")))
+	assert.True(t, s.Keep(message("5", "web1", "job failed")))
+	assert.Len(t, s.Flush(), 0)
+
+	c.t = c.t.Add(10 * time.Second)
+	summaries := s.Flush()
+	if assert.Len(t, summaries, 1) {
+		summary := summaries[0]
+		assert.Equal(t, "last message repeated 2 times", summary.Fields.Message)
+		assert.Equal(t, "web1", summary.Fields.HostName)
+		assert.Equal(t, "cron", summary.Fields.AppName)
+		assert.Equal(t, "2", summary.Fields.GetProperty("suppress", "repeated"))
+		assert.Equal(t, "10.1.2.3", summary.Fields.GetProperty("skewer", "client"))
+		assert.Equal(t, "10.1.2.3", summary.ClientAddr)
+		assert.Equal(t, utils.MyULID("conf"), summary.ConfId)
+		assert.Equal(t, c.t, summary.Fields.GetTimeReported().UTC())
+	}
+	assert.Len(t, s.entries, 0)
+
+	// a new window starts
+	assert.True(t, s.Keep(message("6", "web1", "job 1 done")))
+	assert.False(t, s.Keep(message("7", "web1", "job 2 done")))
+	c.t = c.t.Add(11 * time.Second)
+	// the window is closed by the next repeat
+	assert.True(t, s.Keep(message("8", "web1", "job 3 done")))
+	assert.Len(t, s.Flush(), 1)
+
+	assert.Equal(t, float64(3), counterValue(t, "dedup", "stderr"))
+}
+
+func TestThrottle(t *testing.T) {
+	s, c := newSuppressor(conf.SuppressionConfig{Name: "throttle", Mode: "throttle", Key: []string{"hostname"}, Max: 2})
+
+	assert.True(t, s.Keep(message("1", "web1", "a")))
+	assert.True(t, s.Keep(message("2", "web1", "b")))
+	assert.False(t, s.Keep(message("3", "web1", "c")))
+	assert.True(t, s.Keep(message("4", "web2", "d")))
+	assert.False(t, s.Keep(message("5", "web1", "e")))
+
+	c.t = c.t.Add(10 * time.Second)
+	assert.True(t, s.Keep(message("6", "web1", "f")))
+	// no summaries in throttle mode
+	assert.Len(t, s.Flush(), 0)
+
+	assert.Equal(t, float64(2), counterValue(t, "throttle", "stderr"))
+}
+
+func TestMaxKeys(t *testing.T) {
+	s, _ := newSuppressor(conf.SuppressionConfig{Name: "maxkeys", MaxKeys: 2})
+
+	assert.True(t, s.Keep(message("1", "web1", "a")))
+	assert.True(t, s.Keep(message("2", "web2", "a")))
+	// the third key is not tracked
+	assert.True(t, s.Keep(message("3", "web3", "a")))
+	assert.True(t, s.Keep(message("4", "web3", "a")))
+	assert.False(t, s.Keep(message("5", "web1", "a")))
+	assert.Len(t, s.entries, 2)
+}
+
+func counterValue(t *testing.T, labels ...string) float64 {
+	var metric dto.Metric
+	var c prometheus.Counter = SuppressedCounter.WithLabelValues(labels...)
+	assert.NoError(t, c.Write(&metric))
+	return metric.GetCounter().GetValue()
+}
@@ -0,0 +1,108 @@
+package binder
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// the first file descriptor passed by systemd, see sd_listen_fds(3)
+const listenFdsStart = 3
+
+// inheritedSocket is a listening socket passed by systemd (socket
+// activation). The socket belongs to systemd: the binder only gives
+// duplicates of it to the children, so that the socket survives the
+// restarts of skewer.
+type inheritedSocket struct {
+	name   string
+	file   *os.File
+	stream bool
+	addr   net.Addr
+}
+
+// activatedSockets returns the sockets passed by systemd with the LISTEN_PID,
+// LISTEN_FDS and LISTEN_FDNAMES environment variables. The variables are
+// unset, so that the child processes do not see them.
+func activatedSockets() (sockets []*inheritedSocket, err error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < nfds; i++ {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+		s := &inheritedSocket{file: os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))}
+		if i < len(names) {
+			s.name = names[i]
+		}
+		// net.FileListener and net.FilePacketConn work on duplicates of
+		// the file descriptor
+		if l, err := net.FileListener(s.file); err == nil {
+			s.stream = true
+			s.addr = l.Addr()
+			_ = l.Close()
+		} else if c, err := net.FilePacketConn(s.file); err == nil {
+			s.addr = c.LocalAddr()
+			_ = c.Close()
+		} else {
+			return nil, err
+		}
+		sockets = append(sockets, s)
+	}
+	return sockets, nil
+}
+
+// matches tells whether the socket can be used to listen on laddr. The
+// socket matches when its systemd name (FileDescriptorName) is laddr or the
+// port of laddr, or when its address is laddr.
+func (s *inheritedSocket) matches(lnet, laddr string) bool {
+	if IsStream(lnet) != s.stream {
+		return false
+	}
+	_, port, _ := net.SplitHostPort(laddr)
+	if len(s.name) > 0 && (s.name == laddr || s.name == port) {
+		return true
+	}
+	switch a := s.addr.(type) {
+	case *net.UnixAddr:
+		return strings.HasPrefix(lnet, "unix") && a.Name == laddr
+	case *net.TCPAddr:
+		return strings.HasPrefix(lnet, "tcp") && sameAddr(a.IP, a.Port, laddr)
+	case *net.UDPAddr:
+		return strings.HasPrefix(lnet, "udp") && sameAddr(a.IP, a.Port, laddr)
+	}
+	return false
+}
+
+func sameAddr(ip net.IP, port int, laddr string) bool {
+	host, p, err := net.SplitHostPort(laddr)
+	if err != nil || p != strconv.Itoa(port) {
+		return false
+	}
+	requested := net.ParseIP(host)
+	if len(host) == 0 || requested.IsUnspecified() {
+		return ip.IsUnspecified()
+	}
+	return requested.Equal(ip)
+}
+
+func findInherited(sockets []*inheritedSocket, lnet, laddr string) *inheritedSocket {
+	for _, s := range sockets {
+		if s.matches(lnet, laddr) {
+			return s
+		}
+	}
+	return nil
+}
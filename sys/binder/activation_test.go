@@ -0,0 +1,76 @@
+package binder
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInheritedSocketMatches(t *testing.T) {
+	tcpAny := &inheritedSocket{stream: true, addr: &net.TCPAddr{IP: net.IPv6zero, Port: 514}}
+	udpLocal := &inheritedSocket{addr: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 514}}
+	devlog := &inheritedSocket{name: "syslog", addr: &net.UnixAddr{Name: "/run/systemd/journal/syslog", Net: "unixgram"}}
+	named := &inheritedSocket{name: "6514", stream: true, addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6514}}
+
+	tests := []struct {
+		name    string
+		socket  *inheritedSocket
+		lnet    string
+		laddr   string
+		matches bool
+	}{
+		{"any address", tcpAny, "tcp", ":514", true},
+		{"unspecified IPv4", tcpAny, "tcp", "0.0.0.0:514", true},
+		{"other port", tcpAny, "tcp", ":515", false},
+		{"stream vs datagram", tcpAny, "udp", ":514", false},
+		{"same IP", udpLocal, "udp", "127.0.0.1:514", true},
+		{"other IP", udpLocal, "udp", "127.0.0.2:514", false},
+		{"unix path", devlog, "unixgram", "/run/systemd/journal/syslog", true},
+		{"other unix path", devlog, "unixgram", "/dev/log", false},
+		{"name is the port", named, "tcp", ":6514", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.matches, tt.socket.matches(tt.lnet, tt.laddr), tt.name)
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-binder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	live := filepath.Join(dir, "live")
+	conn, err := net.ListenPacket("unixgram", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	removeStaleSocket(live)
+	_, err = os.Lstat(live)
+	assert.NoError(t, err, "a socket in use must be kept")
+
+	stale := filepath.Join(dir, "stale")
+	old, err := net.ListenPacket("unixgram", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// closing a datagram socket leaves its path behind
+	old.Close()
+	removeStaleSocket(stale)
+	_, err = os.Lstat(stale)
+	assert.True(t, os.IsNotExist(err), "a stale socket must be removed")
+
+	regular := filepath.Join(dir, "regular")
+	if err := ioutil.WriteFile(regular, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	removeStaleSocket(regular)
+	_, err = os.Lstat(regular)
+	assert.NoError(t, err, "only sockets are removed")
+}
@@ -59,8 +59,11 @@ func (c *fileConn) Close() error {
 
 type filePConn struct {
 	net.PacketConn
-	uid string
-	err error
+	uid    string
+	err    error
+	addr   string
+	client *clientImpl
+	once   sync.Once
 }
 
 func (c *filePConn) SetWriteBuffer(bytes int) error {
@@ -83,8 +86,28 @@ func (c *filePConn) SetReadBuffer(bytes int) error {
 	return nil
 }
 
-func (c *filePConn) Close() error {
-	return c.PacketConn.Close()
+func (c *filePConn) Close() (err error) {
+	c.once.Do(func() {
+		err = c.PacketConn.Close()
+		// the binder keeps its own copy of the socket
+		_, _ = c.client.writer.Write([]byte(fmt.Sprintf("stoplisten %s", c.addr)))
+	})
+	return err
+}
+
+// ReadMsgUnix reads a datagram and its out-of-band data from a unix socket.
+func (c *filePConn) ReadMsgUnix(b, oob []byte) (n, oobn, flags int, addr *net.UnixAddr, err error) {
+	if uc, ok := c.PacketConn.(*net.UnixConn); ok {
+		return uc.ReadMsgUnix(b, oob)
+	}
+	return 0, 0, 0, nil, errors.New("Not a unix socket")
+}
+
+func (c *filePConn) SyscallConn() (syscall.RawConn, error) {
+	if sc, ok := c.PacketConn.(syscall.Conn); ok {
+		return sc.SyscallConn()
+	}
+	return nil, errors.New("Not a syscall.Conn")
 }
 
 type extConns struct {
@@ -337,7 +360,7 @@ func NewClient(binderFile *os.File, secret *memguard.LockedBuffer, logger log15.
 									rc, err := net.FilePacketConn(rf)
 									rf.Close()
 									if err == nil {
-										c.newPConns.push(addr, &filePConn{PacketConn: rc, uid: uid})
+										c.newPConns.push(addr, &filePConn{PacketConn: rc, uid: uid, addr: addr, client: &c})
 									} else {
 										logger.Warn("Error getting connection from file handler", "error", err)
 									}
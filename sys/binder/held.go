@@ -0,0 +1,183 @@
+package binder
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stephane-martin/skewer/utils"
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// session is the connection between the binder and one binder client.
+type session struct {
+	ctx   context.Context
+	schan chan *ExternalConn
+	pchan chan *ExternalPacketConn
+}
+
+func (s *session) send(c *ExternalConn) bool {
+	select {
+	case s.schan <- c:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// heldListener is a stream listening socket owned by the binder. The
+// accepted connections are sent to the session that owns the listener. A
+// parked listener has no owner: the socket stays open, so that the clients
+// wait in the kernel backlog until a session adopts the listener.
+type heldListener struct {
+	addr      string
+	listener  net.Listener
+	inherited bool
+	mu        sync.Mutex
+	cond      *sync.Cond
+	owner     *session
+	pending   []net.Conn
+	closed    bool
+}
+
+func newHeldListener(addr string, l net.Listener, inherited bool) *heldListener {
+	h := &heldListener{addr: addr, listener: l, inherited: inherited}
+	h.cond = sync.NewCond(&h.mu)
+	return h
+}
+
+func (h *heldListener) ownedBy(s *session) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.owner == s
+}
+
+func (h *heldListener) adopt(s *session) {
+	h.mu.Lock()
+	h.owner = s
+	if d, ok := h.listener.(deadliner); ok {
+		_ = d.SetDeadline(time.Time{})
+	}
+	h.mu.Unlock()
+	h.cond.Broadcast()
+}
+
+func (h *heldListener) park() {
+	h.mu.Lock()
+	h.owner = nil
+	// interrupt Accept without closing the socket
+	if d, ok := h.listener.(deadliner); ok {
+		_ = d.SetDeadline(time.Now())
+	}
+	h.mu.Unlock()
+}
+
+func (h *heldListener) close() {
+	h.mu.Lock()
+	h.closed = true
+	pending := h.pending
+	h.pending = nil
+	h.mu.Unlock()
+	h.cond.Broadcast()
+	_ = h.listener.Close()
+	for _, c := range pending {
+		_ = c.Close()
+	}
+}
+
+// waitOwner blocks until the listener has an owner. It returns nil when the
+// listener has been closed.
+func (h *heldListener) waitOwner() (owner *session, pending []net.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for h.owner == nil && !h.closed {
+		h.cond.Wait()
+	}
+	if h.closed {
+		return nil, nil
+	}
+	pending = h.pending
+	h.pending = nil
+	return h.owner, pending
+}
+
+func (h *heldListener) deliver(owner *session, c net.Conn, logger log15.Logger) {
+	uids := utils.NewUidString()
+	logger.Debug("New accepted connection", "uid", uids, "addr", h.addr)
+	if !owner.send(&ExternalConn{Uid: uids, Conn: c, Addr: h.addr}) {
+		// the owner is gone: keep the connection for the next owner
+		h.mu.Lock()
+		if h.owner == owner {
+			h.owner = nil
+		}
+		h.pending = append(h.pending, c)
+		h.mu.Unlock()
+	}
+}
+
+func (h *heldListener) acceptLoop(logger log15.Logger) {
+	for {
+		owner, pending := h.waitOwner()
+		if owner == nil {
+			return
+		}
+		for _, c := range pending {
+			h.deliver(owner, c, logger)
+		}
+		c, err := h.listener.Accept()
+		if err == nil {
+			h.mu.Lock()
+			owner = h.owner
+			if owner == nil {
+				// parked while accepting
+				h.pending = append(h.pending, c)
+			}
+			h.mu.Unlock()
+			if owner != nil {
+				h.deliver(owner, c, logger)
+			}
+		} else if eerrors.IsTimeout(err) {
+			// the listener has been parked
+		} else if eerrors.HasFileClosed(err) {
+			logger.Debug("Accept has been closed", "error", err, "addr", h.addr)
+			return
+		} else {
+			logger.Warn("Accept error", "error", err, "addr", h.addr)
+			return
+		}
+	}
+}
+
+// heldPacket is a packet socket owned by the binder. The owner session has
+// a duplicate of it.
+type heldPacket struct {
+	addr      string
+	conn      net.PacketConn
+	inherited bool
+	owner     *session
+}
+
+func (p *heldPacket) file() (*os.File, error) {
+	if f, ok := p.conn.(interface {
+		File() (*os.File, error)
+	}); ok {
+		return f.File()
+	}
+	return nil, eerrors.New("Not a file based connection")
+}
+
+func (p *heldPacket) close() {
+	_ = p.conn.Close()
+	parts := strings.SplitN(p.addr, ":", 2)
+	if parts[0] == "unixgram" && !p.inherited && !strings.HasPrefix(parts[1], "@") {
+		_ = os.Remove(parts[1])
+	}
+}
@@ -0,0 +1,202 @@
+package binder
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/stretchr/testify/assert"
+)
+
+func discardLogger() log15.Logger {
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	return logger
+}
+
+func newTestSession(ctx context.Context) *session {
+	return &session{
+		ctx:   ctx,
+		schan: make(chan *ExternalConn),
+		pchan: make(chan *ExternalPacketConn),
+	}
+}
+
+func receiveConn(t *testing.T, s *session) *ExternalConn {
+	t.Helper()
+	select {
+	case c := <-s.schan:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection delivered")
+		return nil
+	}
+}
+
+func noConn(t *testing.T, s *session) {
+	t.Helper()
+	select {
+	case c := <-s.schan:
+		t.Fatalf("unexpected connection from %s", c.Conn.RemoteAddr())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHeldListenerHandover(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "tcp:" + l.Addr().String()
+	h := newHeldListener(addr, l, false)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.acceptLoop(discardLogger())
+	}()
+	defer func() {
+		h.close()
+		wg.Wait()
+	}()
+
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// a connection is delivered to the owner
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	s1 := newTestSession(ctx1)
+	h.adopt(s1)
+	c1 := dial()
+	defer c1.Close()
+	ec := receiveConn(t, s1)
+	assert.Equal(t, addr, ec.Addr)
+	assert.NotEmpty(t, ec.Uid)
+	_ = ec.Conn.Close()
+
+	// a parked listener keeps the clients in the backlog
+	h.park()
+	cancel1()
+	assert.True(t, h.ownedBy(nil))
+	c2 := dial()
+	defer c2.Close()
+	noConn(t, s1)
+
+	// the next owner gets them
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	s2 := newTestSession(ctx2)
+	h.adopt(s2)
+	ec = receiveConn(t, s2)
+	assert.Equal(t, c2.LocalAddr().String(), ec.Conn.RemoteAddr().String())
+	_ = ec.Conn.Close()
+
+	// the connection accepted for an owner that has gone is kept pending
+	cancel2()
+	c3 := dial()
+	defer c3.Close()
+	for deadline := time.Now().Add(5 * time.Second); !h.ownedBy(nil); {
+		if time.Now().After(deadline) {
+			t.Fatal("the connection was not parked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	defer cancel3()
+	s3 := newTestSession(ctx3)
+	h.adopt(s3)
+	ec = receiveConn(t, s3)
+	assert.Equal(t, c3.LocalAddr().String(), ec.Conn.RemoteAddr().String())
+	_ = ec.Conn.Close()
+}
+
+func TestBinderHold(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skewer-binder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Binder{
+		ctx:       ctx,
+		wg:        &sync.WaitGroup{},
+		logger:    discardLogger(),
+		listeners: make(map[string]*heldListener),
+		packets:   make(map[string]*heldPacket),
+	}
+	defer func() {
+		cancel()
+		b.closeAll()
+		b.Wait()
+	}()
+
+	stream := "unix:" + filepath.Join(dir, "stream")
+	packet := "unixgram:" + filepath.Join(dir, "packet")
+	listen := func(s *session) *os.File {
+		if err := b.listenStream(s, stream); err != nil {
+			t.Fatal(err)
+		}
+		f, err := b.listenPacket(s, packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	s1 := newTestSession(ctx)
+	f1 := listen(s1)
+	_ = f1.Close()
+	h := b.listeners[stream]
+	p := b.packets[packet]
+
+	// while held, the sockets of a stopped session are parked
+	b.Hold()
+	b.endSession(s1)
+	assert.Contains(t, b.listeners, stream)
+	assert.Contains(t, b.packets, packet)
+	assert.True(t, h.ownedBy(nil))
+	assert.Nil(t, p.owner)
+
+	// and the next session takes the same sockets over
+	s2 := newTestSession(ctx)
+	f2 := listen(s2)
+	_ = f2.Close()
+	assert.True(t, b.listeners[stream] == h)
+	assert.True(t, b.packets[packet] == p)
+	assert.True(t, h.ownedBy(s2))
+	assert.True(t, p.owner == s2)
+
+	// Release keeps the sockets in use
+	b.Release()
+	assert.Contains(t, b.listeners, stream)
+	assert.Contains(t, b.packets, packet)
+
+	// and closes the parked ones
+	b.Hold()
+	b.endSession(s2)
+	b.Release()
+	assert.Empty(t, b.listeners)
+	assert.Empty(t, b.packets)
+	_, err = os.Lstat(filepath.Join(dir, "packet"))
+	assert.True(t, os.IsNotExist(err))
+
+	// without Hold, the sockets are closed right away
+	s3 := newTestSession(ctx)
+	f3 := listen(s3)
+	_ = f3.Close()
+	b.stopListen(s3, stream)
+	b.stopListen(s3, packet)
+	assert.Empty(t, b.listeners)
+	assert.Empty(t, b.packets)
+}
@@ -24,72 +24,58 @@ type ExternalConn struct {
 
 type ExternalPacketConn struct {
 	Uid  string
-	Conn net.PacketConn
+	File *os.File
 	Addr string
 }
 
-func listen(ctx context.Context, wg *sync.WaitGroup, logger log15.Logger, schan chan *ExternalConn, addr string) (net.Listener, error) {
+func listen(logger log15.Logger, addr string, inherited []*inheritedSocket) (l net.Listener, s *inheritedSocket, err error) {
 	parts := strings.SplitN(addr, ":", 2)
 	lnet := parts[0]
 	laddr := parts[1]
 
-	l, err := net.Listen(lnet, laddr)
+	s = findInherited(inherited, lnet, laddr)
+	if s != nil {
+		logger.Info("Using the socket passed by systemd", "addr", addr, "name", s.name)
+		l, err = net.FileListener(s.file)
+	} else {
+		l, err = net.Listen(lnet, laddr)
+	}
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if lnet == "unix" || lnet == "unixpacket" {
+	if s == nil && (lnet == "unix" || lnet == "unixpacket") {
 		_ = os.Chmod(laddr, 0777)
 		l.(*net.UnixListener).SetUnlinkOnClose(true)
 	}
-
-	cctx, cancel := context.WithCancel(ctx)
-
-	wg.Add(1)
-	go func() {
-		<-cctx.Done()
-		_ = l.Close()
-		wg.Done()
-	}()
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for {
-			c, err := l.Accept()
-			if err == nil {
-				uids := utils.NewUidString()
-				logger.Debug("New accepted connection", "uid", uids, "addr", addr)
-				schan <- &ExternalConn{Uid: uids, Conn: c, Addr: addr}
-			} else if eerrors.HasFileClosed(err) {
-				logger.Debug("Accept has been closed", "error", err, "addr", addr)
-				cancel()
-				return
-			} else {
-				logger.Warn("Accept error", "error", err, "addr", addr)
-				cancel()
-				return
-			}
-		}
-	}()
-
-	return l, nil
+	return l, s, nil
 }
 
-func listenPacket(addr string) (conn net.PacketConn, err error) {
+func listenPacket(logger log15.Logger, addr string, inherited []*inheritedSocket) (conn net.PacketConn, s *inheritedSocket, err error) {
 	parts := strings.SplitN(addr, ":", 2)
 	lnet := parts[0]
 	laddr := parts[1]
 
-	conn, err = net.ListenPacket(lnet, laddr)
+	s = findInherited(inherited, lnet, laddr)
+	if s != nil {
+		logger.Info("Using the socket passed by systemd", "addr", addr, "name", s.name)
+		conn, err = net.FilePacketConn(s.file)
+	} else {
+		if lnet == "unixgram" && !strings.HasPrefix(laddr, "@") {
+			removeStaleSocket(laddr)
+		}
+		conn, err = net.ListenPacket(lnet, laddr)
+	}
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if lnet == "unixgram" {
-		_ = os.Chmod(laddr, 0777)
+		if s == nil {
+			_ = os.Chmod(laddr, 0777)
+		}
 		_ = conn.(*net.UnixConn).SetReadBuffer(65536)
 		_ = conn.(*net.UnixConn).SetWriteBuffer(65536)
 	} else {
@@ -97,22 +83,204 @@ func listenPacket(addr string) (conn net.PacketConn, err error) {
 		_ = conn.(*net.UDPConn).SetWriteBuffer(65535)
 	}
 
-	return conn, nil
+	return conn, s, nil
 }
 
-func Server(ctx context.Context, parentsHandles []uintptr, secret *memguard.LockedBuffer, logger log15.Logger) (wg *sync.WaitGroup, err error) {
-	wg = &sync.WaitGroup{}
+// Binder owns the listening sockets and serves them to the child processes.
+// The children only get duplicates of the sockets.
+//
+// When the binder holds the sockets (see Hold), the sockets that the
+// children stop using are parked instead of being closed: they stay bound,
+// the new TCP clients wait in the kernel backlog and the UDP datagrams are
+// queued in the socket buffer, until a new child asks to listen on the same
+// addresses.
+type Binder struct {
+	ctx       context.Context
+	wg        *sync.WaitGroup
+	secret    *memguard.LockedBuffer
+	logger    log15.Logger
+	inherited []*inheritedSocket
+	mu        sync.Mutex
+	held      bool
+	listeners map[string]*heldListener
+	packets   map[string]*heldPacket
+}
+
+// Server serves the listening sockets to the child processes. The sockets
+// passed by systemd (socket activation) are used when they match the
+// requested addresses, instead of opening new ones.
+func Server(ctx context.Context, parentsHandles []uintptr, secret *memguard.LockedBuffer, logger log15.Logger) (b *Binder, err error) {
+	inherited, err := activatedSockets()
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Error adopting the sockets passed by systemd")
+	}
+	for _, s := range inherited {
+		logger.Info("Socket passed by systemd", "name", s.name, "addr", s.addr.String(), "stream", s.stream)
+	}
+	b = &Binder{
+		ctx:       ctx,
+		wg:        &sync.WaitGroup{},
+		secret:    secret,
+		logger:    logger.New("class", "binder"),
+		inherited: inherited,
+		listeners: make(map[string]*heldListener),
+		packets:   make(map[string]*heldPacket),
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		<-ctx.Done()
+		b.closeAll()
+	}()
+	err = b.Serve(parentsHandles)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Serve serves the listening sockets to more child processes.
+func (b *Binder) Serve(parentsHandles []uintptr) error {
 	for _, handle := range parentsHandles {
-		err = serveOne(ctx, wg, handle, secret, logger)
+		err := b.serveOne(handle)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wait waits until the binder has stopped.
+func (b *Binder) Wait() {
+	b.wg.Wait()
+}
+
+// Hold makes the binder keep the sockets that the children stop using, so
+// that the next child can take them over.
+func (b *Binder) Hold() {
+	b.mu.Lock()
+	b.held = true
+	b.mu.Unlock()
+}
+
+// Release ends Hold. The parked sockets that no child has taken over are
+// closed.
+func (b *Binder) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.held = false
+	for addr, h := range b.listeners {
+		if h.ownedBy(nil) {
+			b.logger.Debug("Closing parked listener", "addr", addr)
+			h.close()
+			delete(b.listeners, addr)
+		}
+	}
+	for addr, p := range b.packets {
+		if p.owner == nil {
+			b.logger.Debug("Closing parked packet socket", "addr", addr)
+			p.close()
+			delete(b.packets, addr)
+		}
+	}
+}
+
+func (b *Binder) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for addr, h := range b.listeners {
+		h.close()
+		delete(b.listeners, addr)
+	}
+	for addr, p := range b.packets {
+		p.close()
+		delete(b.packets, addr)
+	}
+}
+
+func (b *Binder) listenStream(s *session, addr string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if h, ok := b.listeners[addr]; ok {
+		b.logger.Info("Handing over the listening socket", "addr", addr)
+		h.adopt(s)
+		return nil
+	}
+	l, inherited, err := listen(b.logger, addr, b.inherited)
+	if err != nil {
+		return err
+	}
+	h := newHeldListener(addr, l, inherited != nil)
+	h.adopt(s)
+	b.listeners[addr] = h
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		h.acceptLoop(b.logger)
+	}()
+	return nil
+}
+
+func (b *Binder) listenPacket(s *session, addr string) (*os.File, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.packets[addr]
+	if ok {
+		b.logger.Info("Handing over the packet socket", "addr", addr)
+	} else {
+		conn, inherited, err := listenPacket(b.logger, addr, b.inherited)
 		if err != nil {
 			return nil, err
 		}
+		p = &heldPacket{addr: addr, conn: conn, inherited: inherited != nil}
+		b.packets[addr] = p
 	}
-	return wg, nil
+	p.owner = s
+	return p.file()
+}
+
+// stopListen is called when session s does not use addr anymore.
+func (b *Binder) stopListen(s *session, addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drop(s, addr)
 }
 
-func serveOne(ctx context.Context, wg *sync.WaitGroup, parentFD uintptr, secret *memguard.LockedBuffer, logger log15.Logger) error {
-	logger = logger.New("class", "binder")
+// endSession is called when the client of session s has gone.
+func (b *Binder) endSession(s *session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for addr := range b.listeners {
+		b.drop(s, addr)
+	}
+	for addr := range b.packets {
+		b.drop(s, addr)
+	}
+}
+
+func (b *Binder) drop(s *session, addr string) {
+	if h, ok := b.listeners[addr]; ok && h.ownedBy(s) {
+		if b.held {
+			b.logger.Info("Parking listener", "addr", addr)
+			h.park()
+		} else {
+			h.close()
+			delete(b.listeners, addr)
+		}
+	}
+	if p, ok := b.packets[addr]; ok && p.owner == s {
+		if b.held {
+			b.logger.Info("Parking packet socket", "addr", addr)
+			p.owner = nil
+		} else {
+			p.close()
+			delete(b.packets, addr)
+		}
+	}
+}
+
+func (b *Binder) serveOne(parentFD uintptr) error {
+	logger := b.logger
 	parentFile := os.NewFile(parentFD, "parent_file")
 
 	c, err := net.FileConn(parentFile)
@@ -122,49 +290,39 @@ func serveOne(ctx context.Context, wg *sync.WaitGroup, parentFD uintptr, secret
 	}
 	childConn := c.(*net.UnixConn)
 
-	cctx, cancel := context.WithCancel(ctx)
-	wg.Add(1)
+	cctx, cancel := context.WithCancel(b.ctx)
+	b.wg.Add(1)
 	go func() {
 		<-cctx.Done()
 		childConn.Close()
-		wg.Done()
+		b.wg.Done()
 	}()
 
-	schan := make(chan *ExternalConn)
-	pchan := make(chan *ExternalPacketConn)
-	writer := utils.NewEncryptWriter(childConn, secret)
+	s := &session{
+		ctx:   cctx,
+		schan: make(chan *ExternalConn),
+		pchan: make(chan *ExternalPacketConn),
+	}
+	writer := utils.NewEncryptWriter(childConn, b.secret)
 
-	wg.Add(1)
+	b.wg.Add(1)
 	go func() {
-		defer wg.Done()
+		defer b.wg.Done()
 		var smsg string
 		for {
 			select {
 			case <-cctx.Done():
 				return
-			case bc := <-pchan:
-				lnet := strings.SplitN(bc.Addr, ":", 2)[0]
-				var connFile *os.File
-				var err error
-				if lnet == "unixgram" {
-					connFile, err = bc.Conn.(*net.UnixConn).File()
-				} else {
-					connFile, err = bc.Conn.(*net.UDPConn).File()
+			case bc := <-s.pchan:
+				rights := syscall.UnixRights(int(bc.File.Fd()))
+				logger.Debug("Sending new connection to child", "uid", bc.Uid, "addr", bc.Addr)
+				smsg = fmt.Sprintf("newconn %s %s", bc.Uid, bc.Addr)
+				_, _, err := writer.WriteMsgUnix([]byte(smsg), rights, nil)
+				if err != nil {
+					logger.Warn("Failed to send FD to binder client", "error", err)
 				}
-				bc.Conn.Close()
-
-				if err == nil {
-					rights := syscall.UnixRights(int(connFile.Fd()))
-					logger.Debug("Sending new connection to child", "uid", bc.Uid, "addr", bc.Addr)
-					smsg = fmt.Sprintf("newconn %s %s", bc.Uid, bc.Addr)
-					_, _, err := writer.WriteMsgUnix([]byte(smsg), rights, nil)
-					//_, _, err := childConn.WriteMsgUnix([]byte(smsg), rights, nil)
-					if err != nil {
-						logger.Warn("Failed to send FD to binder client", "error", err)
-					}
-					connFile.Close()
-				}
-			case bc := <-schan:
+				bc.File.Close()
+			case bc := <-s.schan:
 				lnet := strings.SplitN(bc.Addr, ":", 2)[0]
 				var connFile *os.File
 				var err error
@@ -179,7 +337,6 @@ func serveOne(ctx context.Context, wg *sync.WaitGroup, parentFD uintptr, secret
 					logger.Debug("Sending new connection to child", "uid", bc.Uid, "addr", bc.Addr)
 					smsg = fmt.Sprintf("newconn %s %s", bc.Uid, bc.Addr)
 					_, _, err := writer.WriteMsgUnix([]byte(smsg), rights, nil)
-					//_, _, err := childConn.WriteMsgUnix([]byte(smsg), rights, nil)
 					if err != nil {
 						logger.Warn("Failed to send FD to binder client", "error", err)
 					}
@@ -191,17 +348,17 @@ func serveOne(ctx context.Context, wg *sync.WaitGroup, parentFD uintptr, secret
 		}
 	}()
 
-	wg.Add(1)
+	b.wg.Add(1)
 	go func() {
 		defer func() {
+			b.endSession(s)
 			cancel()
-			wg.Done()
+			b.wg.Done()
 		}()
 
 		scanner := utils.WithRecover(bufio.NewScanner(childConn))
-		scanner.Split(utils.MakeDecryptSplit(secret))
+		scanner.Split(utils.MakeDecryptSplit(b.secret))
 
-		listeners := map[string]net.Listener{}
 		var rmsg string
 		for scanner.Scan() {
 			rmsg = strings.Trim(scanner.Text(), " \r\n")
@@ -215,23 +372,21 @@ func serveOne(ctx context.Context, wg *sync.WaitGroup, parentFD uintptr, secret
 				for _, addr := range strings.Split(args, " ") {
 					lnet := strings.SplitN(addr, ":", 2)[0]
 					if IsStream(lnet) {
-						l, err := listen(cctx, wg, logger, schan, addr)
+						err := b.listenStream(s, addr)
 						if err == nil {
 							_, err := writer.Write([]byte(fmt.Sprintf("confirmlisten %s", addr)))
 							if err != nil {
 								logger.Warn("Failed to confirm listen to client", "error", err)
-								_ = l.Close()
-							} else {
-								listeners[addr] = l
+								b.stopListen(s, addr)
 							}
 						} else {
 							logger.Warn("Listen error", "error", err, "addr", addr)
 							_, _ = writer.Write([]byte(fmt.Sprintf("error %s %s", addr, err.Error())))
 						}
 					} else {
-						c, err := listenPacket(addr)
+						f, err := b.listenPacket(s, addr)
 						if err == nil {
-							pchan <- &ExternalPacketConn{Addr: addr, Conn: c, Uid: utils.NewUidString()}
+							s.pchan <- &ExternalPacketConn{Addr: addr, File: f, Uid: utils.NewUidString()}
 						} else {
 							logger.Warn("ListenPacket error", "error", err, "addr", addr)
 							_, _ = writer.Write([]byte(fmt.Sprintf("error %s %s", addr, err.Error())))
@@ -240,11 +395,7 @@ func serveOne(ctx context.Context, wg *sync.WaitGroup, parentFD uintptr, secret
 				}
 
 			case "stoplisten":
-				l, ok := listeners[args]
-				if ok {
-					_ = l.Close()
-					delete(listeners, args)
-				}
+				b.stopListen(s, args)
 				logger.Debug("Asked to stop listening", "addr", args)
 				_, _ = writer.Write([]byte(fmt.Sprintf("stopped %s", args)))
 
@@ -261,3 +412,22 @@ func serveOne(ctx context.Context, wg *sync.WaitGroup, parentFD uintptr, secret
 	}()
 	return nil
 }
+
+// removeStaleSocket removes the unix datagram socket at path when it was left
+// by a previous syslog daemon, as /dev/log usually is. A socket that still
+// accepts datagrams is left in place, so that the listen fails instead of
+// stealing the address from a running process.
+func removeStaleSocket(path string) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	conn, err := net.Dial("unixgram", path)
+	if err == nil {
+		_ = conn.Close()
+		return
+	}
+	if eerrors.HasConnRefused(err) {
+		_ = os.Remove(path)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package sys
+
+import (
+	"errors"
+	"syscall"
+)
+
+var CredentialsOOBSize = 0
+
+func EnablePassCred(conn syscall.Conn) error {
+	return errors.New("SO_PASSCRED is only supported on Linux")
+}
+
+func ParseCredentials(oob []byte) (pid int32, uid uint32, gid uint32, ok bool) {
+	return 0, 0, 0, false
+}
@@ -0,0 +1,47 @@
+//go:build linux
+// +build linux
+
+package sys
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// CredentialsOOBSize is the size of the out-of-band buffer that receives the
+// credentials of the sender of a datagram.
+var CredentialsOOBSize = unix.CmsgSpace(unix.SizeofUcred)
+
+// EnablePassCred sets SO_PASSCRED on a unix datagram socket, so that the
+// kernel attaches the credentials of the sender to each datagram.
+func EnablePassCred(conn syscall.Conn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PASSCRED, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// ParseCredentials extracts the credentials of the sender from the
+// out-of-band data of a datagram.
+func ParseCredentials(oob []byte) (pid int32, uid uint32, gid uint32, ok bool) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	for i := range msgs {
+		creds, err := unix.ParseUnixCredentials(&msgs[i])
+		if err == nil {
+			return creds.Pid, creds.Uid, creds.Gid, true
+		}
+	}
+	return 0, 0, 0, false
+}
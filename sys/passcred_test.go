@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+package sys
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseCredentials(t *testing.T) {
+	oob := unix.UnixCredentials(&unix.Ucred{Pid: 1234, Uid: 1000, Gid: 100})
+	pid, uid, gid, ok := ParseCredentials(oob)
+	assert.True(t, ok)
+	assert.Equal(t, int32(1234), pid)
+	assert.Equal(t, uint32(1000), uid)
+	assert.Equal(t, uint32(100), gid)
+
+	rights := unix.UnixRights(0)
+	_, _, _, ok = ParseCredentials(rights)
+	assert.False(t, ok, "rights are not credentials")
+
+	_, _, _, ok = ParseCredentials(nil)
+	assert.False(t, ok)
+
+	_, _, _, ok = ParseCredentials([]byte{1, 2, 3})
+	assert.False(t, ok, "truncated control message")
+}
@@ -0,0 +1,252 @@
+// Package acl implements the access rules of the network sources: which
+// clients may connect, and how much they may send.
+package acl
+
+import (
+	"crypto/x509"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+// Action is what happens to the traffic of a client that exceeds its rate limits.
+type Action int
+
+const (
+	// Drop discards the messages over the limit.
+	Drop Action = iota
+	// Slow stops reading from the client until it is back under the limit.
+	Slow
+	// Close closes the connection of the client.
+	Close
+)
+
+var actionNames = map[Action]string{
+	Drop:  "drop",
+	Slow:  "slow",
+	Close: "close",
+}
+
+func (a Action) String() string {
+	return actionNames[a]
+}
+
+// ParseAction converts the name of an Action. The default is Drop.
+func ParseAction(s string) (Action, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 0 {
+		return Drop, nil
+	}
+	for a, name := range actionNames {
+		if name == s {
+			return a, nil
+		}
+	}
+	return Drop, eerrors.Errorf("Unknown rate limit action: '%s'", s)
+}
+
+// ParseNetworks parses a list of CIDR networks. Single IP addresses are
+// accepted too.
+func ParseNetworks(specs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if len(spec) == 0 {
+			continue
+		}
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, eerrors.Errorf("Invalid IP address: '%s'", spec)
+			}
+			if ip.To4() != nil {
+				spec += "/32"
+			} else {
+				spec += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, eerrors.Wrapf(err, "Invalid network: '%s'", spec)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy holds the access rules of a source.
+type Policy struct {
+	Allow    []*net.IPNet
+	Deny     []*net.IPNet
+	Subjects []string
+	SANs     []string
+	Action   Action
+	messages *Limiter
+	bytes    *Limiter
+}
+
+// NewPolicy builds a Policy. subjects and sans are shell patterns, as
+// accepted by path.Match. A zero rate means no limit.
+func NewPolicy(allow, deny []*net.IPNet, subjects, sans []string, msgRate, byteRate float64, action Action) (*Policy, error) {
+	for _, pattern := range append(append([]string{}, subjects...), sans...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, eerrors.Wrapf(err, "Invalid certificate pattern: '%s'", pattern)
+		}
+	}
+	if msgRate < 0 || byteRate < 0 {
+		return nil, eerrors.New("Rate limits can't be negative")
+	}
+	p := &Policy{
+		Allow:    allow,
+		Deny:     deny,
+		Subjects: subjects,
+		SANs:     sans,
+		Action:   action,
+	}
+	if msgRate > 0 {
+		p.messages = NewLimiter(msgRate)
+	}
+	if byteRate > 0 {
+		p.bytes = NewLimiter(byteRate)
+	}
+	return p, nil
+}
+
+// AllowedIP tells whether the client at ip may connect. Denied networks
+// take precedence. When no allowed network is given, all the clients that
+// are not denied may connect.
+func (p *Policy) AllowedIP(ip net.IP) bool {
+	if p == nil || ip == nil {
+		return true
+	}
+	if contains(p.Deny, ip) {
+		return false
+	}
+	return len(p.Allow) == 0 || contains(p.Allow, ip)
+}
+
+// AllowedAddr is like AllowedIP for a network address. Addresses that do
+// not carry an IP (unix sockets) are always allowed.
+func (p *Policy) AllowedAddr(addr net.Addr) bool {
+	if p == nil || addr == nil {
+		return true
+	}
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return p.AllowedIP(a.IP)
+	case *net.UDPAddr:
+		return p.AllowedIP(a.IP)
+	case *net.IPAddr:
+		return p.AllowedIP(a.IP)
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return true
+	}
+	return p.AllowedIP(net.ParseIP(host))
+}
+
+// ChecksCertificates tells whether the policy restricts the client certificates.
+func (p *Policy) ChecksCertificates() bool {
+	return p != nil && (len(p.Subjects) > 0 || len(p.SANs) > 0)
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedCertificate tells whether the client certificate cert matches one
+// of the allowed subjects or one of the allowed SANs. The certificate chain
+// itself is verified by crypto/tls, according to the client auth type.
+func (p *Policy) AllowedCertificate(cert *x509.Certificate) bool {
+	if !p.ChecksCertificates() {
+		return true
+	}
+	if cert == nil {
+		return false
+	}
+	if matchAny(p.Subjects, cert.Subject.String()) || matchAny(p.Subjects, cert.Subject.CommonName) {
+		return true
+	}
+	if len(p.SANs) == 0 {
+		return false
+	}
+	for _, name := range cert.DNSNames {
+		if matchAny(p.SANs, name) {
+			return true
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if matchAny(p.SANs, email) {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if matchAny(p.SANs, ip.String()) {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if matchAny(p.SANs, uri.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Limited tells whether the policy has rate limits.
+func (p *Policy) Limited() bool {
+	return p != nil && (p.messages != nil || p.bytes != nil)
+}
+
+// Admit accounts for nb messages of size bytes sent by client. With the
+// Slow action, the messages are always admitted, and Admit returns how long
+// the caller should wait before reading more from the client. With the
+// other actions, Admit tells whether the messages are under the limits.
+func (p *Policy) Admit(client string, nb int, size int) (wait time.Duration, ok bool) {
+	if !p.Limited() {
+		return 0, true
+	}
+	now := time.Now()
+	reserve := p.Action == Slow
+	if !reserve {
+		// check both buckets first, so that a message refused by one
+		// bucket does not consume the tokens of the other
+		if p.messages != nil && !p.messages.available(client, float64(nb), now) {
+			return 0, false
+		}
+		if p.bytes != nil && !p.bytes.available(client, float64(size), now) {
+			return 0, false
+		}
+	}
+	ok = true
+	if p.messages != nil {
+		w, admitted := p.messages.take(client, float64(nb), now, reserve)
+		wait, ok = w, admitted
+	}
+	if ok && p.bytes != nil {
+		w, admitted := p.bytes.take(client, float64(size), now, reserve)
+		if w > wait {
+			wait = w
+		}
+		ok = admitted
+	}
+	return wait, ok
+}
@@ -0,0 +1,99 @@
+package acl
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowedIP(t *testing.T) {
+	allow, err := ParseNetworks([]string{"10.0.0.0/8", "2001:db8::/32"})
+	assert.NoError(t, err)
+	deny, err := ParseNetworks([]string{"10.1.2.3"})
+	assert.NoError(t, err)
+	p, err := NewPolicy(allow, deny, nil, nil, 0, 0, Drop)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"10.0.0.1", true},
+		{"10.1.2.3", false},
+		{"192.168.1.1", false},
+		{"2001:db8::1", true},
+		{"::1", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, p.AllowedIP(net.ParseIP(tt.ip)), tt.ip)
+	}
+	assert.True(t, p.AllowedAddr(&net.UnixAddr{Name: "/tmp/sock", Net: "unix"}))
+
+	_, err = ParseNetworks([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
+
+func TestAllowedCertificate(t *testing.T) {
+	p, err := NewPolicy(nil, nil, []string{"CN=client-*,O=Example"}, []string{"*.logs.example.com"}, 0, 0, Drop)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		allowed bool
+	}{
+		{"no certificate", nil, false},
+		{"subject", &x509.Certificate{Subject: pkix.Name{CommonName: "client-1", Organization: []string{"Example"}}}, true},
+		{"dns san", &x509.Certificate{Subject: pkix.Name{CommonName: "other"}, DNSNames: []string{"web.logs.example.com"}}, true},
+		{"no match", &x509.Certificate{Subject: pkix.Name{CommonName: "other"}, DNSNames: []string{"example.com"}}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, p.AllowedCertificate(tt.cert), tt.name)
+	}
+
+	_, err = NewPolicy(nil, nil, []string{"[a-"}, nil, 0, 0, Drop)
+	assert.Error(t, err)
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(10)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		_, ok := l.take("a", 1, now, false)
+		assert.True(t, ok)
+	}
+	_, ok := l.take("a", 1, now, false)
+	assert.False(t, ok)
+	// other clients have their own bucket
+	_, ok = l.take("b", 1, now, false)
+	assert.True(t, ok)
+	// 100ms later, one more token is available
+	_, ok = l.take("a", 1, now.Add(100*time.Millisecond), false)
+	assert.True(t, ok)
+
+	wait, ok := l.take("c", 15, now, true)
+	assert.True(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+}
+
+func TestAdmit(t *testing.T) {
+	p, err := NewPolicy(nil, nil, nil, nil, 10, 100, Drop)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, ok := p.Admit("a", 1, 90)
+	assert.True(t, ok)
+	// refused by the bytes bucket: no message token is consumed
+	for i := 0; i < 20; i++ {
+		_, ok = p.Admit("a", 1, 50)
+		assert.False(t, ok)
+	}
+	_, ok = p.Admit("a", 9, 10)
+	assert.True(t, ok)
+	_, ok = p.Admit("a", 1, 0)
+	assert.False(t, ok)
+}
@@ -0,0 +1,107 @@
+package acl
+
+import (
+	"sync"
+	"time"
+)
+
+// idle buckets are forgotten after a while, so that the memory does not
+// grow with the number of clients ever seen.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a set of token buckets, one per client. The buckets refill at
+// rate tokens per second, and hold at most one second worth of tokens.
+type Limiter struct {
+	rate      float64
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter returns a Limiter with the given rate per second.
+func NewLimiter(rate float64) *Limiter {
+	return &Limiter{
+		rate:      rate,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens += elapsed * l.rate
+		if b.tokens > l.rate {
+			b.tokens = l.rate
+		}
+		b.last = now
+	}
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.rate {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// take removes n tokens from the bucket of client.
+//
+// When reserve is true, the tokens are always taken, possibly leaving the
+// bucket in debt, and take returns the time after which the debt is paid.
+//
+// Otherwise the tokens are taken only if they are available. A full bucket
+// always admits the request, so that a message larger than one second worth
+// of tokens is not refused forever.
+func (l *Limiter) take(client string, n float64, now time.Time, reserve bool) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(client, now)
+	if reserve {
+		b.tokens -= n
+		if b.tokens >= 0 {
+			return 0, true
+		}
+		return time.Duration(-b.tokens / l.rate * float64(time.Second)), true
+	}
+	if l.admits(b, n) {
+		b.tokens -= n
+		return 0, true
+	}
+	return 0, false
+}
+
+// available tells whether take would admit n tokens for client, without
+// taking them.
+func (l *Limiter) available(client string, n float64, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.admits(l.bucket(client, now), n)
+}
+
+func (l *Limiter) admits(b *bucket, n float64) bool {
+	return b.tokens >= n || b.tokens >= l.rate
+}
+
+// bucket returns the refilled bucket of client. l.mu must be held.
+func (l *Limiter) bucket(client string, now time.Time) *bucket {
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[client]
+	if ok {
+		l.refill(b, now)
+	} else {
+		b = &bucket{tokens: l.rate, last: now}
+		l.buckets[client] = b
+	}
+	return b
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"crypto/tls"
+
+	"github.com/pion/dtls/v2"
+)
+
+// NewDTLSConfig converts a TLS config, as returned by NewTLSConfig, to the
+// equivalent DTLS config (RFC 6012).
+func NewDTLSConfig(c *tls.Config, server bool) *dtls.Config {
+	dc := &dtls.Config{
+		Certificates:          c.Certificates,
+		RootCAs:               c.RootCAs,
+		ClientCAs:             c.ClientCAs,
+		ClientAuth:            dtls.ClientAuthType(c.ClientAuth),
+		InsecureSkipVerify:    c.InsecureSkipVerify,
+		VerifyPeerCertificate: c.VerifyPeerCertificate,
+		ServerName:            c.ServerName,
+		ExtendedMasterSecret:  dtls.RequestExtendedMasterSecret,
+	}
+	if server && dc.ClientCAs == nil {
+		// the clients certificates are verified with the configured CA
+		dc.ClientCAs = c.RootCAs
+	}
+	return dc
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	// register the hash functions used by the fingerprints
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+var fingerprintHashes = map[string]crypto.Hash{
+	"SHA1":   crypto.SHA1,
+	"SHA224": crypto.SHA224,
+	"SHA256": crypto.SHA256,
+	"SHA384": crypto.SHA384,
+	"SHA512": crypto.SHA512,
+}
+
+// Fingerprint is the fingerprint of a certificate, as defined in RFC 5425
+// section 4.2.2.
+type Fingerprint struct {
+	Hash crypto.Hash
+	Sum  []byte
+}
+
+// ParseFingerprint parses a fingerprint written as the name of the hash
+// function, followed by the hexadecimal bytes of the hash, separated by
+// colons. This is the format used by rsyslog: "SHA1:10:C4:26:...".
+func ParseFingerprint(s string) (f Fingerprint, err error) {
+	s = strings.TrimSpace(s)
+	idx := strings.Index(s, ":")
+	if idx == -1 {
+		return f, eerrors.Errorf("Invalid fingerprint: '%s'", s)
+	}
+	name := strings.ToUpper(strings.Replace(s[:idx], "-", "", -1))
+	h, ok := fingerprintHashes[name]
+	if !ok {
+		return f, eerrors.Errorf("Unknown fingerprint hash function: '%s'", s[:idx])
+	}
+	sum, err := hex.DecodeString(strings.Replace(s[idx+1:], ":", "", -1))
+	if err != nil {
+		return f, eerrors.Wrapf(err, "Invalid fingerprint: '%s'", s)
+	}
+	if len(sum) != h.Size() {
+		return f, eerrors.Errorf("Invalid fingerprint length: '%s'", s)
+	}
+	return Fingerprint{Hash: h, Sum: sum}, nil
+}
+
+// ParseFingerprints parses a list of fingerprints.
+func ParseFingerprints(specs []string) ([]Fingerprint, error) {
+	fps := make([]Fingerprint, 0, len(specs))
+	for _, spec := range specs {
+		f, err := ParseFingerprint(spec)
+		if err != nil {
+			return nil, err
+		}
+		fps = append(fps, f)
+	}
+	return fps, nil
+}
+
+// Match tells whether the DER encoded certificate has fingerprint f.
+func (f Fingerprint) Match(der []byte) bool {
+	h := f.Hash.New()
+	_, _ = h.Write(der)
+	return bytes.Equal(h.Sum(nil), f.Sum)
+}
+
+func (f Fingerprint) String() string {
+	name := "SHA"
+	for n, h := range fingerprintHashes {
+		if h == f.Hash {
+			name = n
+		}
+	}
+	hexa := strings.ToUpper(hex.EncodeToString(f.Sum))
+	parts := make([]string, 0, len(f.Sum)+1)
+	parts = append(parts, name)
+	for i := 0; i < len(hexa); i += 2 {
+		parts = append(parts, hexa[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+// SetFingerprints configures c so that the peer is authenticated by the
+// fingerprint of its certificate, as in RFC 5425 section 5.2: the peer
+// certificate may be self-signed, the certificate chain is not validated,
+// but the certificate must match one of the fingerprints. When server is
+// true, the clients have to present a certificate.
+func SetFingerprints(c *tls.Config, specs []string, server bool) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	fps, err := ParseFingerprints(specs)
+	if err != nil {
+		return err
+	}
+	if server {
+		c.ClientAuth = tls.RequireAnyClientCert
+	} else {
+		c.InsecureSkipVerify = true
+	}
+	c.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return eerrors.New("The peer did not present a certificate")
+		}
+		for _, f := range fps {
+			if f.Match(rawCerts[0]) {
+				return nil
+			}
+		}
+		return eerrors.Errorf("The peer certificate fingerprint is not allowed: '%s'", Fingerprint{Hash: crypto.SHA1, Sum: sha1Sum(rawCerts[0])})
+	}
+	return nil
+}
+
+func sha1Sum(der []byte) []byte {
+	h := crypto.SHA1.New()
+	_, _ = h.Write(der)
+	return h.Sum(nil)
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseFingerprint(t *testing.T) {
+	der := []byte("certificate")
+	tests := []struct {
+		name  string
+		spec  string
+		valid bool
+		match bool
+	}{
+		{"sha1", "SHA1:73:5A:D5:71:C1:89:D7:BA:84:46:4B:F4:A9:F1:D2:28:01:75:B1:28", true, true},
+		{"lowercase", "sha-1:73:5a:d5:71:c1:89:d7:ba:84:46:4b:f4:a9:f1:d2:28:01:75:b1:28", true, true},
+		{"other certificate", "SHA1:10:C4:26:1D:CB:3C:AF:B7:45:6A:25:E0:4E:38:CA:5C:5C:30:61:FD", true, false},
+		{"unknown hash", "MD5:73:5A:D5:71", false, false},
+		{"wrong length", "SHA256:73:5A:D5:71", false, false},
+		{"no hash", "735AD571", false, false},
+	}
+	for _, tt := range tests {
+		f, err := ParseFingerprint(tt.spec)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !tt.valid {
+			continue
+		}
+		if f.Match(der) != tt.match {
+			t.Errorf("%s: Match() = %v, expected %v", tt.name, !tt.match, tt.match)
+		}
+	}
+
+	f := Fingerprint{Hash: crypto.SHA1, Sum: sha1Sum(der)}
+	if f.String() != "SHA1:73:5A:D5:71:C1:89:D7:BA:84:46:4B:F4:A9:F1:D2:28:01:75:B1:28" {
+		t.Errorf("String() = %s", f.String())
+	}
+}
+
+func selfSigned(t *testing.T, name string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// handshake runs a TLS handshake between client and server, and returns
+// the client and server errors.
+func handshake(t *testing.T, client, server *tls.Config) (error, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		serverErr <- tls.Server(conn, server).Handshake()
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	clientErr := tls.Client(conn, client).Handshake()
+	return clientErr, <-serverErr
+}
+
+func TestSetFingerprints(t *testing.T) {
+	serverCert := selfSigned(t, "server")
+	clientCert := selfSigned(t, "client")
+	fp := func(cert tls.Certificate) string {
+		return Fingerprint{Hash: crypto.SHA1, Sum: sha1Sum(cert.Certificate[0])}.String()
+	}
+	other := "SHA1:10:C4:26:1D:CB:3C:AF:B7:45:6A:25:E0:4E:38:CA:5C:5C:30:61:FD"
+
+	// client side: the self-signed server certificate is accepted when its
+	// fingerprint is known
+	for _, tt := range []struct {
+		name  string
+		specs []string
+		ok    bool
+	}{
+		{"known", []string{other, fp(serverCert)}, true},
+		{"unknown", []string{other}, false},
+	} {
+		client := &tls.Config{ServerName: "server"}
+		if err := SetFingerprints(client, tt.specs, false); err != nil {
+			t.Fatal(err)
+		}
+		clientErr, _ := handshake(t, client, &tls.Config{Certificates: []tls.Certificate{serverCert}})
+		if (clientErr == nil) != tt.ok {
+			t.Errorf("client %s: unexpected handshake result: %v", tt.name, clientErr)
+		}
+	}
+
+	// server side: the client must present a certificate with a known
+	// fingerprint
+	server := &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	if err := SetFingerprints(server, []string{fp(clientCert)}, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name  string
+		certs []tls.Certificate
+		ok    bool
+	}{
+		{"known", []tls.Certificate{clientCert}, true},
+		{"unknown", []tls.Certificate{serverCert}, false},
+		{"no certificate", nil, false},
+	} {
+		client := &tls.Config{InsecureSkipVerify: true, Certificates: tt.certs}
+		_, serverErr := handshake(t, client, server)
+		if (serverErr == nil) != tt.ok {
+			t.Errorf("server %s: unexpected handshake result: %v", tt.name, serverErr)
+		}
+	}
+
+	if err := SetFingerprints(&tls.Config{}, []string{"MD5:00"}, false); err == nil {
+		t.Error("invalid fingerprint accepted")
+	}
+	c := &tls.Config{}
+	if err := SetFingerprints(c, nil, false); err != nil || c.InsecureSkipVerify || c.VerifyPeerCertificate != nil {
+		t.Error("tls config modified without fingerprints")
+	}
+}
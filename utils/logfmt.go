@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+func isLogfmtSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// ParseLogfmt calls f for each key/value pair found in m. pairSep separates
+// the pairs (default: whitespace), kvSep separates the key from the value.
+// Bare keys get the value "true".
+func ParseLogfmt(m []byte, pairSep, kvSep string, f func(key, value string)) error {
+	pSep := []byte(pairSep)
+	kSep := []byte(kvSep)
+	atPairSep := func(i int) int {
+		if len(pSep) == 0 {
+			if isLogfmtSpace(m[i]) {
+				return 1
+			}
+			return 0
+		}
+		if bytes.HasPrefix(m[i:], pSep) {
+			return len(pSep)
+		}
+		return 0
+	}
+
+	i := 0
+	for i < len(m) {
+		// skip separators and blanks before the key
+		if n := atPairSep(i); n > 0 {
+			i += n
+			continue
+		}
+		if isLogfmtSpace(m[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(m) && atPairSep(i) == 0 && !bytes.HasPrefix(m[i:], kSep) {
+			i++
+		}
+		key := string(bytes.TrimSpace(m[start:i]))
+		if len(key) == 0 {
+			return eerrors.Errorf("Empty key at position %d", start)
+		}
+		if i == len(m) || !bytes.HasPrefix(m[i:], kSep) {
+			// bare key
+			f(key, "true")
+			continue
+		}
+		i += len(kSep)
+		if i < len(m) && m[i] == '"' {
+			end := i + 1
+			for end < len(m) && m[end] != '"' {
+				if m[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(m) {
+				return eerrors.Errorf("Unterminated quoted value for key '%s'", key)
+			}
+			value, err := strconv.Unquote(string(m[i : end+1]))
+			if err != nil {
+				// not a valid golang string, keep the raw content
+				value = string(m[i+1 : end])
+			}
+			f(key, value)
+			i = end + 1
+			continue
+		}
+		start = i
+		for i < len(m) && atPairSep(i) == 0 {
+			i++
+		}
+		f(key, string(bytes.TrimSpace(m[start:i])))
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+// Package proxyproto implements the server side of the PROXY protocol (v1
+// and v2), as sent by HAProxy or by the AWS network load balancers.
+//
+// http://www.haproxy.org/download/1.8/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stephane-martin/skewer/utils/eerrors"
+)
+
+var v1Prefix = []byte("PROXY ")
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1 headers are at most 107 bytes long
+const v1MaxLength = 107
+
+// Header holds the addresses carried by a PROXY header. When the proxy sends
+// a LOCAL (v2) or UNKNOWN (v1) header, Source and Destination are nil.
+type Header struct {
+	Version     int
+	Source      net.Addr
+	Destination net.Addr
+}
+
+// ReadHeader reads a PROXY header from r.
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	start, err := r.Peek(len(v1Prefix))
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Error reading PROXY header")
+	}
+	if bytes.Equal(start, v1Prefix) {
+		return readV1(r)
+	}
+	start, err = r.Peek(len(v2Signature))
+	if err == nil && bytes.Equal(start, v2Signature) {
+		return readV2(r)
+	}
+	return nil, eerrors.New("Missing PROXY header")
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, eerrors.Wrap(err, "Error reading PROXY v1 header")
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, eerrors.New("PROXY v1 header is too long")
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	h := &Header{Version: 1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return h, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, eerrors.Errorf("Invalid PROXY v1 header: '%s'", strings.TrimSpace(string(line)))
+	}
+	src := net.ParseIP(fields[2])
+	dst := net.ParseIP(fields[3])
+	srcPort, err1 := parsePort(fields[4])
+	dstPort, err2 := parsePort(fields[5])
+	if src == nil || dst == nil || err1 != nil || err2 != nil {
+		return nil, eerrors.Errorf("Invalid PROXY v1 header: '%s'", strings.TrimSpace(string(line)))
+	}
+	h.Source = &net.TCPAddr{IP: src, Port: srcPort}
+	h.Destination = &net.TCPAddr{IP: dst, Port: dstPort}
+	return h, nil
+}
+
+func parsePort(s string) (int, error) {
+	p, err := strconv.ParseUint(s, 10, 16)
+	return int(p), err
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	var fixed [16]byte
+	_, err := io.ReadFull(r, fixed[:])
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Error reading PROXY v2 header")
+	}
+	if fixed[12]>>4 != 2 {
+		return nil, eerrors.Errorf("Unsupported PROXY protocol version: %d", fixed[12]>>4)
+	}
+	command := fixed[12] & 0x0f
+	family := fixed[13]
+	length := int(binary.BigEndian.Uint16(fixed[14:16]))
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, eerrors.Wrap(err, "Error reading PROXY v2 addresses")
+	}
+	h := &Header{Version: 2}
+	switch command {
+	case 0:
+		// LOCAL: health check from the proxy itself
+		return h, nil
+	case 1:
+	default:
+		return nil, eerrors.Errorf("Unknown PROXY v2 command: %d", command)
+	}
+	switch family >> 4 {
+	case 1:
+		if length < 12 {
+			return nil, eerrors.New("PROXY v2 header is too short for IPv4 addresses")
+		}
+		h.Source = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+	case 2:
+		if length < 36 {
+			return nil, eerrors.New("PROXY v2 header is too short for IPv6 addresses")
+		}
+		h.Source = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+	default:
+		// AF_UNSPEC or AF_UNIX: keep the connection addresses
+	}
+	return h, nil
+}
+
+// Conn is a net.Conn that reads the PROXY header before any other data. The
+// header is read lazily, on the first call to Read or RemoteAddr, so that
+// Accept does not block on slow clients. LocalAddr still returns the local
+// address of the connection.
+type Conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	once    sync.Once
+	header  *Header
+	err     error
+}
+
+// NewConn wraps conn. timeout limits the time to receive the PROXY header.
+func NewConn(conn net.Conn, timeout time.Duration) *Conn {
+	return &Conn{
+		Conn:    conn,
+		reader:  bufio.NewReader(conn),
+		timeout: timeout,
+	}
+}
+
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		if c.timeout > 0 {
+			_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		}
+		c.header, c.err = ReadHeader(c.reader)
+		if c.timeout > 0 {
+			_ = c.Conn.SetReadDeadline(time.Time{})
+		}
+		if c.err != nil {
+			// nothing good can come from this connection
+			_ = c.Conn.Close()
+		}
+	})
+}
+
+// Header returns the PROXY header received on the connection.
+func (c *Conn) Header() (*Header, error) {
+	c.readHeader()
+	return c.header, c.err
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the address of the client, as given by the proxy.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// ProxyAddr returns the address of the proxy.
+func (c *Conn) ProxyAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
+
+type listener struct {
+	net.Listener
+	timeout time.Duration
+}
+
+// NewListener returns a listener whose connections expect a PROXY header.
+func NewListener(l net.Listener, timeout time.Duration) net.Listener {
+	return &listener{Listener: l, timeout: timeout}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn, l.timeout), nil
+}
@@ -0,0 +1,140 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadHeader(t *testing.T) {
+	v2 := append([]byte(nil), v2Signature...)
+	v2 = append(v2, 0x21, 0x11, 0, 12, 192, 168, 0, 1, 10, 0, 0, 1, 0x30, 0x39, 0x02, 0x02)
+	v2Local := append([]byte(nil), v2Signature...)
+	v2Local = append(v2Local, 0x20, 0x00, 0, 0)
+
+	tests := []struct {
+		name   string
+		header []byte
+		source string
+		err    bool
+	}{
+		{name: "v1 tcp4", header: []byte("PROXY TCP4 192.168.0.1 10.0.0.1 12345 514\r\n"), source: "192.168.0.1:12345"},
+		{name: "v1 tcp6", header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 12345 514\r\n"), source: "[2001:db8::1]:12345"},
+		{name: "v1 unknown", header: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v2 tcp4", header: v2, source: "192.168.0.1:12345"},
+		{name: "v2 local", header: v2Local},
+		{name: "v1 invalid", header: []byte("PROXY TCP4 nope 10.0.0.1 12345 514\r\n"), err: true},
+		{name: "missing", header: []byte("<13>1 - - - - - - hello\n"), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(bytes.NewReader(append(tt.header, "payload"...)))
+			h, err := ReadHeader(r)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			if len(tt.source) > 0 {
+				assert.Equal(t, tt.source, h.Source.String())
+			} else {
+				assert.Nil(t, h.Source)
+			}
+			rest, _ := ioutil.ReadAll(r)
+			assert.Equal(t, "payload", string(rest))
+		})
+	}
+}
+
+func TestConn(t *testing.T) {
+	t.Run("header", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() {
+			_, _ = client.Write([]byte("PROXY TCP4 192.168.0.1 10.0.0.1 12345 514\r\npayload"))
+		}()
+		c := NewConn(server, time.Second)
+		defer c.Close()
+		assert.Equal(t, "192.168.0.1:12345", c.RemoteAddr().String())
+		assert.Equal(t, server.RemoteAddr(), c.ProxyAddr())
+		buf := make([]byte, 7)
+		_, err := io.ReadFull(c, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "payload", string(buf))
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() {
+			_, _ = client.Write([]byte("<13>1 - - - - - - hello\n"))
+		}()
+		c := NewConn(server, time.Second)
+		_, err := c.Read(make([]byte, 16))
+		assert.Error(t, err)
+		_, err = c.Header()
+		assert.Error(t, err)
+		// the connection is not usable anymore
+		_, err = server.Read(make([]byte, 1))
+		assert.Error(t, err)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		c := NewConn(server, 50*time.Millisecond)
+		start := time.Now()
+		_, err := c.Header()
+		assert.Error(t, err)
+		assert.True(t, time.Since(start) < time.Second)
+		assert.Equal(t, server.RemoteAddr(), c.RemoteAddr())
+	})
+}
+
+func TestNewListener(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	l := NewListener(tcpListener, time.Second)
+	defer l.Close()
+
+	go func() {
+		client, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		_, _ = client.Write([]byte("PROXY TCP6 2001:db8::1 2001:db8::2 12345 514\r\nhello\n"))
+		_, _ = ioutil.ReadAll(client)
+	}()
+
+	conn, err := l.Accept()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	pconn, ok := conn.(*Conn)
+	if !assert.True(t, ok) {
+		return
+	}
+	// the header is read lazily, after Accept returned
+	h, err := pconn.Header()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "[2001:db8::1]:12345", h.Source.String())
+	assert.Equal(t, "[2001:db8::1]:12345", conn.RemoteAddr().String())
+	assert.Equal(t, "127.0.0.1", pconn.ProxyAddr().(*net.TCPAddr).IP.String())
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", line)
+}